@@ -5,6 +5,50 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAccessExpireMinutes = 15
+	defaultResetExpireMinutes  = 60
+	defaultMFAExpireMinutes    = 5
+	defaultTOTPIssuer          = "Acquaintance"
+
+	defaultBaseDelaySeconds   = 1
+	defaultMaxDelaySeconds    = 300
+	defaultLockoutMinutes     = 15
+	defaultAuditRetentionDays = 90
+	defaultTrustedProxies     = 1
+
+	defaultLoginFreeAttempts    = 3
+	defaultLoginLockoutAttempts = 10
+	defaultIPFreeAttempts       = 20
+	defaultIPLockoutAttempts    = 100
+
+	defaultEventRetentionDays = 7
+	defaultPingSeconds        = 30
+
+	defaultNotifyChannel       = "request_events"
+	defaultMinReconnectSeconds = 10
+	defaultMaxReconnectSeconds = 60
+
+	defaultPushWorkers         = 4
+	defaultPushQueueSize       = 1000
+	defaultPushMaxAttempts     = 5
+	defaultPushBaseDelayMillis = 500
+	defaultPushMaxDelaySeconds = 30
+
+	defaultWebhookPollSeconds      = 5
+	defaultWebhookBatchSize        = 20
+	defaultWebhookTimeoutSeconds   = 10
+	defaultWebhookMaxAttempts      = 8
+	defaultWebhookBaseDelaySeconds = 30
+	defaultWebhookMaxDelayMinutes  = 60
+	defaultWebhookRetentionDays    = 7
+
+	defaultMaxPhotoKB   = 5 * 1024
+	defaultLocalBaseURL = "/media"
 )
 
 func ReadConf(r io.Reader) (Conf, error) {
@@ -15,16 +59,69 @@ func ReadConf(r io.Reader) (Conf, error) {
 }
 
 type Conf struct {
-	PortEnvVar  string      `json:"port_env_var"`
-	DefaultPort int         `json:"default_port"`
-	Auth        AuthConfig  `json:"auth"`
-	DB          DBConfig    `json:"db"`
-	Logic       LogicConfig `json:"logic"`
+	PortEnvVar  string        `json:"port_env_var"`
+	DefaultPort int           `json:"default_port"`
+	Auth        AuthConfig    `json:"auth"`
+	DB          DBConfig      `json:"db"`
+	Logic       LogicConfig   `json:"logic"`
+	Mail        MailConfig    `json:"mail"`
+	Storage     StorageConfig `json:"storage"`
+	Notify      NotifyConfig  `json:"notify"`
+	Push        PushConfig    `json:"push"`
+	Webhook     WebhookConfig `json:"webhook"`
 }
 
 type AuthConfig struct {
-	TokenKey   string `json:"token_key"`
-	ExpireDays int    `json:"expire_days"`
+	TokenKey            string             `json:"token_key"`
+	ExpireDays          int                `json:"expire_days"`
+	AccessExpireMinutes int                `json:"access_expire_minutes"`
+	PasswordHash        PasswordHashConfig `json:"password_hash"`
+	Signing             SigningConfig      `json:"signing"`
+	ResetExpireMinutes  int                `json:"reset_expire_minutes"`
+	Throttle            ThrottleConfig     `json:"throttle"`
+	TOTPIssuer          string             `json:"totp_issuer"`
+	MFAExpireMinutes    int                `json:"mfa_expire_minutes"`
+}
+
+type PasswordHashConfig struct {
+	Algorithm     string `json:"algorithm"`
+	BcryptCost    int    `json:"bcrypt_cost"`
+	Argon2Time    uint32 `json:"argon2_time"`
+	Argon2Memory  uint32 `json:"argon2_memory"`
+	Argon2Threads uint8  `json:"argon2_threads"`
+}
+
+// SigningConfig describes asymmetric keys used to sign access tokens.
+// If KeysDir is empty, tokens are signed with HS256 and TokenKey.
+type SigningConfig struct {
+	KeysDir      string `json:"keys_dir"`
+	ActiveKeyId  string `json:"active_key_id"`
+	GraceMinutes int    `json:"grace_minutes"`
+}
+
+// ThrottleConfig describes protection of sign in against password guessing.
+// Failed attempts are counted per login and per client IP in Store ("memory"
+// or "postgres"). After FreeAttempts failures every next attempt must wait
+// twice longer than the previous one, starting from BaseDelaySeconds and up to
+// MaxDelaySeconds; after LockoutAttempts failures the key is locked for
+// LockoutMinutes. Counters are forgotten LockoutMinutes after the last failure.
+// If TrustForwardedFor is set, the server runs behind TrustedProxies proxies,
+// each of them appending the address of its peer to X-Forwarded-For.
+type ThrottleConfig struct {
+	Store              string         `json:"store"`
+	TrustForwardedFor  bool           `json:"trust_forwarded_for"`
+	TrustedProxies     int            `json:"trusted_proxies"`
+	BaseDelaySeconds   int            `json:"base_delay_seconds"`
+	MaxDelaySeconds    int            `json:"max_delay_seconds"`
+	LockoutMinutes     int            `json:"lockout_minutes"`
+	AuditRetentionDays int            `json:"audit_retention_days"`
+	Login              ThrottlePolicy `json:"login"`
+	IP                 ThrottlePolicy `json:"ip"`
+}
+
+type ThrottlePolicy struct {
+	FreeAttempts    int `json:"free_attempts"`
+	LockoutAttempts int `json:"lockout_attempts"`
 }
 
 type DBConfig struct {
@@ -37,18 +134,259 @@ type DBConfig struct {
 	AuthStringTemplate string `json:"auth_string_template"`
 }
 
+// MailConfig chooses how emails are sent: "smtp" sends them via SMTPHost,
+// "file" dumps them into DumpDir, "memory" keeps them in memory.
+type MailConfig struct {
+	Sender       string `json:"sender"`
+	From         string `json:"from"`
+	SMTPHost     string `json:"smtp_host"`
+	SMTPPort     int    `json:"smtp_port"`
+	SMTPUser     string `json:"smtp_user"`
+	SMTPPassword string `json:"smtp_password"`
+	DumpDir      string `json:"dump_dir"`
+}
+
+// StorageConfig chooses where user photos are kept: "local" writes them into
+// Dir, "s3" uploads them into Bucket of an S3-compatible service at Endpoint,
+// "memory" keeps them in memory. Photos are linked as BaseURL + "/" + key;
+// for "s3" BaseURL defaults to Endpoint + "/" + Bucket.
+type StorageConfig struct {
+	Backend    string `json:"backend"`
+	Dir        string `json:"dir"`
+	BaseURL    string `json:"base_url"`
+	Endpoint   string `json:"endpoint"`
+	Region     string `json:"region"`
+	Bucket     string `json:"bucket"`
+	AccessKey  string `json:"access_key"`
+	SecretKey  string `json:"secret_key"`
+	MaxPhotoKB int    `json:"max_photo_kb"`
+}
+
+// NotifyConfig chooses how wake ups of users waiting for events reach other
+// instances of the app: "postgres" sends them with NOTIFY on Channel, "local"
+// keeps them within the process, which is enough for a single instance.
+type NotifyConfig struct {
+	Backend             string `json:"backend"`
+	Channel             string `json:"channel"`
+	MinReconnectSeconds int    `json:"min_reconnect_seconds"`
+	MaxReconnectSeconds int    `json:"max_reconnect_seconds"`
+}
+
+// PushConfig describes push notifications about meet requests. Backend "remote"
+// sends them with Workers goroutines through FCM and APNs, each of which is
+// used only if configured; "memory" keeps them in memory. A failed delivery is
+// attempted up to MaxAttempts times, waiting twice longer after each failure,
+// starting from BaseDelayMillis and up to MaxDelaySeconds.
+type PushConfig struct {
+	Backend         string     `json:"backend"`
+	Workers         int        `json:"workers"`
+	QueueSize       int        `json:"queue_size"`
+	MaxAttempts     int        `json:"max_attempts"`
+	BaseDelayMillis int        `json:"base_delay_millis"`
+	MaxDelaySeconds int        `json:"max_delay_seconds"`
+	FCM             FCMConfig  `json:"fcm"`
+	APNs            APNsConfig `json:"apns"`
+}
+
+// FCMConfig points to the service account JSON key of a Firebase project.
+// Endpoint and TokenURL override Google's addresses, e.g. to use a stand-in.
+type FCMConfig struct {
+	ProjectId       string `json:"project_id"`
+	CredentialsFile string `json:"credentials_file"`
+	Endpoint        string `json:"endpoint"`
+	TokenURL        string `json:"token_url"`
+}
+
+// APNsConfig describes token based authentication with APNs: KeyFile is the
+// .p8 signing key with KeyId issued to TeamId. Topic is the bundle id of the app.
+type APNsConfig struct {
+	KeyFile  string `json:"key_file"`
+	KeyId    string `json:"key_id"`
+	TeamId   string `json:"team_id"`
+	Topic    string `json:"topic"`
+	Sandbox  bool   `json:"sandbox"`
+	Endpoint string `json:"endpoint"`
+}
+
+// WebhookConfig describes delivery of webhooks. Due deliveries are checked
+// every PollSeconds and sent in batches of BatchSize, each waiting for
+// TimeoutSeconds at most. A failed delivery is attempted up to MaxAttempts
+// times, waiting twice longer after each failure, starting from BaseDelaySeconds
+// and up to MaxDelayMinutes, and then is dead until an admin replays it.
+// Successful deliveries are kept for RetentionDays.
+type WebhookConfig struct {
+	PollSeconds      int `json:"poll_seconds"`
+	BatchSize        int `json:"batch_size"`
+	TimeoutSeconds   int `json:"timeout_seconds"`
+	MaxAttempts      int `json:"max_attempts"`
+	BaseDelaySeconds int `json:"base_delay_seconds"`
+	MaxDelayMinutes  int `json:"max_delay_minutes"`
+	RetentionDays    int `json:"retention_days"`
+}
+
 type LogicConfig struct {
-	Distance          float64 `json:"distance"`
-	OnlineTimeout     int     `json:"online_timeout"`
-	RequestExpiration int     `json:"request_expiration"`
-	CleanupInterval   int     `json:"cleanup_interval"`
-	PollSeconds       int     `json:"poll_seconds"`
+	Distance           float64 `json:"distance"` // metres on the WGS 84 spheroid
+	OnlineTimeout      int     `json:"online_timeout"`
+	RequestExpiration  int     `json:"request_expiration"`
+	CleanupInterval    int     `json:"cleanup_interval"`
+	PollSeconds        int     `json:"poll_seconds"`
+	EventRetentionDays int     `json:"event_retention_days"`
+	PingSeconds        int     `json:"ping_seconds"`
 }
 
 func (conf AuthConfig) GetTokenKey() []byte {
 	return []byte(conf.TokenKey) // TODO use secure service instead of bicycles
 }
 
+func (conf AuthConfig) GetAccessTokenLifetime() time.Duration {
+	if conf.AccessExpireMinutes <= 0 {
+		return time.Minute * defaultAccessExpireMinutes
+	}
+	return time.Minute * time.Duration(conf.AccessExpireMinutes)
+}
+
+func (conf AuthConfig) GetResetTokenLifetime() time.Duration {
+	if conf.ResetExpireMinutes <= 0 {
+		return time.Minute * defaultResetExpireMinutes
+	}
+	return time.Minute * time.Duration(conf.ResetExpireMinutes)
+}
+
+// GetMFATokenLifetime returns how long the user has to enter
+// the second factor after the password has been accepted.
+func (conf AuthConfig) GetMFATokenLifetime() time.Duration {
+	if conf.MFAExpireMinutes <= 0 {
+		return time.Minute * defaultMFAExpireMinutes
+	}
+	return time.Minute * time.Duration(conf.MFAExpireMinutes)
+}
+
+func (conf AuthConfig) GetTOTPIssuer() string {
+	if conf.TOTPIssuer == "" {
+		return defaultTOTPIssuer
+	}
+	return conf.TOTPIssuer
+}
+
+func (conf AuthConfig) GetSessionLifetime() time.Duration {
+	return time.Hour * 24 * time.Duration(conf.ExpireDays)
+}
+
+// GetGracePeriod returns how long retired keys still verify tokens.
+// By default it equals the access token lifetime, so that tokens signed
+// before the rotation stay valid until they expire.
+func (conf AuthConfig) GetGracePeriod() time.Duration {
+	if conf.Signing.GraceMinutes <= 0 {
+		return conf.GetAccessTokenLifetime()
+	}
+	return time.Minute * time.Duration(conf.Signing.GraceMinutes)
+}
+
+func (conf ThrottleConfig) GetBaseDelay() time.Duration {
+	if conf.BaseDelaySeconds <= 0 {
+		return time.Second * defaultBaseDelaySeconds
+	}
+	return time.Second * time.Duration(conf.BaseDelaySeconds)
+}
+
+func (conf ThrottleConfig) GetMaxDelay() time.Duration {
+	if conf.MaxDelaySeconds <= 0 {
+		return time.Second * defaultMaxDelaySeconds
+	}
+	return time.Second * time.Duration(conf.MaxDelaySeconds)
+}
+
+func (conf ThrottleConfig) GetLockoutPeriod() time.Duration {
+	if conf.LockoutMinutes <= 0 {
+		return time.Minute * defaultLockoutMinutes
+	}
+	return time.Minute * time.Duration(conf.LockoutMinutes)
+}
+
+func (conf ThrottleConfig) GetAuditRetentionDays() int {
+	if conf.AuditRetentionDays <= 0 {
+		return defaultAuditRetentionDays
+	}
+	return conf.AuditRetentionDays
+}
+
+func (conf ThrottleConfig) GetTrustedProxies() int {
+	if conf.TrustedProxies <= 0 {
+		return defaultTrustedProxies
+	}
+	return conf.TrustedProxies
+}
+
+func (conf ThrottleConfig) GetLoginPolicy() ThrottlePolicy {
+	return conf.Login.withDefaults(defaultLoginFreeAttempts, defaultLoginLockoutAttempts)
+}
+
+func (conf ThrottleConfig) GetIPPolicy() ThrottlePolicy {
+	return conf.IP.withDefaults(defaultIPFreeAttempts, defaultIPLockoutAttempts)
+}
+
+func (policy ThrottlePolicy) withDefaults(freeAttempts int, lockoutAttempts int) ThrottlePolicy {
+	if policy.FreeAttempts <= 0 {
+		policy.FreeAttempts = freeAttempts
+	}
+	if policy.LockoutAttempts <= 0 {
+		policy.LockoutAttempts = lockoutAttempts
+	}
+	return policy
+}
+
+func (conf LogicConfig) GetEventRetentionDays() int {
+	if conf.EventRetentionDays <= 0 {
+		return defaultEventRetentionDays
+	}
+	return conf.EventRetentionDays
+}
+
+func (conf LogicConfig) GetPingInterval() time.Duration {
+	if conf.PingSeconds <= 0 {
+		return time.Second * defaultPingSeconds
+	}
+	return time.Second * time.Duration(conf.PingSeconds)
+}
+
+func (conf NotifyConfig) GetChannel() string {
+	if conf.Channel == "" {
+		return defaultNotifyChannel
+	}
+	return conf.Channel
+}
+
+func (conf NotifyConfig) GetMinReconnectInterval() time.Duration {
+	if conf.MinReconnectSeconds <= 0 {
+		return time.Second * defaultMinReconnectSeconds
+	}
+	return time.Second * time.Duration(conf.MinReconnectSeconds)
+}
+
+func (conf NotifyConfig) GetMaxReconnectInterval() time.Duration {
+	if conf.MaxReconnectSeconds <= 0 {
+		return time.Second * defaultMaxReconnectSeconds
+	}
+	return time.Second * time.Duration(conf.MaxReconnectSeconds)
+}
+
+func (conf StorageConfig) GetMaxPhotoSize() int64 {
+	if conf.MaxPhotoKB <= 0 {
+		return defaultMaxPhotoKB * 1024
+	}
+	return int64(conf.MaxPhotoKB) * 1024
+}
+
+func (conf StorageConfig) GetBaseURL() string {
+	if conf.BaseURL != "" {
+		return strings.TrimSuffix(conf.BaseURL, "/")
+	}
+	if conf.Endpoint != "" {
+		return strings.TrimSuffix(conf.Endpoint, "/") + "/" + conf.Bucket
+	}
+	return defaultLocalBaseURL
+}
+
 func (conf DBConfig) GetAuthStr() string {
 	return fmt.Sprintf(conf.AuthStringTemplate, conf.User, conf.Password, conf.DBName)
 }
@@ -56,3 +394,96 @@ func (conf DBConfig) GetAuthStr() string {
 func (conf DBConfig) GetEnvAuthString() string {
 	return os.Getenv(conf.EnvVar)
 }
+
+// GetListenerAuthStr returns the connection string for connections opened
+// apart from sql.DB. Like main, it prefers the one set in the environment.
+func (conf DBConfig) GetListenerAuthStr() string {
+	if str := conf.GetEnvAuthString(); str != "" {
+		return str
+	}
+	return conf.GetAuthStr()
+}
+
+func (conf PushConfig) GetWorkers() int {
+	if conf.Workers <= 0 {
+		return defaultPushWorkers
+	}
+	return conf.Workers
+}
+
+func (conf PushConfig) GetQueueSize() int {
+	if conf.QueueSize <= 0 {
+		return defaultPushQueueSize
+	}
+	return conf.QueueSize
+}
+
+func (conf PushConfig) GetMaxAttempts() int {
+	if conf.MaxAttempts <= 0 {
+		return defaultPushMaxAttempts
+	}
+	return conf.MaxAttempts
+}
+
+func (conf PushConfig) GetBaseDelay() time.Duration {
+	if conf.BaseDelayMillis <= 0 {
+		return time.Millisecond * defaultPushBaseDelayMillis
+	}
+	return time.Millisecond * time.Duration(conf.BaseDelayMillis)
+}
+
+func (conf PushConfig) GetMaxDelay() time.Duration {
+	if conf.MaxDelaySeconds <= 0 {
+		return time.Second * defaultPushMaxDelaySeconds
+	}
+	return time.Second * time.Duration(conf.MaxDelaySeconds)
+}
+
+func (conf WebhookConfig) GetPollInterval() time.Duration {
+	if conf.PollSeconds <= 0 {
+		return time.Second * defaultWebhookPollSeconds
+	}
+	return time.Second * time.Duration(conf.PollSeconds)
+}
+
+func (conf WebhookConfig) GetBatchSize() int {
+	if conf.BatchSize <= 0 {
+		return defaultWebhookBatchSize
+	}
+	return conf.BatchSize
+}
+
+func (conf WebhookConfig) GetTimeout() time.Duration {
+	if conf.TimeoutSeconds <= 0 {
+		return time.Second * defaultWebhookTimeoutSeconds
+	}
+	return time.Second * time.Duration(conf.TimeoutSeconds)
+}
+
+func (conf WebhookConfig) GetMaxAttempts() int {
+	if conf.MaxAttempts <= 0 {
+		return defaultWebhookMaxAttempts
+	}
+	return conf.MaxAttempts
+}
+
+func (conf WebhookConfig) GetBaseDelay() time.Duration {
+	if conf.BaseDelaySeconds <= 0 {
+		return time.Second * defaultWebhookBaseDelaySeconds
+	}
+	return time.Second * time.Duration(conf.BaseDelaySeconds)
+}
+
+func (conf WebhookConfig) GetMaxDelay() time.Duration {
+	if conf.MaxDelayMinutes <= 0 {
+		return time.Minute * defaultWebhookMaxDelayMinutes
+	}
+	return time.Minute * time.Duration(conf.MaxDelayMinutes)
+}
+
+func (conf WebhookConfig) GetRetentionDays() int {
+	if conf.RetentionDays <= 0 {
+		return defaultWebhookRetentionDays
+	}
+	return conf.RetentionDays
+}
@@ -0,0 +1,123 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/model"
+)
+
+const (
+	createBlock = `
+		INSERT INTO UserBlock (blockerId, blockedId) VALUES ($1, $2)
+		ON CONFLICT (blockerId, blockedId) DO NOTHING
+	`
+	declinePairRequests = `
+		UPDATE MeetRequest SET status = 'DECLINED'
+		WHERE status = 'PENDING' AND (
+			(requesterId = $1 AND requestedId = $2) OR (requesterId = $2 AND requestedId = $1)
+		)
+		RETURNING id
+	`
+	deleteBlock = `
+		DELETE FROM UserBlock WHERE blockerId = $1 AND blockedId = $2
+	`
+	countBlocks = `
+		SELECT count(*) FROM UserBlock WHERE blockerId = $1 AND blockedId = $2
+	`
+	countPairBlocks = `
+		SELECT count(*) FROM UserBlock
+		WHERE (blockerId = $1 AND blockedId = $2) OR (blockerId = $2 AND blockedId = $1)
+	`
+	getBlockedUsers = `
+		SELECT u.id, u.login, u.age, u.sex, u.about FROM UserBlock b
+			JOIN Users u ON b.blockedId = u.id
+		WHERE b.blockerId = $1
+		ORDER BY b.time DESC
+	`
+)
+
+type BlockDAO interface {
+	// Block adds blockedId to the block list of blockerId and declines pending
+	// requests between them in both directions. Ids of declined requests are returned.
+	Block(blockerId int, blockedId int) ([]int, error)
+	// Unblock returns false if blockedId was not blocked by blockerId.
+	Unblock(blockerId int, blockedId int) (bool, error)
+	IsBlocked(blockerId int, blockedId int) (bool, error)
+	GetBlockedUsers(blockerId int) ([]*model.User, error)
+}
+
+type dbBlockDAO struct {
+	db *sql.DB
+}
+
+func NewDBBlockDAO(db *sql.DB) BlockDAO {
+	var result = new(dbBlockDAO)
+	result.db = db
+	return result
+}
+
+func (dao *dbBlockDAO) Block(blockerId int, blockedId int) ([]int, error) {
+	var tx, txErr = dao.db.Begin()
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	if _, err := tx.Exec(createBlock, blockerId, blockedId); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var rows, err = tx.Query(declinePairRequests, blockerId, blockedId)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var declined = make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		declined = append(declined, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return declined, tx.Commit()
+}
+
+func (dao *dbBlockDAO) Unblock(blockerId int, blockedId int) (bool, error) {
+	return execAffected(dao.db, deleteBlock, blockerId, blockedId)
+}
+
+func (dao *dbBlockDAO) IsBlocked(blockerId int, blockedId int) (bool, error) {
+	var cnt int
+	var err = dao.db.QueryRow(countBlocks, blockerId, blockedId).Scan(&cnt)
+	if err != nil {
+		return false, err
+	}
+	return cnt > 0, nil
+}
+
+func (dao *dbBlockDAO) GetBlockedUsers(blockerId int) ([]*model.User, error) {
+	var rows, err = dao.db.Query(getBlockedUsers, blockerId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result = make([]*model.User, 0)
+	for rows.Next() {
+		var user = new(model.User)
+		if err := rows.Scan(&user.Id, &user.Login, &user.Age, &user.Sex, &user.About); err != nil {
+			return nil, err
+		}
+		result = append(result, user)
+	}
+	return result, rows.Err()
+}
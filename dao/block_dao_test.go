@@ -0,0 +1,122 @@
+package dao
+
+import (
+	"errors"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"testing"
+)
+
+func TestDbBlockDAO_Block_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.
+		ExpectExec("INSERT INTO UserBlock").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectQuery("UPDATE MeetRequest SET status = 'DECLINED'").
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10).AddRow(11))
+	mock.ExpectCommit()
+
+	var blockDAO = NewDBBlockDAO(db)
+	var declined, blockErr = blockDAO.Block(1, 2)
+
+	assert.Nil(t, blockErr)
+	assert.Equal(t, []int{10, 11}, declined)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbBlockDAO_Block_DBError(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.
+		ExpectExec("INSERT INTO UserBlock").
+		WithArgs(1, 2).
+		WillReturnError(errors.New("failed to insert"))
+	mock.ExpectRollback()
+
+	var blockDAO = NewDBBlockDAO(db)
+	var _, blockErr = blockDAO.Block(1, 2)
+
+	assert.NotNil(t, blockErr)
+	assert.Equal(t, "failed to insert", blockErr.Error())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbBlockDAO_Unblock(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("DELETE FROM UserBlock").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var blockDAO = NewDBBlockDAO(db)
+	var found, unblockErr = blockDAO.Unblock(1, 2)
+
+	assert.Nil(t, unblockErr)
+	assert.False(t, found)
+}
+
+func TestDbBlockDAO_IsBlocked(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	var blockDAO = NewDBBlockDAO(db)
+	var blocked, blockedErr = blockDAO.IsBlocked(1, 2)
+
+	assert.Nil(t, blockedErr)
+	assert.True(t, blocked)
+}
+
+func TestDbBlockDAO_GetBlockedUsers(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT u.id, u.login").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about"}).
+				AddRow(2, "login", 30, model.MALE, "about"),
+		)
+
+	var blockDAO = NewDBBlockDAO(db)
+	var users, usersErr = blockDAO.GetBlockedUsers(1)
+
+	assert.Nil(t, usersErr)
+	assert.Equal(t, []*model.User{{Id: 2, Login: "login", Age: 30, Sex: model.MALE, About: "about"}}, users)
+}
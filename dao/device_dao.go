@@ -0,0 +1,71 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/model"
+)
+
+const (
+	saveDevice = `
+		INSERT INTO Device (userId, platform, token) VALUES ($1, $2, $3)
+		ON CONFLICT (token) DO UPDATE SET userId = EXCLUDED.userId, platform = EXCLUDED.platform, updated = now()
+	`
+	getUserDevices    = `SELECT token, platform FROM Device WHERE userId = $1 ORDER BY id`
+	deleteUserDevice  = `DELETE FROM Device WHERE userId = $1 AND token = $2`
+	deleteDevice      = `DELETE FROM Device WHERE token = $1`
+	deleteUserDevices = `DELETE FROM Device WHERE userId = $1`
+)
+
+type DeviceDAO interface {
+	// AddDevice saves the token for the user. A token registered by another
+	// user before is moved to this one.
+	AddDevice(userId int, device *model.Device) error
+	GetDevices(userId int) ([]*model.Device, error)
+	// RemoveDevice returns false if the user has no such token.
+	RemoveDevice(userId int, token string) (bool, error)
+	// DeleteToken removes the token whoever it belongs to. It is used to prune
+	// tokens which push services report as invalid.
+	DeleteToken(token string) error
+}
+
+type dbDeviceDAO struct {
+	db *sql.DB
+}
+
+func NewDBDeviceDAO(db *sql.DB) DeviceDAO {
+	var result = new(dbDeviceDAO)
+	result.db = db
+	return result
+}
+
+func (dao *dbDeviceDAO) AddDevice(userId int, device *model.Device) error {
+	var _, err = dao.db.Exec(saveDevice, userId, device.Platform, device.Token)
+	return err
+}
+
+func (dao *dbDeviceDAO) GetDevices(userId int) ([]*model.Device, error) {
+	var rows, err = dao.db.Query(getUserDevices, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result = make([]*model.Device, 0)
+	for rows.Next() {
+		var device = new(model.Device)
+		if err := rows.Scan(&device.Token, &device.Platform); err != nil {
+			return nil, err
+		}
+		result = append(result, device)
+	}
+	return result, rows.Err()
+}
+
+func (dao *dbDeviceDAO) RemoveDevice(userId int, token string) (bool, error) {
+	return execAffected(dao.db, deleteUserDevice, userId, token)
+}
+
+func (dao *dbDeviceDAO) DeleteToken(token string) error {
+	var _, err = dao.db.Exec(deleteDevice, token)
+	return err
+}
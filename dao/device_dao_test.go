@@ -0,0 +1,93 @@
+package dao
+
+import (
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"testing"
+)
+
+func TestDbDeviceDAO_AddDevice_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("INSERT INTO Device").
+		WithArgs(1, model.PlatformFCM, "token").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var deviceDAO = NewDBDeviceDAO(db)
+	assert.Nil(t, deviceDAO.AddDevice(1, &model.Device{Token: "token", Platform: model.PlatformFCM}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbDeviceDAO_GetDevices_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT token, platform FROM Device").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"token", "platform"}).
+				AddRow("token1", model.PlatformFCM).
+				AddRow("token2", model.PlatformAPNs),
+		)
+
+	var deviceDAO = NewDBDeviceDAO(db)
+	var devices, dbErr = deviceDAO.GetDevices(1)
+
+	assert.Nil(t, dbErr)
+	assert.Equal(t, []*model.Device{
+		{Token: "token1", Platform: model.PlatformFCM},
+		{Token: "token2", Platform: model.PlatformAPNs},
+	}, devices)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbDeviceDAO_RemoveDevice_NotFound(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("DELETE FROM Device WHERE userId").
+		WithArgs(1, "token").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var deviceDAO = NewDBDeviceDAO(db)
+	var removed, dbErr = deviceDAO.RemoveDevice(1, "token")
+
+	assert.Nil(t, dbErr)
+	assert.False(t, removed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbDeviceDAO_DeleteToken_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("DELETE FROM Device WHERE token").
+		WithArgs("token").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var deviceDAO = NewDBDeviceDAO(db)
+	assert.Nil(t, deviceDAO.DeleteToken("token"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,150 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/model"
+)
+
+const (
+	// events of the user are saved holding the lock row of the user till commit, so
+	// that their ids grow in commit order and a reader past some id never misses
+	// an event committed later
+	lockUserEvents = `
+		INSERT INTO EventLock (userId) VALUES ($1)
+		ON CONFLICT (userId) DO UPDATE SET userId = EXCLUDED.userId
+	`
+	createEvent = `INSERT INTO Event (userId, requestId, status) VALUES ($1, $2, $3) RETURNING id`
+	getEvents   = `
+		SELECT e.id, e.time, mr.id, mr.requesterId, u1.login, u1.about, mr.requestedId, u2.login, u2.about, e.status,
+			mr.time, COALESCE(u1.photo, ''), COALESCE(u2.photo, '') FROM Event e
+			JOIN MeetRequest mr ON e.requestId = mr.id
+			JOIN Users u1 ON mr.requesterId = u1.id
+			JOIN Users u2 ON mr.requestedId = u2.id
+		WHERE e.userId = $1 AND e.id > $2
+		ORDER BY e.id
+		LIMIT $3
+	`
+	ackEvents           = `DELETE FROM Event WHERE userId = $1 AND id <= $2`
+	deleteRequestEvents = `DELETE FROM Event WHERE requestId = $1`
+	deleteOldEvents     = `DELETE FROM Event WHERE age(now(), time) > $1 * interval '1 day'`
+	// events of other users about requests of the user go as well
+	deleteUserEvents = `
+		DELETE FROM Event WHERE userId = $1 OR requestId IN (
+			SELECT id FROM MeetRequest WHERE requesterId = $1 OR requestedId = $1
+		)
+	`
+	deleteUserEventLock = `DELETE FROM EventLock WHERE userId = $1`
+)
+
+type EventDAO interface {
+	// AddEvent saves a new event for the user and returns its id.
+	AddEvent(userId int, requestId int, status string) (int64, error)
+	// GetEvents returns at most limit events of the user with ids greater than since, oldest first.
+	GetEvents(userId int, since int64, limit int) ([]*model.Event, error)
+	// Ack removes events of the user up to the one with given id inclusive
+	// and returns the number of removed events.
+	Ack(userId int, upTo int64) (int, error)
+	// DeleteRequestEvents removes undelivered events about the request, so that
+	// nobody learns about a request which was withdrawn.
+	DeleteRequestEvents(requestId int) error
+	// DeleteOldEvents removes events never acknowledged within retentionDays.
+	DeleteOldEvents(retentionDays int) error
+}
+
+type dbEventDAO struct {
+	db *sql.DB
+}
+
+func NewDBEventDAO(db *sql.DB) EventDAO {
+	var result = new(dbEventDAO)
+	result.db = db
+	return result
+}
+
+func (dao *dbEventDAO) AddEvent(userId int, requestId int, status string) (int64, error) {
+	var tx, txErr = dao.db.Begin()
+	if txErr != nil {
+		return 0, txErr
+	}
+
+	var id, err = addEvent(tx, userId, requestId, status)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (dao *dbEventDAO) GetEvents(userId int, since int64, limit int) ([]*model.Event, error) {
+	var rows, err = dao.db.Query(getEvents, userId, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result = make([]*model.Event, 0)
+	for rows.Next() {
+		var event = &model.Event{Request: new(model.MeetRequest)}
+		var r = event.Request
+		err = rows.Scan(
+			&event.Id,
+			&event.Time,
+			&r.Id,
+			&r.RequesterId,
+			&r.RequesterLogin,
+			&r.RequesterAbout,
+			&r.RequestedId,
+			&r.RequestedLogin,
+			&r.RequestedAbout,
+			&r.Status,
+			&r.Time,
+			&r.RequesterPhotoKey,
+			&r.RequestedPhotoKey,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, event)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (dao *dbEventDAO) Ack(userId int, upTo int64) (int, error) {
+	var result, err = dao.db.Exec(ackEvents, userId, upTo)
+	if err != nil {
+		return 0, err
+	}
+
+	var rowsAffected, rowsErr = result.RowsAffected()
+	if rowsErr != nil {
+		return 0, rowsErr
+	}
+	return int(rowsAffected), nil
+}
+
+func (dao *dbEventDAO) DeleteRequestEvents(requestId int) error {
+	var _, err = dao.db.Exec(deleteRequestEvents, requestId)
+	return err
+}
+
+func (dao *dbEventDAO) DeleteOldEvents(retentionDays int) error {
+	var _, err = dao.db.Exec(deleteOldEvents, retentionDays)
+	return err
+}
+
+// addEvent saves the event in the transaction. Transactions saving events of
+// several users save them in ascending order of user ids to avoid deadlocks.
+func addEvent(tx *sql.Tx, userId int, requestId int, status string) (int64, error) {
+	if _, err := tx.Exec(lockUserEvents, userId); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	var err = tx.QueryRow(createEvent, userId, requestId, status).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,157 @@
+package dao
+
+import (
+	"errors"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"testing"
+	"time"
+)
+
+func TestDbEventDAO_AddEvent_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.
+		ExpectExec("INSERT INTO EventLock").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectQuery("INSERT INTO Event ").
+		WithArgs(2, 10, model.StatusAccepted).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectCommit()
+
+	var eventDAO = NewDBEventDAO(db)
+	var id, dbErr = eventDAO.AddEvent(2, 10, model.StatusAccepted)
+
+	assert.Nil(t, dbErr)
+	assert.Equal(t, int64(42), id)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+// Events of the user saved by the expiration daemon and by a request handler
+// at the same time must not commit in other order than their ids go, otherwise
+// a reader past the greater id would skip the other one. Each transaction takes
+// the lock row of the user before its insert takes an id, so the second one waits
+// for the first to commit; the daemon takes locks of requesters in ascending order.
+func TestDbEventDAO_AddEvent_ConcurrentWithDeclineAll(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.
+		ExpectQuery("UPDATE MeetRequest SET status = 'DECLINED'").
+		WithArgs(5).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "requesterId", "requestedId", "time"}).
+				AddRow(11, 3, 1, time.Now()).
+				AddRow(10, 2, 1, time.Now()),
+		)
+	mock.ExpectExec("INSERT INTO EventLock").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO Event ").WithArgs(2, 10, model.StatusDeclined).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectExec("INSERT INTO EventLock").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO Event ").WithArgs(3, 11, model.StatusDeclined).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(43))
+	mock.ExpectCommit()
+	// the handler saving an event for the same user waits for the daemon to commit
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO EventLock").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO Event ").WithArgs(2, 12, model.StatusPending).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(44))
+	mock.ExpectCommit()
+
+	var declined, declineErr = NewMeetDAO(db).DeclineAll(5)
+	assert.Nil(t, declineErr)
+	assert.Equal(t, 2, len(declined))
+	assert.Equal(t, 11, declined[0].Id)
+
+	var id, addErr = NewDBEventDAO(db).AddEvent(2, 12, model.StatusPending)
+	assert.Nil(t, addErr)
+	assert.Equal(t, int64(44), id)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbEventDAO_AddEvent_LockError(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.
+		ExpectExec("INSERT INTO EventLock").
+		WithArgs(2).
+		WillReturnError(errors.New("deadlock detected"))
+	mock.ExpectRollback()
+
+	var eventDAO = NewDBEventDAO(db)
+	var _, dbErr = eventDAO.AddEvent(2, 10, model.StatusAccepted)
+
+	assert.NotNil(t, dbErr)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbEventDAO_GetEvents_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var columns = []string{
+		"e.id", "e.time", "mr.id", "mr.requesterId", "u1.login", "u1.about", "mr.requestedId", "u2.login",
+		"u2.about", "e.status", "mr.time", "requesterPhoto", "requestedPhoto",
+	}
+	mock.
+		ExpectQuery("SELECT e.id").
+		WithArgs(1, 41, 100).
+		WillReturnRows(
+			sqlmock.NewRows(columns).
+				AddRow(42, time.Now(), 10, 2, "login2", "about2", 1, "login1", "about1", model.StatusPending, time.Now(), "", "").
+				AddRow(43, time.Now(), 10, 2, "login2", "about2", 1, "login1", "about1", model.StatusInterrupted, time.Now(), "", ""),
+		)
+
+	var eventDAO = NewDBEventDAO(db)
+	var events, dbErr = eventDAO.GetEvents(1, 41, 100)
+
+	assert.Nil(t, dbErr)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, int64(42), events[0].Id)
+	assert.Equal(t, 10, events[0].Request.Id)
+	assert.Equal(t, model.StatusPending, events[0].Request.Status)
+	assert.Equal(t, model.StatusInterrupted, events[1].Request.Status)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbEventDAO_Ack_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("DELETE FROM Event").
+		WithArgs(1, 43).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	var eventDAO = NewDBEventDAO(db)
+	var removed, dbErr = eventDAO.Ack(1, 43)
+
+	assert.Nil(t, dbErr)
+	assert.Equal(t, 2, removed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
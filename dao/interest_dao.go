@@ -0,0 +1,123 @@
+package dao
+
+import (
+	"database/sql"
+)
+
+const (
+	getUserInterests = `
+		SELECT i.name FROM UserInterest ui
+			JOIN Interest i ON ui.interestId = i.id
+		WHERE ui.userId = $1
+		ORDER BY i.name
+	`
+	// DO UPDATE makes RETURNING work for already existing interests as well
+	saveInterest = `
+		INSERT INTO Interest (name) VALUES ($1)
+		ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id
+	`
+	createUserInterest = `
+		INSERT INTO UserInterest (userId, interestId) VALUES ($1, $2)
+		ON CONFLICT (userId, interestId) DO NOTHING
+	`
+	deleteUserInterest = `
+		DELETE FROM UserInterest ui USING Interest i
+		WHERE ui.interestId = i.id AND ui.userId = $1 AND i.name = $2
+	`
+	deleteUserInterests = `DELETE FROM UserInterest WHERE userId = $1`
+)
+
+// InterestDAO expects names already normalized with model.NormalizeInterest.
+type InterestDAO interface {
+	// GetUserInterests returns interests of the user in alphabetical order.
+	GetUserInterests(userId int) ([]string, error)
+	// SetUserInterests replaces all interests of the user.
+	SetUserInterests(userId int, names []string) error
+	// AddUserInterest returns false if the user already has this interest.
+	AddUserInterest(userId int, name string) (bool, error)
+	// RemoveUserInterest returns false if the user has no such interest.
+	RemoveUserInterest(userId int, name string) (bool, error)
+}
+
+type dbInterestDAO struct {
+	db *sql.DB
+}
+
+func NewDBInterestDAO(db *sql.DB) InterestDAO {
+	var result = new(dbInterestDAO)
+	result.db = db
+	return result
+}
+
+func (dao *dbInterestDAO) GetUserInterests(userId int) ([]string, error) {
+	var rows, err = dao.db.Query(getUserInterests, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result = make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		result = append(result, name)
+	}
+	return result, rows.Err()
+}
+
+func (dao *dbInterestDAO) SetUserInterests(userId int, names []string) error {
+	var tx, txErr = dao.db.Begin()
+	if txErr != nil {
+		return txErr
+	}
+
+	if _, err := tx.Exec(deleteUserInterests, userId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, name := range names {
+		if _, err := addUserInterest(tx, userId, name); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (dao *dbInterestDAO) AddUserInterest(userId int, name string) (bool, error) {
+	var tx, txErr = dao.db.Begin()
+	if txErr != nil {
+		return false, txErr
+	}
+
+	var added, err = addUserInterest(tx, userId, name)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return added, tx.Commit()
+}
+
+func (dao *dbInterestDAO) RemoveUserInterest(userId int, name string) (bool, error) {
+	return execAffected(dao.db, deleteUserInterest, userId, name)
+}
+
+func addUserInterest(tx *sql.Tx, userId int, name string) (bool, error) {
+	var interestId int
+	if err := tx.QueryRow(saveInterest, name).Scan(&interestId); err != nil {
+		return false, err
+	}
+
+	var result, err = tx.Exec(createUserInterest, userId, interestId)
+	if err != nil {
+		return false, err
+	}
+	var rowsAffected, rowsErr = result.RowsAffected()
+	if rowsErr != nil {
+		return false, rowsErr
+	}
+	return rowsAffected > 0, nil
+}
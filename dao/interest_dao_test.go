@@ -0,0 +1,142 @@
+package dao
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"testing"
+)
+
+func TestDbInterestDAO_GetUserInterests_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT i.name FROM UserInterest").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("board games").AddRow("chess"))
+
+	var interestDAO = NewDBInterestDAO(db)
+	var interests, dbErr = interestDAO.GetUserInterests(1)
+
+	assert.Nil(t, dbErr)
+	assert.Equal(t, []string{"board games", "chess"}, interests)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbInterestDAO_SetUserInterests_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.
+		ExpectExec("DELETE FROM UserInterest").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.
+		ExpectQuery("INSERT INTO Interest").
+		WithArgs("chess").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.
+		ExpectExec("INSERT INTO UserInterest").
+		WithArgs(1, 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectQuery("INSERT INTO Interest").
+		WithArgs("hiking").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+	mock.
+		ExpectExec("INSERT INTO UserInterest").
+		WithArgs(1, 11).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var interestDAO = NewDBInterestDAO(db)
+	var dbErr = interestDAO.SetUserInterests(1, []string{"chess", "hiking"})
+
+	assert.Nil(t, dbErr)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbInterestDAO_SetUserInterests_DBError(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.
+		ExpectExec("DELETE FROM UserInterest").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectQuery("INSERT INTO Interest").
+		WithArgs("chess").
+		WillReturnError(errors.New("failed to insert"))
+	mock.ExpectRollback()
+
+	var interestDAO = NewDBInterestDAO(db)
+	var dbErr = interestDAO.SetUserInterests(1, []string{"chess"})
+
+	assert.NotNil(t, dbErr)
+	assert.Equal(t, "failed to insert", dbErr.Error())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbInterestDAO_AddUserInterest_Exists(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.
+		ExpectQuery("INSERT INTO Interest").
+		WithArgs("chess").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.
+		ExpectExec("INSERT INTO UserInterest").
+		WithArgs(1, 10).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	var interestDAO = NewDBInterestDAO(db)
+	var added, dbErr = interestDAO.AddUserInterest(1, "chess")
+
+	assert.Nil(t, dbErr)
+	assert.False(t, added)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbInterestDAO_RemoveUserInterest_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("DELETE FROM UserInterest ui USING Interest").
+		WithArgs(1, "chess").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var interestDAO = NewDBInterestDAO(db)
+	var removed, dbErr = interestDAO.RemoveUserInterest(1, "chess")
+
+	assert.Nil(t, dbErr)
+	assert.True(t, removed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,64 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/model"
+)
+
+const (
+	saveLoginFailure = `
+		INSERT INTO LoginFailure (login, ip, reason) VALUES ($1, $2, $3)
+	`
+	getLoginFailures = `
+		SELECT COALESCE(ip, ''), reason, time FROM LoginFailure WHERE login = $1 ORDER BY id
+	`
+	deleteOldLoginFailures = `
+		DELETE FROM LoginFailure WHERE age(now(), time) > $1 * interval '1 day'
+	`
+)
+
+// LoginAuditDAO keeps the audit trail of failed sign in attempts.
+type LoginAuditDAO interface {
+	SaveFailure(login string, ip string, reason string) error
+	// GetFailures returns failed attempts to sign in with the login, the oldest first.
+	GetFailures(login string) ([]*model.LoginFailure, error)
+	DeleteOldFailures(retentionDays int) error
+}
+
+type dbLoginAuditDAO struct {
+	db *sql.DB
+}
+
+func NewDBLoginAuditDAO(db *sql.DB) LoginAuditDAO {
+	var result = new(dbLoginAuditDAO)
+	result.db = db
+	return result
+}
+
+func (dao *dbLoginAuditDAO) SaveFailure(login string, ip string, reason string) error {
+	var _, err = dao.db.Exec(saveLoginFailure, login, ip, reason)
+	return err
+}
+
+func (dao *dbLoginAuditDAO) GetFailures(login string) ([]*model.LoginFailure, error) {
+	var rows, err = dao.db.Query(getLoginFailures, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result = make([]*model.LoginFailure, 0)
+	for rows.Next() {
+		var failure = new(model.LoginFailure)
+		if err := rows.Scan(&failure.IP, &failure.Reason, &failure.Time); err != nil {
+			return nil, err
+		}
+		result = append(result, failure)
+	}
+	return result, rows.Err()
+}
+
+func (dao *dbLoginAuditDAO) DeleteOldFailures(retentionDays int) error {
+	var _, err = dao.db.Exec(deleteOldLoginFailures, retentionDays)
+	return err
+}
@@ -0,0 +1,71 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/model"
+	"time"
+)
+
+const (
+	getLoginAttempts = `
+		SELECT failures, lastFailure FROM LoginThrottle WHERE attemptKey = $1 AND lastFailure > $2
+	`
+	addLoginFailure = `
+		INSERT INTO LoginThrottle (attemptKey, failures, lastFailure) VALUES ($1, 1, $2)
+		ON CONFLICT (attemptKey) DO UPDATE SET
+			failures = CASE WHEN LoginThrottle.lastFailure > $3 THEN LoginThrottle.failures + 1 ELSE 1 END,
+			lastFailure = $2
+		RETURNING failures, lastFailure
+	`
+	resetLoginAttempts = `
+		DELETE FROM LoginThrottle WHERE attemptKey = $1
+	`
+	deleteStaleLoginAttempts = `
+		DELETE FROM LoginThrottle WHERE lastFailure <= $1
+	`
+)
+
+// LoginThrottleDAO keeps failed sign in counters in the database,
+// so that they are shared by all instances of the server.
+// Failures made before since are not taken into account.
+type LoginThrottleDAO interface {
+	Get(key string, since time.Time) (model.LoginAttempts, error)
+	AddFailure(key string, now time.Time, since time.Time) (model.LoginAttempts, error)
+	Reset(key string) error
+	DeleteStale(since time.Time) error
+}
+
+type dbLoginThrottleDAO struct {
+	db *sql.DB
+}
+
+func NewDBLoginThrottleDAO(db *sql.DB) LoginThrottleDAO {
+	var result = new(dbLoginThrottleDAO)
+	result.db = db
+	return result
+}
+
+func (dao *dbLoginThrottleDAO) Get(key string, since time.Time) (model.LoginAttempts, error) {
+	var attempts model.LoginAttempts
+	var err = dao.db.QueryRow(getLoginAttempts, key, since).Scan(&attempts.Failures, &attempts.LastFailure)
+	if err == sql.ErrNoRows {
+		return model.LoginAttempts{}, nil
+	}
+	return attempts, err
+}
+
+func (dao *dbLoginThrottleDAO) AddFailure(key string, now time.Time, since time.Time) (model.LoginAttempts, error) {
+	var attempts model.LoginAttempts
+	var err = dao.db.QueryRow(addLoginFailure, key, now, since).Scan(&attempts.Failures, &attempts.LastFailure)
+	return attempts, err
+}
+
+func (dao *dbLoginThrottleDAO) Reset(key string) error {
+	var _, err = dao.db.Exec(resetLoginAttempts, key)
+	return err
+}
+
+func (dao *dbLoginThrottleDAO) DeleteStale(since time.Time) error {
+	var _, err = dao.db.Exec(deleteStaleLoginAttempts, since)
+	return err
+}
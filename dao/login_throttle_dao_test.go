@@ -0,0 +1,98 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"testing"
+	"time"
+)
+
+func TestDbLoginThrottleDAO_Get_Found(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var since = time.Date(2017, 10, 17, 0, 0, 0, 0, time.UTC)
+	var last = since.Add(time.Minute)
+	mock.
+		ExpectQuery("SELECT failures, lastFailure FROM LoginThrottle").
+		WithArgs("login:login", since).
+		WillReturnRows(sqlmock.NewRows([]string{"failures", "lastFailure"}).AddRow(3, last))
+
+	var throttleDAO = NewDBLoginThrottleDAO(db)
+	var attempts, getErr = throttleDAO.Get("login:login", since)
+
+	assert.Nil(t, getErr)
+	assert.Equal(t, model.LoginAttempts{Failures: 3, LastFailure: last}, attempts)
+}
+
+func TestDbLoginThrottleDAO_Get_NotFound(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT failures, lastFailure FROM LoginThrottle").
+		WillReturnError(sql.ErrNoRows)
+
+	var throttleDAO = NewDBLoginThrottleDAO(db)
+	var attempts, getErr = throttleDAO.Get("login:login", time.Now())
+
+	assert.Nil(t, getErr)
+	assert.Equal(t, model.LoginAttempts{}, attempts)
+}
+
+func TestDbLoginThrottleDAO_AddFailure(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var now = time.Date(2017, 10, 17, 0, 0, 0, 0, time.UTC)
+	var since = now.Add(-time.Hour)
+	mock.
+		ExpectQuery("INSERT INTO LoginThrottle .* ON CONFLICT").
+		WithArgs("ip:127.0.0.1", now, since).
+		WillReturnRows(sqlmock.NewRows([]string{"failures", "lastFailure"}).AddRow(2, now))
+
+	var throttleDAO = NewDBLoginThrottleDAO(db)
+	var attempts, addErr = throttleDAO.AddFailure("ip:127.0.0.1", now, since)
+
+	assert.Nil(t, addErr)
+	assert.Equal(t, model.LoginAttempts{Failures: 2, LastFailure: now}, attempts)
+}
+
+func TestDbLoginThrottleDAO_ResetAndDeleteStale(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var since = time.Date(2017, 10, 17, 0, 0, 0, 0, time.UTC)
+	mock.
+		ExpectExec("DELETE FROM LoginThrottle WHERE attemptKey").
+		WithArgs("login:login").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec("DELETE FROM LoginThrottle WHERE lastFailure").
+		WithArgs(since).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+
+	var throttleDAO = NewDBLoginThrottleDAO(db)
+
+	assert.Nil(t, throttleDAO.Reset("login:login"))
+	assert.Nil(t, throttleDAO.DeleteStale(since))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -3,6 +3,7 @@ package dao
 import (
 	"database/sql"
 	"github.com/Sovianum/acquaintance-server/model"
+	"sort"
 )
 
 const (
@@ -11,37 +12,66 @@ const (
 		WHERE requesterId = $1 AND requestedId = $2 AND status = 'PENDING'
 	`
 	getIncomePendingRequests = `
-		SELECT mr.id, mr.requesterId, u1.login, u1.about, mr.requestedId, u2.login, u2.about, mr.status, mr.time FROM MeetRequest mr
+		SELECT mr.id, mr.requesterId, u1.login, u1.about, mr.requestedId, u2.login, u2.about, mr.status, mr.time,
+			COALESCE(u1.photo, ''), COALESCE(u2.photo, '') FROM MeetRequest mr
 			JOIN Users u1 ON mr.requesterId = u1.id
 			JOIN Users u2 ON mr.requestedId = u2.id
 		WHERE mr.requestedId = $1 AND status = 'PENDING'
 	`
 	getOutcomePendingRequests = `
-		SELECT mr.id, mr.requesterId, u1.login, u1.about, mr.requestedId, u2.login, u2.about, mr.status, mr.time FROM MeetRequest mr
+		SELECT mr.id, mr.requesterId, u1.login, u1.about, mr.requestedId, u2.login, u2.about, mr.status, mr.time,
+			COALESCE(u1.photo, ''), COALESCE(u2.photo, '') FROM MeetRequest mr
 			JOIN Users u1 ON mr.requesterId = u1.id
 			JOIN Users u2 ON mr.requestedId = u2.id
 		WHERE mr.requesterId = $1 AND status = 'PENDING'
 	`
 	getAllRequests = `
-		SELECT mr.id, mr.requesterId, u1.login, u1.about, mr.requestedId, u2.login, u2.about, mr.status, mr.time FROM MeetRequest mr
+		SELECT mr.id, mr.requesterId, u1.login, u1.about, mr.requestedId, u2.login, u2.about, mr.status, mr.time,
+			COALESCE(u1.photo, ''), COALESCE(u2.photo, '') FROM MeetRequest mr
 			JOIN Users u1 ON mr.requesterId = u1.id
 			JOIN Users u2 ON mr.requestedId = u2.id
 		WHERE mr.requestedId = $1 OR mr.requesterId = $1
 	`
+	// latest positions are taken as in GetVisiblePosition of PositionDAO and the distance
+	// is measured to the position of the requested user ($3) as the requester ($2) sees it
+	// with $5 as the least fuzz radius, so that requests do not tell more about positions
+	// than neighbours do; ghosts are only accessible to their accepted counterparts
 	checkAccessibility = `
-		SELECT ST_DistanceSphere(p1.point, p2.point) < $1 FROM
+		SELECT ST_Distance(p1.point, v.point) < $1 FROM
 			(
-				SELECT * FROM Position
-				WHERE userId = $2 AND age(now(), time) < $4 * interval '1 minute'
-				ORDER BY time DESC
+				SELECT point FROM Position
+				WHERE userId = $2 AND age(now(), LEAST(clientTime, time)) < $4 * interval '1 minute'
+				ORDER BY LEAST(clientTime, time) DESC
 				LIMIT 1
 			) p1,
 			(
-				SELECT * FROM Position
-				WHERE userId = $3 AND age(now(), time) < $4 * interval '1 minute'
-				ORDER BY time DESC
+				SELECT point FROM Position
+				WHERE userId = $3 AND age(now(), LEAST(clientTime, time)) < $4 * interval '1 minute'
+				ORDER BY LEAST(clientTime, time) DESC
 				LIMIT 1
 			) p2
+			LEFT JOIN Privacy pr ON pr.userId = $3
+			CROSS JOIN LATERAL (
+				SELECT EXISTS (
+					SELECT 1 FROM MeetRequest r
+					WHERE r.status = 'ACCEPTED' AND (
+						(r.requesterId = $2 AND r.requestedId = $3) OR
+						(r.requesterId = $3 AND r.requestedId = $2)
+					)
+				) exact
+			) e
+			CROSS JOIN LATERAL (
+				SELECT GREATEST(pr.fuzzRadius, $5) / 111320.0 step
+			) g
+			CROSS JOIN LATERAL (
+				SELECT CASE WHEN e.exact THEN p2.point
+					ELSE ST_SnapToGrid(
+						p2.point::GEOMETRY, 0, 0,
+						g.step / GREATEST(cos(radians(round(ST_Y(p2.point::GEOMETRY) / g.step) * g.step)), 0.01),
+						g.step
+					)::GEOGRAPHY END point
+			) v
+		WHERE e.exact OR NOT COALESCE(pr.ghost, FALSE)
 	`
 	createRequest = `
 		INSERT INTO MeetRequest (requesterId, requestedId) VALUES ($1, $2)
@@ -50,7 +80,8 @@ const (
 		UPDATE MeetRequest SET status = $1 WHERE id = $2 AND requestedId = $3
 	`
 	getRequestById = `
-		SELECT mr.id, mr.requesterId, u1.login, u1.about, mr.requestedId, u2.login, u2.about, mr.status, mr.time FROM
+		SELECT mr.id, mr.requesterId, u1.login, u1.about, mr.requestedId, u2.login, u2.about, mr.status, mr.time,
+		COALESCE(u1.photo, ''), COALESCE(u2.photo, '') FROM
 		MeetRequest mr
 		JOIN Users u1 ON mr.requesterId = u1.id
 		JOIN Users u2 ON mr.requestedId = u2.id
@@ -60,7 +91,9 @@ const (
 		SELECT max(id) FROM MeetRequest
 	`
 	declineAll = `
-		UPDATE MeetRequest SET status = 'DECLINED' WHERE status = 'PENDING' AND age(now(), time) > $1 * interval '1 minute'
+		UPDATE MeetRequest SET status = 'DECLINED'
+		WHERE status = 'PENDING' AND age(now(), time) > $1 * interval '1 minute'
+		RETURNING id, requesterId, requestedId, time
 	`
 )
 
@@ -68,6 +101,7 @@ const (
 	ImpossibleID = -1 - iota
 	RequestExists
 	UserInaccessible
+	UserBlocked
 )
 
 func IsInvalidId(id int) bool {
@@ -81,7 +115,9 @@ type MeetRequestDAO interface {
 	GetOutcomePendingRequests(requesterId int) ([]*model.MeetRequest, error)
 	GetRequestById(id int) (*model.MeetRequest, error)
 	UpdateRequest(id int, requestedId int, status string) (int, error)
-	DeclineAll(timeoutMin int) error
+	// DeclineAll declines expired pending requests, saves events about it for
+	// requesters and returns the requests without logins and photos.
+	DeclineAll(timeoutMin int) ([]*model.MeetRequest, error)
 }
 
 type meetRequestDAO struct {
@@ -107,6 +143,8 @@ func (dao *meetRequestDAO) GetRequestById(id int) (*model.MeetRequest, error) {
 			&r.RequestedAbout,
 			&r.Status,
 			&r.Time,
+			&r.RequesterPhotoKey,
+			&r.RequestedPhotoKey,
 		)
 	if err != nil {
 		return nil, err
@@ -127,6 +165,15 @@ func (dao *meetRequestDAO) GetOutcomePendingRequests(requesterId int) ([]*model.
 }
 
 func (dao *meetRequestDAO) CreateRequest(requesterId int, requestedId int, requestTimeoutMin int, maxDistance float64) (int, error) {
+	var blockCnt int
+	if err := dao.db.QueryRow(countPairBlocks, requesterId, requestedId).Scan(&blockCnt); err != nil {
+		return ImpossibleID, err
+	}
+
+	if blockCnt > 0 {
+		return UserBlocked, nil
+	}
+
 	var requestCnt, countErr = dao.countPendingRequests(requesterId, requestedId)
 	if countErr != nil {
 		return ImpossibleID, countErr
@@ -182,13 +229,53 @@ func (dao *meetRequestDAO) UpdateRequest(id int, requestedId int, status string)
 	return int(rowsAffected), nil
 }
 
-func (dao *meetRequestDAO) DeclineAll(timeoutMin int) error {
-	var _, err = dao.db.Exec(declineAll, timeoutMin)
-	return err
+func (dao *meetRequestDAO) DeclineAll(timeoutMin int) ([]*model.MeetRequest, error) {
+	var tx, txErr = dao.db.Begin()
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	var result, err = scanDeclined(tx, timeoutMin)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// requesters get an event about each expired request in the same transaction
+	var byRequester = make([]*model.MeetRequest, len(result))
+	copy(byRequester, result)
+	sort.SliceStable(byRequester, func(i, j int) bool {
+		return byRequester[i].RequesterId < byRequester[j].RequesterId
+	})
+	for _, request := range byRequester {
+		if _, err := addEvent(tx, request.RequesterId, request.Id, model.StatusDeclined); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return result, tx.Commit()
+}
+
+func scanDeclined(tx *sql.Tx, timeoutMin int) ([]*model.MeetRequest, error) {
+	var rows, err = tx.Query(declineAll, timeoutMin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result = make([]*model.MeetRequest, 0)
+	for rows.Next() {
+		var request = &model.MeetRequest{Status: model.StatusDeclined}
+		if err := rows.Scan(&request.Id, &request.RequesterId, &request.RequestedId, &request.Time); err != nil {
+			return nil, err
+		}
+		result = append(result, request)
+	}
+	return result, rows.Err()
 }
 
 func (dao *meetRequestDAO) isAccessible(id1 int, id2 int, maxDistance float64, timeoutMin int) (bool, error) {
-	var rows, err = dao.db.Query(checkAccessibility, maxDistance, id1, id2, timeoutMin)
+	var rows, err = dao.db.Query(checkAccessibility, maxDistance, id1, id2, timeoutMin, model.MinFuzzRadius)
 	if err != nil {
 		return false, err
 	}
@@ -233,6 +320,8 @@ func (dao *meetRequestDAO) getRequestsTemplate(sql string, userId int) ([]*model
 			&request.RequestedAbout,
 			&request.Status,
 			&request.Time,
+			&request.RequesterPhotoKey,
+			&request.RequestedPhotoKey,
 		)
 		if err != nil {
 			return nil, err
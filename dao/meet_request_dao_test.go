@@ -35,8 +35,10 @@ func TestMeetRequestDAO_GetRequestById_Success(t *testing.T) {
 				"requestedAbout",
 				"status",
 				"time",
+				"requesterPhoto",
+				"requestedPhoto",
 			}).
-				AddRow(1, 2, "requesterLogin", "requesterAbout", 3, "requestedLogin", "requestedAbout", model.StatusPending, date),
+				AddRow(1, 2, "requesterLogin", "requesterAbout", 3, "requestedLogin", "requestedAbout", model.StatusPending, date, "", ""),
 		)
 
 	var request = &model.MeetRequest{
@@ -96,8 +98,9 @@ func TestMeetRequestDAO_GetRequests_Success(t *testing.T) {
 			sqlmock.NewRows([]string{
 				"id", "requesterId", "requesterLogin", "requesterAbout",
 				"requestedId", "requestedLogin", "requestedAbout", "status", "time",
+				"requesterPhoto", "requestedPhoto",
 			}).
-				AddRow(1, 2, "r_login", "r_about", 3, "d_login", "d_about", model.StatusPending, date),
+				AddRow(1, 2, "r_login", "r_about", 3, "d_login", "d_about", model.StatusPending, date, "", ""),
 		)
 
 	var request = &model.MeetRequest{
@@ -169,6 +172,8 @@ func TestMeetRequestDAO_CreateRequest(t *testing.T) {
 		requestTimeOutMin int
 		maxDistance       float64
 
+		blocked bool
+
 		countErrIsNil bool
 		countErrMsg   string
 		countRes      []driver.Value
@@ -273,6 +278,22 @@ func TestMeetRequestDAO_CreateRequest(t *testing.T) {
 
 			expectedId: ImpossibleID,
 		},
+		{
+			requesterId:       1,
+			requestedId:       2,
+			requestTimeOutMin: 10,
+			maxDistance:       10,
+			blocked:           true,
+			countErrIsNil:     true,
+			countRes:          []driver.Value{0},
+
+			accessErrIsNil: true,
+			accessRes:      []driver.Value{true},
+
+			createErrIsNil: true,
+
+			expectedId: UserBlocked,
+		},
 	}
 
 	for i, testCase := range cases {
@@ -282,6 +303,16 @@ func TestMeetRequestDAO_CreateRequest(t *testing.T) {
 			t.Fatal(err)
 		}
 
+		var blockCnt = 0
+		if testCase.blocked {
+			blockCnt = 1
+		}
+		mock.
+			ExpectQuery("SELECT count\\(\\*\\) FROM UserBlock").
+			WithArgs(testCase.requesterId, testCase.requestedId).
+			WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(blockCnt))
+
+		// for blocked users the rest of expectations is left unused
 		if testCase.countErrIsNil {
 			mock.
 				ExpectQuery("SELECT count").
@@ -298,12 +329,12 @@ func TestMeetRequestDAO_CreateRequest(t *testing.T) {
 			if testCase.accessErrIsNil {
 				mock.
 					ExpectQuery("SELECT").
-					WithArgs(testCase.maxDistance, testCase.requesterId, testCase.requestedId, testCase.requestTimeOutMin).
+					WithArgs(testCase.maxDistance, testCase.requesterId, testCase.requestedId, testCase.requestTimeOutMin, model.MinFuzzRadius).
 					WillReturnRows(sqlmock.NewRows([]string{"accessible"}).AddRow(testCase.accessRes...))
 			} else {
 				mock.
 					ExpectQuery("SELECT").
-					WithArgs(testCase.maxDistance, testCase.requesterId, testCase.requestedId, testCase.requestTimeOutMin).
+					WithArgs(testCase.maxDistance, testCase.requesterId, testCase.requestedId, testCase.requestTimeOutMin, model.MinFuzzRadius).
 					WillReturnError(errors.New(testCase.accessErrMsg))
 			}
 		}
@@ -352,6 +383,52 @@ func TestMeetRequestDAO_CreateRequest(t *testing.T) {
 	}
 }
 
+func TestMeetRequestDAO_CreateRequest_Ghost(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM UserBlock").WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(0))
+	mock.ExpectQuery("SELECT count").WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(0))
+	// no row comes for a ghost without an accepted request, however close it is
+	mock.
+		ExpectQuery("WHERE e.exact OR NOT COALESCE\\(pr.ghost, FALSE\\)").
+		WithArgs(10., 1, 2, 10, model.MinFuzzRadius).
+		WillReturnRows(sqlmock.NewRows([]string{"accessible"}))
+
+	var id, dbErr = NewMeetDAO(db).CreateRequest(1, 2, 10, 10)
+
+	assert.Nil(t, dbErr)
+	assert.Equal(t, UserInaccessible, id)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMeetRequestDAO_CreateRequest_Fuzzed(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM UserBlock").WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(0))
+	mock.ExpectQuery("SELECT count").WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(0))
+	// the distance is measured to the snapped point the requester sees among neighbours
+	mock.
+		ExpectQuery("SELECT ST_Distance\\(p1.point, v.point\\) < \\$1 .*GREATEST\\(pr.fuzzRadius, \\$5\\)").
+		WithArgs(10., 1, 2, 10, model.MinFuzzRadius).
+		WillReturnRows(sqlmock.NewRows([]string{"accessible"}).AddRow(false))
+
+	var id, dbErr = NewMeetDAO(db).CreateRequest(1, 2, 10, 10)
+
+	assert.Nil(t, dbErr)
+	assert.Equal(t, UserInaccessible, id)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
 func TestMeetRequestDAO_UpdateRequest(t *testing.T) {
 	var cases = []struct {
 		requestId    int
@@ -0,0 +1,63 @@
+package dao
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	createPasswordReset = `
+		INSERT INTO PasswordReset (userId, tokenHash, expires) VALUES ($1, $2, $3)
+	`
+	usePasswordReset = `
+		UPDATE PasswordReset SET used = TRUE
+		WHERE tokenHash = $1 AND NOT used AND expires > now()
+		RETURNING userId
+	`
+	deleteUserPasswordResets = `
+		DELETE FROM PasswordReset WHERE userId = $1
+	`
+	deleteStalePasswordResets = `
+		DELETE FROM PasswordReset WHERE used OR expires < now()
+	`
+)
+
+type PasswordResetDAO interface {
+	CreateReset(userId int, tokenHash []byte, expires time.Time) error
+	// UseReset marks the reset token as used and returns id of its owner.
+	// It returns sql.ErrNoRows if the token is unknown, used or expired.
+	UseReset(tokenHash []byte) (int, error)
+	DeleteUserResets(userId int) error
+	DeleteStaleResets() error
+}
+
+type dbPasswordResetDAO struct {
+	db *sql.DB
+}
+
+func NewDBPasswordResetDAO(db *sql.DB) PasswordResetDAO {
+	var result = new(dbPasswordResetDAO)
+	result.db = db
+	return result
+}
+
+func (dao *dbPasswordResetDAO) CreateReset(userId int, tokenHash []byte, expires time.Time) error {
+	var _, err = dao.db.Exec(createPasswordReset, userId, tokenHash, expires)
+	return err
+}
+
+func (dao *dbPasswordResetDAO) UseReset(tokenHash []byte) (int, error) {
+	var userId int
+	var err = dao.db.QueryRow(usePasswordReset, tokenHash).Scan(&userId)
+	return userId, err
+}
+
+func (dao *dbPasswordResetDAO) DeleteUserResets(userId int) error {
+	var _, err = dao.db.Exec(deleteUserPasswordResets, userId)
+	return err
+}
+
+func (dao *dbPasswordResetDAO) DeleteStaleResets() error {
+	var _, err = dao.db.Exec(deleteStalePasswordResets)
+	return err
+}
@@ -0,0 +1,91 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"testing"
+	"time"
+)
+
+func TestDbPasswordResetDAO_CreateReset(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var expires = time.Date(2017, 10, 17, 0, 0, 0, 0, time.UTC)
+	mock.
+		ExpectExec("INSERT INTO PasswordReset").
+		WithArgs(1, []byte("hash"), expires).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	var resetDAO = NewDBPasswordResetDAO(db)
+
+	assert.Nil(t, resetDAO.CreateReset(1, []byte("hash"), expires))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbPasswordResetDAO_UseReset_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("UPDATE PasswordReset SET used = TRUE").
+		WithArgs([]byte("hash")).
+		WillReturnRows(sqlmock.NewRows([]string{"userId"}).AddRow(1))
+
+	var resetDAO = NewDBPasswordResetDAO(db)
+	var userId, useErr = resetDAO.UseReset([]byte("hash"))
+
+	assert.Nil(t, useErr)
+	assert.Equal(t, 1, userId)
+}
+
+func TestDbPasswordResetDAO_UseReset_NotFound(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("UPDATE PasswordReset SET used = TRUE").
+		WithArgs([]byte("hash")).
+		WillReturnRows(sqlmock.NewRows([]string{"userId"}))
+
+	var resetDAO = NewDBPasswordResetDAO(db)
+	var _, useErr = resetDAO.UseReset([]byte("hash"))
+
+	assert.Equal(t, sql.ErrNoRows, useErr)
+}
+
+func TestDbPasswordResetDAO_Delete(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("DELETE FROM PasswordReset WHERE userId").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.
+		ExpectExec("DELETE FROM PasswordReset WHERE used").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	var resetDAO = NewDBPasswordResetDAO(db)
+
+	assert.Nil(t, resetDAO.DeleteUserResets(1))
+	assert.Nil(t, resetDAO.DeleteStaleResets())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
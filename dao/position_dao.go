@@ -3,18 +3,123 @@ package dao
 import (
 	"database/sql"
 	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/lib/pq"
 	"time"
 )
 
 const (
-	savePosition        = "INSERT INTO Position (userId, point) VALUES ($1, ST_MakePoint($2, $3))"
-	getLastPositionById = "SELECT id, userId, ST_X(p.point) x, ST_Y(p.point) y, time FROM Position p " +
-		"WHERE p.userId = $1 ORDER BY time DESC LIMIT 1"
+	savePosition = `
+		INSERT INTO Position (userId, point, accuracy, altitude, speed, clientTime)
+		VALUES ($1, ST_SetSRID(ST_MakePoint($2, $3), 4326)::GEOGRAPHY, $4, $5, $6, $7)
+		ON CONFLICT DO NOTHING
+	`
+	// positions are copied to a temporary table first as COPY can not skip duplicates
+	createPositionBatch = `
+		CREATE TEMP TABLE PositionBatch (
+			idx        INTEGER,
+			latitude   DOUBLE PRECISION,
+			longitude  DOUBLE PRECISION,
+			accuracy   DOUBLE PRECISION,
+			altitude   DOUBLE PRECISION,
+			speed      DOUBLE PRECISION,
+			clientTime TIMESTAMP
+		) ON COMMIT DROP
+	`
+	// positions the user ($1) already has with the same client time are skipped,
+	// indices of saved ones are returned
+	insertPositionBatch = `
+		WITH inserted AS (
+			INSERT INTO Position (userId, point, accuracy, altitude, speed, clientTime)
+			SELECT $1, ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)::GEOGRAPHY,
+				accuracy, altitude, speed, clientTime
+			FROM PositionBatch ORDER BY idx
+			ON CONFLICT DO NOTHING
+			RETURNING clientTime
+		)
+		SELECT b.idx FROM PositionBatch b JOIN inserted i ON i.clientTime = b.clientTime
+	`
+	// the user ($1) sees own and accepted counterparts' positions exactly, positions
+	// of others are snapped to the grid of their fuzz radius raised to at least $3
+	// without accuracy, altitude and speed, positions of ghosts are not seen at all;
+	// metres are converted to degrees of latitude, the longitude step is widened by
+	// 1 / cos of the snapped latitude (capped near the poles) to keep cells square;
+	// positions are ordered by the time they were taken, which is the client time of
+	// positions queued offline and uploaded later, capped by the save time so that
+	// a device clock running ahead does not make a position the latest one
+	// (LEAST skips NULL client time)
+	getVisiblePosition = `
+		SELECT p.id, p.userId, ST_Y(v.point) latitude, ST_X(v.point) longitude,
+			CASE WHEN e.exact THEN p.accuracy END accuracy,
+			CASE WHEN e.exact THEN p.altitude END altitude,
+			CASE WHEN e.exact THEN p.speed END speed,
+			p.clientTime, p.time
+		FROM Position p
+			LEFT JOIN Privacy pr ON pr.userId = p.userId
+			CROSS JOIN LATERAL (
+				SELECT p.userId = $1 OR EXISTS (
+					SELECT 1 FROM MeetRequest r
+					WHERE r.status = 'ACCEPTED' AND (
+						(r.requesterId = $1 AND r.requestedId = p.userId) OR
+						(r.requesterId = p.userId AND r.requestedId = $1)
+					)
+				) exact
+			) e
+			CROSS JOIN LATERAL (
+				SELECT GREATEST(pr.fuzzRadius, $3) / 111320.0 step
+			) g
+			CROSS JOIN LATERAL (
+				SELECT CASE WHEN e.exact THEN p.point::GEOMETRY
+					ELSE ST_SnapToGrid(
+						p.point::GEOMETRY, 0, 0,
+						g.step / GREATEST(cos(radians(round(ST_Y(p.point::GEOMETRY) / g.step) * g.step)), 0.01),
+						g.step
+					) END point
+			) v
+		WHERE p.userId = $2 AND (p.userId = $1 OR NOT COALESCE(pr.ghost, FALSE))
+		ORDER BY LEAST(p.clientTime, p.time) DESC LIMIT 1
+	`
+	getPositionsById = `
+		SELECT id, userId, ST_Y(point::GEOMETRY) latitude, ST_X(point::GEOMETRY) longitude,
+			accuracy, altitude, speed, clientTime, time
+		FROM Position WHERE userId = $1 ORDER BY LEAST(clientTime, time)
+	`
+	getLastPositionsById = `
+		SELECT id, userId, ST_Y(point::GEOMETRY) latitude, ST_X(point::GEOMETRY) longitude,
+			accuracy, altitude, speed, clientTime, time
+		FROM Position WHERE userId = $1 ORDER BY LEAST(clientTime, time) DESC LIMIT $2
+	`
 )
 
+// unquoted identifiers of the temporary table are folded to lower case
+var (
+	positionBatchTable   = "positionbatch"
+	positionBatchColumns = []string{
+		"idx", "latitude", "longitude", "accuracy", "altitude", "speed", "clienttime",
+	}
+)
+
+// rowScanner is either *sql.Row or *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
 type PositionDAO interface {
+	// Save saves the position unless the user already has one with the same client time.
 	Save(position *model.Position) error
-	GetUserPositionById(id int) (*model.Position, error)
+	// SaveBatch saves positions of the user in a single transaction. Positions must
+	// have distinct client times, ones the user already has a position with the same
+	// client time are skipped. It returns whether each of the positions was saved.
+	SaveBatch(userId int, positions []*model.Position) ([]bool, error)
+	// GetVisiblePosition returns the latest position of the user as the viewer may see
+	// it according to privacy settings of the user, see model.Privacy.
+	// It returns sql.ErrNoRows if there is no such position or the user is a ghost.
+	GetVisiblePosition(viewerId int, userId int) (*model.Position, error)
+	// GetUserPositions returns the whole exact position history of the user, oldest first.
+	// It is only for the user itself.
+	GetUserPositions(id int) ([]*model.Position, error)
+	// GetLastUserPositions returns at most limit latest exact positions of the user, newest first.
+	// It is only for moderators.
+	GetLastUserPositions(id int, limit int) ([]*model.Position, error)
 }
 
 type dbPositionDAO struct {
@@ -28,20 +133,157 @@ func NewDBPositionDAO(db *sql.DB) PositionDAO {
 }
 
 func (dao *dbPositionDAO) Save(position *model.Position) error {
-	_, err := dao.db.Exec(savePosition, position.UserId, position.Point.X, position.Point.Y)
+	_, err := dao.db.Exec(
+		savePosition,
+		position.UserId,
+		position.Point.Longitude,
+		position.Point.Latitude,
+		position.Accuracy,
+		position.Altitude,
+		position.Speed,
+		getNullableTime(position.ClientTime),
+	)
 	return err
 }
 
-func (dao *dbPositionDAO) GetUserPositionById(id int) (*model.Position, error) {
+func (dao *dbPositionDAO) SaveBatch(userId int, positions []*model.Position) ([]bool, error) {
+	var tx, txErr = dao.db.Begin()
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	var saved, err = savePositionBatch(tx, userId, positions)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func (dao *dbPositionDAO) GetVisiblePosition(viewerId int, userId int) (*model.Position, error) {
+	return scanPosition(dao.db.QueryRow(getVisiblePosition, viewerId, userId, model.MinFuzzRadius))
+}
+
+func (dao *dbPositionDAO) GetUserPositions(id int) ([]*model.Position, error) {
+	return dao.getPositions(getPositionsById, id)
+}
+
+func (dao *dbPositionDAO) GetLastUserPositions(id int, limit int) ([]*model.Position, error) {
+	return dao.getPositions(getLastPositionsById, id, limit)
+}
+
+func (dao *dbPositionDAO) getPositions(query string, args ...interface{}) ([]*model.Position, error) {
+	var rows, err = dao.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result = make([]*model.Position, 0)
+	for rows.Next() {
+		var position, err = scanPosition(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, position)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func savePositionBatch(tx *sql.Tx, userId int, positions []*model.Position) ([]bool, error) {
+	if _, err := tx.Exec(createPositionBatch); err != nil {
+		return nil, err
+	}
+
+	var stmt, err = tx.Prepare(pq.CopyIn(positionBatchTable, positionBatchColumns...))
+	if err != nil {
+		return nil, err
+	}
+	for i, position := range positions {
+		_, err = stmt.Exec(
+			i,
+			position.Point.Latitude,
+			position.Point.Longitude,
+			position.Accuracy,
+			position.Altitude,
+			position.Speed,
+			getNullableTime(position.ClientTime),
+		)
+		if err != nil {
+			stmt.Close()
+			return nil, err
+		}
+	}
+	// exec without arguments flushes the buffered rows
+	if _, err = stmt.Exec(); err != nil {
+		stmt.Close()
+		return nil, err
+	}
+	if err = stmt.Close(); err != nil {
+		return nil, err
+	}
+
+	var rows, queryErr = tx.Query(insertPositionBatch, userId)
+	if queryErr != nil {
+		return nil, queryErr
+	}
+	defer rows.Close()
+
+	var saved = make([]bool, len(positions))
+	for rows.Next() {
+		var idx int
+		if err = rows.Scan(&idx); err != nil {
+			return nil, err
+		}
+		saved[idx] = true
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func getNullableTime(quotedTime *model.QuotedTime) *time.Time {
+	if quotedTime == nil {
+		return nil
+	}
+	var result = time.Time(*quotedTime)
+	return &result
+}
+
+func scanPosition(row rowScanner) (*model.Position, error) {
 	var position = new(model.Position)
+	var clientTime pq.NullTime
 	var posTime time.Time
-	var err = dao.db.QueryRow(getLastPositionById, id).Scan(
-		&position.Id, &position.UserId, &position.Point.X, &position.Point.Y, &posTime,
+	var err = row.Scan(
+		&position.Id,
+		&position.UserId,
+		&position.Point.Latitude,
+		&position.Point.Longitude,
+		&position.Accuracy,
+		&position.Altitude,
+		&position.Speed,
+		&clientTime,
+		&posTime,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	position.ClientTime = getQuotedTime(clientTime)
 	position.Time = model.QuotedTime(posTime)
 	return position, nil
 }
@@ -9,6 +9,10 @@ import (
 	"time"
 )
 
+var positionColumns = []string{
+	"id", "userId", "latitude", "longitude", "accuracy", "altitude", "speed", "clientTime", "time",
+}
+
 func TestDbPositionDAO_Save_Success(t *testing.T) {
 	var db, mock, err = sqlmock.New()
 
@@ -19,10 +23,10 @@ func TestDbPositionDAO_Save_Success(t *testing.T) {
 
 	mock.
 		ExpectExec("INSERT INTO Position").
-		WithArgs(100, 10., 20.).
+		WithArgs(100, 10., 20., nil, nil, nil, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	var position = &model.Position{UserId: 100, Point: model.Point{X: 10., Y: 20.}}
+	var position = &model.Position{UserId: 100, Point: model.Point{Latitude: 20., Longitude: 10.}}
 
 	var positionDAO = NewDBPositionDAO(db)
 	var saveErr = positionDAO.Save(position)
@@ -40,10 +44,10 @@ func TestDbPositionDAO_Save_DuplicateLogin(t *testing.T) {
 
 	mock.
 		ExpectExec("INSERT INTO Position").
-		WithArgs(100, 10., 20.).
+		WithArgs(100, 10., 20., nil, nil, nil, nil).
 		WillReturnError(errors.New("Duplicate id"))
 
-	var position = &model.Position{UserId: 100, Point: model.Point{X: 10., Y: 20.}}
+	var position = &model.Position{UserId: 100, Point: model.Point{Latitude: 20., Longitude: 10.}}
 
 	var positionDAO = NewDBPositionDAO(db)
 	var saveErr = positionDAO.Save(position)
@@ -61,18 +65,20 @@ func TestDbPositionDAO_Get_Success(t *testing.T) {
 	defer db.Close()
 
 	var date = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
-	var rows = sqlmock.NewRows([]string{"id", "userId", "x", "y", "time"}).
-		AddRow(1, 100, 10., 20., date)
+	var rows = sqlmock.NewRows(positionColumns).
+		AddRow(1, 100, 20., 10., nil, nil, nil, nil, date)
 
 	mock.
-		ExpectQuery("SELECT id, userId").
-		WithArgs(1).
+		ExpectQuery("SELECT p.id, p.userId").
+		WithArgs(2, 100, model.MinFuzzRadius).
 		WillReturnRows(rows)
 
-	var position = &model.Position{Id: 1, UserId: 100, Point: model.Point{X: 10., Y: 20.}, Time: model.QuotedTime(date)}
+	var position = &model.Position{
+		Id: 1, UserId: 100, Point: model.Point{Latitude: 20., Longitude: 10.}, Time: model.QuotedTime(date),
+	}
 
 	var positionDAO = NewDBPositionDAO(db)
-	var dbPosition, userErr = positionDAO.GetUserPositionById(1)
+	var dbPosition, userErr = positionDAO.GetVisiblePosition(2, 100)
 
 	assert.Nil(t, userErr)
 	assert.Equal(t, position, dbPosition)
@@ -88,12 +94,243 @@ func TestDbPositionDAO_Get_NotFound(t *testing.T) {
 
 	mock.
 		ExpectQuery("SELECT").
-		WithArgs(1).
+		WithArgs(2, 1, model.MinFuzzRadius).
 		WillReturnError(errors.New("position not found"))
 
 	var positionDAO = NewDBPositionDAO(db)
-	var _, positionErr = positionDAO.GetUserPositionById(1)
+	var _, positionErr = positionDAO.GetVisiblePosition(2, 1)
 
 	assert.NotNil(t, positionErr)
 	assert.Equal(t, "position not found", positionErr.Error())
 }
+
+func TestDbPositionDAO_Get_NoPrivacyStranger(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var date = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
+	var rows = sqlmock.NewRows(positionColumns).
+		AddRow(1, 100, 20.001, 10.001, nil, nil, nil, nil, date)
+
+	// a user without Privacy row is neither exact for strangers nor snapped to a zero grid
+	mock.
+		ExpectQuery(`SELECT p.userId = \$1 OR EXISTS .*GREATEST\(pr.fuzzRadius, \$3\)`).
+		WithArgs(2, 100, model.MinFuzzRadius).
+		WillReturnRows(rows)
+
+	var positionDAO = NewDBPositionDAO(db)
+	var position, positionErr = positionDAO.GetVisiblePosition(2, 100)
+
+	assert.Nil(t, positionErr)
+	assert.Nil(t, position.Accuracy)
+	assert.Nil(t, position.Altitude)
+	assert.Nil(t, position.Speed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbPositionDAO_GetUserPositions_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var date1 = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
+	var date2 = time.Date(2003, 10, 18, 0, 0, 0, 0, time.UTC)
+	var rows = sqlmock.NewRows(positionColumns).
+		AddRow(1, 100, 20., 10., nil, nil, nil, nil, date1).
+		AddRow(2, 100, 21., 11., nil, nil, nil, nil, date2)
+
+	mock.
+		ExpectQuery("SELECT id, userId.*ORDER BY LEAST\\(clientTime, time\\)$").
+		WithArgs(100).
+		WillReturnRows(rows)
+
+	var positionDAO = NewDBPositionDAO(db)
+	var positions, positionsErr = positionDAO.GetUserPositions(100)
+
+	assert.Nil(t, positionsErr)
+	assert.Equal(
+		t,
+		[]*model.Position{
+			{Id: 1, UserId: 100, Point: model.Point{Latitude: 20., Longitude: 10.}, Time: model.QuotedTime(date1)},
+			{Id: 2, UserId: 100, Point: model.Point{Latitude: 21., Longitude: 11.}, Time: model.QuotedTime(date2)},
+		},
+		positions,
+	)
+}
+
+func TestDbPositionDAO_GetUserPositions_DBError(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT id, userId").
+		WithArgs(100).
+		WillReturnError(errors.New("failed to select"))
+
+	var positionDAO = NewDBPositionDAO(db)
+	var _, positionsErr = positionDAO.GetUserPositions(100)
+
+	assert.NotNil(t, positionsErr)
+	assert.Equal(t, "failed to select", positionsErr.Error())
+}
+
+func TestDbPositionDAO_GetLastUserPositions_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var date = time.Date(2003, 10, 18, 0, 0, 0, 0, time.UTC)
+	var rows = sqlmock.NewRows(positionColumns).
+		AddRow(2, 100, 21., 11., nil, nil, nil, nil, date)
+
+	mock.
+		ExpectQuery("SELECT id, userId.*ORDER BY LEAST\\(clientTime, time\\) DESC LIMIT").
+		WithArgs(100, 1).
+		WillReturnRows(rows)
+
+	var positionDAO = NewDBPositionDAO(db)
+	var positions, positionsErr = positionDAO.GetLastUserPositions(100, 1)
+
+	assert.Nil(t, positionsErr)
+	assert.Equal(
+		t,
+		[]*model.Position{
+			{Id: 2, UserId: 100, Point: model.Point{Latitude: 21., Longitude: 11.}, Time: model.QuotedTime(date)},
+		},
+		positions,
+	)
+}
+
+func TestDbPositionDAO_SaveBatch_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var date1 = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
+	var date2 = time.Date(2003, 10, 18, 0, 0, 0, 0, time.UTC)
+	var accuracy = 15.
+
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TEMP TABLE PositionBatch").WillReturnResult(sqlmock.NewResult(0, 0))
+	var copyIn = mock.ExpectPrepare("COPY \"positionbatch\"")
+	copyIn.ExpectExec().WithArgs(0, 20., 10., accuracy, nil, nil, date1).WillReturnResult(sqlmock.NewResult(0, 1))
+	copyIn.ExpectExec().WithArgs(1, 21., 11., nil, nil, nil, date2).WillReturnResult(sqlmock.NewResult(0, 1))
+	copyIn.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectQuery("WITH inserted AS \\(\\s*INSERT INTO Position").
+		WithArgs(100).
+		WillReturnRows(sqlmock.NewRows([]string{"idx"}).AddRow(1))
+	mock.ExpectCommit()
+
+	var quoted1, quoted2 = model.QuotedTime(date1), model.QuotedTime(date2)
+	var positions = []*model.Position{
+		{Point: model.Point{Latitude: 20., Longitude: 10.}, Accuracy: &accuracy, ClientTime: &quoted1},
+		{Point: model.Point{Latitude: 21., Longitude: 11.}, ClientTime: &quoted2},
+	}
+
+	var positionDAO = NewDBPositionDAO(db)
+	var saved, saveErr = positionDAO.SaveBatch(100, positions)
+
+	assert.Nil(t, saveErr)
+	assert.Equal(t, []bool{false, true}, saved)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbPositionDAO_Get_OlderBatchAfterLive(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var queued = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
+	var live = time.Date(2003, 10, 17, 1, 0, 0, 0, time.UTC)
+	var uploaded = time.Date(2003, 10, 17, 2, 0, 0, 0, time.UTC)
+
+	mock.
+		ExpectExec("INSERT INTO Position").
+		WithArgs(100, 10., 20., nil, nil, nil, live).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TEMP TABLE PositionBatch").WillReturnResult(sqlmock.NewResult(0, 0))
+	var copyIn = mock.ExpectPrepare("COPY \"positionbatch\"")
+	copyIn.ExpectExec().WithArgs(0, 30., 40., nil, nil, nil, queued).WillReturnResult(sqlmock.NewResult(0, 1))
+	copyIn.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectQuery("WITH inserted AS \\(\\s*INSERT INTO Position").
+		WithArgs(100).
+		WillReturnRows(sqlmock.NewRows([]string{"idx"}).AddRow(0))
+	mock.ExpectCommit()
+	// the batch is saved later, but the live position was taken later
+	mock.
+		ExpectQuery("ORDER BY LEAST\\(p.clientTime, p.time\\) DESC LIMIT 1").
+		WithArgs(100, 100, model.MinFuzzRadius).
+		WillReturnRows(sqlmock.NewRows(positionColumns).AddRow(1, 100, 20., 10., nil, nil, nil, live, uploaded))
+
+	var liveTime, queuedTime = model.QuotedTime(live), model.QuotedTime(queued)
+	var positionDAO = NewDBPositionDAO(db)
+	assert.Nil(t, positionDAO.Save(&model.Position{
+		UserId: 100, Point: model.Point{Latitude: 20., Longitude: 10.}, ClientTime: &liveTime,
+	}))
+	var _, saveErr = positionDAO.SaveBatch(100, []*model.Position{
+		{Point: model.Point{Latitude: 30., Longitude: 40.}, ClientTime: &queuedTime},
+	})
+	assert.Nil(t, saveErr)
+
+	var position, positionErr = positionDAO.GetVisiblePosition(100, 100)
+
+	assert.Nil(t, positionErr)
+	assert.Equal(t, model.Point{Latitude: 20., Longitude: 10.}, position.Point)
+	assert.Equal(t, &liveTime, position.ClientTime)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbPositionDAO_SaveBatch_CopyError(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var date = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TEMP TABLE PositionBatch").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectPrepare("COPY \"positionbatch\"").
+		ExpectExec().
+		WithArgs(0, 20., 10., nil, nil, nil, date).
+		WillReturnError(errors.New("failed to copy"))
+	mock.ExpectRollback()
+
+	var quoted = model.QuotedTime(date)
+	var positions = []*model.Position{
+		{Point: model.Point{Latitude: 20., Longitude: 10.}, ClientTime: &quoted},
+	}
+
+	var positionDAO = NewDBPositionDAO(db)
+	var _, saveErr = positionDAO.SaveBatch(100, positions)
+
+	assert.NotNil(t, saveErr)
+	assert.Equal(t, "failed to copy", saveErr.Error())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,55 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/model"
+)
+
+const (
+	getPrivacy = `SELECT ghost, fuzzRadius FROM Privacy WHERE userId = $1`
+	setPrivacy = `
+		INSERT INTO Privacy (userId, ghost, fuzzRadius) VALUES ($1, $2, $3)
+		ON CONFLICT (userId) DO UPDATE SET ghost = EXCLUDED.ghost, fuzzRadius = EXCLUDED.fuzzRadius
+	`
+	deleteUserPrivacy = `DELETE FROM Privacy WHERE userId = $1`
+)
+
+// PrivacyDAO keeps privacy settings of users. The settings are applied by
+// readers of positions, see PositionDAO.GetVisiblePosition and UserDAO.GetNeighbourUsers.
+type PrivacyDAO interface {
+	// GetPrivacy returns default settings if the user has never changed them.
+	// Fuzz radius saved before model.MinFuzzRadius was introduced is raised
+	// to it, as readers of positions do.
+	GetPrivacy(userId int) (*model.Privacy, error)
+	SetPrivacy(userId int, privacy *model.Privacy) error
+}
+
+type dbPrivacyDAO struct {
+	db *sql.DB
+}
+
+func NewDBPrivacyDAO(db *sql.DB) PrivacyDAO {
+	var result = new(dbPrivacyDAO)
+	result.db = db
+	return result
+}
+
+func (dao *dbPrivacyDAO) GetPrivacy(userId int) (*model.Privacy, error) {
+	var privacy = new(model.Privacy)
+	var err = dao.db.QueryRow(getPrivacy, userId).Scan(&privacy.Ghost, &privacy.FuzzRadius)
+	if err == sql.ErrNoRows {
+		return &model.Privacy{FuzzRadius: model.MinFuzzRadius}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if privacy.FuzzRadius < model.MinFuzzRadius {
+		privacy.FuzzRadius = model.MinFuzzRadius
+	}
+	return privacy, nil
+}
+
+func (dao *dbPrivacyDAO) SetPrivacy(userId int, privacy *model.Privacy) error {
+	var _, err = dao.db.Exec(setPrivacy, userId, privacy.Ghost, privacy.FuzzRadius)
+	return err
+}
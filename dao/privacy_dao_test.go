@@ -0,0 +1,68 @@
+package dao
+
+import (
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"testing"
+)
+
+func TestDbPrivacyDAO_GetPrivacy_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT ghost, fuzzRadius FROM Privacy").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"ghost", "fuzzRadius"}).AddRow(true, 500))
+
+	var privacyDAO = NewDBPrivacyDAO(db)
+	var privacy, dbErr = privacyDAO.GetPrivacy(1)
+
+	assert.Nil(t, dbErr)
+	assert.Equal(t, &model.Privacy{Ghost: true, FuzzRadius: 500}, privacy)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbPrivacyDAO_GetPrivacy_Default(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT ghost, fuzzRadius FROM Privacy").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"ghost", "fuzzRadius"}))
+
+	var privacyDAO = NewDBPrivacyDAO(db)
+	var privacy, dbErr = privacyDAO.GetPrivacy(1)
+
+	assert.Nil(t, dbErr)
+	assert.Equal(t, &model.Privacy{FuzzRadius: model.MinFuzzRadius}, privacy)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbPrivacyDAO_SetPrivacy_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("INSERT INTO Privacy").
+		WithArgs(1, false, 500).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var privacyDAO = NewDBPrivacyDAO(db)
+	assert.Nil(t, privacyDAO.SetPrivacy(1, &model.Privacy{FuzzRadius: 500}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,119 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/model"
+	"time"
+)
+
+const (
+	// the login of the reported user is kept in case the account is deleted
+	createReport = `
+		INSERT INTO Report (reporterId, reportedId, reportedLogin, requestId, reason, text)
+		SELECT $1, $2, login, $3, $4, $5 FROM Users WHERE id = $2
+		RETURNING id, reportedLogin
+	`
+	getOpenReports = `
+		SELECT id, COALESCE(reporterId, 0), COALESCE(reportedId, 0), reportedLogin, requestId, reason, text, status, time
+		FROM Report
+		WHERE status = 'open'
+		ORDER BY time
+		LIMIT $1 OFFSET $2
+	`
+	getReportById = `
+		SELECT id, COALESCE(reporterId, 0), COALESCE(reportedId, 0), reportedLogin, requestId, reason, text, status, time
+		FROM Report WHERE id = $1
+	`
+	resolveReport = `
+		UPDATE Report SET status = 'resolved', resolvedBy = $2, action = $3, comment = $4, resolvedAt = now()
+		WHERE id = $1 AND status = 'open'
+	`
+)
+
+// ReportDAO keeps reports. Reports outlive accounts of both users, ids of
+// deleted users are returned as 0.
+type ReportDAO interface {
+	// CreateReport fills ReportedLogin of the report and returns its id.
+	// It returns sql.ErrNoRows if there is no reported user.
+	CreateReport(report *model.Report) (int, error)
+	// GetOpenReports returns unresolved reports, the oldest first.
+	GetOpenReports(limit int, offset int) ([]*model.Report, error)
+	// GetReportById returns sql.ErrNoRows if there is no such report.
+	GetReportById(id int) (*model.Report, error)
+	// ResolveReport returns false if the report is not open.
+	ResolveReport(id int, moderatorId int, action string, comment string) (bool, error)
+}
+
+type dbReportDAO struct {
+	db *sql.DB
+}
+
+func NewDBReportDAO(db *sql.DB) ReportDAO {
+	var result = new(dbReportDAO)
+	result.db = db
+	return result
+}
+
+func (dao *dbReportDAO) CreateReport(report *model.Report) (int, error) {
+	var id int
+	var err = dao.db.QueryRow(
+		createReport, report.ReporterId, report.ReportedId, report.RequestId, report.Reason, report.Text,
+	).Scan(&id, &report.ReportedLogin)
+	return id, err
+}
+
+func (dao *dbReportDAO) GetOpenReports(limit int, offset int) ([]*model.Report, error) {
+	var rows, err = dao.db.Query(getOpenReports, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result = make([]*model.Report, 0)
+	for rows.Next() {
+		var report, scanErr = scanReport(rows)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		result = append(result, report)
+	}
+	return result, rows.Err()
+}
+
+func (dao *dbReportDAO) GetReportById(id int) (*model.Report, error) {
+	return scanReport(dao.db.QueryRow(getReportById, id))
+}
+
+func (dao *dbReportDAO) ResolveReport(id int, moderatorId int, action string, comment string) (bool, error) {
+	return execAffected(dao.db, resolveReport, id, moderatorId, action, comment)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReport(row scanner) (*model.Report, error) {
+	var report = new(model.Report)
+	var requestId sql.NullInt64
+	var reportTime time.Time
+	var err = row.Scan(
+		&report.Id,
+		&report.ReporterId,
+		&report.ReportedId,
+		&report.ReportedLogin,
+		&requestId,
+		&report.Reason,
+		&report.Text,
+		&report.Status,
+		&reportTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+	report.Time = model.QuotedTime(reportTime)
+	if requestId.Valid {
+		var id = int(requestId.Int64)
+		report.RequestId = &id
+	}
+	return report, nil
+}
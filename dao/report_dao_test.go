@@ -0,0 +1,114 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"testing"
+	"time"
+)
+
+func TestDbReportDAO_CreateReport(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var requestId = 10
+	mock.
+		ExpectQuery("INSERT INTO Report").
+		WithArgs(1, 2, &requestId, model.ReasonSpam, "text").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "reportedLogin"}).AddRow(5, "login2"))
+
+	var reportDAO = NewDBReportDAO(db)
+	var report = &model.Report{
+		ReporterId: 1, ReportedId: 2, RequestId: &requestId, Reason: model.ReasonSpam, Text: "text",
+	}
+	var id, createErr = reportDAO.CreateReport(report)
+
+	assert.Nil(t, createErr)
+	assert.Equal(t, 5, id)
+	assert.Equal(t, "login2", report.ReportedLogin)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbReportDAO_GetOpenReports(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var date = time.Date(2017, 10, 17, 0, 0, 0, 0, time.UTC)
+	mock.
+		ExpectQuery("SELECT id, COALESCE\\(reporterId, 0\\), COALESCE\\(reportedId, 0\\), reportedLogin, requestId").
+		WithArgs(20, 0).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "reporterId", "reportedId", "reportedLogin", "requestId", "reason", "text", "status", "time"}).
+				AddRow(1, 1, 2, "login2", nil, model.ReasonFake, "", model.ReportOpen, date).
+				AddRow(2, 0, 2, "login2", 10, model.ReasonSpam, "text", model.ReportOpen, date),
+		)
+
+	var reportDAO = NewDBReportDAO(db)
+	var reports, getErr = reportDAO.GetOpenReports(20, 0)
+
+	var requestId = 10
+	assert.Nil(t, getErr)
+	assert.Equal(
+		t,
+		[]*model.Report{
+			{
+				Id: 1, ReporterId: 1, ReportedId: 2, ReportedLogin: "login2", Reason: model.ReasonFake,
+				Status: model.ReportOpen, Time: model.QuotedTime(date),
+			},
+			{
+				Id: 2, ReporterId: 0, ReportedId: 2, ReportedLogin: "login2", RequestId: &requestId, Reason: model.ReasonSpam, Text: "text",
+				Status: model.ReportOpen, Time: model.QuotedTime(date),
+			},
+		},
+		reports,
+	)
+}
+
+func TestDbReportDAO_GetReportById_NotFound(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT id, COALESCE").
+		WithArgs(1).
+		WillReturnError(sql.ErrNoRows)
+
+	var reportDAO = NewDBReportDAO(db)
+	var _, getErr = reportDAO.GetReportById(1)
+
+	assert.Equal(t, sql.ErrNoRows, getErr)
+}
+
+func TestDbReportDAO_ResolveReport(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE Report SET status = 'resolved'").
+		WithArgs(1, 100, model.ActionWarn, "comment").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var reportDAO = NewDBReportDAO(db)
+	var resolved, resolveErr = reportDAO.ResolveReport(1, 100, model.ActionWarn, "comment")
+
+	assert.Nil(t, resolveErr)
+	assert.True(t, resolved)
+}
@@ -0,0 +1,108 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/model"
+	"time"
+)
+
+const (
+	createSession = `
+		INSERT INTO Session (userId, refreshHash, expires) VALUES ($1, $2, $3) RETURNING id
+	`
+	getSessionById = `
+		SELECT id, userId, refreshHash, expires, revoked FROM Session WHERE id = $1
+	`
+	rotateSession = `
+		UPDATE Session SET refreshHash = $1, expires = $2
+		WHERE id = $3 AND refreshHash = $4 AND NOT revoked AND expires > now()
+	`
+	checkSessionActive = `
+		SELECT count(*) cnt FROM Session WHERE id = $1 AND NOT revoked AND expires > now()
+	`
+	revokeSession = `
+		UPDATE Session SET revoked = TRUE WHERE id = $1
+	`
+	revokeUserSessions = `
+		UPDATE Session SET revoked = TRUE WHERE userId = $1
+	`
+	deleteStaleSessions = `
+		DELETE FROM Session WHERE revoked OR expires < now()
+	`
+)
+
+type SessionDAO interface {
+	CreateSession(userId int, refreshHash []byte, expires time.Time) (int, error)
+	GetSessionById(id int) (*model.Session, error)
+	// RotateSession replaces refresh hash of an active session only if it still
+	// equals oldHash. It returns false if the session was not updated.
+	RotateSession(id int, oldHash []byte, newHash []byte, expires time.Time) (bool, error)
+	IsActive(id int) (bool, error)
+	RevokeSession(id int) error
+	RevokeUserSessions(userId int) error
+	DeleteStaleSessions() error
+}
+
+type dbSessionDAO struct {
+	db *sql.DB
+}
+
+func NewDBSessionDAO(db *sql.DB) SessionDAO {
+	var result = new(dbSessionDAO)
+	result.db = db
+	return result
+}
+
+func (dao *dbSessionDAO) CreateSession(userId int, refreshHash []byte, expires time.Time) (int, error) {
+	var id int
+	var err = dao.db.QueryRow(createSession, userId, refreshHash, expires).Scan(&id)
+	return id, err
+}
+
+func (dao *dbSessionDAO) GetSessionById(id int) (*model.Session, error) {
+	var session = new(model.Session)
+	var err = dao.db.QueryRow(getSessionById, id).Scan(
+		&session.Id, &session.UserId, &session.RefreshHash, &session.Expires, &session.Revoked,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (dao *dbSessionDAO) RotateSession(id int, oldHash []byte, newHash []byte, expires time.Time) (bool, error) {
+	var result, err = dao.db.Exec(rotateSession, newHash, expires, id, oldHash)
+	if err != nil {
+		return false, err
+	}
+
+	var rowsAffected, rowsErr = result.RowsAffected()
+	if rowsErr != nil {
+		return false, rowsErr
+	}
+	return rowsAffected == 1, nil
+}
+
+func (dao *dbSessionDAO) IsActive(id int) (bool, error) {
+	var cnt int
+	var err = dao.db.QueryRow(checkSessionActive, id).Scan(&cnt)
+	if err != nil {
+		return false, err
+	}
+	return cnt > 0, nil
+}
+
+func (dao *dbSessionDAO) RevokeSession(id int) error {
+	var _, err = dao.db.Exec(revokeSession, id)
+	return err
+}
+
+func (dao *dbSessionDAO) RevokeUserSessions(userId int) error {
+	var _, err = dao.db.Exec(revokeUserSessions, userId)
+	return err
+}
+
+func (dao *dbSessionDAO) DeleteStaleSessions() error {
+	var _, err = dao.db.Exec(deleteStaleSessions)
+	return err
+}
@@ -0,0 +1,181 @@
+package dao
+
+import (
+	"errors"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"testing"
+	"time"
+)
+
+func TestDbSessionDAO_CreateSession_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var expires = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
+	mock.
+		ExpectQuery("INSERT INTO Session").
+		WithArgs(1, []byte("hash"), expires).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+
+	var sessionDAO = NewDBSessionDAO(db)
+	var id, createErr = sessionDAO.CreateSession(1, []byte("hash"), expires)
+
+	assert.Nil(t, createErr)
+	assert.Equal(t, 10, id)
+}
+
+func TestDbSessionDAO_CreateSession_DBError(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("INSERT INTO Session").
+		WillReturnError(errors.New("failed to create"))
+
+	var sessionDAO = NewDBSessionDAO(db)
+	var _, createErr = sessionDAO.CreateSession(1, []byte("hash"), time.Now())
+
+	assert.NotNil(t, createErr)
+	assert.Equal(t, "failed to create", createErr.Error())
+}
+
+func TestDbSessionDAO_GetSessionById_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var expires = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
+	mock.
+		ExpectQuery("SELECT id, userId, refreshHash").
+		WithArgs(10).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "userId", "refreshHash", "expires", "revoked"}).
+				AddRow(10, 1, []byte("hash"), expires, false),
+		)
+
+	var sessionDAO = NewDBSessionDAO(db)
+	var session, getErr = sessionDAO.GetSessionById(10)
+
+	assert.Nil(t, getErr)
+	assert.Equal(t, &model.Session{Id: 10, UserId: 1, RefreshHash: []byte("hash"), Expires: expires}, session)
+}
+
+func TestDbSessionDAO_GetSessionById_NotFound(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT").
+		WithArgs(10).
+		WillReturnError(errors.New("session not found"))
+
+	var sessionDAO = NewDBSessionDAO(db)
+	var _, getErr = sessionDAO.GetSessionById(10)
+
+	assert.NotNil(t, getErr)
+	assert.Equal(t, "session not found", getErr.Error())
+}
+
+func TestDbSessionDAO_RotateSession(t *testing.T) {
+	var cases = []struct {
+		rowsAffected int64
+		expected     bool
+	}{
+		{rowsAffected: 1, expected: true},
+		{rowsAffected: 0, expected: false},
+	}
+
+	for i, testCase := range cases {
+		var db, mock, err = sqlmock.New()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var expires = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
+		mock.
+			ExpectExec("UPDATE Session SET refreshHash").
+			WithArgs([]byte("new"), expires, 10, []byte("old")).
+			WillReturnResult(sqlmock.NewResult(0, testCase.rowsAffected))
+
+		var sessionDAO = NewDBSessionDAO(db)
+		var rotated, rotateErr = sessionDAO.RotateSession(10, []byte("old"), []byte("new"), expires)
+
+		assert.Nil(t, rotateErr, i)
+		assert.Equal(t, testCase.expected, rotated, i)
+
+		db.Close()
+	}
+}
+
+func TestDbSessionDAO_IsActive(t *testing.T) {
+	var cases = []struct {
+		cnt      int
+		expected bool
+	}{
+		{cnt: 1, expected: true},
+		{cnt: 0, expected: false},
+	}
+
+	for i, testCase := range cases {
+		var db, mock, err = sqlmock.New()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mock.
+			ExpectQuery("SELECT count").
+			WithArgs(10).
+			WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(testCase.cnt))
+
+		var sessionDAO = NewDBSessionDAO(db)
+		var active, activeErr = sessionDAO.IsActive(10)
+
+		assert.Nil(t, activeErr, i)
+		assert.Equal(t, testCase.expected, active, i)
+
+		db.Close()
+	}
+}
+
+func TestDbSessionDAO_Revoke(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE Session SET revoked = TRUE WHERE id").
+		WithArgs(10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec("UPDATE Session SET revoked = TRUE WHERE userId").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	var sessionDAO = NewDBSessionDAO(db)
+
+	assert.Nil(t, sessionDAO.RevokeSession(10))
+	assert.Nil(t, sessionDAO.RevokeUserSessions(1))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
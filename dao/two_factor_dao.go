@@ -0,0 +1,145 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/model"
+)
+
+const (
+	getTwoFactor = `
+		SELECT userId, secret, enabled, lastCounter FROM TwoFactor WHERE userId = $1
+	`
+	savePendingSecret = `
+		INSERT INTO TwoFactor (userId, secret) VALUES ($1, $2)
+		ON CONFLICT (userId) DO UPDATE SET secret = $2, enabled = FALSE, lastCounter = 0
+		WHERE NOT TwoFactor.enabled
+	`
+	enableTwoFactor = `
+		UPDATE TwoFactor SET enabled = TRUE, lastCounter = $2 WHERE userId = $1 AND NOT enabled
+	`
+	useTwoFactorCounter = `
+		UPDATE TwoFactor SET lastCounter = $2 WHERE userId = $1 AND enabled AND lastCounter < $2
+	`
+	deleteTwoFactor = `
+		DELETE FROM TwoFactor WHERE userId = $1
+	`
+	deleteRecoveryCodes = `
+		DELETE FROM RecoveryCode WHERE userId = $1
+	`
+	createRecoveryCode = `
+		INSERT INTO RecoveryCode (userId, codeHash) VALUES ($1, $2)
+	`
+	useRecoveryCode = `
+		UPDATE RecoveryCode SET used = TRUE WHERE userId = $1 AND codeHash = $2 AND NOT used
+	`
+)
+
+type TwoFactorDAO interface {
+	// GetTwoFactor returns sql.ErrNoRows if the user has never enrolled.
+	GetTwoFactor(userId int) (*model.TwoFactor, error)
+	// SavePendingSecret starts enrollment. It returns false if two-factor
+	// authentication is already enabled, the secret is not replaced then.
+	SavePendingSecret(userId int, secret []byte) (bool, error)
+	// Enable turns on a pending secret, accepting the code of counter
+	// step, and replaces all recovery codes of the user.
+	Enable(userId int, counter int64, recoveryHashes [][]byte) (bool, error)
+	// UseCounter accepts a code of counter step only once.
+	UseCounter(userId int, counter int64) (bool, error)
+	UseRecoveryCode(userId int, codeHash []byte) (bool, error)
+	// Disable removes the secret and recovery codes of the user.
+	Disable(userId int) error
+}
+
+type dbTwoFactorDAO struct {
+	db *sql.DB
+}
+
+func NewDBTwoFactorDAO(db *sql.DB) TwoFactorDAO {
+	var result = new(dbTwoFactorDAO)
+	result.db = db
+	return result
+}
+
+func (dao *dbTwoFactorDAO) GetTwoFactor(userId int) (*model.TwoFactor, error) {
+	var twoFactor = new(model.TwoFactor)
+	var err = dao.db.QueryRow(getTwoFactor, userId).Scan(
+		&twoFactor.UserId, &twoFactor.Secret, &twoFactor.Enabled, &twoFactor.LastCounter,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return twoFactor, nil
+}
+
+func (dao *dbTwoFactorDAO) SavePendingSecret(userId int, secret []byte) (bool, error) {
+	return execAffected(dao.db, savePendingSecret, userId, secret)
+}
+
+func (dao *dbTwoFactorDAO) Enable(userId int, counter int64, recoveryHashes [][]byte) (bool, error) {
+	var tx, txErr = dao.db.Begin()
+	if txErr != nil {
+		return false, txErr
+	}
+
+	var enabled, enableErr = execAffected(tx, enableTwoFactor, userId, counter)
+	if enableErr != nil || !enabled {
+		tx.Rollback()
+		return false, enableErr
+	}
+
+	if _, err := tx.Exec(deleteRecoveryCodes, userId); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	for _, hash := range recoveryHashes {
+		if _, err := tx.Exec(createRecoveryCode, userId, hash); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+func (dao *dbTwoFactorDAO) UseCounter(userId int, counter int64) (bool, error) {
+	return execAffected(dao.db, useTwoFactorCounter, userId, counter)
+}
+
+func (dao *dbTwoFactorDAO) UseRecoveryCode(userId int, codeHash []byte) (bool, error) {
+	return execAffected(dao.db, useRecoveryCode, userId, codeHash)
+}
+
+func (dao *dbTwoFactorDAO) Disable(userId int) error {
+	var tx, txErr = dao.db.Begin()
+	if txErr != nil {
+		return txErr
+	}
+
+	if _, err := tx.Exec(deleteRecoveryCodes, userId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(deleteTwoFactor, userId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// execAffected runs query and reports whether it has changed any rows.
+func execAffected(db execer, query string, args ...interface{}) (bool, error) {
+	var result, err = db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	var rowsAffected, rowsErr = result.RowsAffected()
+	if rowsErr != nil {
+		return false, rowsErr
+	}
+	return rowsAffected > 0, nil
+}
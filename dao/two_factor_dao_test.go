@@ -0,0 +1,187 @@
+package dao
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"testing"
+)
+
+func TestDbTwoFactorDAO_GetTwoFactor_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT userId, secret, enabled, lastCounter FROM TwoFactor").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"userId", "secret", "enabled", "lastCounter"}).
+				AddRow(1, []byte("secret"), true, 100),
+		)
+
+	var twoFactorDAO = NewDBTwoFactorDAO(db)
+	var twoFactor, getErr = twoFactorDAO.GetTwoFactor(1)
+
+	assert.Nil(t, getErr)
+	assert.Equal(t, &model.TwoFactor{UserId: 1, Secret: []byte("secret"), Enabled: true, LastCounter: 100}, twoFactor)
+}
+
+func TestDbTwoFactorDAO_GetTwoFactor_NotFound(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT userId, secret").
+		WithArgs(1).
+		WillReturnError(sql.ErrNoRows)
+
+	var twoFactorDAO = NewDBTwoFactorDAO(db)
+	var _, getErr = twoFactorDAO.GetTwoFactor(1)
+
+	assert.Equal(t, sql.ErrNoRows, getErr)
+}
+
+func TestDbTwoFactorDAO_SavePendingSecret_AlreadyEnabled(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("INSERT INTO TwoFactor .* ON CONFLICT").
+		WithArgs(1, []byte("secret")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var twoFactorDAO = NewDBTwoFactorDAO(db)
+	var saved, saveErr = twoFactorDAO.SavePendingSecret(1, []byte("secret"))
+
+	assert.Nil(t, saveErr)
+	assert.False(t, saved)
+}
+
+func TestDbTwoFactorDAO_Enable_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.
+		ExpectExec("UPDATE TwoFactor SET enabled = TRUE").
+		WithArgs(1, 100).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec("DELETE FROM RecoveryCode").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectExec("INSERT INTO RecoveryCode").
+		WithArgs(1, []byte("hash1")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.
+		ExpectExec("INSERT INTO RecoveryCode").
+		WithArgs(1, []byte("hash2")).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	var twoFactorDAO = NewDBTwoFactorDAO(db)
+	var enabled, enableErr = twoFactorDAO.Enable(1, 100, [][]byte{[]byte("hash1"), []byte("hash2")})
+
+	assert.Nil(t, enableErr)
+	assert.True(t, enabled)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbTwoFactorDAO_Enable_NotPending(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.
+		ExpectExec("UPDATE TwoFactor SET enabled = TRUE").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	var twoFactorDAO = NewDBTwoFactorDAO(db)
+	var enabled, enableErr = twoFactorDAO.Enable(1, 100, [][]byte{[]byte("hash1")})
+
+	assert.Nil(t, enableErr)
+	assert.False(t, enabled)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbTwoFactorDAO_UseCounter_Replay(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE TwoFactor SET lastCounter").
+		WithArgs(1, 100).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var twoFactorDAO = NewDBTwoFactorDAO(db)
+	var used, useErr = twoFactorDAO.UseCounter(1, 100)
+
+	assert.Nil(t, useErr)
+	assert.False(t, used)
+}
+
+func TestDbTwoFactorDAO_UseRecoveryCode_DBError(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE RecoveryCode SET used = TRUE").
+		WithArgs(1, []byte("hash")).
+		WillReturnError(errors.New("db fail"))
+
+	var twoFactorDAO = NewDBTwoFactorDAO(db)
+	var _, useErr = twoFactorDAO.UseRecoveryCode(1, []byte("hash"))
+
+	assert.NotNil(t, useErr)
+}
+
+func TestDbTwoFactorDAO_Disable(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM RecoveryCode").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec("DELETE FROM TwoFactor").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var twoFactorDAO = NewDBTwoFactorDAO(db)
+
+	assert.Nil(t, twoFactorDAO.Disable(1))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
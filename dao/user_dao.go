@@ -3,33 +3,165 @@ package dao
 import (
 	"database/sql"
 	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/lib/pq"
+	"strings"
+	"time"
 )
 
 const (
-	saveUser          = `INSERT INTO Users (login, password, age, sex, about) VALUES ($1, $2, $3, $4, $5)`
-	getUserById       = `SELECT id, login, password, age, sex, about FROM Users WHERE id = $1`
-	getUserByLogin    = `SELECT id, login, password, age, sex, about FROM Users WHERE login = $1`
-	getIdByLogin      = `SELECT id FROM Users WHERE login = $1`
-	getNeighbourUsers = `SELECT DISTINCT ON (u2.id) u2.id, u2.login, u2.age, u2.sex, u2.about
-						 FROM Users u1
-						 	JOIN Users u2 ON u2.id != u1.id
-						 	JOIN Position p1 ON u1.id = p1.userId
-						 	JOIN Position p2 ON u2.id = p2.userId
-						 WHERE u1.id = $1
-							AND ST_DistanceSphere(p1.point, p2.point) <= $2
-							AND age(current_timestamp, p2.time) < $3 * interval '1 minute'`
+	saveUser = `INSERT INTO Users (login, password, age, sex, about, email)
+				VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))`
+	getUserById    = `SELECT id, login, password, age, sex, about, COALESCE(email, ''), role, banned, suspendedUntil, COALESCE(photo, '') FROM Users WHERE id = $1`
+	getUserByLogin = `SELECT id, login, password, age, sex, about, COALESCE(email, ''), role, banned, suspendedUntil, COALESCE(photo, '') FROM Users WHERE login = $1`
+	getUserByEmail = `SELECT id, login, password, age, sex, about, COALESCE(email, ''), role, banned, suspendedUntil, COALESCE(photo, '') FROM Users WHERE email = $1`
+	getIdByLogin   = `SELECT id FROM Users WHERE login = $1`
+	updatePassword = `UPDATE Users SET password = $1 WHERE id = $2`
+	updateUser     = `UPDATE Users SET age = $1, sex = $2, about = $3 WHERE id = $4`
+	// neighbours are compared by their latest positions only, positions are ordered and aged by
+	// the time they were taken as in GetVisiblePosition of PositionDAO; if $4 is not empty, only neighbours
+	// having at least one of these interests are returned and the ones sharing more interests with
+	// the user go first, otherwise the nearest ones go first; $5-$7 restrict age and sex
+	// (0 and '' mean no restriction), $8-$10 is the keyset cursor (all NULL for the first page);
+	// ghosts are skipped, distance and bearing of the others are measured to their positions
+	// as GetVisiblePosition of PositionDAO shows them with $12 as the least fuzz radius
+	getNeighbourUsers = `SELECT n.id, n.login, n.age, n.sex, n.about, n.photo, n.shared, n.distance, n.bearing, n.time
+						 FROM (
+							SELECT u2.id, u2.login, u2.age, u2.sex, u2.about,
+								COALESCE(u2.photo, '') photo,
+								ST_Distance(p1.point, v.point) distance,
+								COALESCE(degrees(ST_Azimuth(p1.point, v.point)), 0) bearing,
+								p2.time,
+								ARRAY(
+									SELECT i.name FROM UserInterest ui1
+										JOIN UserInterest ui2 ON ui1.interestId = ui2.interestId
+										JOIN Interest i ON ui1.interestId = i.id
+									WHERE ui1.userId = u1.id AND ui2.userId = u2.id
+									ORDER BY i.name
+								) shared
+							FROM Users u1
+								JOIN LATERAL (
+									SELECT point FROM Position WHERE userId = u1.id
+									ORDER BY LEAST(clientTime, time) DESC LIMIT 1
+								) p1 ON TRUE
+								JOIN Users u2 ON u2.id != u1.id
+								JOIN LATERAL (
+									SELECT point, LEAST(clientTime, time) time FROM Position WHERE userId = u2.id
+									ORDER BY LEAST(clientTime, time) DESC LIMIT 1
+								) p2 ON TRUE
+								LEFT JOIN Privacy pr ON pr.userId = u2.id
+								CROSS JOIN LATERAL (
+									SELECT GREATEST(pr.fuzzRadius, $12) / 111320.0 step
+								) g
+								CROSS JOIN LATERAL (
+									SELECT CASE WHEN EXISTS (
+										SELECT 1 FROM MeetRequest r
+										WHERE r.status = 'ACCEPTED' AND (
+											(r.requesterId = u1.id AND r.requestedId = u2.id) OR
+											(r.requesterId = u2.id AND r.requestedId = u1.id)
+										)
+									) THEN p2.point
+										ELSE ST_SnapToGrid(
+											p2.point::GEOMETRY, 0, 0,
+											g.step / GREATEST(cos(radians(round(ST_Y(p2.point::GEOMETRY) / g.step) * g.step)), 0.01),
+											g.step
+										)::GEOGRAPHY END point
+								) v
+							WHERE u1.id = $1
+								AND ST_DWithin(p1.point, v.point, $2)
+								AND age(current_timestamp, p2.time) < $3 * interval '1 minute'
+								AND NOT u2.banned
+								AND NOT COALESCE(pr.ghost, FALSE)
+								AND (u2.suspendedUntil IS NULL OR u2.suspendedUntil < now())
+								AND NOT EXISTS (
+									SELECT 1 FROM UserBlock b
+									WHERE (b.blockerId = u1.id AND b.blockedId = u2.id)
+										OR (b.blockerId = u2.id AND b.blockedId = u1.id)
+								)
+								AND (cardinality($4::TEXT[]) = 0 OR EXISTS (
+									SELECT 1 FROM UserInterest ui
+										JOIN Interest i ON ui.interestId = i.id
+									WHERE ui.userId = u2.id AND i.name = ANY($4::TEXT[])
+								))
+								AND ($5::INT = 0 OR u2.age >= $5)
+								AND ($6::INT = 0 OR u2.age <= $6)
+								AND ($7::TEXT = '' OR u2.sex::TEXT = $7)
+						 ) n
+							CROSS JOIN LATERAL (
+								SELECT CASE WHEN cardinality($4::TEXT[]) = 0 THEN 0 ELSE cardinality(n.shared) END rank
+							) r
+						 WHERE $8::INT IS NULL
+							OR r.rank < $8
+							OR (r.rank = $8 AND (n.distance, n.id) > ($9::FLOAT8, $10::INT))
+						 ORDER BY r.rank DESC, n.distance, n.id
+						 LIMIT $11`
 	checkUserById    = `SELECT count(*) cnt FROM Users u WHERE u.id = $1`
 	checkUserByLogin = `SELECT count(*) cnt FROM Users u WHERE u.login = $1`
+	checkUserByEmail = `SELECT count(*) cnt FROM Users u WHERE u.email = $1`
+	searchUsers      = `SELECT id, login, age, sex, about, COALESCE(email, ''), role, banned, suspendedUntil, COALESCE(photo, '') FROM Users
+						WHERE login ILIKE $1 OR email ILIKE $1
+						ORDER BY id LIMIT $2 OFFSET $3`
+	setUserBanned = `UPDATE Users SET banned = $1 WHERE id = $2`
+	setUserRole   = `UPDATE Users SET role = $1 WHERE id = $2`
+	setSuspension = `UPDATE Users SET suspendedUntil = $1 WHERE id = $2`
+	setUserPhoto  = `UPDATE Users SET photo = NULLIF($1, '') WHERE id = $2`
+
+	// rows referencing Users(id) are removed or unlinked before the user itself
+	deleteUserPositions = `DELETE FROM Position WHERE userId = $1`
+	// reports outlive the account, so that a reported user can not erase them; requests
+	// of reports are always the ones of the user, so they are unlinked as well
+	unlinkUserReports = `
+		UPDATE Report SET reporterId = NULLIF(reporterId, $1), reportedId = NULLIF(reportedId, $1), requestId = NULL
+		WHERE reporterId = $1 OR reportedId = $1
+	`
+	deleteUserRequests      = `DELETE FROM MeetRequest WHERE requesterId = $1 OR requestedId = $1`
+	deleteUserBlocks        = `DELETE FROM UserBlock WHERE blockerId = $1 OR blockedId = $1`
+	deleteUserSessions      = `DELETE FROM Session WHERE userId = $1`
+	deleteUserPasswordReset = `DELETE FROM PasswordReset WHERE userId = $1`
+	deleteUserRecoveryCodes = `DELETE FROM RecoveryCode WHERE userId = $1`
+	deleteUserTwoFactor     = `DELETE FROM TwoFactor WHERE userId = $1`
+	// failed sign in records keep the login and IP addresses, not the id
+	deleteUserLoginFailures = `DELETE FROM LoginFailure WHERE login = (SELECT login FROM Users WHERE id = $1)`
+	deleteUser              = `DELETE FROM Users WHERE id = $1`
 )
 
 type UserDAO interface {
 	Save(user *model.User) (int, error)
 	GetUserById(id int) (*model.User, error)
 	GetUserByLogin(login string) (*model.User, error)
-	GetNeighbourUsers(id int, distance float64, onlineTimeoutMin int) ([]*model.User, error)
+	GetUserByEmail(email string) (*model.User, error)
+	// GetNeighbourUsers returns users whose latest position is recent and within filter.Radius
+	// from the latest position of the user, nearest first. If filter.Interests are given, only users
+	// having at least one of them are returned and users sharing more interests go first.
+	// At most filter.Limit neighbours following filter.After are returned; the cursor of the last one
+	// is returned as well if there are more neighbours to fetch, otherwise it is nil.
+	// Privacy settings of the users are respected, see model.Privacy.
+	GetNeighbourUsers(id int, filter *model.NeighbourFilter) ([]*model.Neighbour, *model.NeighbourCursor, error)
 	GetIdByLogin(login string) (int, error)
+	UpdatePassword(id int, password string) error
+	// Update saves profile fields (age, sex, about) of the user.
+	// It returns false if there is no user with such id.
+	Update(user *model.User) (bool, error)
+	// Delete removes the user together with positions, meet requests (both sent
+	// and received) and events about them, blocks (in both directions), interests,
+	// push devices, privacy settings, sessions, password resets, two-factor settings
+	// and failed sign in records in a single transaction. Reports by and about
+	// the user are kept without the link to the user.
+	// It returns false if there is no user with such id.
+	Delete(id int) (bool, error)
+	// SearchUsers returns users whose login or email contains query, ordered by id.
+	SearchUsers(query string, limit int, offset int) ([]*model.User, error)
+	// SetBanned and SetRole return false if there is no user with such id.
+	SetBanned(id int, banned bool) (bool, error)
+	SetRole(id int, role string) (bool, error)
+	// Suspend hides the user from others and forbids signing in until the given time.
+	// It returns false if there is no user with such id.
+	Suspend(id int, until time.Time) (bool, error)
+	// SetPhoto saves the storage key of the user's photo, empty key removes the photo.
+	// It returns false if there is no user with such id.
+	SetPhoto(id int, key string) (bool, error)
 	ExistsById(id int) (bool, error)
 	ExistsByLogin(login string) (bool, error)
+	ExistsByEmail(email string) (bool, error)
 }
 
 type dbUserDAO struct {
@@ -43,7 +175,7 @@ func NewDBUserDAO(db *sql.DB) UserDAO {
 }
 
 func (dao *dbUserDAO) Save(user *model.User) (int, error) {
-	_, saveErr := dao.db.Exec(saveUser, user.Login, user.Password, user.Age, user.Sex, user.About)
+	_, saveErr := dao.db.Exec(saveUser, user.Login, user.Password, user.Age, user.Sex, user.About, user.Email)
 	if saveErr != nil {
 		return 0, saveErr
 	}
@@ -62,27 +194,142 @@ func (dao *dbUserDAO) GetIdByLogin(login string) (int, error) {
 }
 
 func (dao *dbUserDAO) GetUserById(id int) (*model.User, error) {
-	var user = new(model.User)
-	var err = dao.db.QueryRow(getUserById, id).Scan(&user.Id, &user.Login, &user.Password, &user.Age, &user.Sex, &user.About)
+	return dao.getUser(getUserById, id)
+}
+
+func (dao *dbUserDAO) GetUserByLogin(login string) (*model.User, error) {
+	return dao.getUser(getUserByLogin, login)
+}
+
+func (dao *dbUserDAO) GetUserByEmail(email string) (*model.User, error) {
+	return dao.getUser(getUserByEmail, email)
+}
+
+func (dao *dbUserDAO) GetNeighbourUsers(
+	id int, filter *model.NeighbourFilter,
+) ([]*model.Neighbour, *model.NeighbourCursor, error) {
+	var interests = filter.Interests
+	if interests == nil {
+		interests = []string{}
+	}
+	var cursorRank, cursorDistance, cursorId interface{}
+	if filter.After != nil {
+		cursorRank, cursorDistance, cursorId = filter.After.Rank, filter.After.Distance, filter.After.Id
+	}
+
+	// one extra row tells whether there is a next page
+	var rows, err = dao.db.Query(
+		getNeighbourUsers, id, filter.Radius, filter.OnlineTimeout, pq.Array(interests),
+		filter.MinAge, filter.MaxAge, filter.Sex, cursorRank, cursorDistance, cursorId, filter.Limit+1,
+		model.MinFuzzRadius,
+	)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	defer rows.Close()
 
-	return user, nil
+	var result = make([]*model.Neighbour, 0)
+	for rows.Next() {
+		var neighbour = &model.Neighbour{User: new(model.User)}
+		var lastSeen time.Time
+		err = rows.Scan(
+			&neighbour.Id, &neighbour.Login, &neighbour.Age, &neighbour.Sex, &neighbour.About, &neighbour.PhotoKey,
+			pq.Array(&neighbour.SharedInterests), &neighbour.Distance, &neighbour.Bearing, &lastSeen,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		neighbour.LastSeen = model.QuotedTime(lastSeen)
+
+		result = append(result, neighbour)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(result) <= filter.Limit {
+		return result, nil, nil
+	}
+
+	result = result[:filter.Limit]
+	var last = result[len(result)-1]
+	var cursor = &model.NeighbourCursor{Distance: last.Distance, Id: last.Id}
+	if len(interests) > 0 {
+		cursor.Rank = len(last.SharedInterests)
+	}
+	return result, cursor, nil
 }
 
-func (dao *dbUserDAO) GetUserByLogin(login string) (*model.User, error) {
-	var user = new(model.User)
-	var err = dao.db.QueryRow(getUserByLogin, login).Scan(&user.Id, &user.Login, &user.Password, &user.Age, &user.Sex, &user.About)
+func (dao *dbUserDAO) UpdatePassword(id int, password string) error {
+	var _, err = dao.db.Exec(updatePassword, password, id)
+	return err
+}
+
+func (dao *dbUserDAO) Update(user *model.User) (bool, error) {
+	var result, err = dao.db.Exec(updateUser, user.Age, user.Sex, user.About, user.Id)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	return user, nil
+	var rowsAffected, rowsErr = result.RowsAffected()
+	if rowsErr != nil {
+		return false, rowsErr
+	}
+	return rowsAffected > 0, nil
+}
+
+func (dao *dbUserDAO) Delete(id int) (bool, error) {
+	var tx, txErr = dao.db.Begin()
+	if txErr != nil {
+		return false, txErr
+	}
+
+	var dependent = []string{
+		deleteUserPositions,
+		unlinkUserReports,
+		deleteUserEvents,
+		deleteUserEventLock,
+		deleteUserRequests,
+		deleteUserBlocks,
+		deleteUserInterests,
+		deleteUserDevices,
+		deleteUserPrivacy,
+		deleteUserSessions,
+		deleteUserPasswordReset,
+		deleteUserRecoveryCodes,
+		deleteUserTwoFactor,
+		deleteUserLoginFailures,
+	}
+	for _, query := range dependent {
+		if _, err := tx.Exec(query, id); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+
+	var result, err = tx.Exec(deleteUser, id)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	var rowsAffected, rowsErr = result.RowsAffected()
+	if rowsErr != nil {
+		tx.Rollback()
+		return false, rowsErr
+	}
+	if rowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	return true, tx.Commit()
 }
 
-func (dao *dbUserDAO) GetNeighbourUsers(id int, distance float64, onlineTimeoutMin int) ([]*model.User, error) {
-	var rows, err = dao.db.Query(getNeighbourUsers, id, distance, onlineTimeoutMin)
+func (dao *dbUserDAO) SearchUsers(query string, limit int, offset int) ([]*model.User, error) {
+	var rows, err = dao.db.Query(searchUsers, "%"+escapeLike(query)+"%", limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -91,10 +338,15 @@ func (dao *dbUserDAO) GetNeighbourUsers(id int, distance float64, onlineTimeoutM
 	var result = make([]*model.User, 0)
 	for rows.Next() {
 		var user = new(model.User)
-		err = rows.Scan(&user.Id, &user.Login, &user.Age, &user.Sex, &user.About)
+		var suspendedUntil pq.NullTime
+		err = rows.Scan(
+			&user.Id, &user.Login, &user.Age, &user.Sex, &user.About, &user.Email, &user.Role, &user.Banned, &suspendedUntil,
+			&user.PhotoKey,
+		)
 		if err != nil {
 			return nil, err
 		}
+		user.SuspendedUntil = getQuotedTime(suspendedUntil)
 
 		result = append(result, user)
 	}
@@ -107,6 +359,22 @@ func (dao *dbUserDAO) GetNeighbourUsers(id int, distance float64, onlineTimeoutM
 	return result, nil
 }
 
+func (dao *dbUserDAO) SetBanned(id int, banned bool) (bool, error) {
+	return execAffected(dao.db, setUserBanned, banned, id)
+}
+
+func (dao *dbUserDAO) SetRole(id int, role string) (bool, error) {
+	return execAffected(dao.db, setUserRole, role, id)
+}
+
+func (dao *dbUserDAO) Suspend(id int, until time.Time) (bool, error) {
+	return execAffected(dao.db, setSuspension, until, id)
+}
+
+func (dao *dbUserDAO) SetPhoto(id int, key string) (bool, error) {
+	return execAffected(dao.db, setUserPhoto, key, id)
+}
+
 func (dao *dbUserDAO) ExistsById(id int) (bool, error) {
 	var cnt int
 	var err = dao.db.QueryRow(checkUserById, id).Scan(&cnt)
@@ -127,8 +395,46 @@ func (dao *dbUserDAO) ExistsByLogin(login string) (bool, error) {
 	return cnt > 0, nil
 }
 
+func (dao *dbUserDAO) ExistsByEmail(email string) (bool, error) {
+	var cnt int
+	var err = dao.db.QueryRow(checkUserByEmail, email).Scan(&cnt)
+	if err != nil {
+		return false, err
+	}
+
+	return cnt > 0, nil
+}
+
+func (dao *dbUserDAO) getUser(query string, arg interface{}) (*model.User, error) {
+	var user = new(model.User)
+	var suspendedUntil pq.NullTime
+	var err = dao.db.QueryRow(query, arg).Scan(
+		&user.Id, &user.Login, &user.Password, &user.Age, &user.Sex, &user.About, &user.Email, &user.Role, &user.Banned,
+		&suspendedUntil, &user.PhotoKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+	user.SuspendedUntil = getQuotedTime(suspendedUntil)
+
+	return user, nil
+}
+
 func (dao *dbUserDAO) getIdByLogin(login string) (int, error) {
 	var id int
 	var getErr = dao.db.QueryRow(getIdByLogin, login).Scan(&id)
 	return id, getErr
 }
+
+func getQuotedTime(t pq.NullTime) *model.QuotedTime {
+	if !t.Valid {
+		return nil
+	}
+	var result = model.QuotedTime(t.Time)
+	return &result
+}
+
+// escapeLike makes LIKE treat wildcard characters of s literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
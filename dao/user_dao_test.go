@@ -7,6 +7,7 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 	"testing"
+	"time"
 )
 
 func TestDbUserDAO_ExistsByID_UserFound(t *testing.T) {
@@ -153,7 +154,7 @@ func TestDbUserDAO_Save_Success(t *testing.T) {
 	var hash, _ = bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
 	mock.
 		ExpectExec("INSERT INTO").
-		WithArgs("login", string(hash), 100, model.FEMALE, "").
+		WithArgs("login", string(hash), 100, model.FEMALE, "", "login@mail.ru").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.
@@ -161,7 +162,7 @@ func TestDbUserDAO_Save_Success(t *testing.T) {
 		WithArgs("login").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
-	var user = &model.User{Login: "login", Password: string(hash), Sex: model.FEMALE, Age: 100}
+	var user = &model.User{Login: "login", Password: string(hash), Sex: model.FEMALE, Age: 100, Email: "login@mail.ru"}
 
 	var userDAO = NewDBUserDAO(db)
 	var id, saveErr = userDAO.Save(user)
@@ -180,7 +181,7 @@ func TestDbUserDAO_Save_DuplicateLogin(t *testing.T) {
 
 	mock.
 		ExpectExec("INSERT INTO").
-		WithArgs("login", "pass", 100, model.FEMALE, "").
+		WithArgs("login", "pass", 100, model.FEMALE, "", "").
 		WillReturnError(errors.New("Duplicate id"))
 
 	var user = &model.User{Login: "login", Password: "pass", Sex: model.FEMALE, Age: 100}
@@ -192,6 +193,106 @@ func TestDbUserDAO_Save_DuplicateLogin(t *testing.T) {
 	assert.Equal(t, "Duplicate id", saveErr.Error())
 }
 
+func TestDbUserDAO_UpdatePassword_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE Users SET password").
+		WithArgs("hash", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var userDAO = NewDBUserDAO(db)
+	var updateErr = userDAO.UpdatePassword(1, "hash")
+
+	assert.Nil(t, updateErr)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbUserDAO_UpdatePassword_DBError(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE Users SET password").
+		WithArgs("hash", 1).
+		WillReturnError(errors.New("failed to update"))
+
+	var userDAO = NewDBUserDAO(db)
+	var updateErr = userDAO.UpdatePassword(1, "hash")
+
+	assert.NotNil(t, updateErr)
+	assert.Equal(t, "failed to update", updateErr.Error())
+}
+
+func TestDbUserDAO_Update_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var user = &model.User{Id: 1, Login: "login", Sex: model.FEMALE, Age: 30, About: "about"}
+	mock.
+		ExpectExec("UPDATE Users SET age").
+		WithArgs(user.Age, user.Sex, user.About, user.Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var userDAO = NewDBUserDAO(db)
+	var updated, updateErr = userDAO.Update(user)
+
+	assert.Nil(t, updateErr)
+	assert.True(t, updated)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbUserDAO_Update_NotFound(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE Users SET age").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var userDAO = NewDBUserDAO(db)
+	var updated, updateErr = userDAO.Update(&model.User{Id: 1})
+
+	assert.Nil(t, updateErr)
+	assert.False(t, updated)
+}
+
+func TestDbUserDAO_Update_DBError(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE Users SET age").
+		WillReturnError(errors.New("failed to update"))
+
+	var userDAO = NewDBUserDAO(db)
+	var _, updateErr = userDAO.Update(&model.User{Id: 1})
+
+	assert.NotNil(t, updateErr)
+	assert.Equal(t, "failed to update", updateErr.Error())
+}
+
 func TestDbUserDAO_GetUserById_Success(t *testing.T) {
 	var db, mock, err = sqlmock.New()
 
@@ -200,15 +301,17 @@ func TestDbUserDAO_GetUserById_Success(t *testing.T) {
 	}
 	defer db.Close()
 
-	var rows = sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about"}).
-		AddRow(1, "login", "pass", 100, model.MALE, "about")
+	var rows = sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+		AddRow(1, "login", "pass", 100, model.MALE, "about", "", model.RoleUser, false, nil, "")
 
 	mock.
 		ExpectQuery("SELECT").
 		WithArgs(1).
 		WillReturnRows(rows)
 
-	var user = &model.User{Id: 1, Login: "login", Password: "pass", Sex: model.MALE, Age: 100, About: "about"}
+	var user = &model.User{
+		Id: 1, Login: "login", Password: "pass", Sex: model.MALE, Age: 100, About: "about", Role: model.RoleUser,
+	}
 
 	var userDAO = NewDBUserDAO(db)
 	var dbUser, userErr = userDAO.GetUserById(1)
@@ -245,15 +348,17 @@ func TestDbUserDAO_GetUserByLogin_Success(t *testing.T) {
 	}
 	defer db.Close()
 
-	var rows = sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about"}).
-		AddRow(1, "login", "pass", 100, model.MALE, "about")
+	var rows = sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+		AddRow(1, "login", "pass", 100, model.MALE, "about", "", model.RoleUser, false, nil, "")
 
 	mock.
 		ExpectQuery("SELECT").
 		WithArgs("login").
 		WillReturnRows(rows)
 
-	var user = &model.User{Id: 1, Login: "login", Password: "pass", Sex: model.MALE, Age: 100, About: "about"}
+	var user = &model.User{
+		Id: 1, Login: "login", Password: "pass", Sex: model.MALE, Age: 100, About: "about", Role: model.RoleUser,
+	}
 
 	var userDAO = NewDBUserDAO(db)
 	var dbUser, userErr = userDAO.GetUserByLogin(user.Login)
@@ -282,6 +387,54 @@ func TestDbUserDAO_GetUserByLogin_NotFound(t *testing.T) {
 	assert.Equal(t, "user not found", userErr.Error())
 }
 
+func TestDbUserDAO_GetUserByEmail_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var rows = sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+		AddRow(1, "login", "pass", 100, model.MALE, "about", "login@mail.ru", model.RoleUser, false, nil, "")
+
+	mock.
+		ExpectQuery("SELECT .* WHERE email").
+		WithArgs("login@mail.ru").
+		WillReturnRows(rows)
+
+	var user = &model.User{
+		Id: 1, Login: "login", Password: "pass", Sex: model.MALE, Age: 100, About: "about", Email: "login@mail.ru",
+		Role: model.RoleUser,
+	}
+
+	var userDAO = NewDBUserDAO(db)
+	var dbUser, userErr = userDAO.GetUserByEmail(user.Email)
+
+	assert.Nil(t, userErr)
+	assert.Equal(t, user, dbUser)
+}
+
+func TestDbUserDAO_ExistsByEmail(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs("login@mail.ru").
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+
+	var userDAO = NewDBUserDAO(db)
+	var exists, existsErr = userDAO.ExistsByEmail("login@mail.ru")
+
+	assert.Nil(t, existsErr)
+	assert.True(t, exists)
+}
+
 func TestDbUserDAO_GetIdByLogin_Success(t *testing.T) {
 	var db, mock, err = sqlmock.New()
 
@@ -331,28 +484,44 @@ func TestDbUserDAO_GetNeighbour_Success(t *testing.T) {
 	}
 	defer db.Close()
 
-	var rows = sqlmock.NewRows([]string{"id", "login", "age", "sex", "about"}).
-		AddRow(1, "login1", 101, model.MALE, "about1").
-		AddRow(2, "login2", 102, model.FEMALE, "about2")
+	var lastSeen = time.Date(2017, 10, 17, 12, 0, 0, 0, time.UTC)
+	var rows = sqlmock.NewRows([]string{"id", "login", "age", "sex", "about", "photo", "shared", "distance", "bearing", "time"}).
+		AddRow(1, "login1", 101, model.MALE, "about1", "photos/1/abc", "{chess,\"board games\"}", 120.5, 45.0, lastSeen).
+		AddRow(2, "login2", 102, model.FEMALE, "about2", "", "{}", 80.25, 270.0, lastSeen)
 
 	mock.
 		ExpectQuery("SELECT").
-		WithArgs(0, float64(100), 1).
+		WithArgs(0, float64(100), 1, "{\"board games\",\"chess\"}", 0, 0, "", nil, nil, nil, 3, model.MinFuzzRadius).
 		WillReturnRows(rows)
 
-	var users = []*model.User{
-		{Id: 1, Login: "login1", Sex: model.MALE, Age: 101, About: "about1"},
-		{Id: 2, Login: "login2", Sex: model.FEMALE, Age: 102, About: "about2"},
+	var neighbours = []*model.Neighbour{
+		{
+			User:            &model.User{Id: 1, Login: "login1", Sex: model.MALE, Age: 101, About: "about1", PhotoKey: "photos/1/abc"},
+			SharedInterests: []string{"chess", "board games"},
+			Distance:        120.5,
+			Bearing:         45,
+			LastSeen:        model.QuotedTime(lastSeen),
+		},
+		{
+			User:            &model.User{Id: 2, Login: "login2", Sex: model.FEMALE, Age: 102, About: "about2"},
+			SharedInterests: []string{},
+			Distance:        80.25,
+			Bearing:         270,
+			LastSeen:        model.QuotedTime(lastSeen),
+		},
 	}
 
 	var userDAO = NewDBUserDAO(db)
-	var dbUsers, userErr = userDAO.GetNeighbourUsers(0, float64(100), 1)
+	var dbNeighbours, next, userErr = userDAO.GetNeighbourUsers(0, &model.NeighbourFilter{
+		Radius: 100, OnlineTimeout: 1, Interests: []string{"board games", "chess"}, Limit: 2,
+	})
 
 	assert.Nil(t, userErr)
-	assert.Equal(t, len(users), len(dbUsers))
+	assert.Nil(t, next)
+	assert.Equal(t, len(neighbours), len(dbNeighbours))
 
-	for i := 0; i != len(users); i++ {
-		assert.Equal(t, users[i], dbUsers[i], i)
+	for i := 0; i != len(neighbours); i++ {
+		assert.Equal(t, neighbours[i], dbNeighbours[i], i)
 	}
 }
 
@@ -364,20 +533,50 @@ func TestDbUserDAO_GetNeighbour_Empty(t *testing.T) {
 	}
 	defer db.Close()
 
-	var rows = sqlmock.NewRows([]string{"id", "login", "age", "sex", "about"})
+	var rows = sqlmock.NewRows([]string{"id", "login", "age", "sex", "about", "photo", "shared", "distance", "bearing", "time"})
 
 	mock.
 		ExpectQuery("SELECT").
-		WithArgs(0, float64(100), 1).
+		WithArgs(0, float64(100), 1, "{}", 0, 0, "", nil, nil, nil, 21, model.MinFuzzRadius).
 		WillReturnRows(rows)
 
 	var userDAO = NewDBUserDAO(db)
-	var dbUsers, userErr = userDAO.GetNeighbourUsers(0, float64(100), 1)
+	var dbUsers, _, userErr = userDAO.GetNeighbourUsers(0, &model.NeighbourFilter{Radius: 100, OnlineTimeout: 1, Limit: 20})
 
 	assert.Nil(t, userErr)
 	assert.Equal(t, 0, len(dbUsers))
 }
 
+func TestDbUserDAO_GetNeighbour_NextPage(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var rows = sqlmock.NewRows([]string{"id", "login", "age", "sex", "about", "photo", "shared", "distance", "bearing", "time"}).
+		AddRow(3, "login3", 30, model.FEMALE, "about3", "", "{chess}", 20.5, 90.0, time.Now()).
+		AddRow(4, "login4", 30, model.FEMALE, "about4", "", "{}", 30.25, 90.0, time.Now())
+
+	mock.
+		ExpectQuery("SELECT").
+		WithArgs(0, float64(100), 1, "{}", 25, 35, model.FEMALE, 0, 12.5, 2, 2, model.MinFuzzRadius).
+		WillReturnRows(rows)
+
+	var userDAO = NewDBUserDAO(db)
+	var dbUsers, next, userErr = userDAO.GetNeighbourUsers(0, &model.NeighbourFilter{
+		Radius: 100, OnlineTimeout: 1, MinAge: 25, MaxAge: 35, Sex: model.FEMALE, Limit: 1,
+		After: &model.NeighbourCursor{Distance: 12.5, Id: 2},
+	})
+
+	assert.Nil(t, userErr)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 1, len(dbUsers))
+	assert.Equal(t, 3, dbUsers[0].Id)
+	assert.Equal(t, &model.NeighbourCursor{Distance: 20.5, Id: 3}, next)
+}
+
 func TestDbUserDAO_GetNeighbour_DBError(t *testing.T) {
 	var db, mock, err = sqlmock.New()
 
@@ -388,12 +587,192 @@ func TestDbUserDAO_GetNeighbour_DBError(t *testing.T) {
 
 	mock.
 		ExpectQuery("SELECT").
-		WithArgs(0, float64(100), 1).
+		WithArgs(0, float64(100), 1, "{}", 0, 0, "", nil, nil, nil, 21, model.MinFuzzRadius).
 		WillReturnError(errors.New("failed to get"))
 
 	var userDAO = NewDBUserDAO(db)
-	var _, userErr = userDAO.GetNeighbourUsers(0, float64(100), 1)
+	var _, _, userErr = userDAO.GetNeighbourUsers(0, &model.NeighbourFilter{Radius: 100, OnlineTimeout: 1, Limit: 20})
 
 	assert.NotNil(t, userErr)
 	assert.Equal(t, "failed to get", userErr.Error())
 }
+
+func TestDbUserDAO_Delete_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM Position").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec("UPDATE Report SET reporterId = NULLIF").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Event").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM EventLock").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM MeetRequest").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM UserBlock").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM UserInterest").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Device").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Privacy").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Session").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM PasswordReset").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM RecoveryCode").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM TwoFactor").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM LoginFailure").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("DELETE FROM Users").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var userDAO = NewDBUserDAO(db)
+	var deleted, deleteErr = userDAO.Delete(1)
+
+	assert.Nil(t, deleteErr)
+	assert.True(t, deleted)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbUserDAO_Delete_NotFound(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM Position").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE Report SET reporterId = NULLIF").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Event").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM EventLock").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM MeetRequest").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM UserBlock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM UserInterest").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Device").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Privacy").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Session").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM PasswordReset").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM RecoveryCode").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM TwoFactor").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM LoginFailure").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Users").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	var userDAO = NewDBUserDAO(db)
+	var deleted, deleteErr = userDAO.Delete(1)
+
+	assert.Nil(t, deleteErr)
+	assert.False(t, deleted)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbUserDAO_Delete_DBError(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM Position").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE Report SET reporterId = NULLIF").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Event").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM EventLock").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM MeetRequest").WillReturnError(errors.New("failed to delete"))
+	mock.ExpectRollback()
+
+	var userDAO = NewDBUserDAO(db)
+	var _, deleteErr = userDAO.Delete(1)
+
+	assert.NotNil(t, deleteErr)
+	assert.Equal(t, "failed to delete", deleteErr.Error())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbUserDAO_SearchUsers_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT id, login, age").
+		WithArgs("%50\\%%", 10, 0).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login50%", 30, model.MALE, "about", "", model.RoleModerator, true, nil, ""),
+		)
+
+	var userDAO = NewDBUserDAO(db)
+	var users, searchErr = userDAO.SearchUsers("50%", 10, 0)
+
+	assert.Nil(t, searchErr)
+	assert.Equal(
+		t,
+		[]*model.User{
+			{Id: 1, Login: "login50%", Age: 30, Sex: model.MALE, About: "about", Role: model.RoleModerator, Banned: true},
+		},
+		users,
+	)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbUserDAO_SetBanned(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE Users SET banned").
+		WithArgs(true, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec("UPDATE Users SET banned").
+		WithArgs(true, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var userDAO = NewDBUserDAO(db)
+
+	var found, banErr = userDAO.SetBanned(1, true)
+	assert.Nil(t, banErr)
+	assert.True(t, found)
+
+	found, banErr = userDAO.SetBanned(2, true)
+	assert.Nil(t, banErr)
+	assert.False(t, found)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbUserDAO_SetPhoto(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE Users SET photo = NULLIF").
+		WithArgs("photos/1/abc", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec("UPDATE Users SET photo = NULLIF").
+		WithArgs("", 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var userDAO = NewDBUserDAO(db)
+
+	var found, setErr = userDAO.SetPhoto(1, "photos/1/abc")
+	assert.Nil(t, setErr)
+	assert.True(t, found)
+
+	found, setErr = userDAO.SetPhoto(2, "")
+	assert.Nil(t, setErr)
+	assert.False(t, found)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
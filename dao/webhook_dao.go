@@ -0,0 +1,243 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	createWebhookSubscription = `
+		INSERT INTO WebhookSubscription (url, secret, events) VALUES ($1, $2, $3) RETURNING id, created
+	`
+	getWebhookSubscriptions   = `SELECT id, url, events, created FROM WebhookSubscription ORDER BY id`
+	deleteWebhookSubscription = `DELETE FROM WebhookSubscription WHERE id = $1`
+	enqueueWebhook            = `
+		INSERT INTO WebhookDelivery (subscriptionId, eventType, payload)
+		SELECT id, $1, $2 FROM WebhookSubscription
+		WHERE cardinality(events) = 0 OR $1 = ANY(events)
+	`
+	// SKIP LOCKED lets instances claim different deliveries at the same time
+	claimWebhookDeliveries = `
+		UPDATE WebhookDelivery d SET nextAttempt = now() + $2 * interval '1 second'
+		FROM WebhookSubscription s
+		WHERE s.id = d.subscriptionId AND d.id IN (
+			SELECT id FROM WebhookDelivery
+			WHERE status = 'pending' AND nextAttempt <= now()
+			ORDER BY nextAttempt
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.subscriptionId, s.url, s.secret, d.eventType, d.payload, d.attempts
+	`
+	markWebhookDelivered = `
+		UPDATE WebhookDelivery SET status = 'delivered', attempts = attempts + 1, lastError = NULL WHERE id = $1
+	`
+	markWebhookFailed = `
+		UPDATE WebhookDelivery SET attempts = attempts + 1, lastError = $2, nextAttempt = now() + $3 * interval '1 second'
+		WHERE id = $1
+	`
+	markWebhookDead = `
+		UPDATE WebhookDelivery SET status = 'dead', attempts = attempts + 1, lastError = $2 WHERE id = $1
+	`
+	getWebhookDeliveries = `
+		SELECT d.id, d.subscriptionId, s.url, d.eventType, d.payload, d.status, d.attempts, d.nextAttempt,
+			COALESCE(d.lastError, ''), d.created FROM WebhookDelivery d
+			JOIN WebhookSubscription s ON d.subscriptionId = s.id
+		WHERE d.status = $1
+		ORDER BY d.id DESC
+		LIMIT $2 OFFSET $3
+	`
+	// payloads refer to users by ids only, see webhook.RequestData
+	getUserWebhookDeliveries = `
+		SELECT d.id, d.subscriptionId, s.url, d.eventType, d.payload, d.status, d.attempts, d.nextAttempt,
+			COALESCE(d.lastError, ''), d.created FROM WebhookDelivery d
+			JOIN WebhookSubscription s ON d.subscriptionId = s.id
+		WHERE $1 IN (
+			(d.payload::json #>> '{data,requester_id}')::int,
+			(d.payload::json #>> '{data,requested_id}')::int
+		)
+		ORDER BY d.id
+	`
+	replayWebhookDelivery = `
+		UPDATE WebhookDelivery SET status = 'pending', attempts = 0, nextAttempt = now()
+		WHERE id = $1 AND status = 'dead'
+	`
+	deleteOldWebhookDeliveries = `
+		DELETE FROM WebhookDelivery WHERE status = 'delivered' AND age(now(), created) > $1 * interval '1 day'
+	`
+)
+
+// WebhookDAO keeps webhook subscriptions and the queue of their deliveries.
+type WebhookDAO interface {
+	// CreateSubscription saves the subscription and sets its id and time.
+	CreateSubscription(subscription *model.WebhookSubscription) error
+	// GetSubscriptions returns subscriptions without secrets.
+	GetSubscriptions() ([]*model.WebhookSubscription, error)
+	// DeleteSubscription removes the subscription with all its deliveries.
+	// It returns false if there is no such subscription.
+	DeleteSubscription(id int) (bool, error)
+	// Enqueue saves a delivery of the payload for every subscription to the event type.
+	Enqueue(eventType string, payload []byte) error
+	// ClaimDeliveries returns at most limit due deliveries together with URLs and
+	// secrets of their subscriptions. They are postponed by lease, so that other
+	// instances do not take them while they are being sent.
+	ClaimDeliveries(limit int, lease time.Duration) ([]*model.WebhookDelivery, error)
+	MarkDelivered(id int64) error
+	// MarkFailed schedules the next attempt of the delivery after retryIn.
+	MarkFailed(id int64, errMsg string, retryIn time.Duration) error
+	// MarkDead stops attempts of the delivery until it is replayed.
+	MarkDead(id int64, errMsg string) error
+	// GetDeliveries returns deliveries with given status, the newest first.
+	GetDeliveries(status string, limit int, offset int) ([]*model.WebhookDelivery, error)
+	// GetUserDeliveries returns deliveries of events about requests of the user, the oldest first.
+	GetUserDeliveries(userId int) ([]*model.WebhookDelivery, error)
+	// Replay makes a dead delivery due with a fresh count of attempts.
+	// It returns false if there is no such dead delivery.
+	Replay(id int64) (bool, error)
+	// DeleteOldDeliveries removes successful deliveries older than retentionDays.
+	// Dead ones are kept until they are replayed.
+	DeleteOldDeliveries(retentionDays int) error
+}
+
+type dbWebhookDAO struct {
+	db *sql.DB
+}
+
+func NewDBWebhookDAO(db *sql.DB) WebhookDAO {
+	var result = new(dbWebhookDAO)
+	result.db = db
+	return result
+}
+
+func (dao *dbWebhookDAO) CreateSubscription(subscription *model.WebhookSubscription) error {
+	return dao.db.QueryRow(
+		createWebhookSubscription, subscription.URL, subscription.Secret, pq.Array(subscription.Events),
+	).Scan(&subscription.Id, &subscription.Time)
+}
+
+func (dao *dbWebhookDAO) GetSubscriptions() ([]*model.WebhookSubscription, error) {
+	var rows, err = dao.db.Query(getWebhookSubscriptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result = make([]*model.WebhookSubscription, 0)
+	for rows.Next() {
+		var subscription = &model.WebhookSubscription{Events: make([]string, 0)}
+		var err = rows.Scan(&subscription.Id, &subscription.URL, pq.Array(&subscription.Events), &subscription.Time)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, subscription)
+	}
+	return result, rows.Err()
+}
+
+func (dao *dbWebhookDAO) DeleteSubscription(id int) (bool, error) {
+	return execAffected(dao.db, deleteWebhookSubscription, id)
+}
+
+func (dao *dbWebhookDAO) Enqueue(eventType string, payload []byte) error {
+	var _, err = dao.db.Exec(enqueueWebhook, eventType, string(payload))
+	return err
+}
+
+func (dao *dbWebhookDAO) ClaimDeliveries(limit int, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	var rows, err = dao.db.Query(claimWebhookDeliveries, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result = make([]*model.WebhookDelivery, 0)
+	for rows.Next() {
+		var delivery = &model.WebhookDelivery{Status: model.DeliveryPending}
+		var payload string
+		var err = rows.Scan(
+			&delivery.Id,
+			&delivery.SubscriptionId,
+			&delivery.URL,
+			&delivery.Secret,
+			&delivery.EventType,
+			&payload,
+			&delivery.Attempts,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = []byte(payload)
+		result = append(result, delivery)
+	}
+	return result, rows.Err()
+}
+
+func (dao *dbWebhookDAO) MarkDelivered(id int64) error {
+	var _, err = dao.db.Exec(markWebhookDelivered, id)
+	return err
+}
+
+func (dao *dbWebhookDAO) MarkFailed(id int64, errMsg string, retryIn time.Duration) error {
+	var _, err = dao.db.Exec(markWebhookFailed, id, errMsg, retryIn.Seconds())
+	return err
+}
+
+func (dao *dbWebhookDAO) MarkDead(id int64, errMsg string) error {
+	var _, err = dao.db.Exec(markWebhookDead, id, errMsg)
+	return err
+}
+
+func (dao *dbWebhookDAO) GetDeliveries(status string, limit int, offset int) ([]*model.WebhookDelivery, error) {
+	var rows, err = dao.db.Query(getWebhookDeliveries, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+func (dao *dbWebhookDAO) GetUserDeliveries(userId int) ([]*model.WebhookDelivery, error) {
+	var rows, err = dao.db.Query(getUserWebhookDeliveries, userId)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+func (dao *dbWebhookDAO) Replay(id int64) (bool, error) {
+	return execAffected(dao.db, replayWebhookDelivery, id)
+}
+
+func (dao *dbWebhookDAO) DeleteOldDeliveries(retentionDays int) error {
+	var _, err = dao.db.Exec(deleteOldWebhookDeliveries, retentionDays)
+	return err
+}
+
+func scanDeliveries(rows *sql.Rows) ([]*model.WebhookDelivery, error) {
+	defer rows.Close()
+
+	var result = make([]*model.WebhookDelivery, 0)
+	for rows.Next() {
+		var delivery = new(model.WebhookDelivery)
+		var payload string
+		var err = rows.Scan(
+			&delivery.Id,
+			&delivery.SubscriptionId,
+			&delivery.URL,
+			&delivery.EventType,
+			&payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttempt,
+			&delivery.LastError,
+			&delivery.Time,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = []byte(payload)
+		result = append(result, delivery)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,158 @@
+package dao
+
+import (
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"testing"
+	"time"
+)
+
+func TestDbWebhookDAO_CreateSubscription_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var created = time.Now()
+	var events = []string{model.WebhookRequestCreated}
+	mock.
+		ExpectQuery("INSERT INTO WebhookSubscription").
+		WithArgs("https://partner.example", "0123456789abcdef", pq.Array(events)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created"}).AddRow(1, created))
+
+	var webhookDAO = NewDBWebhookDAO(db)
+	var subscription = &model.WebhookSubscription{
+		URL: "https://partner.example", Secret: "0123456789abcdef", Events: events,
+	}
+
+	assert.Nil(t, webhookDAO.CreateSubscription(subscription))
+	assert.Equal(t, 1, subscription.Id)
+	assert.Equal(t, created, time.Time(subscription.Time))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbWebhookDAO_Enqueue_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("INSERT INTO WebhookDelivery").
+		WithArgs(model.WebhookRequestExpired, "{}").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	var webhookDAO = NewDBWebhookDAO(db)
+	assert.Nil(t, webhookDAO.Enqueue(model.WebhookRequestExpired, []byte("{}")))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbWebhookDAO_ClaimDeliveries_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("UPDATE WebhookDelivery d SET nextAttempt").
+		WithArgs(10, 30.0).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "subscriptionId", "url", "secret", "eventType", "payload", "attempts"}).
+				AddRow(5, 1, "https://partner.example", "0123456789abcdef", model.WebhookRequestCreated, "{}", 2),
+		)
+
+	var webhookDAO = NewDBWebhookDAO(db)
+	var deliveries, dbErr = webhookDAO.ClaimDeliveries(10, 30*time.Second)
+
+	assert.Nil(t, dbErr)
+	assert.Equal(t, []*model.WebhookDelivery{{
+		Id:             5,
+		SubscriptionId: 1,
+		URL:            "https://partner.example",
+		Secret:         "0123456789abcdef",
+		EventType:      model.WebhookRequestCreated,
+		Payload:        []byte("{}"),
+		Status:         model.DeliveryPending,
+		Attempts:       2,
+	}}, deliveries)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbWebhookDAO_MarkFailed_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE WebhookDelivery SET attempts = attempts \\+ 1").
+		WithArgs(5, "responded with 500", 60.0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var webhookDAO = NewDBWebhookDAO(db)
+	assert.Nil(t, webhookDAO.MarkFailed(5, "responded with 500", time.Minute))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbWebhookDAO_Replay_NotDead(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE WebhookDelivery SET status = 'pending'").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var webhookDAO = NewDBWebhookDAO(db)
+	var replayed, dbErr = webhookDAO.Replay(5)
+
+	assert.Nil(t, dbErr)
+	assert.False(t, replayed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDbWebhookDAO_GetUserDeliveries_Success(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var payload = `{"data": {"request_id": 10, "requester_id": 1, "requested_id": 2}}`
+	mock.
+		ExpectQuery("WHERE \\$1 IN \\(").
+		WithArgs(2).
+		WillReturnRows(
+			sqlmock.NewRows([]string{
+				"id", "subscriptionId", "url", "eventType", "payload", "status", "attempts", "nextAttempt",
+				"lastError", "created",
+			}).AddRow(
+				5, 1, "https://partner.example", model.WebhookRequestCreated, payload,
+				model.DeliveryDelivered, 1, time.Now(), "", time.Now(),
+			),
+		)
+
+	var webhookDAO = NewDBWebhookDAO(db)
+	var deliveries, dbErr = webhookDAO.GetUserDeliveries(2)
+
+	assert.Nil(t, dbErr)
+	assert.Equal(t, 1, len(deliveries))
+	assert.Equal(t, int64(5), deliveries[0].Id)
+	assert.Equal(t, payload, string(deliveries[0].Payload))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,138 @@
+package hashing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+const (
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+
+	defaultArgon2Time    = 1
+	defaultArgon2Memory  = 64 * 1024
+	defaultArgon2Threads = 4
+
+	// $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+	argon2Template       = "$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s"
+	argon2ParamsTemplate = "m=%d,t=%d,p=%d"
+)
+
+var (
+	argon2Prefix          = []byte("$argon2id$")
+	errArgon2Malformed    = errors.New("malformed argon2id hash")
+	errArgon2Incompatible = errors.New("incompatible argon2id version")
+	errPasswordMismatch   = errors.New("password does not match hash")
+)
+
+type argon2Algorithm struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+type argon2Hash struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func newArgon2Algorithm(time uint32, memory uint32, threads uint8) *argon2Algorithm {
+	var result = &argon2Algorithm{time: time, memory: memory, threads: threads}
+	if result.time == 0 {
+		result.time = defaultArgon2Time
+	}
+	if result.memory == 0 {
+		result.memory = defaultArgon2Memory
+	}
+	if result.threads == 0 {
+		result.threads = defaultArgon2Threads
+	}
+	return result
+}
+
+func (alg *argon2Algorithm) name() string {
+	return Argon2id
+}
+
+func (alg *argon2Algorithm) matches(hash []byte) bool {
+	return bytes.HasPrefix(hash, argon2Prefix)
+}
+
+func (alg *argon2Algorithm) hash(password []byte) ([]byte, error) {
+	var salt = make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	var key = argon2.IDKey(password, salt, alg.time, alg.memory, alg.threads, argon2KeyLen)
+	var encoded = fmt.Sprintf(
+		argon2Template,
+		argon2.Version,
+		alg.memory,
+		alg.time,
+		alg.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+	return []byte(encoded), nil
+}
+
+func (alg *argon2Algorithm) validate(password []byte, hash []byte) error {
+	var parsed, err = parseArgon2Hash(hash)
+	if err != nil {
+		return err
+	}
+
+	var key = argon2.IDKey(password, parsed.salt, parsed.time, parsed.memory, parsed.threads, uint32(len(parsed.key)))
+	if subtle.ConstantTimeCompare(key, parsed.key) != 1 {
+		return errPasswordMismatch
+	}
+	return nil
+}
+
+func (alg *argon2Algorithm) outdated(hash []byte) bool {
+	var parsed, err = parseArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+	return parsed.time != alg.time || parsed.memory != alg.memory || parsed.threads != alg.threads
+}
+
+func parseArgon2Hash(hash []byte) (*argon2Hash, error) {
+	// leading "$" produces an empty first part
+	var parts = strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return nil, errArgon2Malformed
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, errArgon2Malformed
+	}
+	if version != argon2.Version {
+		return nil, errArgon2Incompatible
+	}
+
+	var result = new(argon2Hash)
+	if _, err := fmt.Sscanf(parts[3], argon2ParamsTemplate, &result.memory, &result.time, &result.threads); err != nil {
+		return nil, errArgon2Malformed
+	}
+
+	var err error
+	if result.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, errArgon2Malformed
+	}
+	if result.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, errArgon2Malformed
+	}
+	return result, nil
+}
@@ -0,0 +1,49 @@
+package hashing
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var bcryptPrefixes = [][]byte{[]byte("$2a$"), []byte("$2b$"), []byte("$2y$")}
+
+type bcryptAlgorithm struct {
+	cost int
+}
+
+func newBcryptAlgorithm(cost int) (*bcryptAlgorithm, error) {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost %d is out of range [%d, %d]", cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &bcryptAlgorithm{cost: cost}, nil
+}
+
+func (alg *bcryptAlgorithm) name() string {
+	return Bcrypt
+}
+
+func (alg *bcryptAlgorithm) matches(hash []byte) bool {
+	for _, prefix := range bcryptPrefixes {
+		if bytes.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (alg *bcryptAlgorithm) hash(password []byte) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(password, alg.cost)
+}
+
+func (alg *bcryptAlgorithm) validate(password []byte, hash []byte) error {
+	return bcrypt.CompareHashAndPassword(hash, password)
+}
+
+func (alg *bcryptAlgorithm) outdated(hash []byte) bool {
+	var cost, err = bcrypt.Cost(hash)
+	return err != nil || cost != alg.cost
+}
@@ -0,0 +1,92 @@
+package hashing
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/config"
+)
+
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+var errUnknownHashFormat = errors.New("unknown password hash format")
+
+// Hasher hashes passwords with the configured algorithm and validates hashes
+// produced by any supported algorithm (including legacy unsalted SHA-256 ones).
+// Every hash except the legacy one starts with an algorithm prefix in modular
+// crypt format ("$2a$" for bcrypt, "$argon2id$" for argon2id), so stored hashes
+// remain verifiable after the configured algorithm changes.
+type Hasher interface {
+	Hash(password []byte) ([]byte, error)
+	Validate(password []byte, hash []byte) error
+	// NeedsRehash reports whether hash was produced by an algorithm or with
+	// parameters other than the configured ones.
+	NeedsRehash(hash []byte) bool
+}
+
+type algorithm interface {
+	name() string
+	matches(hash []byte) bool
+	hash(password []byte) ([]byte, error)
+	validate(password []byte, hash []byte) error
+	outdated(hash []byte) bool
+}
+
+func NewHasher(conf config.PasswordHashConfig) (Hasher, error) {
+	var bcryptAlg, bcryptErr = newBcryptAlgorithm(conf.BcryptCost)
+	if bcryptErr != nil {
+		return nil, bcryptErr
+	}
+	var argon2Alg = newArgon2Algorithm(conf.Argon2Time, conf.Argon2Memory, conf.Argon2Threads)
+
+	var preferred algorithm
+	switch conf.Algorithm {
+	case Bcrypt, "":
+		preferred = bcryptAlg
+	case Argon2id:
+		preferred = argon2Alg
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm \"%s\"", conf.Algorithm)
+	}
+
+	return &hasher{
+		preferred: preferred,
+		known:     []algorithm{bcryptAlg, argon2Alg, legacyAlgorithm{}},
+	}, nil
+}
+
+type hasher struct {
+	preferred algorithm
+	known     []algorithm
+}
+
+func (h *hasher) Hash(password []byte) ([]byte, error) {
+	return h.preferred.hash(password)
+}
+
+func (h *hasher) Validate(password []byte, hash []byte) error {
+	var alg = h.find(hash)
+	if alg == nil {
+		return errUnknownHashFormat
+	}
+	return alg.validate(password, hash)
+}
+
+func (h *hasher) NeedsRehash(hash []byte) bool {
+	var alg = h.find(hash)
+	if alg == nil {
+		return true
+	}
+	return alg.name() != h.preferred.name() || alg.outdated(hash)
+}
+
+func (h *hasher) find(hash []byte) algorithm {
+	for _, alg := range h.known {
+		if alg.matches(hash) {
+			return alg
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package hashing
+
+import (
+	"crypto/sha256"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func TestNewHasher_UnknownAlgorithm(t *testing.T) {
+	var _, err = NewHasher(config.PasswordHashConfig{Algorithm: "md5"})
+	assert.NotNil(t, err)
+}
+
+func TestNewHasher_BadBcryptCost(t *testing.T) {
+	var _, err = NewHasher(config.PasswordHashConfig{Algorithm: Bcrypt, BcryptCost: bcrypt.MaxCost + 1})
+	assert.NotNil(t, err)
+}
+
+func TestHasher_Bcrypt(t *testing.T) {
+	var hasher, err = NewHasher(config.PasswordHashConfig{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost})
+	assert.Nil(t, err)
+
+	var hash, hashErr = hasher.Hash([]byte("password"))
+	assert.Nil(t, hashErr)
+	assert.True(t, strings.HasPrefix(string(hash), "$2a$"))
+
+	assert.Nil(t, hasher.Validate([]byte("password"), hash))
+	assert.NotNil(t, hasher.Validate([]byte("wrong"), hash))
+	assert.False(t, hasher.NeedsRehash(hash))
+}
+
+func TestHasher_Argon2id(t *testing.T) {
+	var hasher, err = NewHasher(config.PasswordHashConfig{Algorithm: Argon2id, Argon2Memory: 1024})
+	assert.Nil(t, err)
+
+	var hash, hashErr = hasher.Hash([]byte("password"))
+	assert.Nil(t, hashErr)
+	assert.True(t, strings.HasPrefix(string(hash), "$argon2id$v=19$m=1024,t=1,p=4$"))
+
+	assert.Nil(t, hasher.Validate([]byte("password"), hash))
+	assert.NotNil(t, hasher.Validate([]byte("wrong"), hash))
+	assert.False(t, hasher.NeedsRehash(hash))
+}
+
+func TestHasher_Argon2idMalformed(t *testing.T) {
+	var hasher, _ = NewHasher(config.PasswordHashConfig{Algorithm: Argon2id})
+
+	assert.NotNil(t, hasher.Validate([]byte("password"), []byte("$argon2id$v=19$garbage")))
+	assert.NotNil(t, hasher.Validate([]byte("password"), []byte("$argon2id$v=16$m=1024,t=1,p=4$c2FsdA$a2V5")))
+	assert.True(t, hasher.NeedsRehash([]byte("$argon2id$v=19$garbage")))
+}
+
+func TestHasher_Legacy(t *testing.T) {
+	var hasher, _ = NewHasher(config.PasswordHashConfig{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost})
+	var legacyHash = sha256.Sum256([]byte("password"))
+
+	assert.Nil(t, hasher.Validate([]byte("password"), legacyHash[:]))
+	assert.NotNil(t, hasher.Validate([]byte("wrong"), legacyHash[:]))
+	assert.True(t, hasher.NeedsRehash(legacyHash[:]))
+}
+
+func TestHasher_UnknownFormat(t *testing.T) {
+	var hasher, _ = NewHasher(config.PasswordHashConfig{})
+
+	assert.Equal(t, errUnknownHashFormat, hasher.Validate([]byte("password"), []byte("pass")))
+	assert.True(t, hasher.NeedsRehash([]byte("pass")))
+}
+
+func TestHasher_NeedsRehash(t *testing.T) {
+	var bcryptHasher, _ = NewHasher(config.PasswordHashConfig{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost})
+	var strongerBcryptHasher, _ = NewHasher(config.PasswordHashConfig{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost + 1})
+	var argon2Hasher, _ = NewHasher(config.PasswordHashConfig{Algorithm: Argon2id, Argon2Memory: 1024})
+	var strongerArgon2Hasher, _ = NewHasher(config.PasswordHashConfig{Algorithm: Argon2id, Argon2Memory: 2048})
+
+	var bcryptHash, _ = bcryptHasher.Hash([]byte("password"))
+	var argon2Hash, _ = argon2Hasher.Hash([]byte("password"))
+
+	assert.True(t, strongerBcryptHasher.NeedsRehash(bcryptHash))
+	assert.True(t, argon2Hasher.NeedsRehash(bcryptHash))
+	assert.True(t, bcryptHasher.NeedsRehash(argon2Hash))
+	assert.True(t, strongerArgon2Hasher.NeedsRehash(argon2Hash))
+
+	// hashes stay valid whatever algorithm is preferred
+	assert.Nil(t, argon2Hasher.Validate([]byte("password"), bcryptHash))
+	assert.Nil(t, bcryptHasher.Validate([]byte("password"), argon2Hash))
+}
@@ -0,0 +1,37 @@
+package hashing
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+)
+
+const legacyName = "sha256"
+
+// legacyAlgorithm verifies unsalted SHA-256 hashes stored before the password
+// hashing subsystem was introduced. It is never used to produce new hashes.
+type legacyAlgorithm struct{}
+
+func (legacyAlgorithm) name() string {
+	return legacyName
+}
+
+func (legacyAlgorithm) matches(hash []byte) bool {
+	return len(hash) == sha256.Size
+}
+
+func (legacyAlgorithm) hash(password []byte) ([]byte, error) {
+	return nil, errors.New("legacy sha256 hashes must not be produced")
+}
+
+func (legacyAlgorithm) validate(password []byte, hash []byte) error {
+	var passHash = sha256.Sum256(password)
+	if subtle.ConstantTimeCompare(passHash[:], hash) != 1 {
+		return errPasswordMismatch
+	}
+	return nil
+}
+
+func (legacyAlgorithm) outdated(hash []byte) bool {
+	return true
+}
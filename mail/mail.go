@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/config"
+	"mime"
+	"time"
+)
+
+const (
+	SMTP   = "smtp"
+	File   = "file"
+	Memory = "memory"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+func NewMailer(conf config.MailConfig) (Mailer, error) {
+	switch conf.Sender {
+	case SMTP:
+		return newSMTPMailer(conf), nil
+	case File:
+		return newFileMailer(conf.DumpDir, conf.From)
+	case Memory, "":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail sender \"%s\"", conf.Sender)
+	}
+}
+
+// format renders msg as a plain text RFC 5322 message.
+func format(from string, msg Message, date time.Time) []byte {
+	var buf = new(bytes.Buffer)
+	fmt.Fprintf(buf, "From: %s\r\n", from)
+	fmt.Fprintf(buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(msg.Body)
+	return buf.Bytes()
+}
@@ -0,0 +1,62 @@
+package mail
+
+import (
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewMailer_Unknown(t *testing.T) {
+	var _, err = NewMailer(config.MailConfig{Sender: "pigeon"})
+	assert.NotNil(t, err)
+}
+
+func TestMemoryMailer(t *testing.T) {
+	var mailer, err = NewMailer(config.MailConfig{Sender: Memory})
+	assert.Nil(t, err)
+
+	assert.Nil(t, mailer.Send(Message{To: "a@b.c", Subject: "subject", Body: "body"}))
+	assert.Equal(t, []Message{{To: "a@b.c", Subject: "subject", Body: "body"}}, mailer.(*MemoryMailer).Messages())
+}
+
+func TestFileMailer(t *testing.T) {
+	var dir, dirErr = ioutil.TempDir("", "mail")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+
+	var mailer, err = NewMailer(config.MailConfig{Sender: File, DumpDir: dir, From: "noreply@b.c"})
+	assert.Nil(t, err)
+	assert.Nil(t, mailer.Send(Message{To: "a@b.c", Subject: "subject", Body: "body"}))
+
+	var files, _ = filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.Equal(t, 1, len(files))
+
+	var data, _ = ioutil.ReadFile(files[0])
+	assert.True(t, strings.Contains(string(data), "To: a@b.c\r\n"))
+	assert.True(t, strings.HasSuffix(string(data), "\r\n\r\nbody"))
+}
+
+func TestFormat(t *testing.T) {
+	var date = time.Date(2017, 10, 17, 0, 0, 0, 0, time.UTC)
+	var data = format("noreply@b.c", Message{To: "a@b.c", Subject: "Сброс", Body: "body"}, date)
+
+	assert.Equal(
+		t,
+		"From: noreply@b.c\r\n"+
+			"To: a@b.c\r\n"+
+			"Subject: =?utf-8?q?=D0=A1=D0=B1=D1=80=D0=BE=D1=81?=\r\n"+
+			"Date: Tue, 17 Oct 2017 00:00:00 +0000\r\n"+
+			"MIME-Version: 1.0\r\n"+
+			"Content-Type: text/plain; charset=utf-8\r\n"+
+			"\r\n"+
+			"body",
+		string(data),
+	)
+}
@@ -0,0 +1,82 @@
+package mail
+
+import (
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/config"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func newSMTPMailer(conf config.MailConfig) Mailer {
+	var auth smtp.Auth
+	if conf.SMTPUser != "" {
+		auth = smtp.PlainAuth("", conf.SMTPUser, conf.SMTPPassword, conf.SMTPHost)
+	}
+	return &smtpMailer{
+		addr: fmt.Sprintf("%s:%d", conf.SMTPHost, conf.SMTPPort),
+		from: conf.From,
+		auth: auth,
+	}
+}
+
+func (m *smtpMailer) Send(msg Message) error {
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, format(m.from, msg, time.Now()))
+}
+
+// fileMailer writes every message into a separate .eml file. It is meant
+// for local development where there is no SMTP server.
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+func newFileMailer(dir string, from string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &fileMailer{dir: dir, from: from}, nil
+}
+
+func (m *fileMailer) Send(msg Message) error {
+	var now = time.Now()
+	var name = fmt.Sprintf("%d-%s.eml", now.UnixNano(), strings.Replace(msg.To, string(filepath.Separator), "_", -1))
+	return ioutil.WriteFile(filepath.Join(m.dir, name), format(m.from, msg, now), 0600)
+}
+
+// MemoryMailer keeps sent messages so that tests can inspect them.
+type MemoryMailer struct {
+	lock     sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{messages: make([]Message, 0)}
+}
+
+func (m *MemoryMailer) Send(msg Message) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *MemoryMailer) Messages() []Message {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var result = make([]Message, len(m.messages))
+	copy(result, m.messages)
+	return result
+}
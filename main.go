@@ -25,7 +25,10 @@ func main() {
 	}
 	var logger = mylog.NewLogger(os.Stdout)
 
-	var env = server.NewEnv(db, conf, logger)
+	var env, envErr = server.NewEnv(db, conf, logger)
+	if envErr != nil {
+		panic(envErr)
+	}
 	var router = server.GetRouter(env)
 
 	var portLine = fmt.Sprintf(":%d", getServerPort(conf))
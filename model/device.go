@@ -0,0 +1,59 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	PlatformFCM  = "fcm"
+	PlatformAPNs = "apns"
+
+	MaxDeviceTokenLength = 512 // length of Device.token column
+
+	DeviceRequiredToken    = "\"token\" field required"
+	DeviceRequiredPlatform = "\"platform\" field required"
+	DeviceEmptyToken       = "token must not be empty"
+	DeviceInvalidPlatform  = "platform must be either \"fcm\" or \"apns\""
+)
+
+var DeviceTokenTooLong = fmt.Sprintf("token must not be longer than %d characters", MaxDeviceTokenLength)
+
+// Device is a push notification token of an app installation. FCM tokens
+// come from Android devices, APNs tokens from iOS ones.
+type Device struct {
+	Token    string `json:"token"`
+	Platform string `json:"platform"`
+}
+
+func (device *Device) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(
+		data,
+		[]string{"token", "platform"},
+		[]string{DeviceRequiredToken, DeviceRequiredPlatform},
+	)
+	if err != nil {
+		return err
+	}
+
+	type deviceAlias Device
+	var dest = (*deviceAlias)(device)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+
+	device.Token = strings.TrimSpace(device.Token)
+	if device.Token == "" {
+		return errors.New(DeviceEmptyToken)
+	}
+	if len(device.Token) > MaxDeviceTokenLength {
+		return errors.New(DeviceTokenTooLong)
+	}
+	if device.Platform != PlatformFCM && device.Platform != PlatformAPNs {
+		return errors.New(DeviceInvalidPlatform)
+	}
+	return nil
+}
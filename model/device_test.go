@@ -0,0 +1,35 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestDevice_Unmarshal(t *testing.T) {
+	var device = Device{}
+	assert.Nil(t, json.Unmarshal([]byte("{\"token\": \" abc \", \"platform\": \"apns\"}"), &device))
+	assert.Equal(t, Device{Token: "abc", Platform: PlatformAPNs}, device)
+}
+
+func TestDevice_UnmarshalErrors(t *testing.T) {
+	var testData = []struct {
+		data   string
+		errMsg string
+	}{
+		{"{\"platform\": \"fcm\"}", DeviceRequiredToken},
+		{"{\"token\": \"abc\"}", DeviceRequiredPlatform},
+		{"{\"token\": \" \", \"platform\": \"fcm\"}", DeviceEmptyToken},
+		{"{\"token\": \"" + strings.Repeat("a", MaxDeviceTokenLength+1) + "\", \"platform\": \"fcm\"}", DeviceTokenTooLong},
+		{"{\"token\": \"abc\", \"platform\": \"wns\"}", DeviceInvalidPlatform},
+	}
+
+	for i, item := range testData {
+		var device = Device{}
+		var err = json.Unmarshal([]byte(item.data), &device)
+		if assert.NotNil(t, err, i) {
+			assert.True(t, strings.Contains(err.Error(), item.errMsg), i)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+const (
+	EventAckRequiredId = "\"id\" field required"
+	EventAckInvalidId  = "\"id\" must be positive"
+)
+
+// Event tells a user that a meet request sent by or addressed to them has
+// got a new status. Request holds the status the request had when the event
+// was created. Event ids grow monotonically, so the id of the last received
+// event serves as a cursor for the next poll.
+type Event struct {
+	Id      int64        `json:"id"`
+	Time    QuotedTime   `json:"time"`
+	Request *MeetRequest `json:"request"`
+}
+
+// EventAck confirms delivery of all events up to the one with Id inclusive.
+type EventAck struct {
+	Id int64 `json:"id"`
+}
+
+func (ack *EventAck) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(data, []string{"id"}, []string{EventAckRequiredId})
+	if err != nil {
+		return err
+	}
+
+	type ackAlias EventAck
+	var dest = (*ackAlias)(ack)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+
+	if ack.Id <= 0 {
+		return errors.New(EventAckInvalidId)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEventAck_UnmarshalJSON(t *testing.T) {
+	var testData = []struct {
+		body   string
+		id     int64
+		errMsg string
+	}{
+		{`{"id": 42}`, 42, ""},
+		{`{}`, 0, EventAckRequiredId},
+		{`{"id": 0}`, 0, EventAckInvalidId},
+	}
+
+	for i, item := range testData {
+		var ack EventAck
+		var err = json.Unmarshal([]byte(item.body), &ack)
+		if item.errMsg == "" {
+			assert.Nil(t, err, i)
+			assert.Equal(t, item.id, ack.Id, i)
+		} else {
+			assert.NotNil(t, err, i)
+			assert.Equal(t, item.errMsg, err.Error(), i)
+		}
+	}
+}
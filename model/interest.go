@@ -0,0 +1,109 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaxInterests      = 20
+	MaxInterestLength = 50 // length of Interest.name column
+
+	InterestListRequired = "\"interests\" field required"
+	InterestRequiredName = "\"name\" field required"
+	InterestEmpty        = "interest must not be empty"
+	InterestInvalidChars = "interest may contain only letters, digits, spaces and dashes"
+)
+
+var (
+	InterestTooLong  = fmt.Sprintf("interest must not be longer than %d characters", MaxInterestLength)
+	TooManyInterests = fmt.Sprintf("there must be at most %d interests", MaxInterests)
+)
+
+// Interest is a tag a user attaches to the profile, e.g. "board games".
+type Interest struct {
+	Name string `json:"name"`
+}
+
+func (interest *Interest) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(data, []string{"name"}, []string{InterestRequiredName})
+	if err != nil {
+		return err
+	}
+
+	type interestAlias Interest
+	var dest = (*interestAlias)(interest)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+
+	interest.Name, err = NormalizeInterest(interest.Name)
+	return err
+}
+
+// InterestList replaces all interests of a user.
+type InterestList struct {
+	Interests []string `json:"interests"`
+}
+
+func (list *InterestList) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(data, []string{"interests"}, []string{InterestListRequired})
+	if err != nil {
+		return err
+	}
+
+	type listAlias InterestList
+	var dest = (*listAlias)(list)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+
+	list.Interests, err = NormalizeInterests(list.Interests)
+	return err
+}
+
+// NormalizeInterests normalizes every interest and drops duplicates
+// keeping the original order.
+func NormalizeInterests(names []string) ([]string, error) {
+	var result = make([]string, 0, len(names))
+	var seen = make(map[string]bool)
+	for _, name := range names {
+		var normalized, err = NormalizeInterest(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[normalized] {
+			seen[normalized] = true
+			result = append(result, normalized)
+		}
+	}
+
+	if len(result) > MaxInterests {
+		return nil, errors.New(TooManyInterests)
+	}
+	return result, nil
+}
+
+// NormalizeInterest lowercases the name and collapses whitespace,
+// so that "Board  Games" and "board games" are the same interest.
+func NormalizeInterest(name string) (string, error) {
+	var normalized = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	if normalized == "" {
+		return "", errors.New(InterestEmpty)
+	}
+	if utf8.RuneCountInString(normalized) > MaxInterestLength {
+		return "", errors.New(InterestTooLong)
+	}
+	for _, r := range normalized {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && r != '-' {
+			return "", errors.New(InterestInvalidChars)
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeInterest(t *testing.T) {
+	var testData = []struct {
+		name       string
+		normalized string
+		errMsg     string
+	}{
+		{"  Board \t Games ", "board games", ""},
+		{"Сноуборд", "сноуборд", ""},
+		{"sci-fi", "sci-fi", ""},
+		{" ", "", InterestEmpty},
+		{"c++", "", InterestInvalidChars},
+		{strings.Repeat("a", MaxInterestLength+1), "", InterestTooLong},
+	}
+
+	for i, item := range testData {
+		var normalized, err = NormalizeInterest(item.name)
+		assert.Equal(t, item.normalized, normalized, i)
+		if item.errMsg == "" {
+			assert.Nil(t, err, i)
+		} else {
+			assert.Equal(t, item.errMsg, err.Error(), i)
+		}
+	}
+}
+
+func TestInterestList_Unmarshal(t *testing.T) {
+	var list = InterestList{}
+	assert.Nil(t, json.Unmarshal([]byte("{\"interests\": [\"Chess\", \"chess\", \"Hiking\"]}"), &list))
+	assert.Equal(t, []string{"chess", "hiking"}, list.Interests)
+
+	var tooMany = make([]string, MaxInterests+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("\"tag%d\"", i)
+	}
+
+	var testData = []struct {
+		data   string
+		errMsg string
+	}{
+		{"{}", InterestListRequired},
+		{"{\"interests\": [\"\"]}", InterestEmpty},
+		{"{\"interests\": [" + strings.Join(tooMany, ",") + "]}", TooManyInterests},
+	}
+
+	for i, item := range testData {
+		var err = json.Unmarshal([]byte(item.data), &InterestList{})
+		assert.NotNil(t, err, i)
+		assert.Equal(t, item.errMsg, err.Error(), i)
+	}
+}
+
+func TestInterest_Unmarshal(t *testing.T) {
+	var interest = Interest{}
+	assert.Nil(t, json.Unmarshal([]byte("{\"name\": \" Jazz \"}"), &interest))
+	assert.Equal(t, "jazz", interest.Name)
+
+	var err = json.Unmarshal([]byte("{}"), &Interest{})
+	assert.Equal(t, InterestRequiredName, err.Error())
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	LoginFailureUnknownLogin  = "unknown_login"
+	LoginFailureWrongPassword = "wrong_password"
+	LoginFailureWrongCode     = "wrong_code"
+	LoginFailureThrottled     = "throttled"
+)
+
+// LoginAttempts counts recent failed sign in attempts made with the same login or from the same IP.
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// LoginFailure is a failed sign in attempt from the audit trail.
+type LoginFailure struct {
+	IP     string     `json:"ip"`
+	Reason string     `json:"reason"`
+	Time   QuotedTime `json:"time"`
+}
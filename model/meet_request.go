@@ -17,4 +17,9 @@ type MeetRequest struct {
 	RequestedAbout string     `json:"requested_about"`
 	Time           QuotedTime `json:"time"`
 	Status         string     `json:"status"`
+
+	RequesterPhotoKey string `json:"-"`
+	RequestedPhotoKey string `json:"-"`
+	RequesterPhoto    *Photo `json:"requester_photo,omitempty"`
+	RequestedPhoto    *Photo `json:"requested_photo,omitempty"`
 }
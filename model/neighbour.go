@@ -0,0 +1,104 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	NeighbourInvalidSex      = "\"sex\" must be either M or F"
+	NeighbourInvalidRadius   = "\"radius\" must be positive"
+	NeighbourInvalidCursor   = "invalid cursor"
+	NeighbourInvalidAgeRange = "\"min_age\" must not be greater than \"max_age\""
+
+	cursorSeparator = ":"
+)
+
+var (
+	NeighbourInvalidAge = fmt.Sprintf("\"min_age\" and \"max_age\" must be between %d and %d", MinAge, MaxAge)
+)
+
+// Neighbour is a user seen nearby as viewed by the one looking for neighbours.
+// User fields are inlined into JSON, so clients reading bare users still work.
+type Neighbour struct {
+	*User
+
+	// SharedInterests are interests the neighbour has in common with the viewer.
+	SharedInterests []string   `json:"shared_interests,omitempty"`
+	Distance        float64    `json:"distance"` // metres between latest positions
+	Bearing         float64    `json:"bearing"`  // degrees clockwise from north, from the viewer to the neighbour
+	LastSeen        QuotedTime `json:"last_seen"`
+}
+
+// NeighbourFilter narrows and pages the neighbour search.
+// Zero values of MinAge, MaxAge and Sex mean no restriction.
+type NeighbourFilter struct {
+	Radius        float64 // metres
+	OnlineTimeout int     // minutes
+	Interests     []string
+	MinAge        int
+	MaxAge        int
+	Sex           string
+	Limit         int
+	After         *NeighbourCursor
+}
+
+// Validate checks age and sex restrictions coming from the client.
+func (filter *NeighbourFilter) Validate() error {
+	for _, age := range []int{filter.MinAge, filter.MaxAge} {
+		if age != 0 && (age < MinAge || age > MaxAge) {
+			return errors.New(NeighbourInvalidAge)
+		}
+	}
+	if filter.MinAge != 0 && filter.MaxAge != 0 && filter.MinAge > filter.MaxAge {
+		return errors.New(NeighbourInvalidAgeRange)
+	}
+	if filter.Sex != UNKNOWN && filter.Sex != MALE && filter.Sex != FEMALE {
+		return errors.New(NeighbourInvalidSex)
+	}
+	return nil
+}
+
+// NeighbourCursor points at the last neighbour of a page. Neighbours are
+// ordered by rank (descending), then by distance and id, so the cursor keeps
+// all three. Rank is the number of shared interests if neighbours are
+// filtered by interests and 0 otherwise.
+type NeighbourCursor struct {
+	Rank     int
+	Distance float64
+	Id       int
+}
+
+// String returns an opaque representation of the cursor safe to put into URL.
+func (cursor *NeighbourCursor) String() string {
+	var plain = strings.Join([]string{
+		strconv.Itoa(cursor.Rank),
+		strconv.FormatFloat(cursor.Distance, 'g', -1, 64),
+		strconv.Itoa(cursor.Id),
+	}, cursorSeparator)
+	return base64.RawURLEncoding.EncodeToString([]byte(plain))
+}
+
+func ParseNeighbourCursor(str string) (*NeighbourCursor, error) {
+	var invalid = errors.New(NeighbourInvalidCursor)
+
+	var plain, decodeErr = base64.RawURLEncoding.DecodeString(str)
+	if decodeErr != nil {
+		return nil, invalid
+	}
+	var parts = strings.Split(string(plain), cursorSeparator)
+	if len(parts) != 3 {
+		return nil, invalid
+	}
+
+	var rank, rankErr = strconv.Atoi(parts[0])
+	var distance, distanceErr = strconv.ParseFloat(parts[1], 64)
+	var id, idErr = strconv.Atoi(parts[2])
+	if rankErr != nil || distanceErr != nil || idErr != nil || rank < 0 || distance < 0 {
+		return nil, invalid
+	}
+	return &NeighbourCursor{Rank: rank, Distance: distance, Id: id}, nil
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNeighbourFilter_Validate(t *testing.T) {
+	var testData = []struct {
+		filter NeighbourFilter
+		errMsg string
+	}{
+		{NeighbourFilter{}, ""},
+		{NeighbourFilter{MinAge: 20, MaxAge: 30, Sex: FEMALE}, ""},
+		{NeighbourFilter{MinAge: 30, MaxAge: 30}, ""},
+		{NeighbourFilter{MinAge: 10}, NeighbourInvalidAge},
+		{NeighbourFilter{MaxAge: MaxAge + 1}, NeighbourInvalidAge},
+		{NeighbourFilter{MinAge: 40, MaxAge: 30}, NeighbourInvalidAgeRange},
+		{NeighbourFilter{Sex: "X"}, NeighbourInvalidSex},
+	}
+
+	for i, item := range testData {
+		var err = item.filter.Validate()
+		if item.errMsg == "" {
+			assert.Nil(t, err, i)
+		} else {
+			assert.Equal(t, item.errMsg, err.Error(), i)
+		}
+	}
+}
+
+func TestNeighbourCursor_RoundTrip(t *testing.T) {
+	var cursor = &NeighbourCursor{Rank: 2, Distance: 123.456789, Id: 42}
+	var parsed, err = ParseNeighbourCursor(cursor.String())
+
+	assert.Nil(t, err)
+	assert.Equal(t, cursor, parsed)
+}
+
+func TestParseNeighbourCursor_Invalid(t *testing.T) {
+	for _, str := range []string{"", "!!!", "MToy", "YTpiOmM", "LTE6MTozIA"} {
+		var _, err = ParseNeighbourCursor(str)
+		assert.NotNil(t, err, str)
+	}
+}
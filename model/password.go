@@ -0,0 +1,88 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+const (
+	PasswordChangeRequiredOld   = "\"old_password\" field required"
+	PasswordChangeRequiredNew   = "\"new_password\" field required"
+	PasswordEmpty               = "password must not be empty"
+	PasswordResetRequiredLogin  = "either \"login\" or \"email\" field required"
+	PasswordResetRequiredToken  = "\"token\" field required"
+	PasswordResetRequiredPasswd = "\"password\" field required"
+)
+
+type PasswordChange struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+func (change *PasswordChange) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(
+		data,
+		[]string{"old_password", "new_password"},
+		[]string{PasswordChangeRequiredOld, PasswordChangeRequiredNew},
+	)
+	if err != nil {
+		return err
+	}
+
+	type changeAlias PasswordChange
+	var dest = (*changeAlias)(change)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+	if change.NewPassword == "" {
+		return errors.New(PasswordEmpty)
+	}
+	return nil
+}
+
+// PasswordResetRequest identifies the user by either login or email.
+type PasswordResetRequest struct {
+	Login string `json:"login"`
+	Email string `json:"email"`
+}
+
+func (request *PasswordResetRequest) UnmarshalJSON(data []byte) error {
+	type requestAlias PasswordResetRequest
+	var dest = (*requestAlias)(request)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+	if request.Login == "" && request.Email == "" {
+		return errors.New(PasswordResetRequiredLogin)
+	}
+	return nil
+}
+
+type PasswordResetConfirm struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (confirm *PasswordResetConfirm) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(
+		data,
+		[]string{"token", "password"},
+		[]string{PasswordResetRequiredToken, PasswordResetRequiredPasswd},
+	)
+	if err != nil {
+		return err
+	}
+
+	type confirmAlias PasswordResetConfirm
+	var dest = (*confirmAlias)(confirm)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+	if confirm.Password == "" {
+		return errors.New(PasswordEmpty)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPasswordChange_Unmarshal(t *testing.T) {
+	var change = PasswordChange{}
+	var err = json.Unmarshal([]byte("{\"old_password\": \"old\", \"new_password\": \"new\"}"), &change)
+
+	assert.Nil(t, err)
+	assert.Equal(t, PasswordChange{OldPassword: "old", NewPassword: "new"}, change)
+
+	err = json.Unmarshal([]byte("{\"old_password\": \"old\"}"), &change)
+	assert.Equal(t, PasswordChangeRequiredNew, err.Error())
+
+	err = json.Unmarshal([]byte("{\"old_password\": \"old\", \"new_password\": \"\"}"), &change)
+	assert.Equal(t, PasswordEmpty, err.Error())
+}
+
+func TestPasswordResetRequest_Unmarshal(t *testing.T) {
+	var request = PasswordResetRequest{}
+	assert.Nil(t, json.Unmarshal([]byte("{\"email\": \"petya@mail.ru\"}"), &request))
+	assert.Equal(t, "petya@mail.ru", request.Email)
+
+	request = PasswordResetRequest{}
+	var err = json.Unmarshal([]byte("{}"), &request)
+	assert.Equal(t, PasswordResetRequiredLogin, err.Error())
+}
+
+func TestPasswordResetConfirm_Unmarshal(t *testing.T) {
+	var confirm = PasswordResetConfirm{}
+	assert.Nil(t, json.Unmarshal([]byte("{\"token\": \"token\", \"password\": \"pass\"}"), &confirm))
+	assert.Equal(t, PasswordResetConfirm{Token: "token", Password: "pass"}, confirm)
+
+	var err = json.Unmarshal([]byte("{\"password\": \"pass\"}"), &confirm)
+	assert.Equal(t, PasswordResetRequiredToken, err.Error())
+}
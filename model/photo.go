@@ -0,0 +1,8 @@
+package model
+
+// Photo holds links to square thumbnails of a user's photo.
+type Photo struct {
+	Small  string `json:"small"`
+	Medium string `json:"medium"`
+	Large  string `json:"large"`
+}
@@ -2,24 +2,104 @@ package model
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 )
 
 const (
-	PositionRequiredUserId = "\"user_id\" field required"
-	PositionRequiredPoint  = "\"position\" field required"
-	PositionRequireTime    = "\"time\" field required"
+	MinLatitude  = -90.
+	MaxLatitude  = 90.
+	MinLongitude = -180.
+	MaxLongitude = 180.
+	MinAltitude  = -1000.  // metres, below the lowest land
+	MaxAltitude  = 20000.  // metres, above airliners
+	MaxSpeed     = 300.    // metres per second, faster than airliners
+	MaxAccuracy  = 100000. // metres
+
+	// positions determined earlier are useless for finding neighbours
+	MaxPositionAge = 10 * time.Minute
+	// clocks of devices may be a bit ahead of the server one
+	MaxClockSkew = time.Minute
+	// offline clients upload queued positions when they are back online
+	MaxQueuedPositionAge = 7 * 24 * time.Hour
+	MaxPositionBatch     = 1000
+
+	PositionSaved     = "saved"
+	PositionDuplicate = "duplicate"
+	PositionInvalid   = "invalid"
+
+	PositionRequiredUserId     = "\"user_id\" field required"
+	PositionRequiredPoint      = "\"position\" field required"
+	PositionRequireTime        = "\"time\" field required"
+	PointRequiredCoordinates   = "\"latitude\" and \"longitude\" fields required"
+	PositionInvalidFutureTime  = "\"client_time\" must not be in the future"
+	PositionRequiredClientTime = "\"client_time\" field required"
+)
+
+var (
+	PointInvalidLatitude      = fmt.Sprintf("\"latitude\" must be between %v and %v", MinLatitude, MaxLatitude)
+	PointInvalidLongitude     = fmt.Sprintf("\"longitude\" must be between %v and %v", MinLongitude, MaxLongitude)
+	PositionInvalidAccuracy   = fmt.Sprintf("\"accuracy\" must be between 0 and %v", MaxAccuracy)
+	PositionInvalidAltitude   = fmt.Sprintf("\"altitude\" must be between %v and %v", MinAltitude, MaxAltitude)
+	PositionInvalidSpeed      = fmt.Sprintf("\"speed\" must be between 0 and %v", MaxSpeed)
+	PositionInvalidStaleTime  = fmt.Sprintf("\"client_time\" must not be older than %v", MaxPositionAge)
+	PositionInvalidQueuedTime = fmt.Sprintf("\"client_time\" must not be older than %v", MaxQueuedPositionAge)
+	PositionInvalidBatchSize  = fmt.Sprintf("batch must contain at most %v positions", MaxPositionBatch)
 )
 
+// Point is a WGS 84 (SRID 4326) location in degrees.
 type Point struct {
-	X float64 `json:"x"`
-	Y float64 `json:"y"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
 }
 
+// UnmarshalJSON accepts {"x", "y"} points of old clients as well. The server
+// used to pass them to ST_MakePoint as is, so x is longitude and y is latitude.
+func (point *Point) UnmarshalJSON(data []byte) error {
+	var fields struct {
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		X         *float64 `json:"x"`
+		Y         *float64 `json:"y"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	switch {
+	case fields.Latitude != nil && fields.Longitude != nil:
+		point.Latitude, point.Longitude = *fields.Latitude, *fields.Longitude
+	case fields.X != nil && fields.Y != nil:
+		point.Latitude, point.Longitude = *fields.Y, *fields.X
+	default:
+		return errors.New(PointRequiredCoordinates)
+	}
+	return point.Validate()
+}
+
+func (point *Point) Validate() error {
+	if point.Latitude < MinLatitude || point.Latitude > MaxLatitude {
+		return errors.New(PointInvalidLatitude)
+	}
+	if point.Longitude < MinLongitude || point.Longitude > MaxLongitude {
+		return errors.New(PointInvalidLongitude)
+	}
+	return nil
+}
+
+// Position is a point where the user was at ClientTime according to the
+// device, Time is when the server saved it. Accuracy, altitude, speed and
+// client time are optional.
 type Position struct {
-	Id     int        `json:"id"`
-	UserId int        `json:"user_id"`
-	Point  Point      `json:"point"`
-	Time   QuotedTime `json:"time"`
+	Id         int         `json:"id"`
+	UserId     int         `json:"user_id"`
+	Point      Point       `json:"point"`
+	Accuracy   *float64    `json:"accuracy,omitempty"` // metres, radius of uncertainty
+	Altitude   *float64    `json:"altitude,omitempty"` // metres above the WGS 84 ellipsoid
+	Speed      *float64    `json:"speed,omitempty"`    // metres per second
+	ClientTime *QuotedTime `json:"client_time,omitempty"`
+	Time       QuotedTime  `json:"time"`
 }
 
 func (pos *Position) UnmarshalJSON(data []byte) error {
@@ -46,5 +126,84 @@ func (pos *Position) UnmarshalJSON(data []byte) error {
 }
 
 func (pos *Position) Validate() error {
+	if err := pos.validateMeasurements(); err != nil {
+		return err
+	}
+	if pos.ClientTime != nil {
+		return validateClientTime(*pos.ClientTime, MaxPositionAge, PositionInvalidStaleTime)
+	}
+	return nil
+}
+
+func (pos *Position) validateMeasurements() error {
+	if err := pos.Point.Validate(); err != nil {
+		return err
+	}
+	if pos.Accuracy != nil && (*pos.Accuracy < 0 || *pos.Accuracy > MaxAccuracy) {
+		return errors.New(PositionInvalidAccuracy)
+	}
+	if pos.Altitude != nil && (*pos.Altitude < MinAltitude || *pos.Altitude > MaxAltitude) {
+		return errors.New(PositionInvalidAltitude)
+	}
+	if pos.Speed != nil && (*pos.Speed < 0 || *pos.Speed > MaxSpeed) {
+		return errors.New(PositionInvalidSpeed)
+	}
+	return nil
+}
+
+func validateClientTime(clientTime QuotedTime, maxAge time.Duration, staleMsg string) error {
+	var age = time.Now().Sub(time.Time(clientTime))
+	if age < -MaxClockSkew {
+		return errors.New(PositionInvalidFutureTime)
+	}
+	if age > maxAge {
+		return errors.New(staleMsg)
+	}
 	return nil
 }
+
+// QueuedPosition is a position an offline client queued to upload later in a
+// batch. Client time is required, it identifies the position within the batch
+// and may be as old as MaxQueuedPositionAge.
+type QueuedPosition struct {
+	Position
+}
+
+func (pos *QueuedPosition) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(
+		data,
+		[]string{"point", "client_time"},
+		[]string{PositionRequiredPoint, PositionRequiredClientTime},
+	)
+	if err != nil {
+		return err
+	}
+
+	type positionAlias Position
+	var dest = (*positionAlias)(&pos.Position)
+
+	err = json.Unmarshal(data, dest)
+	if err != nil {
+		return err
+	}
+
+	return pos.Validate()
+}
+
+func (pos *QueuedPosition) Validate() error {
+	if err := pos.validateMeasurements(); err != nil {
+		return err
+	}
+	if pos.ClientTime == nil {
+		return errors.New(PositionRequiredClientTime)
+	}
+	return validateClientTime(*pos.ClientTime, MaxQueuedPositionAge, PositionInvalidQueuedTime)
+}
+
+// PositionResult tells what happened to the position with the index in a batch.
+// Error message is set for invalid positions only.
+type PositionResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	ErrMsg string `json:"err_msg,omitempty"`
+}
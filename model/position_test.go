@@ -16,14 +16,93 @@ func TestPosition_Unmarshal_ParseError(t *testing.T) {
 
 func TestPosition_Unmarshal_Success(t *testing.T) {
 	var pos = Position{}
-	var data = []byte("{\"user_id\": 100, \"time\": \"2006-01-02T15:04:05Z\", \"point\": {\"x\": 100, \"y\": 200}}")
+	var data = []byte("{\"user_id\": 100, \"time\": \"2006-01-02T15:04:05Z\", \"point\": {\"x\": 100, \"y\": 20}}")
 	var err = json.Unmarshal(data, &pos)
 
 	assert.Nil(t, err)
 	assert.Equal(t, 100, pos.UserId)
-	assert.Equal(t, Point{100, 200}, pos.Point)
+	assert.Equal(t, Point{Latitude: 20, Longitude: 100}, pos.Point)
 
 	var timeStamp, timeErr = time.Parse("2006-01-02T15:04:05", "2006-01-02T15:04:05")
 	assert.Nil(t, timeErr)
 	assert.Equal(t, QuotedTime(timeStamp), pos.Time)
 }
+
+func TestPosition_Unmarshal_LatitudeLongitude(t *testing.T) {
+	var pos = Position{}
+	var data = []byte(`{"point": {"latitude": 55.75, "longitude": 37.6}, "accuracy": 15, "speed": 1.5}`)
+	var err = json.Unmarshal(data, &pos)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Point{Latitude: 55.75, Longitude: 37.6}, pos.Point)
+	assert.Equal(t, 15., *pos.Accuracy)
+	assert.Equal(t, 1.5, *pos.Speed)
+	assert.Nil(t, pos.Altitude)
+	assert.Nil(t, pos.ClientTime)
+}
+
+func TestPosition_Unmarshal_Invalid(t *testing.T) {
+	var now = time.Now().UTC()
+	var cases = []struct {
+		data     string
+		errorStr string
+	}{
+		{`{}`, PositionRequiredPoint},
+		{`{"point": {"latitude": 55.75}}`, PointRequiredCoordinates},
+		{`{"point": {"latitude": 91, "longitude": 37.6}}`, PointInvalidLatitude},
+		{`{"point": {"latitude": 55.75, "longitude": -181}}`, PointInvalidLongitude},
+		{`{"point": {"x": 37.6, "y": 200}}`, PointInvalidLatitude},
+		{`{"point": {"latitude": 55.75, "longitude": 37.6}, "accuracy": -1}`, PositionInvalidAccuracy},
+		{`{"point": {"latitude": 55.75, "longitude": 37.6}, "altitude": 30000}`, PositionInvalidAltitude},
+		{`{"point": {"latitude": 55.75, "longitude": 37.6}, "speed": 1000}`, PositionInvalidSpeed},
+		{
+			`{"point": {"latitude": 55.75, "longitude": 37.6}, "client_time": "` +
+				now.Add(time.Hour).Format("2006-01-02T15:04:05") + `Z"}`,
+			PositionInvalidFutureTime,
+		},
+		{
+			`{"point": {"latitude": 55.75, "longitude": 37.6}, "client_time": "` +
+				now.Add(-time.Hour).Format("2006-01-02T15:04:05") + `Z"}`,
+			PositionInvalidStaleTime,
+		},
+	}
+
+	for _, c := range cases {
+		var pos = Position{}
+		var err = json.Unmarshal([]byte(c.data), &pos)
+		if assert.NotNil(t, err, c.data) {
+			assert.Equal(t, c.errorStr, err.Error(), c.data)
+		}
+	}
+}
+
+func TestQueuedPosition_Unmarshal_Success(t *testing.T) {
+	var clientTime = time.Now().UTC().Add(-48 * time.Hour).Format("2006-01-02T15:04:05")
+	var pos = QueuedPosition{}
+	var data = []byte(`{"point": {"x": 37.6, "y": 55.75}, "client_time": "` + clientTime + `Z"}`)
+	var err = json.Unmarshal(data, &pos)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Point{Latitude: 55.75, Longitude: 37.6}, pos.Point)
+	assert.Equal(t, clientTime, pos.ClientTime.String())
+}
+
+func TestQueuedPosition_Unmarshal_Invalid(t *testing.T) {
+	var stale = time.Now().UTC().Add(-MaxQueuedPositionAge - time.Hour).Format("2006-01-02T15:04:05")
+	var cases = []struct {
+		data     string
+		errorStr string
+	}{
+		{`null`, PositionRequiredPoint + ";\n" + PositionRequiredClientTime},
+		{`{"point": {"latitude": 55.75, "longitude": 37.6}}`, PositionRequiredClientTime},
+		{`{"point": {"latitude": 55.75, "longitude": 37.6}, "client_time": "` + stale + `Z"}`, PositionInvalidQueuedTime},
+	}
+
+	for _, c := range cases {
+		var pos = QueuedPosition{}
+		var err = json.Unmarshal([]byte(c.data), &pos)
+		if assert.NotNil(t, err, c.data) {
+			assert.Equal(t, c.errorStr, err.Error(), c.data)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	MinFuzzRadius = 100   // metres
+	MaxFuzzRadius = 10000 // metres
+
+	PrivacyRequiredGhost      = "\"ghost\" field required"
+	PrivacyRequiredFuzzRadius = "\"fuzz_radius\" field required"
+)
+
+var (
+	PrivacyInvalidFuzzRadius = fmt.Sprintf("\"fuzz_radius\" must be between %d and %d", MinFuzzRadius, MaxFuzzRadius)
+)
+
+// Privacy controls how the position of a user is shown to others. A ghost is
+// not listed among neighbours, its position is never revealed and only its
+// accepted counterparts may send it requests. Otherwise
+// positions are snapped to a grid with FuzzRadius metres cells, so that
+// repeated requests do not average to the exact point; counterparts of
+// an accepted meet request see the exact position. Users who have never
+// changed the settings get MinFuzzRadius.
+type Privacy struct {
+	Ghost      bool `json:"ghost"`
+	FuzzRadius int  `json:"fuzz_radius"`
+}
+
+func (privacy *Privacy) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(
+		data,
+		[]string{"ghost", "fuzz_radius"},
+		[]string{PrivacyRequiredGhost, PrivacyRequiredFuzzRadius},
+	)
+	if err != nil {
+		return err
+	}
+
+	type privacyAlias Privacy
+	var dest = (*privacyAlias)(privacy)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+
+	if privacy.FuzzRadius < MinFuzzRadius || privacy.FuzzRadius > MaxFuzzRadius {
+		return errors.New(PrivacyInvalidFuzzRadius)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestPrivacy_Unmarshal(t *testing.T) {
+	var privacy = Privacy{}
+	assert.Nil(t, json.Unmarshal([]byte("{\"ghost\": true, \"fuzz_radius\": 500}"), &privacy))
+	assert.Equal(t, Privacy{Ghost: true, FuzzRadius: 500}, privacy)
+}
+
+func TestPrivacy_UnmarshalErrors(t *testing.T) {
+	var testData = []struct {
+		data   string
+		errMsg string
+	}{
+		{"{\"fuzz_radius\": 500}", PrivacyRequiredGhost},
+		{"{\"ghost\": false}", PrivacyRequiredFuzzRadius},
+		{"{\"ghost\": false, \"fuzz_radius\": -1}", "must be between 100 and"},
+		{"{\"ghost\": false, \"fuzz_radius\": 0}", "must be between 100 and"},
+		{"{\"ghost\": false, \"fuzz_radius\": 10001}", "must be between 100 and"},
+	}
+
+	for i, item := range testData {
+		var privacy = Privacy{}
+		var err = json.Unmarshal([]byte(item.data), &privacy)
+		if assert.NotNil(t, err, i) {
+			assert.True(t, strings.Contains(err.Error(), item.errMsg), i)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	ReasonSpam          = "spam"
+	ReasonHarassment    = "harassment"
+	ReasonInappropriate = "inappropriate"
+	ReasonFake          = "fake"
+	ReasonOther         = "other"
+
+	ReportOpen     = "open"
+	ReportResolved = "resolved"
+
+	ActionDismiss = "dismiss"
+	ActionWarn    = "warn"
+	ActionSuspend = "suspend"
+	ActionBan     = "ban"
+
+	MaxReportTextLength = 1000 // length of Report.text column
+	MaxSuspendDays      = 365
+
+	ReportRequiredUser   = "\"reported_id\" field required"
+	ReportRequiredReason = "\"reason\" field required"
+	ReportInvalidReason  = "\"reason\" must be one of spam, harassment, inappropriate, fake, other"
+
+	ResolutionRequiredAction = "\"action\" field required"
+	ResolutionInvalidAction  = "\"action\" must be one of dismiss, warn, suspend, ban"
+)
+
+var (
+	ReportTextTooLong     = fmt.Sprintf("\"text\" must not be longer than %d characters", MaxReportTextLength)
+	ResolutionInvalidDays = fmt.Sprintf("\"days\" must be between 1 and %d for suspension", MaxSuspendDays)
+)
+
+// Report is a complaint of one user about another one, optionally
+// about a particular meet request between them. Reports are kept when
+// either user deletes the account, the id of a deleted user is 0 and
+// ReportedLogin tells who was reported.
+type Report struct {
+	Id            int        `json:"id"`
+	ReporterId    int        `json:"reporter_id"`
+	ReportedId    int        `json:"reported_id"`
+	ReportedLogin string     `json:"reported_login"`
+	RequestId     *int       `json:"request_id,omitempty"`
+	Reason        string     `json:"reason"`
+	Text          string     `json:"text"`
+	Status        string     `json:"status"`
+	Time          QuotedTime `json:"time"`
+}
+
+func (report *Report) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(
+		data,
+		[]string{"reported_id", "reason"},
+		[]string{ReportRequiredUser, ReportRequiredReason},
+	)
+	if err != nil {
+		return err
+	}
+
+	type reportAlias Report
+	var dest = (*reportAlias)(report)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+
+	switch report.Reason {
+	case ReasonSpam, ReasonHarassment, ReasonInappropriate, ReasonFake, ReasonOther:
+	default:
+		return errors.New(ReportInvalidReason)
+	}
+	if utf8.RuneCountInString(report.Text) > MaxReportTextLength {
+		return errors.New(ReportTextTooLong)
+	}
+	return nil
+}
+
+// ReportView is an open report as shown to moderators.
+type ReportView struct {
+	Report
+	ReportedUser   *User          `json:"reported_user"`
+	RecentRequests []*MeetRequest `json:"recent_requests"`
+}
+
+// ReportResolution is the moderator's decision on a report. Days
+// is required for suspension only.
+type ReportResolution struct {
+	Action  string `json:"action"`
+	Days    int    `json:"days"`
+	Comment string `json:"comment"`
+}
+
+func (resolution *ReportResolution) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(data, []string{"action"}, []string{ResolutionRequiredAction})
+	if err != nil {
+		return err
+	}
+
+	type resolutionAlias ReportResolution
+	var dest = (*resolutionAlias)(resolution)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+
+	switch resolution.Action {
+	case ActionDismiss, ActionWarn, ActionBan:
+	case ActionSuspend:
+		if resolution.Days < 1 || resolution.Days > MaxSuspendDays {
+			return errors.New(ResolutionInvalidDays)
+		}
+	default:
+		return errors.New(ResolutionInvalidAction)
+	}
+	if utf8.RuneCountInString(resolution.Comment) > MaxReportTextLength {
+		return errors.New(ReportTextTooLong)
+	}
+	return nil
+}
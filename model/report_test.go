@@ -0,0 +1,54 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestReport_Unmarshal(t *testing.T) {
+	var report = Report{}
+	assert.Nil(t, json.Unmarshal([]byte("{\"reported_id\": 2, \"request_id\": 10, \"reason\": \"spam\"}"), &report))
+	assert.Equal(t, 2, report.ReportedId)
+	assert.Equal(t, 10, *report.RequestId)
+	assert.Equal(t, ReasonSpam, report.Reason)
+
+	var testData = []struct {
+		data   string
+		errMsg string
+	}{
+		{"{\"reason\": \"spam\"}", ReportRequiredUser},
+		{"{\"reported_id\": 2}", ReportRequiredReason},
+		{"{\"reported_id\": 2, \"reason\": \"boring\"}", ReportInvalidReason},
+		{"{\"reported_id\": 2, \"reason\": \"other\", \"text\": \"" + strings.Repeat("я", MaxReportTextLength+1) + "\"}", ReportTextTooLong},
+	}
+
+	for i, item := range testData {
+		var err = json.Unmarshal([]byte(item.data), &Report{})
+		assert.NotNil(t, err, i)
+		assert.Equal(t, item.errMsg, err.Error(), i)
+	}
+}
+
+func TestReportResolution_Unmarshal(t *testing.T) {
+	var resolution = ReportResolution{}
+	assert.Nil(t, json.Unmarshal([]byte("{\"action\": \"suspend\", \"days\": 7}"), &resolution))
+	assert.Equal(t, ReportResolution{Action: ActionSuspend, Days: 7}, resolution)
+
+	var testData = []struct {
+		data   string
+		errMsg string
+	}{
+		{"{}", ResolutionRequiredAction},
+		{"{\"action\": \"kill\"}", ResolutionInvalidAction},
+		{"{\"action\": \"suspend\"}", ResolutionInvalidDays},
+		{"{\"action\": \"suspend\", \"days\": 1000}", ResolutionInvalidDays},
+	}
+
+	for i, item := range testData {
+		var err = json.Unmarshal([]byte(item.data), &ReportResolution{})
+		assert.NotNil(t, err, i)
+		assert.Equal(t, item.errMsg, err.Error(), i)
+	}
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	RefreshRequiredToken = "\"refresh_token\" field required"
+)
+
+type Session struct {
+	Id          int
+	UserId      int
+	RefreshHash []byte
+	Expires     time.Time
+	Revoked     bool
+}
+
+func (session *Session) IsActive(now time.Time) bool {
+	return !session.Revoked && session.Expires.After(now)
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (request *RefreshRequest) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(
+		data,
+		[]string{"refresh_token"},
+		[]string{RefreshRequiredToken},
+	)
+	if err != nil {
+		return err
+	}
+
+	type requestAlias RefreshRequest
+	var dest = (*requestAlias)(request)
+
+	return json.Unmarshal(data, dest)
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSession_IsActive(t *testing.T) {
+	var now = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	assert.True(t, (&Session{Expires: now.Add(time.Minute)}).IsActive(now))
+	assert.False(t, (&Session{Expires: now.Add(-time.Minute)}).IsActive(now))
+	assert.False(t, (&Session{Expires: now.Add(time.Minute), Revoked: true}).IsActive(now))
+}
+
+func TestRefreshRequest_Unmarshal_Success(t *testing.T) {
+	var request = RefreshRequest{}
+	var err = json.Unmarshal([]byte("{\"refresh_token\": \"1.token\"}"), &request)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1.token", request.RefreshToken)
+}
+
+func TestRefreshRequest_Unmarshal_Incomplete(t *testing.T) {
+	var request = RefreshRequest{}
+	var err = json.Unmarshal([]byte("{}"), &request)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, RefreshRequiredToken, err.Error())
+}
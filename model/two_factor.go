@@ -0,0 +1,93 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+const (
+	TwoFactorRequiredCode  = "\"code\" field required"
+	TwoFactorRequiredToken = "\"mfa_token\" field required"
+	TwoFactorEmptyCode     = "code must not be empty"
+)
+
+// TwoFactor holds TOTP secret of the user. The secret is pending until the user
+// confirms it with a code; LastCounter is the time step of the last accepted
+// code, codes of this and earlier steps are rejected to prevent replays.
+type TwoFactor struct {
+	UserId      int
+	Secret      []byte
+	Enabled     bool
+	LastCounter int64
+}
+
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// MFAChallenge is returned by sign in instead of a token pair when the user has
+// two-factor authentication enabled; the token is exchanged for a token pair
+// together with a one-time code.
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// TwoFactorCode carries either a TOTP code or a recovery code.
+type TwoFactorCode struct {
+	Code string `json:"code"`
+}
+
+func (code *TwoFactorCode) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(
+		data,
+		[]string{"code"},
+		[]string{TwoFactorRequiredCode},
+	)
+	if err != nil {
+		return err
+	}
+
+	type codeAlias TwoFactorCode
+	var dest = (*codeAlias)(code)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+	if code.Code == "" {
+		return errors.New(TwoFactorEmptyCode)
+	}
+	return nil
+}
+
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+func (request *MFAVerifyRequest) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(
+		data,
+		[]string{"mfa_token", "code"},
+		[]string{TwoFactorRequiredToken, TwoFactorRequiredCode},
+	)
+	if err != nil {
+		return err
+	}
+
+	type requestAlias MFAVerifyRequest
+	var dest = (*requestAlias)(request)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+	if request.Code == "" {
+		return errors.New(TwoFactorEmptyCode)
+	}
+	return nil
+}
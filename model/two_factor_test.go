@@ -0,0 +1,28 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTwoFactorCode_Unmarshal(t *testing.T) {
+	var code = TwoFactorCode{}
+	assert.Nil(t, json.Unmarshal([]byte("{\"code\": \"123456\"}"), &code))
+	assert.Equal(t, TwoFactorCode{Code: "123456"}, code)
+
+	var err = json.Unmarshal([]byte("{}"), &code)
+	assert.Equal(t, TwoFactorRequiredCode, err.Error())
+
+	err = json.Unmarshal([]byte("{\"code\": \"\"}"), &code)
+	assert.Equal(t, TwoFactorEmptyCode, err.Error())
+}
+
+func TestMFAVerifyRequest_Unmarshal(t *testing.T) {
+	var request = MFAVerifyRequest{}
+	assert.Nil(t, json.Unmarshal([]byte("{\"mfa_token\": \"token\", \"code\": \"123456\"}"), &request))
+	assert.Equal(t, MFAVerifyRequest{MFAToken: "token", Code: "123456"}, request)
+
+	var err = json.Unmarshal([]byte("{\"code\": \"123456\"}"), &request)
+	assert.Equal(t, TwoFactorRequiredToken, err.Error())
+}
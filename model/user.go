@@ -3,7 +3,11 @@ package model
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/mail"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -14,6 +18,25 @@ const (
 	UserRequiredLogin      = "\"login\" field required"
 	UserRequiredPassword   = "\"password\" field required"
 	RegistrationInvalidSex = "\"invalid sex: must be either M or F\""
+
+	MinAge         = 18
+	MaxAge         = 120
+	MaxAboutLength = 1000 // length of Users.about column
+	MaxEmailLength = 254  // length of Users.email column
+
+	UserInvalidEmail = "\"email\" must be a valid email address"
+
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+
+	UserInvalidRole        = "\"role\" must be one of user, moderator, admin"
+	RoleUpdateRequiredRole = "\"role\" field required"
+)
+
+var (
+	UserInvalidAge   = fmt.Sprintf("\"age\" must be either 0 (not specified) or between %d and %d", MinAge, MaxAge)
+	UserAboutTooLong = fmt.Sprintf("\"about\" must not be longer than %d characters", MaxAboutLength)
 )
 
 type User struct {
@@ -23,8 +46,19 @@ type User struct {
 	Age      int    `json:"age"`
 	Sex      string `json:"sex"`
 	About    string `json:"about"`
+	Email    string `json:"email,omitempty"`
+	Role     string `json:"role,omitempty"`
+	Banned   bool   `json:"banned,omitempty"`
+
+	SuspendedUntil *QuotedTime `json:"suspended_until,omitempty"`
+
+	PhotoKey string `json:"-"`
+	Photo    *Photo `json:"photo,omitempty"`
 }
 
+// UnmarshalJSON checks the format of the fields only. Profile constraints
+// (age bounds, length of about, email) are checked by Validate where a user
+// is created or updated, so users stored before them can still be decoded.
 func (user *User) UnmarshalJSON(data []byte) error {
 	var err = checkPresence(
 		data,
@@ -43,19 +77,112 @@ func (user *User) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	err = user.Validate()
-
-	return err
+	if !isValidSex(user.Sex) {
+		return errors.New(RegistrationInvalidSex)
+	}
+	return nil
 }
 
 func (user *User) Validate() error {
 	var msgList = make([]string, 0)
-	if user.Sex != UNKNOWN && user.Sex != MALE && user.Sex != FEMALE {
+	if !isValidSex(user.Sex) {
 		msgList = append(msgList, RegistrationInvalidSex)
 	}
+	if !isValidAge(user.Age) {
+		msgList = append(msgList, UserInvalidAge)
+	}
+	if !isValidAbout(user.About) {
+		msgList = append(msgList, UserAboutTooLong)
+	}
+	if user.Email != "" && !isValidEmail(user.Email) {
+		msgList = append(msgList, UserInvalidEmail)
+	}
 
 	if len(msgList) != 0 {
 		return errors.New(strings.Join(msgList, ";\n"))
 	}
 	return nil
 }
+
+func isValidSex(sex string) bool {
+	return sex == UNKNOWN || sex == MALE || sex == FEMALE
+}
+
+// isValidAge accepts zero, which means the age is not set.
+func isValidAge(age int) bool {
+	return age == 0 || (age >= MinAge && age <= MaxAge)
+}
+
+func isValidAbout(about string) bool {
+	return utf8.RuneCountInString(about) <= MaxAboutLength
+}
+
+// isValidEmail accepts bare addresses only, without display names.
+func isValidEmail(email string) bool {
+	if len(email) > MaxEmailLength {
+		return false
+	}
+	var address, err = mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
+// IsSuspended tells whether the suspension of the user is not over at t.
+func (user *User) IsSuspended(t time.Time) bool {
+	return user.SuspendedUntil != nil && t.Before(time.Time(*user.SuspendedUntil))
+}
+
+// RoleUpdate is the body of a request changing role of a user.
+type RoleUpdate struct {
+	Role string `json:"role"`
+}
+
+func (update *RoleUpdate) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(data, []string{"role"}, []string{RoleUpdateRequiredRole})
+	if err != nil {
+		return err
+	}
+
+	type updateAlias RoleUpdate
+	var dest = (*updateAlias)(update)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+	if !IsValidRole(update.Role) {
+		return errors.New(UserInvalidRole)
+	}
+	return nil
+}
+
+// rolesOrder lists roles from the least to the most privileged.
+var rolesOrder = []string{RoleUser, RoleModerator, RoleAdmin}
+
+func IsValidRole(role string) bool {
+	return roleLevel(role) >= 0
+}
+
+// RolesOf returns the role together with all less privileged ones,
+// so that e.g. an admin passes checks for the moderator role.
+func RolesOf(role string) []string {
+	var level = roleLevel(role)
+	if level < 0 {
+		return []string{}
+	}
+	var result = make([]string, level+1)
+	copy(result, rolesOrder[:level+1])
+	return result
+}
+
+// Outranks tells whether role is strictly more privileged than other.
+func Outranks(role string, other string) bool {
+	return roleLevel(role) > roleLevel(other)
+}
+
+func roleLevel(role string) int {
+	for i, item := range rolesOrder {
+		if item == role {
+			return i
+		}
+	}
+	return -1
+}
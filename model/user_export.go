@@ -0,0 +1,17 @@
+package model
+
+// UserExport contains everything the server stores about a user.
+// Password hash is never exported.
+type UserExport struct {
+	Time      QuotedTime     `json:"time"`
+	Profile   *User          `json:"profile"`
+	Positions []*Position    `json:"positions"`
+	Requests  []*MeetRequest `json:"requests"`
+	Interests []string       `json:"interests"`
+	Privacy   *Privacy       `json:"privacy"`
+	Devices   []*Device      `json:"devices"`
+	Blocks    []*User        `json:"blocks"`
+	// Webhooks are deliveries of events about requests of the user to external services.
+	Webhooks   []*WebhookDelivery `json:"webhooks"`
+	LoginAudit []*LoginFailure    `json:"login_audit"`
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	UserPatchEmpty = "patch must contain at least one of \"age\", \"sex\", \"about\""
+)
+
+// UserPatch holds profile changes with JSON merge patch (RFC 7396) semantics:
+// absent fields are left intact, null resets the field to its default value.
+type UserPatch struct {
+	Age   *int
+	Sex   *string
+	About *string
+}
+
+func (patch *UserPatch) UnmarshalJSON(data []byte) error {
+	var fields = make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return errors.New(UserPatchEmpty)
+	}
+
+	var msgList = make([]string, 0)
+	for _, name := range sortedKeys(fields) {
+		var value = fields[name]
+		var err error
+		switch name {
+		case "age":
+			patch.Age = new(int)
+			err = unmarshalNullable(value, patch.Age)
+		case "sex":
+			patch.Sex = new(string)
+			err = unmarshalNullable(value, patch.Sex)
+		case "about":
+			patch.About = new(string)
+			err = unmarshalNullable(value, patch.About)
+		default:
+			err = errors.New("can not be changed")
+		}
+
+		if err != nil {
+			msgList = append(msgList, fmt.Sprintf("\"%s\": %s", name, err.Error()))
+		}
+	}
+
+	if len(msgList) != 0 {
+		return errors.New(strings.Join(msgList, ";\n"))
+	}
+	return nil
+}
+
+// Apply merges patch into user. Only the patched fields are validated, so that
+// profiles saved before the current rules can still be changed.
+func (patch *UserPatch) Apply(user *User) error {
+	var msgList = make([]string, 0)
+	if patch.Sex != nil {
+		if !isValidSex(*patch.Sex) {
+			msgList = append(msgList, RegistrationInvalidSex)
+		}
+		user.Sex = *patch.Sex
+	}
+	if patch.Age != nil {
+		if !isValidAge(*patch.Age) {
+			msgList = append(msgList, UserInvalidAge)
+		}
+		user.Age = *patch.Age
+	}
+	if patch.About != nil {
+		if !isValidAbout(*patch.About) {
+			msgList = append(msgList, UserAboutTooLong)
+		}
+		user.About = *patch.About
+	}
+
+	if len(msgList) != 0 {
+		return errors.New(strings.Join(msgList, ";\n"))
+	}
+	return nil
+}
+
+// unmarshalNullable leaves dest with zero value if data is JSON null.
+func unmarshalNullable(data json.RawMessage, dest interface{}) error {
+	if string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	var result = make([]string, 0, len(m))
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestUserPatch_Unmarshal_Partial(t *testing.T) {
+	var patch = UserPatch{}
+	var err = json.Unmarshal([]byte("{\"age\": 30}"), &patch)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 30, *patch.Age)
+	assert.Nil(t, patch.Sex)
+	assert.Nil(t, patch.About)
+}
+
+func TestUserPatch_Unmarshal_Null(t *testing.T) {
+	var patch = UserPatch{}
+	var err = json.Unmarshal([]byte("{\"about\": null}"), &patch)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "", *patch.About)
+}
+
+func TestUserPatch_Unmarshal_Errors(t *testing.T) {
+	var testData = []struct {
+		data     string
+		expected string
+	}{
+		{"{}", UserPatchEmpty},
+		{"{\"login\": \"other\"}", "\"login\": can not be changed"},
+		{"{\"password\": \"pass\", \"age\": 30}", "\"password\": can not be changed"},
+	}
+
+	for i, item := range testData {
+		var patch = UserPatch{}
+		var err = json.Unmarshal([]byte(item.data), &patch)
+
+		assert.NotNil(t, err, i)
+		assert.Equal(t, item.expected, err.Error(), i)
+	}
+
+	var patch = UserPatch{}
+	assert.NotNil(t, json.Unmarshal([]byte("{\"age\": \"old\"}"), &patch))
+}
+
+func TestUserPatch_Apply(t *testing.T) {
+	var user = &User{Id: 1, Login: "login", Age: 30, Sex: MALE, About: "about"}
+	var patch = UserPatch{}
+	json.Unmarshal([]byte("{\"sex\": \"F\", \"about\": null}"), &patch)
+
+	assert.Nil(t, patch.Apply(user))
+	assert.Equal(t, &User{Id: 1, Login: "login", Age: 30, Sex: FEMALE, About: ""}, user)
+}
+
+func TestUserPatch_Apply_Invalid(t *testing.T) {
+	var user = &User{Id: 1, Login: "login", Age: 30}
+	var patch = UserPatch{}
+	json.Unmarshal([]byte("{\"age\": 5}"), &patch)
+
+	var err = patch.Apply(user)
+	assert.NotNil(t, err)
+	assert.Equal(t, UserInvalidAge, err.Error())
+}
+
+func TestUserPatch_Apply_LegacyUser(t *testing.T) {
+	var user = &User{Id: 1, Login: "login", Age: 5, About: strings.Repeat("a", MaxAboutLength+1)}
+	var patch = UserPatch{}
+	json.Unmarshal([]byte("{\"sex\": \"F\"}"), &patch)
+
+	assert.Nil(t, patch.Apply(user))
+	assert.Equal(t, FEMALE, user.Sex)
+}
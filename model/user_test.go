@@ -3,7 +3,9 @@ package model
 import (
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestUser_Unmarshal_ParseError(t *testing.T) {
@@ -31,3 +33,69 @@ func TestUser_Unmarshal_Success(t *testing.T) {
 	assert.Equal(t, "login", user.Login)
 	assert.Equal(t, 10, user.Id)
 }
+
+func TestUser_Unmarshal_SkipsProfileConstraints(t *testing.T) {
+	var user = User{}
+	var data = []byte("{\"login\": \"login\", \"age\": 200}")
+	var err = json.Unmarshal(data, &user)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, user.Age)
+	assert.Equal(t, UserInvalidAge, user.Validate().Error())
+}
+
+func TestUser_Validate_Age(t *testing.T) {
+	assert.Nil(t, (&User{Age: 0}).Validate())
+	assert.Nil(t, (&User{Age: MinAge}).Validate())
+	assert.Nil(t, (&User{Age: MaxAge}).Validate())
+	assert.Equal(t, UserInvalidAge, (&User{Age: MinAge - 1}).Validate().Error())
+	assert.Equal(t, UserInvalidAge, (&User{Age: MaxAge + 1}).Validate().Error())
+}
+
+func TestUser_Validate_About(t *testing.T) {
+	// length is counted in characters, not bytes, as in the column definition
+	assert.Nil(t, (&User{About: strings.Repeat("я", MaxAboutLength)}).Validate())
+	assert.Equal(t, UserAboutTooLong, (&User{About: strings.Repeat("a", MaxAboutLength+1)}).Validate().Error())
+}
+
+func TestUser_Validate_Email(t *testing.T) {
+	assert.Nil(t, (&User{Email: ""}).Validate())
+	assert.Nil(t, (&User{Email: "petya@mail.ru"}).Validate())
+	assert.Equal(t, UserInvalidEmail, (&User{Email: "petya"}).Validate().Error())
+	assert.Equal(t, UserInvalidEmail, (&User{Email: "Petya <petya@mail.ru>"}).Validate().Error())
+}
+
+func TestRolesOf(t *testing.T) {
+	assert.Equal(t, []string{RoleUser}, RolesOf(RoleUser))
+	assert.Equal(t, []string{RoleUser, RoleModerator}, RolesOf(RoleModerator))
+	assert.Equal(t, []string{RoleUser, RoleModerator, RoleAdmin}, RolesOf(RoleAdmin))
+	assert.Equal(t, []string{}, RolesOf("superuser"))
+}
+
+func TestOutranks(t *testing.T) {
+	assert.True(t, Outranks(RoleAdmin, RoleModerator))
+	assert.True(t, Outranks(RoleModerator, RoleUser))
+	assert.False(t, Outranks(RoleModerator, RoleModerator))
+	assert.False(t, Outranks(RoleUser, RoleAdmin))
+}
+
+func TestRoleUpdate_Unmarshal(t *testing.T) {
+	var update = RoleUpdate{}
+	assert.Nil(t, json.Unmarshal([]byte("{\"role\": \"moderator\"}"), &update))
+	assert.Equal(t, RoleModerator, update.Role)
+
+	var err = json.Unmarshal([]byte("{}"), &update)
+	assert.Equal(t, RoleUpdateRequiredRole, err.Error())
+
+	err = json.Unmarshal([]byte("{\"role\": \"superuser\"}"), &update)
+	assert.Equal(t, UserInvalidRole, err.Error())
+}
+
+func TestUser_IsSuspended(t *testing.T) {
+	var now = time.Now()
+	var until = QuotedTime(now.Add(time.Hour))
+
+	assert.False(t, (&User{}).IsSuspended(now))
+	assert.True(t, (&User{SuspendedUntil: &until}).IsSuspended(now))
+	assert.False(t, (&User{SuspendedUntil: &until}).IsSuspended(now.Add(2*time.Hour)))
+}
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	WebhookRequestCreated     = "request.created"
+	WebhookRequestAccepted    = "request.accepted"
+	WebhookRequestDeclined    = "request.declined"
+	WebhookRequestInterrupted = "request.interrupted"
+	WebhookRequestExpired     = "request.expired"
+
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+
+	MaxWebhookURLLength    = 2048 // length of WebhookSubscription.url column
+	MinWebhookSecretLength = 16
+	MaxWebhookSecretLength = 256 // length of WebhookSubscription.secret column
+
+	WebhookRequiredURL    = "\"url\" field required"
+	WebhookRequiredSecret = "\"secret\" field required"
+	WebhookInvalidURL     = "\"url\" must be an absolute http or https URL"
+	WebhookInvalidEvent   = "\"events\" may contain only request.created, request.accepted, request.declined, " +
+		"request.interrupted, request.expired"
+)
+
+var (
+	WebhookURLTooLong    = fmt.Sprintf("\"url\" must not be longer than %d characters", MaxWebhookURLLength)
+	WebhookInvalidSecret = fmt.Sprintf(
+		"\"secret\" must be from %d to %d characters long", MinWebhookSecretLength, MaxWebhookSecretLength,
+	)
+)
+
+var webhookEventTypes = []string{
+	WebhookRequestCreated,
+	WebhookRequestAccepted,
+	WebhookRequestDeclined,
+	WebhookRequestInterrupted,
+	WebhookRequestExpired,
+}
+
+// WebhookSubscription is an external service told about lifecycle events of
+// meet requests. Payloads are signed with Secret, which is shown only once,
+// when the subscription is created.
+type WebhookSubscription struct {
+	Id     int    `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	// Events lists event types sent to the subscription; all of them are sent if it is empty.
+	Events []string   `json:"events"`
+	Time   QuotedTime `json:"time"`
+}
+
+func (subscription *WebhookSubscription) UnmarshalJSON(data []byte) error {
+	var err = checkPresence(
+		data,
+		[]string{"url", "secret"},
+		[]string{WebhookRequiredURL, WebhookRequiredSecret},
+	)
+	if err != nil {
+		return err
+	}
+
+	type subscriptionAlias WebhookSubscription
+	var dest = (*subscriptionAlias)(subscription)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+
+	if len(subscription.URL) > MaxWebhookURLLength {
+		return errors.New(WebhookURLTooLong)
+	}
+	var parsed, urlErr = url.Parse(subscription.URL)
+	if urlErr != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New(WebhookInvalidURL)
+	}
+	if len(subscription.Secret) < MinWebhookSecretLength || len(subscription.Secret) > MaxWebhookSecretLength {
+		return errors.New(WebhookInvalidSecret)
+	}
+
+	var events = make([]string, 0, len(subscription.Events))
+	var seen = make(map[string]bool)
+	for _, event := range subscription.Events {
+		event = strings.TrimSpace(event)
+		if !isWebhookEventType(event) {
+			return errors.New(WebhookInvalidEvent)
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	subscription.Events = events
+	return nil
+}
+
+// WebhookDelivery is a payload queued for a subscription. Payload is kept
+// as sent, so that a replayed delivery is the same as the original one.
+type WebhookDelivery struct {
+	Id             int64           `json:"id"`
+	SubscriptionId int             `json:"subscription_id"`
+	URL            string          `json:"url"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttempt    QuotedTime      `json:"next_attempt"`
+	LastError      string          `json:"last_error"`
+	Time           QuotedTime      `json:"time"`
+
+	Secret string `json:"-"`
+}
+
+func isWebhookEventType(event string) bool {
+	for _, eventType := range webhookEventTypes {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
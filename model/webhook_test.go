@@ -0,0 +1,40 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestWebhookSubscription_Unmarshal(t *testing.T) {
+	var subscription = WebhookSubscription{}
+	var data = "{\"url\": \"https://partner.example/hooks\", \"secret\": \"0123456789abcdef\", " +
+		"\"events\": [\"request.created\", \" request.created\", \"request.expired\"]}"
+	assert.Nil(t, json.Unmarshal([]byte(data), &subscription))
+	assert.Equal(t, "https://partner.example/hooks", subscription.URL)
+	assert.Equal(t, []string{WebhookRequestCreated, WebhookRequestExpired}, subscription.Events)
+}
+
+func TestWebhookSubscription_UnmarshalErrors(t *testing.T) {
+	var secret = "\"secret\": \"0123456789abcdef\""
+	var testData = []struct {
+		data   string
+		errMsg string
+	}{
+		{"{" + secret + "}", WebhookRequiredURL},
+		{"{\"url\": \"https://partner.example\"}", WebhookRequiredSecret},
+		{"{\"url\": \"ftp://partner.example\", " + secret + "}", "must be an absolute http or https URL"},
+		{"{\"url\": \"/hooks\", " + secret + "}", "must be an absolute http or https URL"},
+		{"{\"url\": \"https://partner.example\", \"secret\": \"short\"}", "must be from 16 to 256 characters long"},
+		{"{\"url\": \"https://partner.example\", " + secret + ", \"events\": [\"user.created\"]}", "may contain only"},
+	}
+
+	for i, item := range testData {
+		var subscription = WebhookSubscription{}
+		var err = json.Unmarshal([]byte(item.data), &subscription)
+		if assert.NotNil(t, err, i) {
+			assert.True(t, strings.Contains(err.Error(), item.errMsg), i)
+		}
+	}
+}
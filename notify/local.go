@@ -0,0 +1,38 @@
+package notify
+
+import "sync"
+
+// localNotifier passes wake ups within the process.
+type localNotifier struct {
+	lock sync.RWMutex
+	wake WakeFunc
+}
+
+func NewLocalNotifier() Notifier {
+	return new(localNotifier)
+}
+
+func (notifier *localNotifier) Publish(userId int) error {
+	notifier.lock.RLock()
+	defer notifier.lock.RUnlock()
+
+	if notifier.wake == nil {
+		return ErrNotListening
+	}
+	notifier.wake(userId)
+	return nil
+}
+
+func (notifier *localNotifier) Listen(wake WakeFunc) error {
+	notifier.lock.Lock()
+	notifier.wake = wake
+	notifier.lock.Unlock()
+	return nil
+}
+
+func (notifier *localNotifier) Close() error {
+	notifier.lock.Lock()
+	notifier.wake = nil
+	notifier.lock.Unlock()
+	return nil
+}
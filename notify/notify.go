@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/Sovianum/acquaintance-server/mylog"
+)
+
+const (
+	Local    = "local"
+	Postgres = "postgres"
+
+	// AllUsers is passed to WakeFunc when wake ups may have been lost,
+	// e.g. while the notifier was reconnecting. Real user ids start from 1.
+	AllUsers = 0
+)
+
+var ErrNotListening = errors.New("notifier is not listening")
+
+// WakeFunc wakes up users of this instance waiting for new events.
+type WakeFunc func(userId int)
+
+// Notifier delivers wake ups published by any instance of the app to all of
+// them, so that a user waiting on one instance learns about events saved by
+// another one. The events themselves are kept in the database.
+type Notifier interface {
+	// Publish sends a wake up of the user to all instances including this one.
+	Publish(userId int) error
+	// Listen starts passing wake ups to wake. It is called once.
+	Listen(wake WakeFunc) error
+	Close() error
+}
+
+func NewNotifier(conf config.NotifyConfig, db *sql.DB, connStr string, logger *mylog.Logger) (Notifier, error) {
+	switch conf.Backend {
+	case Postgres:
+		return newPostgresNotifier(conf, db, connStr, logger), nil
+	case Local, "":
+		return NewLocalNotifier(), nil
+	default:
+		return nil, fmt.Errorf("unsupported notify backend \"%s\"", conf.Backend)
+	}
+}
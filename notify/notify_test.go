@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/Sovianum/acquaintance-server/mylog"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+type fakeListener struct {
+	listened      chan string
+	notifications chan *pq.Notification
+}
+
+func newFakeListener() *fakeListener {
+	return &fakeListener{listened: make(chan string, 1), notifications: make(chan *pq.Notification)}
+}
+
+func (listener *fakeListener) Listen(channel string) error {
+	listener.listened <- channel
+	return nil
+}
+
+func (listener *fakeListener) NotificationChannel() <-chan *pq.Notification {
+	return listener.notifications
+}
+
+func (listener *fakeListener) Ping() error { return nil }
+
+func (listener *fakeListener) Close() error { return nil }
+
+func TestNewNotifier_Unsupported(t *testing.T) {
+	var _, err = NewNotifier(config.NotifyConfig{Backend: "redis"}, nil, "", nil)
+	assert.NotNil(t, err)
+}
+
+func TestLocalNotifier(t *testing.T) {
+	var notifier = NewLocalNotifier()
+	assert.Equal(t, ErrNotListening, notifier.Publish(1))
+
+	var woken = make([]int, 0)
+	notifier.Listen(func(userId int) {
+		woken = append(woken, userId)
+	})
+	assert.Nil(t, notifier.Publish(1))
+	assert.Nil(t, notifier.Publish(2))
+	assert.Equal(t, []int{1, 2}, woken)
+
+	notifier.Close()
+	assert.Equal(t, ErrNotListening, notifier.Publish(3))
+}
+
+func TestPostgresNotifier_Publish(t *testing.T) {
+	var db, mock, err = sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("SELECT pg_notify").
+		WithArgs("request_events", "5").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var notifier = getPostgresNotifier(db, newFakeListener())
+	assert.Nil(t, notifier.Publish(5))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresNotifier_Listen(t *testing.T) {
+	var listener = newFakeListener()
+	var notifier = getPostgresNotifier(nil, listener)
+	defer notifier.Close()
+
+	var woken = make(chan int)
+	notifier.Listen(func(userId int) {
+		woken <- userId
+	})
+
+	listener.notifications <- &pq.Notification{Channel: "request_events", Extra: "5"}
+	assert.Equal(t, 5, receive(t, woken))
+
+	// invalid payload is skipped
+	listener.notifications <- &pq.Notification{Channel: "request_events", Extra: "abc"}
+	// reconnect wakes up everybody
+	listener.notifications <- nil
+	assert.Equal(t, AllUsers, receive(t, woken))
+
+	assert.Equal(t, "request_events", <-listener.listened)
+}
+
+func getPostgresNotifier(db *sql.DB, listener listener) *postgresNotifier {
+	return &postgresNotifier{
+		db:       db,
+		channel:  config.NotifyConfig{}.GetChannel(),
+		listener: listener,
+		logger:   mylog.NewLogger(ioutil.Discard),
+		done:     make(chan struct{}),
+	}
+}
+
+func receive(t *testing.T, woken chan int) int {
+	select {
+	case userId := <-woken:
+		return userId
+	case <-time.After(time.Second):
+		t.Fatal("no wake up")
+		return 0
+	}
+}
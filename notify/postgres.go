@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"database/sql"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/Sovianum/acquaintance-server/mylog"
+	"github.com/lib/pq"
+	"strconv"
+	"time"
+)
+
+const (
+	publish = `SELECT pg_notify($1, $2)`
+
+	// lib/pq advises to ping an idle listener to find out about a lost connection
+	listenerPingInterval = 90 * time.Second
+)
+
+// listener is the part of pq.Listener used by postgresNotifier.
+type listener interface {
+	Listen(channel string) error
+	NotificationChannel() <-chan *pq.Notification
+	Ping() error
+	Close() error
+}
+
+// postgresNotifier publishes wake ups with NOTIFY and gets them with LISTEN
+// on a dedicated connection. pq.Listener reconnects by itself; wake ups sent
+// while it was disconnected are lost, so all local users are woken up after
+// a reconnect to check for new events.
+type postgresNotifier struct {
+	db       *sql.DB
+	channel  string
+	listener listener
+	logger   *mylog.Logger
+	done     chan struct{}
+}
+
+func newPostgresNotifier(conf config.NotifyConfig, db *sql.DB, connStr string, logger *mylog.Logger) *postgresNotifier {
+	var notifier = &postgresNotifier{
+		db:      db,
+		channel: conf.GetChannel(),
+		logger:  logger,
+		done:    make(chan struct{}),
+	}
+	notifier.listener = pq.NewListener(
+		connStr, conf.GetMinReconnectInterval(), conf.GetMaxReconnectInterval(), notifier.logListenerEvent,
+	)
+	return notifier
+}
+
+func (notifier *postgresNotifier) Publish(userId int) error {
+	var _, err = notifier.db.Exec(publish, notifier.channel, strconv.Itoa(userId))
+	return err
+}
+
+// Listen does not wait for the connection to be established, LISTEN is
+// issued in background and repeated by pq.Listener after each reconnect.
+func (notifier *postgresNotifier) Listen(wake WakeFunc) error {
+	go func() {
+		if err := notifier.listener.Listen(notifier.channel); err != nil {
+			notifier.logger.Errorf("failed to listen channel %s: %s", notifier.channel, err.Error())
+		}
+	}()
+	go notifier.dispatch(wake)
+	return nil
+}
+
+func (notifier *postgresNotifier) Close() error {
+	close(notifier.done)
+	return notifier.listener.Close()
+}
+
+func (notifier *postgresNotifier) dispatch(wake WakeFunc) {
+	var ticker = time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case notification := <-notifier.listener.NotificationChannel():
+			if notification == nil {
+				// pq.Listener sends nil after a reconnect
+				wake(AllUsers)
+				continue
+			}
+			var userId, err = strconv.Atoi(notification.Extra)
+			if err != nil {
+				notifier.logger.Errorf("got invalid notification payload \"%s\"", notification.Extra)
+				continue
+			}
+			wake(userId)
+		case <-ticker.C:
+			go notifier.listener.Ping()
+		case <-notifier.done:
+			return
+		}
+	}
+}
+
+func (notifier *postgresNotifier) logListenerEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventConnected:
+		notifier.logger.Infof("notify listener connected")
+	case pq.ListenerEventReconnected:
+		notifier.logger.Infof("notify listener reconnected")
+	case pq.ListenerEventDisconnected:
+		notifier.logger.Errorf("notify listener disconnected: %s", err.Error())
+	case pq.ListenerEventConnectionAttemptFailed:
+		notifier.logger.Errorf("notify listener failed to connect: %s", err.Error())
+	}
+}
@@ -0,0 +1,152 @@
+package photo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+)
+
+const (
+	Small  = "small"
+	Medium = "medium"
+	Large  = "large"
+
+	ContentType = "image/jpeg"
+
+	// MaxDimension limits the decoded image, so that a small file
+	// can not make the server allocate gigabytes of memory.
+	MaxDimension = 4096
+
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("photo must be a JPEG, PNG or GIF image")
+	ErrTooLarge          = fmt.Errorf("photo must not be larger than %dx%d pixels", MaxDimension, MaxDimension)
+)
+
+type Size struct {
+	Name string
+	Side int
+}
+
+// Sizes lists thumbnails generated for every photo.
+var Sizes = []Size{
+	{Small, 64},
+	{Medium, 256},
+	{Large, 640},
+}
+
+var supportedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Key returns the storage key of the thumbnail of the given size.
+func Key(base string, size string) string {
+	return base + "_" + size + ".jpg"
+}
+
+// Thumbnails renders square JPEG thumbnails of all Sizes cropped around
+// the center of the image. The result maps size names to file contents.
+// Transparent areas become white and metadata such as EXIF is dropped.
+func Thumbnails(data []byte) (map[string][]byte, error) {
+	if !supportedTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedFormat
+	}
+
+	var conf, _, confErr = image.DecodeConfig(bytes.NewReader(data))
+	if confErr != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if conf.Width > MaxDimension || conf.Height > MaxDimension {
+		return nil, ErrTooLarge
+	}
+	if conf.Width == 0 || conf.Height == 0 {
+		return nil, ErrUnsupportedFormat
+	}
+
+	var img, _, decodeErr = image.Decode(bytes.NewReader(data))
+	if decodeErr != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	var square = cropSquare(img)
+
+	var result = make(map[string][]byte, len(Sizes))
+	for _, size := range Sizes {
+		var buf = new(bytes.Buffer)
+		var err = jpeg.Encode(buf, resize(square, size.Side), &jpeg.Options{Quality: jpegQuality})
+		if err != nil {
+			return nil, err
+		}
+		result[size.Name] = buf.Bytes()
+	}
+	return result, nil
+}
+
+// cropSquare draws the central square of img over a white background.
+func cropSquare(img image.Image) *image.RGBA {
+	var bounds = img.Bounds()
+	var side = bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	var offset = image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+
+	var result = image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(result, result.Bounds(), image.NewUniform(color.White), image.ZP, draw.Src)
+	draw.Draw(result, result.Bounds(), img, offset, draw.Over)
+	return result
+}
+
+// resize scales the square src to side x side pixels. Every destination pixel
+// is the average of the source pixels it covers, which gives smooth results
+// when shrinking; when enlarging it degrades to the nearest neighbour.
+func resize(src *image.RGBA, side int) *image.RGBA {
+	var srcSide = src.Bounds().Dx()
+	var dst = image.NewRGBA(image.Rect(0, 0, side, side))
+
+	for y := 0; y < side; y++ {
+		var y0, y1 = span(y, side, srcSide)
+		for x := 0; x < side; x++ {
+			var x0, x1 = span(x, side, srcSide)
+
+			var r, g, b, cnt int
+			for sy := y0; sy < y1; sy++ {
+				var i = src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					cnt++
+					i += 4
+				}
+			}
+
+			var j = dst.PixOffset(x, y)
+			dst.Pix[j] = uint8(r / cnt)
+			dst.Pix[j+1] = uint8(g / cnt)
+			dst.Pix[j+2] = uint8(b / cnt)
+			dst.Pix[j+3] = 0xff
+		}
+	}
+	return dst
+}
+
+// span returns source pixels [from, to) covered by destination pixel i.
+func span(i int, dstSide int, srcSide int) (int, int) {
+	var from = i * srcSide / dstSide
+	var to = (i + 1) * srcSide / dstSide
+	if to <= from {
+		to = from + 1
+	}
+	return from, to
+}
@@ -0,0 +1,62 @@
+package photo
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnails(t *testing.T) {
+	// left half is red, right half is transparent
+	var img = image.NewNRGBA(image.Rect(0, 0, 300, 200))
+	for x := 0; x < 150; x++ {
+		for y := 0; y < 200; y++ {
+			img.Set(x, y, color.NRGBA{R: 0xff, A: 0xff})
+		}
+	}
+
+	var thumbnails, err = Thumbnails(encodePNG(img))
+	assert.Nil(t, err)
+	assert.Equal(t, len(Sizes), len(thumbnails))
+
+	for _, size := range Sizes {
+		var thumbnail, decodeErr = jpeg.Decode(bytes.NewReader(thumbnails[size.Name]))
+		assert.Nil(t, decodeErr)
+		assert.Equal(t, image.Rect(0, 0, size.Side, size.Side), thumbnail.Bounds())
+
+		var r, g, b, _ = thumbnail.At(size.Side/4, size.Side/2).RGBA()
+		assert.True(t, r>>8 > 0xe0 && g>>8 < 0x20 && b>>8 < 0x20, "left part must stay red")
+
+		r, g, b, _ = thumbnail.At(size.Side*3/4, size.Side/2).RGBA()
+		assert.True(t, r>>8 > 0xe0 && g>>8 > 0xe0 && b>>8 > 0xe0, "transparent part must become white")
+	}
+}
+
+func TestThumbnails_Unsupported(t *testing.T) {
+	var _, err = Thumbnails([]byte("<html><body>not an image</body></html>"))
+	assert.Equal(t, ErrUnsupportedFormat, err)
+
+	// valid signature, broken content
+	var data = encodePNG(image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	_, err = Thumbnails(data[:20])
+	assert.Equal(t, ErrUnsupportedFormat, err)
+}
+
+func TestThumbnails_TooLarge(t *testing.T) {
+	var _, err = Thumbnails(encodePNG(image.NewGray(image.Rect(0, 0, MaxDimension+1, 1))))
+	assert.Equal(t, ErrTooLarge, err)
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, "photos/1/abc_small.jpg", Key("photos/1/abc", Small))
+}
+
+func encodePNG(img image.Image) []byte {
+	var buf = new(bytes.Buffer)
+	png.Encode(buf, img)
+	return buf.Bytes()
+}
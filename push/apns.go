@@ -0,0 +1,188 @@
+package push
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	apnsService    = "APNs"
+	apnsProduction = "https://api.push.apple.com"
+	apnsSandbox    = "https://api.sandbox.push.apple.com"
+	// APNs rejects provider tokens older than an hour and refreshing them
+	// more often than every 20 minutes
+	providerTokenLifetime = 50 * time.Minute
+
+	apnsBadDeviceToken         = "BadDeviceToken"
+	apnsUnregistered           = "Unregistered"
+	apnsDeviceTokenNotForTopic = "DeviceTokenNotForTopic"
+	apnsExpiredProviderToken   = "ExpiredProviderToken"
+)
+
+var errNotECKey = errors.New("APNs key must be an ECDSA private key")
+
+type apnsAlert struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type apnsResponse struct {
+	Reason string `json:"reason"`
+}
+
+// apnsSender sends messages with APNs provider API, which is served over
+// HTTP/2 only; the default transport negotiates it over TLS. Requests are
+// authorized with provider tokens signed with the .p8 key of the team.
+type apnsSender struct {
+	client   *http.Client
+	endpoint string
+	topic    string
+	keyId    string
+	teamId   string
+	key      *ecdsa.PrivateKey
+	now      func() time.Time
+
+	lock          sync.Mutex
+	providerToken string
+	issued        time.Time
+}
+
+func NewAPNsSender(conf config.APNsConfig, client *http.Client) (Sender, error) {
+	var data, err = ioutil.ReadFile(conf.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	var key, keyErr = parseAPNsKey(data)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	var endpoint = conf.Endpoint
+	switch {
+	case endpoint != "":
+	case conf.Sandbox:
+		endpoint = apnsSandbox
+	default:
+		endpoint = apnsProduction
+	}
+
+	return &apnsSender{
+		client:   client,
+		endpoint: endpoint,
+		topic:    conf.Topic,
+		keyId:    conf.KeyId,
+		teamId:   conf.TeamId,
+		key:      key,
+		now:      time.Now,
+	}, nil
+}
+
+func (sender *apnsSender) Send(token string, msg Message) error {
+	var providerToken, tokenErr = sender.getProviderToken()
+	if tokenErr != nil {
+		return tokenErr
+	}
+
+	// custom data goes next to "aps" dictionary
+	var payload = map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": apnsAlert{Title: msg.Title, Body: msg.Body},
+			"sound": "default",
+		},
+	}
+	for key, value := range msg.Data {
+		payload[key] = value
+	}
+	var body, _ = json.Marshal(payload)
+
+	var req, _ = http.NewRequest(http.MethodPost, sender.endpoint+"/3/device/"+token, bytes.NewReader(body))
+	req.Header.Set("Authorization", "bearer "+providerToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apns-topic", sender.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+
+	var resp, err = sender.client.Do(req)
+	if err != nil {
+		return Temporary(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var apnsResp apnsResponse
+	json.NewDecoder(resp.Body).Decode(&apnsResp)
+
+	switch {
+	case resp.StatusCode == http.StatusGone,
+		apnsResp.Reason == apnsBadDeviceToken,
+		apnsResp.Reason == apnsUnregistered,
+		apnsResp.Reason == apnsDeviceTokenNotForTopic:
+		return ErrInvalidToken
+	case apnsResp.Reason == apnsExpiredProviderToken:
+		sender.resetProviderToken()
+		return Temporary(statusError(apnsService, resp.StatusCode, apnsResp.Reason))
+	default:
+		return statusError(apnsService, resp.StatusCode, apnsResp.Reason)
+	}
+}
+
+func (sender *apnsSender) getProviderToken() (string, error) {
+	sender.lock.Lock()
+	defer sender.lock.Unlock()
+
+	var now = sender.now()
+	if sender.providerToken != "" && now.Sub(sender.issued) < providerTokenLifetime {
+		return sender.providerToken, nil
+	}
+
+	var token = jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": sender.teamId,
+		"iat": now.Unix(),
+	})
+	token.Header["kid"] = sender.keyId
+
+	var signed, err = token.SignedString(sender.key)
+	if err != nil {
+		return "", err
+	}
+	sender.providerToken = signed
+	sender.issued = now
+	return signed, nil
+}
+
+func (sender *apnsSender) resetProviderToken() {
+	sender.lock.Lock()
+	sender.providerToken = ""
+	sender.lock.Unlock()
+}
+
+// parseAPNsKey reads a .p8 key, which Apple issues in PKCS #8 format.
+func parseAPNsKey(data []byte) (*ecdsa.PrivateKey, error) {
+	var block, _ = pem.Decode(data)
+	if block == nil {
+		return nil, jwt.ErrKeyMustBePEMEncoded
+	}
+
+	var parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	var key, ok = parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errNotECKey
+	}
+	return key, nil
+}
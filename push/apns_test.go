@@ -0,0 +1,171 @@
+package push
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// apnsStandIn imitates APNs provider API over HTTP/2. Token "gone" is
+// unregistered, token "bad" is malformed, token "expired" makes the provider
+// token expired.
+type apnsStandIn struct {
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+
+	lock     sync.Mutex
+	payloads map[string]map[string]interface{}
+}
+
+func newAPNsStandIn(t *testing.T) *apnsStandIn {
+	var key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var standIn = &apnsStandIn{key: key, payloads: make(map[string]map[string]interface{})}
+	standIn.server = httptest.NewUnstartedServer(http.HandlerFunc(standIn.send))
+	standIn.server.EnableHTTP2 = true
+	standIn.server.StartTLS()
+	return standIn
+}
+
+func (standIn *apnsStandIn) send(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 {
+		w.WriteHeader(http.StatusHTTPVersionNotSupported)
+		return
+	}
+	// tests move the clock of the sender, so times are not checked
+	var parser = &jwt.Parser{SkipClaimsValidation: true}
+	var providerToken, err = parser.Parse(
+		strings.TrimPrefix(r.Header.Get("Authorization"), "bearer "),
+		func(token *jwt.Token) (interface{}, error) {
+			return &standIn.key.PublicKey, nil
+		},
+	)
+	if err != nil || providerToken.Header["kid"] != "key" || providerToken.Claims.(jwt.MapClaims)["iss"] != "team" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"reason": "InvalidProviderToken"}`))
+		return
+	}
+	if r.Header.Get("apns-topic") != "app.around.you" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"reason": "TopicDisallowed"}`))
+		return
+	}
+
+	var token = strings.TrimPrefix(r.URL.Path, "/3/device/")
+	switch token {
+	case "gone":
+		w.WriteHeader(http.StatusGone)
+		w.Write([]byte(`{"reason": "Unregistered", "timestamp": 1500000000000}`))
+	case "bad":
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"reason": "BadDeviceToken"}`))
+	case "expired":
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"reason": "ExpiredProviderToken"}`))
+	default:
+		var payload = make(map[string]interface{})
+		json.NewDecoder(r.Body).Decode(&payload)
+		standIn.lock.Lock()
+		standIn.payloads[token] = payload
+		standIn.lock.Unlock()
+	}
+}
+
+func (standIn *apnsStandIn) getSender(t *testing.T, dir string) *apnsSender {
+	var der, derErr = x509.MarshalPKCS8PrivateKey(standIn.key)
+	if derErr != nil {
+		t.Fatal(derErr)
+	}
+	var keyFile = filepath.Join(dir, "AuthKey_key.p8")
+	var keyData = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := ioutil.WriteFile(keyFile, keyData, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var sender, err = NewAPNsSender(config.APNsConfig{
+		KeyFile:  keyFile,
+		KeyId:    "key",
+		TeamId:   "team",
+		Topic:    "app.around.you",
+		Endpoint: standIn.server.URL,
+	}, standIn.server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender.(*apnsSender)
+}
+
+func TestAPNsSender(t *testing.T) {
+	var dir, dirErr = ioutil.TempDir("", "apns")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+
+	var standIn = newAPNsStandIn(t)
+	defer standIn.server.Close()
+	var sender = standIn.getSender(t, dir)
+
+	assert.Nil(t, sender.Send("iphone", testMessage))
+	assert.Equal(t, map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]interface{}{"title": "title", "body": "body"},
+			"sound": "default",
+		},
+		"request_id": "1",
+	}, standIn.payloads["iphone"])
+
+	assert.Equal(t, ErrInvalidToken, sender.Send("gone", testMessage))
+	assert.Equal(t, ErrInvalidToken, sender.Send("bad", testMessage))
+}
+
+func TestAPNsSender_ProviderToken(t *testing.T) {
+	var dir, dirErr = ioutil.TempDir("", "apns")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+
+	var standIn = newAPNsStandIn(t)
+	defer standIn.server.Close()
+	var sender = standIn.getSender(t, dir)
+
+	var now = time.Now()
+	sender.now = func() time.Time { return now }
+	assert.Nil(t, sender.Send("iphone", testMessage))
+	var first = sender.providerToken
+
+	now = now.Add(providerTokenLifetime / 2)
+	assert.Nil(t, sender.Send("iphone", testMessage))
+	assert.Equal(t, first, sender.providerToken, "token is reused")
+
+	now = now.Add(providerTokenLifetime)
+	assert.Nil(t, sender.Send("iphone", testMessage))
+	assert.NotEqual(t, first, sender.providerToken, "token is refreshed")
+
+	assert.True(t, IsTemporary(sender.Send("expired", testMessage)))
+	assert.Equal(t, "", sender.providerToken, "expired token is dropped")
+}
+
+func TestParseAPNsKey_NotPEM(t *testing.T) {
+	var _, err = parseAPNsKey([]byte("not a key"))
+	assert.Equal(t, jwt.ErrKeyMustBePEMEncoded, err)
+}
@@ -0,0 +1,130 @@
+package push
+
+import (
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/Sovianum/acquaintance-server/dao"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/mylog"
+	"sync"
+	"time"
+)
+
+type job struct {
+	userId int
+	msg    Message
+}
+
+// Dispatcher delivers messages to devices of users with a pool of workers.
+// Temporary failures are retried with exponential backoff, tokens reported
+// as invalid are deleted. Messages queued after the queue is full are dropped:
+// push notifications are a hint, events are still delivered when the app polls.
+type Dispatcher struct {
+	devices     dao.DeviceDAO
+	senders     map[string]Sender
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	sleep       func(time.Duration)
+	logger      *mylog.Logger
+
+	lock   sync.RWMutex
+	closed bool
+	jobs   chan job
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher starts the workers. senders are keyed by platform, devices
+// of platforms without a sender are skipped.
+func NewDispatcher(
+	conf config.PushConfig, devices dao.DeviceDAO, senders map[string]Sender, logger *mylog.Logger,
+) *Dispatcher {
+	var dispatcher = &Dispatcher{
+		devices:     devices,
+		senders:     senders,
+		maxAttempts: conf.GetMaxAttempts(),
+		baseDelay:   conf.GetBaseDelay(),
+		maxDelay:    conf.GetMaxDelay(),
+		sleep:       time.Sleep,
+		logger:      logger,
+		jobs:        make(chan job, conf.GetQueueSize()),
+	}
+
+	for i := 0; i != conf.GetWorkers(); i++ {
+		dispatcher.wg.Add(1)
+		go dispatcher.work()
+	}
+	return dispatcher
+}
+
+func (dispatcher *Dispatcher) Notify(userId int, msg Message) {
+	dispatcher.lock.RLock()
+	defer dispatcher.lock.RUnlock()
+
+	if dispatcher.closed {
+		return
+	}
+	select {
+	case dispatcher.jobs <- job{userId: userId, msg: msg}:
+	default:
+		dispatcher.logger.Errorf("push queue is full, dropped notification of user %d", userId)
+	}
+}
+
+// Close waits for queued messages to be delivered.
+func (dispatcher *Dispatcher) Close() error {
+	dispatcher.lock.Lock()
+	if !dispatcher.closed {
+		dispatcher.closed = true
+		close(dispatcher.jobs)
+	}
+	dispatcher.lock.Unlock()
+
+	dispatcher.wg.Wait()
+	return nil
+}
+
+func (dispatcher *Dispatcher) work() {
+	defer dispatcher.wg.Done()
+
+	for job := range dispatcher.jobs {
+		var devices, err = dispatcher.devices.GetDevices(job.userId)
+		if err != nil {
+			dispatcher.logger.Errorf("failed to get devices of user %d: %s", job.userId, err.Error())
+			continue
+		}
+		for _, device := range devices {
+			dispatcher.deliver(device, job.msg)
+		}
+	}
+}
+
+func (dispatcher *Dispatcher) deliver(device *model.Device, msg Message) {
+	var sender, ok = dispatcher.senders[device.Platform]
+	if !ok {
+		return
+	}
+
+	var delay = dispatcher.baseDelay
+	for attempt := 1; ; attempt++ {
+		var err = sender.Send(device.Token, msg)
+		switch {
+		case err == nil:
+			return
+		case err == ErrInvalidToken:
+			if err := dispatcher.devices.DeleteToken(device.Token); err != nil {
+				dispatcher.logger.Errorf("failed to prune %s token: %s", device.Platform, err.Error())
+			}
+			return
+		case !IsTemporary(err) || attempt == dispatcher.maxAttempts:
+			dispatcher.logger.Errorf(
+				"failed to push to %s device after %d attempts: %s", device.Platform, attempt, err.Error(),
+			)
+			return
+		}
+
+		dispatcher.sleep(delay)
+		if delay *= 2; delay > dispatcher.maxDelay {
+			delay = dispatcher.maxDelay
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package push
+
+import (
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/mylog"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeDeviceDAO struct {
+	lock    sync.Mutex
+	devices map[int][]*model.Device
+	deleted []string
+}
+
+func newFakeDeviceDAO(userId int, devices ...*model.Device) *fakeDeviceDAO {
+	return &fakeDeviceDAO{devices: map[int][]*model.Device{userId: devices}, deleted: make([]string, 0)}
+}
+
+func (dao *fakeDeviceDAO) AddDevice(userId int, device *model.Device) error {
+	return nil
+}
+
+func (dao *fakeDeviceDAO) GetDevices(userId int) ([]*model.Device, error) {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	return dao.devices[userId], nil
+}
+
+func (dao *fakeDeviceDAO) RemoveDevice(userId int, token string) (bool, error) {
+	return false, nil
+}
+
+func (dao *fakeDeviceDAO) DeleteToken(token string) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	dao.deleted = append(dao.deleted, token)
+	return nil
+}
+
+var testMessage = Message{Title: "title", Body: "body", Data: map[string]string{"request_id": "1"}}
+
+func TestNewNotifier(t *testing.T) {
+	var notifier, err = NewNotifier(config.PushConfig{}, nil, nil)
+	assert.Nil(t, err)
+	assert.IsType(t, new(MemoryNotifier), notifier)
+
+	_, err = NewNotifier(config.PushConfig{Backend: "pigeon"}, nil, nil)
+	assert.NotNil(t, err)
+
+	_, err = NewNotifier(config.PushConfig{Backend: Remote, FCM: config.FCMConfig{ProjectId: "p"}}, nil, nil)
+	assert.NotNil(t, err, "missing credentials file")
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	var devices = newFakeDeviceDAO(
+		1,
+		&model.Device{Token: "android", Platform: model.PlatformFCM},
+		&model.Device{Token: "iphone", Platform: model.PlatformAPNs},
+	)
+	var sender = NewMemorySender()
+	// there is no APNs sender, so the iphone is skipped
+	var dispatcher, _ = getDispatcher(devices, sender, 3)
+
+	dispatcher.Notify(1, testMessage)
+	dispatcher.Notify(2, testMessage)
+	dispatcher.Close()
+
+	assert.Equal(t, []Delivery{{Token: "android", Message: testMessage}}, sender.Deliveries())
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	var devices = newFakeDeviceDAO(1, &model.Device{Token: "android", Platform: model.PlatformFCM})
+	var sender = NewMemorySender()
+	sender.Failures = 3
+	var dispatcher, delays = getDispatcher(devices, sender, 5)
+
+	dispatcher.Notify(1, testMessage)
+	dispatcher.Close()
+
+	assert.Equal(t, 4, sender.Attempts())
+	assert.Equal(t, 1, len(sender.Deliveries()))
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 250 * time.Millisecond}, *delays)
+}
+
+func TestDispatcher_GiveUp(t *testing.T) {
+	var devices = newFakeDeviceDAO(1, &model.Device{Token: "android", Platform: model.PlatformFCM})
+	var sender = NewMemorySender()
+	sender.Failures = 10
+	var dispatcher, _ = getDispatcher(devices, sender, 3)
+
+	dispatcher.Notify(1, testMessage)
+	dispatcher.Close()
+
+	assert.Equal(t, 3, sender.Attempts())
+	assert.Equal(t, 0, len(sender.Deliveries()))
+	assert.Equal(t, 0, len(devices.deleted))
+}
+
+func TestDispatcher_PruneInvalidToken(t *testing.T) {
+	var devices = newFakeDeviceDAO(
+		1,
+		&model.Device{Token: "old", Platform: model.PlatformFCM},
+		&model.Device{Token: "new", Platform: model.PlatformFCM},
+	)
+	var sender = NewMemorySender()
+	sender.Invalid["old"] = true
+	var dispatcher, _ = getDispatcher(devices, sender, 3)
+
+	dispatcher.Notify(1, testMessage)
+	dispatcher.Close()
+
+	assert.Equal(t, []string{"old"}, devices.deleted)
+	assert.Equal(t, []Delivery{{Token: "new", Message: testMessage}}, sender.Deliveries())
+}
+
+func TestDispatcher_NotifyAfterClose(t *testing.T) {
+	var devices = newFakeDeviceDAO(1, &model.Device{Token: "android", Platform: model.PlatformFCM})
+	var sender = NewMemorySender()
+	var dispatcher, _ = getDispatcher(devices, sender, 3)
+
+	dispatcher.Close()
+	dispatcher.Notify(1, testMessage)
+	assert.Nil(t, dispatcher.Close())
+	assert.Equal(t, 0, sender.Attempts())
+}
+
+// getDispatcher returns a dispatcher sending FCM messages with sender.
+// It records delays between attempts instead of sleeping.
+func getDispatcher(devices *fakeDeviceDAO, sender Sender, maxAttempts int) (*Dispatcher, *[]time.Duration) {
+	var conf = config.PushConfig{
+		Workers:         2,
+		MaxAttempts:     maxAttempts,
+		BaseDelayMillis: 100,
+		MaxDelaySeconds: 1,
+	}
+	var dispatcher = NewDispatcher(
+		conf, devices, map[string]Sender{model.PlatformFCM: sender}, mylog.NewLogger(ioutil.Discard),
+	)
+	// seconds are too coarse to see the cap within a few attempts
+	dispatcher.maxDelay = 250 * time.Millisecond
+
+	var lock sync.Mutex
+	var delays = make([]time.Duration, 0)
+	dispatcher.sleep = func(delay time.Duration) {
+		lock.Lock()
+		delays = append(delays, delay)
+		lock.Unlock()
+	}
+	return dispatcher, &delays
+}
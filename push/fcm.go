@@ -0,0 +1,220 @@
+package push
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fcmService        = "FCM"
+	fcmEndpoint       = "https://fcm.googleapis.com"
+	fcmScope          = "https://www.googleapis.com/auth/firebase.messaging"
+	googleTokenURL    = "https://oauth2.googleapis.com/token"
+	jwtBearerGrant    = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	fcmUnregistered   = "UNREGISTERED"
+	assertionLifetime = time.Hour
+	// an access token is renewed a bit before it expires, so that it does not
+	// expire on the way to FCM
+	accessTokenMargin = time.Minute
+)
+
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+}
+
+type accessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type fcmRequest struct {
+	Message fcmMessage `json:"message"`
+}
+
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification fcmNotification   `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      fcmAndroid        `json:"android"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type fcmAndroid struct {
+	Priority string `json:"priority"`
+}
+
+type fcmErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// fcmSender sends messages with FCM HTTP v1 API. The API is authorized with
+// OAuth 2 access tokens which are obtained for a JWT signed with the key of
+// a service account and cached until they expire.
+type fcmSender struct {
+	client   *http.Client
+	url      string
+	tokenURL string
+	email    string
+	key      *rsa.PrivateKey
+	now      func() time.Time
+
+	lock        sync.Mutex
+	accessToken string
+	expires     time.Time
+}
+
+func NewFCMSender(conf config.FCMConfig, client *http.Client) (Sender, error) {
+	var data, err = ioutil.ReadFile(conf.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var account serviceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, err
+	}
+	var key, keyErr = jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	var endpoint = conf.Endpoint
+	if endpoint == "" {
+		endpoint = fcmEndpoint
+	}
+	var tokenURL = conf.TokenURL
+	if tokenURL == "" {
+		tokenURL = googleTokenURL
+	}
+
+	return &fcmSender{
+		client:   client,
+		url:      fmt.Sprintf("%s/v1/projects/%s/messages:send", endpoint, conf.ProjectId),
+		tokenURL: tokenURL,
+		email:    account.ClientEmail,
+		key:      key,
+		now:      time.Now,
+	}, nil
+}
+
+func (sender *fcmSender) Send(token string, msg Message) error {
+	var accessToken, tokenErr = sender.getAccessToken()
+	if tokenErr != nil {
+		return Temporary(tokenErr)
+	}
+
+	var body, _ = json.Marshal(fcmRequest{
+		Message: fcmMessage{
+			Token:        token,
+			Notification: fcmNotification{Title: msg.Title, Body: msg.Body},
+			Data:         msg.Data,
+			Android:      fcmAndroid{Priority: "high"},
+		},
+	})
+	var req, _ = http.NewRequest(http.MethodPost, sender.url, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp, err = sender.client.Do(req)
+	if err != nil {
+		return Temporary(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var errResp fcmErrorResponse
+	json.NewDecoder(resp.Body).Decode(&errResp)
+	for _, detail := range errResp.Error.Details {
+		if detail.ErrorCode == fcmUnregistered {
+			return ErrInvalidToken
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return ErrInvalidToken
+	case http.StatusUnauthorized:
+		// the access token may have been revoked, the next attempt gets a new one
+		sender.resetAccessToken()
+		return Temporary(statusError(fcmService, resp.StatusCode, errResp.Error.Message))
+	default:
+		return statusError(fcmService, resp.StatusCode, errResp.Error.Message)
+	}
+}
+
+func (sender *fcmSender) getAccessToken() (string, error) {
+	sender.lock.Lock()
+	defer sender.lock.Unlock()
+
+	var now = sender.now()
+	if sender.accessToken != "" && now.Before(sender.expires.Add(-accessTokenMargin)) {
+		return sender.accessToken, nil
+	}
+
+	var assertion, signErr = jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   sender.email,
+		"scope": fcmScope,
+		"aud":   sender.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(assertionLifetime).Unix(),
+	}).SignedString(sender.key)
+	if signErr != nil {
+		return "", signErr
+	}
+
+	var resp, err = sender.client.PostForm(sender.tokenURL, url.Values{
+		"grant_type": {jwtBearerGrant},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var reason, _ = ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to get access token: %d %s", resp.StatusCode, strings.TrimSpace(string(reason)))
+	}
+	var tokenResp accessTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", err
+	}
+	if tokenResp.AccessToken == "" {
+		return "", errors.New("got empty access token")
+	}
+
+	sender.accessToken = tokenResp.AccessToken
+	sender.expires = now.Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	return sender.accessToken, nil
+}
+
+func (sender *fcmSender) resetAccessToken() {
+	sender.lock.Lock()
+	sender.accessToken = ""
+	sender.lock.Unlock()
+}
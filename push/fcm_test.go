@@ -0,0 +1,165 @@
+package push
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fcmStandIn imitates Google token endpoint and FCM HTTP v1 API.
+// Token "gone" is unregistered, token "busy" makes FCM unavailable.
+type fcmStandIn struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	lock          sync.Mutex
+	tokenRequests int
+	messages      []fcmMessage
+}
+
+func newFCMStandIn(t *testing.T) *fcmStandIn {
+	var key, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var standIn = &fcmStandIn{key: key, messages: make([]fcmMessage, 0)}
+	var mux = http.NewServeMux()
+	mux.HandleFunc("/token", standIn.issueToken)
+	mux.HandleFunc("/v1/projects/project/messages:send", standIn.send)
+	standIn.server = httptest.NewServer(mux)
+	return standIn
+}
+
+func (standIn *fcmStandIn) issueToken(w http.ResponseWriter, r *http.Request) {
+	// tests move the clock of the sender, so times are not checked
+	var parser = &jwt.Parser{SkipClaimsValidation: true}
+	var assertion, err = parser.Parse(r.PostFormValue("assertion"), func(token *jwt.Token) (interface{}, error) {
+		return &standIn.key.PublicKey, nil
+	})
+	if err != nil || r.PostFormValue("grant_type") != jwtBearerGrant {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var claims = assertion.Claims.(jwt.MapClaims)
+	if claims["iss"] != "push@project.iam" || claims["scope"] != fcmScope {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	standIn.lock.Lock()
+	standIn.tokenRequests++
+	standIn.lock.Unlock()
+	json.NewEncoder(w).Encode(accessTokenResponse{AccessToken: "access", ExpiresIn: 3600})
+}
+
+func (standIn *fcmStandIn) send(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer access" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var req fcmRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	switch req.Message.Token {
+	case "gone":
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": {"code": 404, "message": "Requested entity was not found.", "status": "NOT_FOUND",
+			"details": [{"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError", "errorCode": "UNREGISTERED"}]}}`))
+	case "busy":
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error": {"code": 503, "message": "The service is currently unavailable.", "status": "UNAVAILABLE"}}`))
+	default:
+		standIn.lock.Lock()
+		standIn.messages = append(standIn.messages, req.Message)
+		standIn.lock.Unlock()
+		w.Write([]byte(`{"name": "projects/project/messages/1"}`))
+	}
+}
+
+func (standIn *fcmStandIn) getSender(t *testing.T, dir string) *fcmSender {
+	var keyData = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(standIn.key)})
+	var credentials, _ = json.Marshal(serviceAccount{ClientEmail: "push@project.iam", PrivateKey: string(keyData)})
+	var credentialsFile = filepath.Join(dir, "credentials.json")
+	if err := ioutil.WriteFile(credentialsFile, credentials, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var sender, err = NewFCMSender(config.FCMConfig{
+		ProjectId:       "project",
+		CredentialsFile: credentialsFile,
+		Endpoint:        standIn.server.URL,
+		TokenURL:        standIn.server.URL + "/token",
+	}, standIn.server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender.(*fcmSender)
+}
+
+func TestFCMSender(t *testing.T) {
+	var dir, dirErr = ioutil.TempDir("", "fcm")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+
+	var standIn = newFCMStandIn(t)
+	defer standIn.server.Close()
+	var sender = standIn.getSender(t, dir)
+
+	assert.Nil(t, sender.Send("android", testMessage))
+	assert.Nil(t, sender.Send("android", testMessage))
+	assert.Equal(t, ErrInvalidToken, sender.Send("gone", testMessage))
+
+	var err = sender.Send("busy", testMessage)
+	assert.True(t, IsTemporary(err))
+
+	assert.Equal(t, 1, standIn.tokenRequests, "access token is cached")
+	assert.Equal(t, 2, len(standIn.messages))
+	assert.Equal(t, fcmMessage{
+		Token:        "android",
+		Notification: fcmNotification{Title: "title", Body: "body"},
+		Data:         map[string]string{"request_id": "1"},
+		Android:      fcmAndroid{Priority: "high"},
+	}, standIn.messages[0])
+}
+
+func TestFCMSender_RenewAccessToken(t *testing.T) {
+	var dir, dirErr = ioutil.TempDir("", "fcm")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+
+	var standIn = newFCMStandIn(t)
+	defer standIn.server.Close()
+	var sender = standIn.getSender(t, dir)
+
+	var now = time.Now()
+	sender.now = func() time.Time { return now }
+	assert.Nil(t, sender.Send("android", testMessage))
+
+	now = now.Add(time.Hour)
+	assert.Nil(t, sender.Send("android", testMessage))
+	assert.Equal(t, 2, standIn.tokenRequests)
+
+	// a revoked token is dropped and a new one is got with the next attempt
+	sender.accessToken = "revoked"
+	assert.True(t, IsTemporary(sender.Send("android", testMessage)))
+	assert.Nil(t, sender.Send("android", testMessage))
+	assert.Equal(t, 3, standIn.tokenRequests)
+}
@@ -0,0 +1,90 @@
+package push
+
+import "sync"
+
+type Notification struct {
+	UserId  int
+	Message Message
+}
+
+// MemoryNotifier keeps notifications so that tests can inspect them.
+type MemoryNotifier struct {
+	lock          sync.Mutex
+	notifications []Notification
+}
+
+func NewMemoryNotifier() *MemoryNotifier {
+	return &MemoryNotifier{notifications: make([]Notification, 0)}
+}
+
+func (notifier *MemoryNotifier) Notify(userId int, msg Message) {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	notifier.notifications = append(notifier.notifications, Notification{UserId: userId, Message: msg})
+}
+
+func (notifier *MemoryNotifier) Close() error {
+	return nil
+}
+
+func (notifier *MemoryNotifier) Notifications() []Notification {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	var result = make([]Notification, len(notifier.notifications))
+	copy(result, notifier.notifications)
+	return result
+}
+
+type Delivery struct {
+	Token   string
+	Message Message
+}
+
+// MemorySender is a fake push service. It rejects tokens from Invalid
+// and fails the first Failures sends temporarily.
+type MemorySender struct {
+	Invalid  map[string]bool
+	Failures int
+
+	lock       sync.Mutex
+	attempts   int
+	deliveries []Delivery
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{Invalid: make(map[string]bool), deliveries: make([]Delivery, 0)}
+}
+
+func (sender *MemorySender) Send(token string, msg Message) error {
+	sender.lock.Lock()
+	defer sender.lock.Unlock()
+
+	sender.attempts++
+	if sender.Invalid[token] {
+		return ErrInvalidToken
+	}
+	if sender.attempts <= sender.Failures {
+		return Temporary(errUnavailable)
+	}
+	sender.deliveries = append(sender.deliveries, Delivery{Token: token, Message: msg})
+	return nil
+}
+
+// Attempts returns the number of sends including failed ones.
+func (sender *MemorySender) Attempts() int {
+	sender.lock.Lock()
+	defer sender.lock.Unlock()
+
+	return sender.attempts
+}
+
+func (sender *MemorySender) Deliveries() []Delivery {
+	sender.lock.Lock()
+	defer sender.lock.Unlock()
+
+	var result = make([]Delivery, len(sender.deliveries))
+	copy(result, sender.deliveries)
+	return result
+}
@@ -0,0 +1,115 @@
+package push
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/Sovianum/acquaintance-server/dao"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/mylog"
+	"net/http"
+	"time"
+)
+
+const (
+	Remote = "remote"
+	Memory = "memory"
+
+	sendTimeout = 10 * time.Second
+)
+
+var (
+	// ErrInvalidToken means that the push service will never accept the token
+	// again, e.g. because the app was removed, so the token is pruned.
+	ErrInvalidToken = errors.New("device token is not valid anymore")
+
+	errUnavailable = errors.New("push service is unavailable")
+)
+
+type Message struct {
+	Title string
+	Body  string
+	// Data is passed to the app as is, so that it can render the message itself.
+	Data map[string]string
+}
+
+// Notifier sends push notifications to all devices of a user, so that users
+// learn about requests while the app is in background and does not poll.
+type Notifier interface {
+	// Notify queues the message and does not wait for it to be delivered.
+	Notify(userId int, msg Message)
+	Close() error
+}
+
+// Sender delivers messages to devices of a single platform.
+type Sender interface {
+	// Send returns ErrInvalidToken if the token must be pruned and an error
+	// made with Temporary if the delivery may succeed later.
+	Send(token string, msg Message) error
+}
+
+type temporaryError struct {
+	err error
+}
+
+func (e temporaryError) Error() string {
+	return e.err.Error()
+}
+
+// Temporary marks err as worth retrying.
+func Temporary(err error) error {
+	return temporaryError{err: err}
+}
+
+func IsTemporary(err error) bool {
+	var _, ok = err.(temporaryError)
+	return ok
+}
+
+func NewNotifier(conf config.PushConfig, devices dao.DeviceDAO, logger *mylog.Logger) (Notifier, error) {
+	switch conf.Backend {
+	case Remote:
+		var senders, err = newSenders(conf)
+		if err != nil {
+			return nil, err
+		}
+		return NewDispatcher(conf, devices, senders, logger), nil
+	case Memory, "":
+		return NewMemoryNotifier(), nil
+	default:
+		return nil, fmt.Errorf("unsupported push backend \"%s\"", conf.Backend)
+	}
+}
+
+// newSenders creates senders of configured platforms only, so that
+// an app built for a single platform needs no credentials of the other one.
+func newSenders(conf config.PushConfig) (map[string]Sender, error) {
+	var client = &http.Client{Timeout: sendTimeout}
+	var senders = make(map[string]Sender)
+
+	if conf.FCM.ProjectId != "" {
+		var sender, err = NewFCMSender(conf.FCM, client)
+		if err != nil {
+			return nil, err
+		}
+		senders[model.PlatformFCM] = sender
+	}
+	if conf.APNs.KeyFile != "" {
+		var sender, err = NewAPNsSender(conf.APNs, client)
+		if err != nil {
+			return nil, err
+		}
+		senders[model.PlatformAPNs] = sender
+	}
+	return senders, nil
+}
+
+// statusError turns an unsuccessful response of a push service into an error.
+// Throttling and server errors are temporary.
+func statusError(service string, code int, reason string) error {
+	var err = fmt.Errorf("%s responded with %d: %s", service, code, reason)
+	if code == http.StatusTooManyRequests || code >= http.StatusInternalServerError {
+		return Temporary(err)
+	}
+	return err
+}
@@ -3,6 +3,18 @@ CREATE EXTENSION IF NOT EXISTS Postgis;
 DROP TABLE IF EXISTS Users CASCADE;
 DROP TABLE IF EXISTS Position CASCADE;
 DROP TABLE IF EXISTS MeetRequest CASCADE;
+DROP TABLE IF EXISTS Session CASCADE;
+DROP TABLE IF EXISTS PasswordReset CASCADE;
+DROP TABLE IF EXISTS LoginThrottle CASCADE;
+DROP TABLE IF EXISTS LoginFailure CASCADE;
+DROP TABLE IF EXISTS TwoFactor CASCADE;
+DROP TABLE IF EXISTS RecoveryCode CASCADE;
+DROP TABLE IF EXISTS UserBlock CASCADE;
+DROP TABLE IF EXISTS Report CASCADE;
+DROP TABLE IF EXISTS Interest CASCADE;
+DROP TABLE IF EXISTS UserInterest CASCADE;
+DROP TABLE IF EXISTS Event CASCADE;
+DROP TABLE IF EXISTS EventLock CASCADE;
 
 DROP TYPE IF EXISTS REQUEST_STATUS;
 DROP TYPE IF EXISTS SEX;
@@ -11,21 +23,37 @@ CREATE TYPE SEX AS ENUM ('M', 'F', '');
 CREATE TYPE REQUEST_STATUS AS ENUM ('PENDING', 'ACCEPTED', 'DECLINED', 'INTERRUPTED');
 
 CREATE TABLE Users (
-  id       SERIAL PRIMARY KEY,
-  login    VARCHAR(50) UNIQUE ,
-  password BYTEA,
-  sex      SEX NOT NULL DEFAULT '',
-  age      INT,
-  about    VARCHAR(1000)
+  id             SERIAL PRIMARY KEY,
+  login          VARCHAR(50) UNIQUE ,
+  password       BYTEA,
+  sex            SEX NOT NULL DEFAULT '',
+  age            INT,
+  about          VARCHAR(1000),
+  email          VARCHAR(254) UNIQUE,
+  role           VARCHAR(20) NOT NULL DEFAULT 'user',
+  banned         BOOLEAN NOT NULL DEFAULT FALSE,
+  suspendedUntil TIMESTAMP,
+  photo          VARCHAR(100)
 );
 
+-- accuracy, altitude and speed are in metres (per second), clientTime is when
+-- the device determined the point, time is when the server saved it
 CREATE TABLE Position (
-  id     SERIAL PRIMARY KEY,
-  userId INTEGER REFERENCES Users (id),
-  point  GEOMETRY,
-  time   TIMESTAMP DEFAULT now()
+  id         SERIAL PRIMARY KEY,
+  userId     INTEGER REFERENCES Users (id),
+  point      GEOGRAPHY(Point, 4326) NOT NULL,
+  accuracy   DOUBLE PRECISION,
+  altitude   DOUBLE PRECISION,
+  speed      DOUBLE PRECISION,
+  clientTime TIMESTAMP,
+  time       TIMESTAMP DEFAULT now()
 );
 
+-- the latest position is the one taken last, client time of positions uploaded later wins
+CREATE INDEX position_user_time_idx ON Position (userId, LEAST(clientTime, time) DESC);
+-- a position determined by the device is saved once however many times it is uploaded
+CREATE UNIQUE INDEX position_user_client_time_idx ON Position (userId, clientTime);
+
 CREATE TABLE MeetRequest (
   id SERIAL PRIMARY KEY,
   time TIMESTAMP DEFAULT now(),
@@ -33,3 +61,158 @@ CREATE TABLE MeetRequest (
   requestedId INT REFERENCES Users(id),
   status REQUEST_STATUS DEFAULT 'PENDING'
 );
+
+CREATE TABLE Session (
+  id          SERIAL PRIMARY KEY,
+  userId      INTEGER REFERENCES Users (id),
+  refreshHash BYTEA     NOT NULL,
+  created     TIMESTAMP DEFAULT now(),
+  expires     TIMESTAMP NOT NULL,
+  revoked     BOOLEAN   NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX session_user_idx ON Session (userId);
+
+CREATE TABLE PasswordReset (
+  id        SERIAL PRIMARY KEY,
+  userId    INTEGER REFERENCES Users (id),
+  tokenHash BYTEA     NOT NULL UNIQUE,
+  created   TIMESTAMP DEFAULT now(),
+  expires   TIMESTAMP NOT NULL,
+  used      BOOLEAN   NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE LoginThrottle (
+  attemptKey  VARCHAR(100) PRIMARY KEY,
+  failures    INTEGER   NOT NULL,
+  lastFailure TIMESTAMP NOT NULL
+);
+
+CREATE TABLE LoginFailure (
+  id     SERIAL PRIMARY KEY,
+  login  VARCHAR(50),
+  ip     VARCHAR(45),
+  reason VARCHAR(20) NOT NULL,
+  time   TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX login_failure_time_idx ON LoginFailure (time);
+
+CREATE TABLE TwoFactor (
+  userId      INTEGER PRIMARY KEY REFERENCES Users (id),
+  secret      BYTEA   NOT NULL,
+  enabled     BOOLEAN NOT NULL DEFAULT FALSE,
+  lastCounter BIGINT  NOT NULL DEFAULT 0
+);
+
+CREATE TABLE RecoveryCode (
+  id       SERIAL PRIMARY KEY,
+  userId   INTEGER REFERENCES Users (id),
+  codeHash BYTEA   NOT NULL,
+  used     BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX recovery_code_user_idx ON RecoveryCode (userId);
+
+CREATE TABLE UserBlock (
+  blockerId INTEGER REFERENCES Users (id),
+  blockedId INTEGER REFERENCES Users (id),
+  time      TIMESTAMP DEFAULT now(),
+  PRIMARY KEY (blockerId, blockedId)
+);
+
+CREATE INDEX user_block_blocked_idx ON UserBlock (blockedId);
+
+-- reports outlive accounts, ids of a deleted user are set to NULL, so the login
+-- of the reported user is kept
+CREATE TABLE Report (
+  id            SERIAL PRIMARY KEY,
+  reporterId    INTEGER REFERENCES Users (id),
+  reportedId    INTEGER REFERENCES Users (id),
+  reportedLogin VARCHAR(50) NOT NULL DEFAULT '',
+  requestId     INTEGER REFERENCES MeetRequest (id),
+  reason        VARCHAR(20)   NOT NULL,
+  text          VARCHAR(1000) NOT NULL DEFAULT '',
+  status        VARCHAR(20)   NOT NULL DEFAULT 'open',
+  time          TIMESTAMP DEFAULT now(),
+  resolvedBy    INTEGER,
+  action        VARCHAR(20),
+  comment       VARCHAR(1000),
+  resolvedAt    TIMESTAMP
+);
+
+CREATE INDEX report_open_idx ON Report (time) WHERE status = 'open';
+
+CREATE TABLE Interest (
+  id   SERIAL PRIMARY KEY,
+  name VARCHAR(50) UNIQUE NOT NULL
+);
+
+CREATE TABLE UserInterest (
+  userId     INTEGER REFERENCES Users (id),
+  interestId INTEGER REFERENCES Interest (id),
+  PRIMARY KEY (userId, interestId)
+);
+
+CREATE INDEX user_interest_interest_idx ON UserInterest (interestId);
+
+CREATE TABLE Event (
+  id        BIGSERIAL PRIMARY KEY,
+  userId    INTEGER REFERENCES Users (id),
+  requestId INTEGER REFERENCES MeetRequest (id),
+  status    REQUEST_STATUS NOT NULL,
+  time      TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX event_user_idx ON Event (userId, id);
+
+-- events of a user are saved holding the row of the user, so that their ids grow
+-- in commit order and cursors past an id never skip an event committed later
+CREATE TABLE EventLock (
+  userId INTEGER PRIMARY KEY REFERENCES Users (id)
+);
+
+-- a token belongs to the app installation, so it moves to whoever signs in on the device last
+CREATE TABLE Device (
+  id       SERIAL PRIMARY KEY,
+  userId   INTEGER REFERENCES Users (id),
+  platform VARCHAR(10) NOT NULL,
+  token    VARCHAR(512) UNIQUE NOT NULL,
+  updated  TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX device_user_idx ON Device (userId);
+
+-- empty events means all event types
+CREATE TABLE WebhookSubscription (
+  id      SERIAL PRIMARY KEY,
+  url     VARCHAR(2048) NOT NULL,
+  secret  VARCHAR(256) NOT NULL,
+  events  VARCHAR(32)[] NOT NULL DEFAULT '{}',
+  created TIMESTAMP DEFAULT now()
+);
+
+CREATE TYPE WEBHOOK_DELIVERY_STATUS AS ENUM ('pending', 'delivered', 'dead');
+
+CREATE TABLE WebhookDelivery (
+  id             BIGSERIAL PRIMARY KEY,
+  subscriptionId INTEGER REFERENCES WebhookSubscription (id) ON DELETE CASCADE,
+  eventType      VARCHAR(32) NOT NULL,
+  payload        TEXT NOT NULL,
+  status         WEBHOOK_DELIVERY_STATUS NOT NULL DEFAULT 'pending',
+  attempts       INTEGER NOT NULL DEFAULT 0,
+  nextAttempt    TIMESTAMP DEFAULT now(),
+  lastError      TEXT,
+  created        TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX webhook_delivery_due_idx ON WebhookDelivery (nextAttempt) WHERE status = 'pending';
+CREATE INDEX webhook_delivery_status_idx ON WebhookDelivery (status, id);
+
+-- users without a row have default settings: visible, snapped to 100 metres grid
+-- (model.MinFuzzRadius)
+CREATE TABLE Privacy (
+  userId     INTEGER PRIMARY KEY REFERENCES Users (id),
+  ghost      BOOLEAN NOT NULL DEFAULT FALSE,
+  fuzzRadius INTEGER NOT NULL DEFAULT 100
+);
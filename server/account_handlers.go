@@ -0,0 +1,220 @@
+package server
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/model"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	formatStr     = "format"
+	zipFormat     = "zip"
+	jsonFormat    = "json"
+	zipMimeType   = "application/zip"
+	exportDirName = "acquaintance-export"
+
+	unknownExportFormat = "unknown export format \"%s\", use \"json\" or \"zip\""
+)
+
+// UserDeleteSelf removes the caller's account with all positions, meet requests,
+// sessions, password resets, failed sign in records and the photo. Pending requests of the user are dropped
+// from the mail boxes of other users and the user's own mail box is discarded.
+func (env *Env) UserDeleteSelf(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var userId = getPrincipal(r).UserId
+
+	var user, userErr = env.userDAO.GetUserById(userId)
+	if userErr == sql.ErrNoRows {
+		var err = errors.New("not found")
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	if userErr != nil {
+		env.logger.LogRequestError(r, userErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(userErr), env.logger)
+		return
+	}
+
+	var deleted, deleteErr = env.userDAO.Delete(userId)
+	if deleteErr != nil {
+		env.logger.LogRequestError(r, deleteErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(deleteErr), env.logger)
+		return
+	}
+	if !deleted {
+		var err = errors.New("not found")
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.meetRequestCache.Delete(strconv.Itoa(userId))
+	if user.PhotoKey != "" {
+		env.deletePhoto(user.PhotoKey)
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+// UserExportSelfGet returns profile, position history and request history of
+// the caller. The data is sent as JSON unless a ZIP archive is requested with
+// "format=zip" query parameter or "Accept: application/zip" header.
+func (env *Env) UserExportSelfGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var userId = getPrincipal(r).UserId
+
+	var format = r.URL.Query().Get(formatStr)
+	if format == "" && r.Header.Get("Accept") == zipMimeType {
+		format = zipFormat
+	}
+	if format != "" && format != jsonFormat && format != zipFormat {
+		var err = fmt.Errorf(unknownExportFormat, format)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var export, code, exportErr = env.getUserExport(userId)
+	if exportErr != nil {
+		env.logger.LogRequestError(r, exportErr)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(exportErr), env.logger)
+		return
+	}
+
+	if format != zipFormat {
+		env.logger.LogRequestSuccess(r)
+		common.WriteWithLogging(r, w, common.GetDataJson(export), env.logger)
+		return
+	}
+
+	w.Header().Set("Content-Type", zipMimeType)
+	w.Header().Set(
+		"Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"%s-%d.zip\"", exportDirName, userId),
+	)
+	if err := writeExportZip(w, export); err != nil {
+		// headers are already sent, so only logging is possible
+		env.logger.LogRequestError(r, err)
+		return
+	}
+	env.logger.LogRequestSuccess(r)
+}
+
+func (env *Env) getUserExport(userId int) (*model.UserExport, int, error) {
+	var exists, existsErr = env.userDAO.ExistsById(userId)
+	if existsErr != nil {
+		return nil, http.StatusInternalServerError, existsErr
+	}
+	if !exists {
+		return nil, http.StatusNotFound, errors.New("not found")
+	}
+
+	var dbUser, dbErr = env.userDAO.GetUserById(userId)
+	if dbErr != nil {
+		return nil, http.StatusInternalServerError, dbErr
+	}
+	dbUser.Password = ""
+	env.setUserPhotos(dbUser)
+
+	var positions, positionsErr = env.positionDAO.GetUserPositions(userId)
+	if positionsErr != nil {
+		return nil, http.StatusInternalServerError, positionsErr
+	}
+
+	var requests, requestsErr = env.meetRequestDAO.GetAllRequests(userId)
+	if requestsErr != nil {
+		return nil, http.StatusInternalServerError, requestsErr
+	}
+	env.setRequestPhotos(requests...)
+
+	var interests, interestsErr = env.interestDAO.GetUserInterests(userId)
+	if interestsErr != nil {
+		return nil, http.StatusInternalServerError, interestsErr
+	}
+
+	var privacy, privacyErr = env.privacyDAO.GetPrivacy(userId)
+	if privacyErr != nil {
+		return nil, http.StatusInternalServerError, privacyErr
+	}
+
+	var devices, devicesErr = env.deviceDAO.GetDevices(userId)
+	if devicesErr != nil {
+		return nil, http.StatusInternalServerError, devicesErr
+	}
+
+	var blocks, blocksErr = env.blockDAO.GetBlockedUsers(userId)
+	if blocksErr != nil {
+		return nil, http.StatusInternalServerError, blocksErr
+	}
+
+	var webhooks, webhooksErr = env.webhookDAO.GetUserDeliveries(userId)
+	if webhooksErr != nil {
+		return nil, http.StatusInternalServerError, webhooksErr
+	}
+
+	var loginAudit, auditErr = env.loginAuditDAO.GetFailures(dbUser.Login)
+	if auditErr != nil {
+		return nil, http.StatusInternalServerError, auditErr
+	}
+
+	return &model.UserExport{
+		Time:       model.QuotedTime(time.Now().UTC()),
+		Profile:    dbUser,
+		Positions:  positions,
+		Requests:   requests,
+		Interests:  interests,
+		Privacy:    privacy,
+		Devices:    devices,
+		Blocks:     blocks,
+		Webhooks:   webhooks,
+		LoginAudit: loginAudit,
+	}, http.StatusOK, nil
+}
+
+// writeExportZip puts every part of the export into a separate JSON file of the archive.
+func writeExportZip(w http.ResponseWriter, export *model.UserExport) error {
+	var files = []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"positions.json", export.Positions},
+		{"requests.json", export.Requests},
+		{"interests.json", export.Interests},
+		{"privacy.json", export.Privacy},
+		{"devices.json", export.Devices},
+		{"blocks.json", export.Blocks},
+		{"webhooks.json", export.Webhooks},
+		{"login_audit.json", export.LoginAudit},
+	}
+
+	var archive = zip.NewWriter(w)
+	for _, file := range files {
+		var fileWriter, createErr = archive.Create(exportDirName + "/" + file.name)
+		if createErr != nil {
+			return createErr
+		}
+
+		var encoder = json.NewEncoder(fileWriter)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/photo"
+	"github.com/Sovianum/acquaintance-server/server/mocks"
+	"github.com/Sovianum/acquaintance-server/storage"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var requestColumns = []string{
+	"id", "requesterId", "requesterLogin", "requesterAbout",
+	"requestedId", "requestedLogin", "requestedAbout", "status", "time",
+	"requesterPhoto", "requestedPhoto",
+}
+
+func TestEnv_UserDeleteSelf_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	env.getMailBox(1)
+	var photoStorage = env.storage.(*storage.MemoryStorage)
+	photoStorage.Put(photo.Key("photos/1/abc", photo.Small), []byte("data"), photo.ContentType)
+
+	mock.
+		ExpectQuery("SELECT id, login, password").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", "hash", 30, model.MALE, "about", "", model.RoleUser, false, nil, "photos/1/abc"),
+		)
+
+	// mock deletion
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM Position").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("UPDATE Report SET reporterId = NULLIF").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Event").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM EventLock").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM MeetRequest").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM UserBlock").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM UserInterest").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Device").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Privacy").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Session").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM PasswordReset").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM RecoveryCode").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM TwoFactor").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM LoginFailure").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM Users").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodDelete,
+		env.withAuth(env.UserDeleteSelf),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var _, found = env.meetRequestCache.Get(strconv.Itoa(1))
+	assert.False(t, found)
+	assert.Empty(t, photoStorage.Keys())
+}
+
+func TestEnv_UserDeleteSelf_NotFound(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT id, login, password").
+		WithArgs(1).
+		WillReturnError(sql.ErrNoRows)
+
+	var env = getEnv(db)
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodDelete,
+		env.withAuth(env.UserDeleteSelf),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserExportSelfGet_Json(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockExport(mock)
+
+	var env = getEnv(db)
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodGet,
+		env.withAuth(env.UserExportSelfGet),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var body = rec.Body.String()
+	assert.True(t, strings.Contains(body, "\"profile\""))
+	assert.True(t, strings.Contains(body, "\"positions\""))
+	assert.True(t, strings.Contains(body, "\"requests\""))
+	assert.True(t, strings.Contains(body, "\"interests\":[\"chess\"]"))
+	assert.True(t, strings.Contains(body, "\"privacy\":{\"ghost\":true,\"fuzz_radius\":500}"))
+	assert.True(t, strings.Contains(body, "\"devices\":[{\"token\":\"device-token\""))
+	assert.True(t, strings.Contains(body, "\"blocks\":[{\"id\":3"))
+	assert.True(t, strings.Contains(body, "\"webhooks\":[{\"id\":5"))
+	assert.True(t, strings.Contains(body, "\"login_audit\":[{\"ip\":\"127.0.0.1\""))
+	assert.False(t, strings.Contains(body, "hash"))
+}
+
+func TestEnv_UserExportSelfGet_Zip(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockExport(mock)
+
+	var env = getEnv(db)
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample+"?format=zip",
+		http.MethodGet,
+		env.withAuth(env.UserExportSelfGet),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, zipMimeType, rec.Header().Get("Content-Type"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var data = rec.Body.Bytes()
+	var archive, zipErr = zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, zipErr)
+
+	var names = make([]string, 0)
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	assert.Equal(
+		t,
+		[]string{
+			"acquaintance-export/profile.json",
+			"acquaintance-export/positions.json",
+			"acquaintance-export/requests.json",
+			"acquaintance-export/interests.json",
+			"acquaintance-export/privacy.json",
+			"acquaintance-export/devices.json",
+			"acquaintance-export/blocks.json",
+			"acquaintance-export/webhooks.json",
+			"acquaintance-export/login_audit.json",
+		},
+		names,
+	)
+
+	var profile, _ = archive.File[0].Open()
+	var profileData, _ = ioutil.ReadAll(profile)
+	assert.True(t, strings.Contains(string(profileData), "\"login\": \"login\""))
+}
+
+func TestEnv_UserExportSelfGet_UnknownFormat(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample+"?format=xml",
+		http.MethodGet,
+		env.withAuth(env.UserExportSelfGet),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func mockExport(mock sqlmock.Sqlmock) {
+	// mock exists
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	// mock user selection
+	mock.
+		ExpectQuery("SELECT id, login, password").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", "hash", 30, model.MALE, "about", "", model.RoleUser, false, nil, ""),
+		)
+
+	// mock position history selection
+	mock.
+		ExpectQuery("SELECT id, userId").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows(positionColumns).
+				AddRow(1, 1, 20., 10., nil, nil, nil, nil, time.Now()),
+		)
+
+	// mock request history selection
+	mock.
+		ExpectQuery("SELECT mr.id").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows(requestColumns).
+				AddRow(10, 1, "login", "about", 2, "other", "about", model.StatusDeclined, time.Now(), "", ""),
+		)
+
+	mock.
+		ExpectQuery("SELECT i.name FROM UserInterest").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("chess"))
+
+	mock.
+		ExpectQuery("SELECT ghost, fuzzRadius FROM Privacy").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"ghost", "fuzzRadius"}).AddRow(true, 500))
+
+	mock.
+		ExpectQuery("SELECT token, platform FROM Device").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"token", "platform"}).AddRow("device-token", model.PlatformFCM))
+
+	mock.
+		ExpectQuery("SELECT u.id, u.login, u.age, u.sex, u.about FROM UserBlock").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about"}).AddRow(3, "blocked", 25, model.FEMALE, ""),
+		)
+
+	mock.
+		ExpectQuery("SELECT d.id, d.subscriptionId").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows(webhookDeliveryColumns).AddRow(
+				5, 1, "https://partner.example", model.WebhookRequestDeclined,
+				`{"data": {"request_id": 10, "requester_id": 1, "requested_id": 2}}`,
+				model.DeliveryDelivered, 1, time.Now(), "", time.Now(),
+			),
+		)
+
+	mock.
+		ExpectQuery("SELECT COALESCE\\(ip, ''\\), reason, time FROM LoginFailure").
+		WithArgs("login").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"ip", "reason", "time"}).
+				AddRow("127.0.0.1", model.LoginFailureWrongPassword, time.Now()),
+		)
+}
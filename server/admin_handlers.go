@@ -0,0 +1,316 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+const (
+	queryStr  = "query"
+	limitStr  = "limit"
+	offsetStr = "offset"
+
+	defaultAdminLimit = 20
+	maxAdminLimit     = 100
+
+	userNotFound     = "user not found"
+	invalidQueryInt  = "\"%s\" must be a non-negative integer"
+	cannotManageSelf = "you can not do it to yourself"
+	cannotManageUser = "you can manage only users with a lower role"
+)
+
+// AdminUsersGet searches users by a part of login or email. All users
+// are returned if query is empty.
+func (env *Env) AdminUsersGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var limit, offset, pageErr = parsePage(r)
+	if pageErr != nil {
+		env.logger.LogRequestError(r, pageErr)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(pageErr), env.logger)
+		return
+	}
+
+	var users, dbErr = env.userDAO.SearchUsers(r.URL.Query().Get(queryStr), limit, offset)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+
+	env.setUserPhotos(users...)
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(users), env.logger)
+}
+
+func (env *Env) AdminUserGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var user, code, err = env.getTargetUser(r)
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	user.Password = ""
+	env.setUserPhotos(user)
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(user), env.logger)
+}
+
+// AdminUserRequestsGet returns all meet requests sent or received by the user.
+func (env *Env) AdminUserRequestsGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var user, code, err = env.getTargetUser(r)
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var requests, dbErr = env.meetRequestDAO.GetAllRequests(user.Id)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+
+	env.setRequestPhotos(requests...)
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(requests), env.logger)
+}
+
+// AdminUserPositionsGet returns last positions of the user, newest first.
+func (env *Env) AdminUserPositionsGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var limit, _, pageErr = parsePage(r)
+	if pageErr != nil {
+		env.logger.LogRequestError(r, pageErr)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(pageErr), env.logger)
+		return
+	}
+
+	var user, code, err = env.getTargetUser(r)
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var positions, dbErr = env.positionDAO.GetLastUserPositions(user.Id, limit)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(positions), env.logger)
+}
+
+// AdminUserBanPost bans the user and revokes all sessions of the user,
+// so that the user is signed out as soon as access tokens expire.
+func (env *Env) AdminUserBanPost(w http.ResponseWriter, r *http.Request) {
+	env.setUserBanned(w, r, true)
+}
+
+func (env *Env) AdminUserUnbanPost(w http.ResponseWriter, r *http.Request) {
+	env.setUserBanned(w, r, false)
+}
+
+// AdminUserLogoutPost revokes all sessions of the user.
+func (env *Env) AdminUserLogoutPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var user, code, err = env.getManagedUser(r)
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	if err := env.sessionDAO.RevokeUserSessions(user.Id); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+// AdminUserRolePut changes role of the user. Sessions are revoked, so that
+// tokens carrying the old role can not be refreshed.
+func (env *Env) AdminUserRolePut(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var update, parseCode, parseErr = parseRoleUpdate(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	var user, code, err = env.getManagedUser(r)
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	if _, err := env.userDAO.SetRole(user.Id, update.Role); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	if err := env.sessionDAO.RevokeUserSessions(user.Id); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+func (env *Env) setUserBanned(w http.ResponseWriter, r *http.Request, banned bool) {
+	env.logger.LogRequestStart(r)
+	var user, code, err = env.getManagedUser(r)
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	if _, err := env.userDAO.SetBanned(user.Id, banned); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	if banned {
+		if err := env.sessionDAO.RevokeUserSessions(user.Id); err != nil {
+			env.logger.LogRequestError(r, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+			return
+		}
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+// getManagedUser returns the user from the url if the caller is allowed to change
+// the user, see checkManageable.
+func (env *Env) getManagedUser(r *http.Request) (*model.User, int, error) {
+	var user, code, err = env.getTargetUser(r)
+	if err != nil {
+		return nil, code, err
+	}
+
+	if err := checkManageable(getPrincipal(r), user); err != nil {
+		return nil, http.StatusForbidden, err
+	}
+	return user, http.StatusOK, nil
+}
+
+// checkManageable allows to change only users with a lower role than
+// the caller has; nobody can manage themselves.
+func checkManageable(principal *Principal, user *model.User) error {
+	if user.Id == principal.UserId {
+		return errors.New(cannotManageSelf)
+	}
+	if !model.Outranks(principal.Role(), user.Role) {
+		return errors.New(cannotManageUser)
+	}
+	return nil
+}
+
+func (env *Env) getTargetUser(r *http.Request) (*model.User, int, error) {
+	var userId, idErr = strconv.Atoi(mux.Vars(r)[id])
+	if idErr != nil {
+		return nil, http.StatusNotFound, errors.New(userNotFound)
+	}
+
+	var user, dbErr = env.userDAO.GetUserById(userId)
+	if dbErr == sql.ErrNoRows {
+		return nil, http.StatusNotFound, errors.New(userNotFound)
+	}
+	if dbErr != nil {
+		return nil, http.StatusInternalServerError, dbErr
+	}
+	return user, http.StatusOK, nil
+}
+
+// parsePage reads limit and offset query parameters. Limit is
+// capped with maxAdminLimit and defaults to defaultAdminLimit.
+func parsePage(r *http.Request) (int, int, error) {
+	var limit, limitErr = getQueryInt(r, limitStr, defaultAdminLimit)
+	if limitErr != nil {
+		return 0, 0, limitErr
+	}
+	if limit == 0 {
+		limit = defaultAdminLimit
+	}
+	if limit > maxAdminLimit {
+		limit = maxAdminLimit
+	}
+
+	var offset, offsetErr = getQueryInt(r, offsetStr, 0)
+	if offsetErr != nil {
+		return 0, 0, offsetErr
+	}
+	return limit, offset, nil
+}
+
+func getQueryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	var str = r.URL.Query().Get(name)
+	if str == "" {
+		return defaultValue, nil
+	}
+
+	var value, err = strconv.Atoi(str)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf(invalidQueryInt, name)
+	}
+	return value, nil
+}
+
+func parseRoleUpdate(r *http.Request) (*model.RoleUpdate, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var update = new(model.RoleUpdate)
+	if err := json.Unmarshal(body, &update); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return update, http.StatusOK, nil
+}
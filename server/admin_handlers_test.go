@@ -0,0 +1,318 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/server/mocks"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnv_AdminUsersGet_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT id, login, age").
+		WithArgs("%log\\_in%", 10, 5).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(2, "log_in", 30, model.MALE, "about", "", model.RoleUser, false, nil, ""),
+		)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/users?query=log_in&limit=10&offset=5",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleModerator),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.True(t, strings.Contains(rec.Body.String(), "log_in"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_AdminUsersGet_Forbidden(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/users",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleUser),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestEnv_AdminUsersGet_BadLimit(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/users?limit=-1",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleModerator),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestEnv_AdminUserGet_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockUser(mock, 2, model.RoleUser, false)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/users/2",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleModerator),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.False(t, strings.Contains(rec.Body.String(), "password"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_AdminUserGet_NotFound(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT id, login, password").
+		WithArgs(2).
+		WillReturnError(sql.ErrNoRows)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/users/2",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleModerator),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_AdminUserPositionsGet_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockUser(mock, 2, model.RoleUser, false)
+	mock.
+		ExpectQuery("SELECT id, userId.*ORDER BY LEAST\\(clientTime, time\\) DESC").
+		WithArgs(2, 3).
+		WillReturnRows(
+			sqlmock.NewRows(positionColumns).
+				AddRow(1, 2, 20.0, 10.0, nil, nil, nil, nil, time.Now()),
+		)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/users/2/positions?limit=3",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleModerator),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_AdminUserBanPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockUser(mock, 2, model.RoleUser, false)
+	mock.
+		ExpectExec("UPDATE Users SET banned").
+		WithArgs(true, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/users/2/ban",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleModerator),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_AdminUserBanPost_NotOutranked(t *testing.T) {
+	var testData = []struct {
+		targetId   int
+		targetRole string
+	}{
+		{2, model.RoleModerator},
+		{2, model.RoleAdmin},
+		{1, model.RoleUser}, // the caller
+	}
+
+	for i, item := range testData {
+		var db, mock, dbErr = sqlmock.New()
+		if dbErr != nil {
+			t.Fatal(dbErr)
+		}
+
+		mockUser(mock, item.targetId, item.targetRole, false)
+
+		var env = getEnv(db)
+		var rec, recErr = getRecorder(
+			fmt.Sprintf("/api/v1/admin/users/%d/ban", item.targetId),
+			http.MethodPost,
+			GetRouter(env).ServeHTTP,
+			strings.NewReader(""),
+			getRoleHeader(env, model.RoleModerator),
+		)
+
+		assert.Nil(t, recErr, i)
+		assert.Equal(t, http.StatusForbidden, rec.Code, i)
+		assert.Nil(t, mock.ExpectationsWereMet(), i)
+		db.Close()
+	}
+}
+
+func TestEnv_AdminUserRolePut_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockUser(mock, 2, model.RoleUser, false)
+	mock.
+		ExpectExec("UPDATE Users SET role").
+		WithArgs(model.RoleModerator, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/users/2/role",
+		http.MethodPut,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"role\": \"moderator\"}"),
+		getRoleHeader(env, model.RoleAdmin),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_AdminUserRolePut_Moderator(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/users/2/role",
+		http.MethodPut,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"role\": \"moderator\"}"),
+		getRoleHeader(env, model.RoleModerator),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestEnv_AdminUserRolePut_InvalidRole(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/users/2/role",
+		http.MethodPut,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"role\": \"superuser\"}"),
+		getRoleHeader(env, model.RoleAdmin),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// getRoleHeader returns authorization header of user 1 having the role.
+func getRoleHeader(env *Env, role string) headerPair {
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId, model.RolesOf(role)...)
+	return headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)}
+}
+
+func mockUser(mock sqlmock.Sqlmock, id int, role string, banned bool) {
+	mock.
+		ExpectQuery("SELECT id, login, password").
+		WithArgs(id).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(id, "login", "hash", 30, model.MALE, "about", "", role, banned, nil, ""),
+		)
+}
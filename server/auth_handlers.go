@@ -1,20 +1,38 @@
 package server
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/Sovianum/acquaintance-server/common"
 	"github.com/Sovianum/acquaintance-server/model"
 	"github.com/dgrijalva/jwt-go"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
-	idStr    = "id"
-	loginStr = "login"
-	expStr   = "exp"
+	idStr        = "id"
+	loginStr     = "login"
+	expStr       = "exp"
+	sessionIdStr = "sid"
+
+	secretLen  = 32
+	jwksMaxAge = 300
+
+	sessionNotFound       = "session not found"
+	sessionRevoked        = "session has been revoked or expired"
+	malformedRefreshToken = "malformed refresh token"
+	userBanned            = "user is banned"
+	userSuspended         = "user is suspended until %s"
 )
 
 func (env *Env) UserRegisterPost(w http.ResponseWriter, r *http.Request) {
@@ -42,7 +60,24 @@ func (env *Env) UserRegisterPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var hash, err = env.hashFunc([]byte(user.Password))
+	if user.Email != "" {
+		var emailTaken, emailErr = env.userDAO.ExistsByEmail(user.Email)
+		if emailErr != nil {
+			env.logger.LogRequestError(r, emailErr)
+			w.WriteHeader(http.StatusInternalServerError)
+			common.WriteWithLogging(r, w, common.GetErrorJson(emailErr), env.logger)
+			return
+		}
+		if emailTaken {
+			var err = errors.New("email is already in use")
+			env.logger.LogRequestError(r, err)
+			w.WriteHeader(http.StatusConflict)
+			common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+			return
+		}
+	}
+
+	var hash, err = env.hasher.Hash([]byte(user.Password))
 	if err != nil {
 		env.logger.LogRequestError(r, err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -50,6 +85,8 @@ func (env *Env) UserRegisterPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	user.Password = string(hash)
+	user.Role = model.RoleUser
+	user.Banned = false
 
 	var userId, saveErr = env.userDAO.Save(user)
 	if saveErr != nil {
@@ -59,7 +96,7 @@ func (env *Env) UserRegisterPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var tokenString, tokenErr = env.generateTokenString(userId, user.Login)
+	var tokens, tokenErr = env.startSession(userId, user.Login, user.Role)
 	if tokenErr != nil {
 		env.logger.LogRequestError(r, tokenErr)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -69,7 +106,7 @@ func (env *Env) UserRegisterPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	env.logger.LogRequestSuccess(r)
-	common.WriteWithLogging(r, w, common.GetDataJson(tokenString), env.logger)
+	common.WriteWithLogging(r, w, common.GetDataJson(tokens), env.logger)
 }
 
 func (env *Env) UserSignInPost(w http.ResponseWriter, r *http.Request) {
@@ -82,6 +119,11 @@ func (env *Env) UserSignInPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var ip = env.getClientIP(r)
+	if env.rejectThrottled(w, r, user.Login, ip) {
+		return
+	}
+
 	var exists, existsErr = env.userDAO.ExistsByLogin(user.Login)
 	if existsErr != nil {
 		env.logger.LogRequestError(r, existsErr)
@@ -92,6 +134,7 @@ func (env *Env) UserSignInPost(w http.ResponseWriter, r *http.Request) {
 	if !exists {
 		var err = errors.New("not found")
 		env.logger.LogRequestError(r, err)
+		env.registerLoginFailure(w, user.Login, ip, model.LoginFailureUnknownLogin)
 		w.WriteHeader(http.StatusNotFound)
 		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
 		return
@@ -105,35 +148,61 @@ func (env *Env) UserSignInPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := env.hashValidator([]byte(user.Password), []byte(dbUser.Password)); err != nil {
+	if err := env.hasher.Validate([]byte(user.Password), []byte(dbUser.Password)); err != nil {
 		env.logger.LogRequestError(r, err)
+		env.registerLoginFailure(w, user.Login, ip, model.LoginFailureWrongPassword)
 		w.WriteHeader(http.StatusNotFound)
 		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
 		return
 	}
+	if err := checkUserAccess(dbUser, time.Now()); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusForbidden)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	env.rehashPassword(dbUser, user.Password)
 
-	var tokenString, tokenErr = env.generateTokenString(dbUser.Id, dbUser.Login)
+	var mfaRequired, mfaErr = env.isTwoFactorEnabled(dbUser.Id)
+	if mfaErr != nil {
+		env.logger.LogRequestError(r, mfaErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(mfaErr), env.logger)
+		return
+	}
+	if mfaRequired {
+		// failure counters are reset only after the second step
+		var mfaToken, tokenErr = env.generateMFAToken(dbUser.Id, dbUser.Login)
+		if tokenErr != nil {
+			env.logger.LogRequestError(r, tokenErr)
+			w.WriteHeader(http.StatusInternalServerError)
+			common.WriteWithLogging(r, w, common.GetErrorJson(tokenErr), env.logger)
+			return
+		}
+
+		env.logger.LogRequestSuccess(r)
+		common.WriteWithLogging(
+			r, w, common.GetDataJson(model.MFAChallenge{MFARequired: true, MFAToken: mfaToken}), env.logger,
+		)
+		return
+	}
+	env.resetLoginFailures(user.Login)
+
+	var tokens, tokenErr = env.startSession(dbUser.Id, dbUser.Login, dbUser.Role)
 	if tokenErr != nil {
 		env.logger.LogRequestError(r, tokenErr)
 		w.WriteHeader(http.StatusInternalServerError)
 		common.WriteWithLogging(r, w, common.GetErrorJson(tokenErr), env.logger)
-		// TODO add info that user has been successfully saved
 		return
 	}
 
 	env.logger.LogRequestSuccess(r)
-	common.WriteWithLogging(r, w, common.GetDataJson(tokenString), env.logger)
+	common.WriteWithLogging(r, w, common.GetDataJson(tokens), env.logger)
 }
 
 func (env *Env) UserGetSelfInfo(w http.ResponseWriter, r *http.Request) {
 	env.logger.LogRequestStart(r)
-	var userId, idCode, idErr = env.getIdFromRequest(r)
-	if idErr != nil {
-		env.logger.LogRequestError(r, idErr)
-		w.WriteHeader(idCode)
-		common.WriteWithLogging(r, w, common.GetErrorJson(idErr), env.logger)
-		return
-	}
+	var userId = getPrincipal(r).UserId
 
 	var exists, existsErr = env.userDAO.ExistsById(userId)
 	if existsErr != nil {
@@ -158,20 +227,341 @@ func (env *Env) UserGetSelfInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	env.setUserPhotos(dbUser)
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(dbUser), env.logger)
+}
+
+func (env *Env) UserUpdateSelfPatch(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var userId = getPrincipal(r).UserId
+
+	var patch, parseCode, parseErr = parseUserPatch(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	var dbUser, dbErr = env.userDAO.GetUserById(userId)
+	if dbErr == sql.ErrNoRows {
+		var err = errors.New("not found")
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+
+	if err := patch.Apply(dbUser); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var updated, updateErr = env.userDAO.Update(dbUser)
+	if updateErr != nil {
+		env.logger.LogRequestError(r, updateErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(updateErr), env.logger)
+		return
+	}
+	if !updated {
+		var err = errors.New("not found")
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	dbUser.Password = ""
+	env.setUserPhotos(dbUser)
 	env.logger.LogRequestSuccess(r)
 	common.WriteWithLogging(r, w, common.GetDataJson(dbUser), env.logger)
 }
 
-func (env *Env) generateTokenString(id int, login string) (string, error) {
-	var token = jwt.New(jwt.SigningMethodHS256)
-	var claims = token.Claims.(jwt.MapClaims)
+// rehashPassword upgrades the stored hash of a user who has just signed in
+// if it was produced by an outdated algorithm or with outdated parameters.
+// Failures are only logged because the user is already authenticated.
+func (env *Env) rehashPassword(dbUser *model.User, password string) {
+	if !env.hasher.NeedsRehash([]byte(dbUser.Password)) {
+		return
+	}
+
+	var hash, hashErr = env.hasher.Hash([]byte(password))
+	if hashErr != nil {
+		env.logger.Errorf("failed to rehash password of user %d: %s", dbUser.Id, hashErr.Error())
+		return
+	}
+	if err := env.userDAO.UpdatePassword(dbUser.Id, string(hash)); err != nil {
+		env.logger.Errorf("failed to save rehashed password of user %d: %s", dbUser.Id, err.Error())
+		return
+	}
+	env.logger.Infof("password hash of user %d upgraded", dbUser.Id)
+}
+
+func (env *Env) UserRefreshPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var refreshRequest, parseCode, parseErr = parseRefreshRequest(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	var tokens, code, err = env.rotateSession(refreshRequest.RefreshToken)
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(tokens), env.logger)
+}
+
+func (env *Env) UserLogoutPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	if err := env.sessionDAO.RevokeSession(getPrincipal(r).SessionId); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+func (env *Env) UserLogoutAllPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var userId = getPrincipal(r).UserId
+
+	if err := env.sessionDAO.RevokeUserSessions(userId); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+// startSession creates a new session for the user and issues
+// a short-lived access token together with a refresh token bound to it.
+func (env *Env) startSession(userId int, login string, role string) (*model.TokenPair, error) {
+	var secret, secretErr = generateSecret()
+	if secretErr != nil {
+		return nil, secretErr
+	}
+
+	var expires = time.Now().Add(env.conf.Auth.GetSessionLifetime())
+	var sessionId, sessionErr = env.sessionDAO.CreateSession(userId, hashSecret(secret), expires)
+	if sessionErr != nil {
+		return nil, sessionErr
+	}
+
+	var accessToken, tokenErr = env.generateTokenString(userId, login, sessionId, model.RolesOf(role)...)
+	if tokenErr != nil {
+		return nil, tokenErr
+	}
+
+	return &model.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: formatRefreshToken(sessionId, secret),
+	}, nil
+}
+
+// rotateSession exchanges a refresh token for a new token pair. Each refresh token
+// can be used only once: presenting an already rotated token means it has leaked,
+// so the whole session gets revoked.
+func (env *Env) rotateSession(refreshToken string) (*model.TokenPair, int, error) {
+	var sessionId, secret, parseErr = parseRefreshToken(refreshToken)
+	if parseErr != nil {
+		return nil, http.StatusBadRequest, parseErr
+	}
+
+	var session, sessionErr = env.sessionDAO.GetSessionById(sessionId)
+	if sessionErr == sql.ErrNoRows {
+		return nil, http.StatusUnauthorized, errors.New(sessionNotFound)
+	}
+	if sessionErr != nil {
+		return nil, http.StatusInternalServerError, sessionErr
+	}
+	if !session.IsActive(time.Now()) {
+		return nil, http.StatusUnauthorized, errors.New(sessionRevoked)
+	}
+
+	var oldHash = hashSecret(secret)
+	if subtle.ConstantTimeCompare(oldHash, session.RefreshHash) != 1 {
+		env.logger.Errorf("refresh token reuse detected for session %d, revoking it", session.Id)
+		if err := env.sessionDAO.RevokeSession(session.Id); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return nil, http.StatusUnauthorized, errors.New(sessionRevoked)
+	}
+
+	var user, userErr = env.userDAO.GetUserById(session.UserId)
+	if userErr != nil {
+		return nil, http.StatusInternalServerError, userErr
+	}
+	if accessErr := checkUserAccess(user, time.Now()); accessErr != nil {
+		if err := env.sessionDAO.RevokeSession(session.Id); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return nil, http.StatusForbidden, accessErr
+	}
+
+	var newSecret, secretErr = generateSecret()
+	if secretErr != nil {
+		return nil, http.StatusInternalServerError, secretErr
+	}
+
+	var expires = time.Now().Add(env.conf.Auth.GetSessionLifetime())
+	var rotated, rotateErr = env.sessionDAO.RotateSession(session.Id, oldHash, hashSecret(newSecret), expires)
+	if rotateErr != nil {
+		return nil, http.StatusInternalServerError, rotateErr
+	}
+	if !rotated {
+		// concurrent refresh with the same token has already won
+		return nil, http.StatusUnauthorized, errors.New(sessionRevoked)
+	}
+
+	var accessToken, tokenErr = env.generateTokenString(user.Id, user.Login, session.Id, model.RolesOf(user.Role)...)
+	if tokenErr != nil {
+		return nil, http.StatusInternalServerError, tokenErr
+	}
+
+	return &model.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: formatRefreshToken(session.Id, newSecret),
+	}, http.StatusOK, nil
+}
+
+func (env *Env) JWKSGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var msg, err = json.Marshal(env.keySet.JWKS())
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", jwksMaxAge))
+	common.WriteWithLogging(r, w, msg, env.logger)
+}
+
+// checkUserAccess rejects banned users and users whose suspension is not over yet.
+func checkUserAccess(user *model.User, now time.Time) error {
+	if user.Banned {
+		return errors.New(userBanned)
+	}
+	if user.IsSuspended(now) {
+		return fmt.Errorf(userSuspended, user.SuspendedUntil.String())
+	}
+	return nil
+}
+
+// generateTokenString issues an access token. Roles are put into the token
+// as is, so a role change takes effect after the next refresh.
+func (env *Env) generateTokenString(id int, login string, sessionId int, roles ...string) (string, error) {
+	if roles == nil {
+		roles = []string{}
+	}
+	return env.keySet.Sign(jwt.MapClaims{
+		idStr:        id,
+		loginStr:     login,
+		sessionIdStr: sessionId,
+		rolesStr:     roles,
+		expStr:       time.Now().Add(env.conf.Auth.GetAccessTokenLifetime()).Unix(),
+	})
+}
+
+// Refresh token has form "<session id>.<secret>"; only sha256 of the secret is stored.
+func formatRefreshToken(sessionId int, secret []byte) string {
+	return fmt.Sprintf("%d.%s", sessionId, base64.RawURLEncoding.EncodeToString(secret))
+}
+
+func parseRefreshToken(refreshToken string) (int, []byte, error) {
+	var parts = strings.SplitN(refreshToken, ".", 2)
+	if len(parts) != 2 {
+		return 0, nil, errors.New(malformedRefreshToken)
+	}
+
+	var sessionId, idErr = strconv.Atoi(parts[0])
+	if idErr != nil {
+		return 0, nil, errors.New(malformedRefreshToken)
+	}
+
+	var secret, secretErr = base64.RawURLEncoding.DecodeString(parts[1])
+	if secretErr != nil || len(secret) != secretLen {
+		return 0, nil, errors.New(malformedRefreshToken)
+	}
+	return sessionId, secret, nil
+}
+
+// generateSecret backs refresh and password reset tokens; only sha256
+// of a secret is stored, so a database leak does not expose the tokens.
+func generateSecret() ([]byte, error) {
+	var secret = make([]byte, secretLen)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func hashSecret(secret []byte) []byte {
+	var hash = sha256.Sum256(secret)
+	return hash[:]
+}
+
+func parseRefreshRequest(r *http.Request) (*model.RefreshRequest, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var request = new(model.RefreshRequest)
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return request, http.StatusOK, nil
+}
+
+func parseUserPatch(r *http.Request) (*model.UserPatch, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
 
-	claims[idStr] = id
-	claims[loginStr] = login
-	claims[expStr] = time.Now().Add(time.Hour * 24 * time.Duration(env.conf.Auth.ExpireDays)).Unix()
+	var patch = new(model.UserPatch)
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
 
-	var tokenKey = env.conf.Auth.GetTokenKey()
-	return token.SignedString(tokenKey)
+	return patch, http.StatusOK, nil
 }
 
 func parseUser(r *http.Request) (*model.User, int, error) {
@@ -188,6 +578,9 @@ func parseUser(r *http.Request) (*model.User, int, error) {
 	if err := json.Unmarshal(body, &user); err != nil {
 		return nil, http.StatusBadRequest, err
 	}
+	if err := user.Validate(); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
 
 	if user.Login == "" || user.Password == "" {
 		return nil, http.StatusBadRequest, errors.New("Empty user")
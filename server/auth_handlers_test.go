@@ -8,16 +8,27 @@ import (
 	"fmt"
 	"github.com/Sovianum/acquaintance-server/config"
 	"github.com/Sovianum/acquaintance-server/dao"
+	"github.com/Sovianum/acquaintance-server/hashing"
+	"github.com/Sovianum/acquaintance-server/mail"
 	"github.com/Sovianum/acquaintance-server/model"
 	"github.com/Sovianum/acquaintance-server/mylog"
+	"github.com/Sovianum/acquaintance-server/server/mocks"
+	"github.com/Sovianum/acquaintance-server/signing"
+	"github.com/Sovianum/acquaintance-server/storage"
+	"github.com/Sovianum/acquaintance-server/throttle"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/patrickmn/go-cache"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -48,7 +59,6 @@ func TestEnv_UserRegisterPost_Success(t *testing.T) {
 	}
 
 	var env = getEnv(db)
-	var hash, _ = env.hashFunc([]byte(user.Password))
 
 	// mock exists
 	mock.
@@ -56,10 +66,10 @@ func TestEnv_UserRegisterPost_Success(t *testing.T) {
 		WithArgs(user.Login).
 		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(0))
 
-	// mock user insertion
+	// mock user insertion; hash is salted so it can not be predicted
 	mock.
 		ExpectExec("INSERT INTO Users").
-		WithArgs(user.Login, string(hash), user.Age, user.Sex, user.About).
+		WithArgs(user.Login, sqlmock.AnyArg(), user.Age, user.Sex, user.About, user.Email).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	// mock id selection
@@ -180,6 +190,40 @@ func TestEnv_UserRegisterPost_Conflict(t *testing.T) {
 	assert.Equal(t, http.StatusConflict, rec.Code)
 }
 
+func TestEnv_UserRegisterPost_EmailConflict(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	// mock login check
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs("login").
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(0))
+
+	// mock email check
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs("login@mail.ru").
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserRegisterPost,
+		strings.NewReader("{\"login\": \"login\", \"password\": \"pass\", \"email\": \"login@mail.ru\"}"),
+		headerPair{"Content-Type", "application/json"},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
 func TestEnv_UserRegisterPost_SaveErr(t *testing.T) {
 	var db, mock, dbErr = sqlmock.New()
 
@@ -198,8 +242,6 @@ func TestEnv_UserRegisterPost_SaveErr(t *testing.T) {
 
 	var env = getEnv(db)
 
-	var hash, _ = env.hashFunc([]byte(user.Password))
-
 	// mock exists
 	mock.
 		ExpectQuery("SELECT count").
@@ -209,7 +251,7 @@ func TestEnv_UserRegisterPost_SaveErr(t *testing.T) {
 	// mock user insertion
 	mock.
 		ExpectExec("INSERT INTO Users").
-		WithArgs(user.Login, hash, user.Age, user.Sex, user.About).
+		WithArgs(user.Login, sqlmock.AnyArg(), user.Age, user.Sex, user.About, user.Email).
 		WillReturnError(errors.New("db fail"))
 
 	// mock id selection
@@ -251,8 +293,6 @@ func TestEnv_UserRegisterPost_IdExtraction(t *testing.T) {
 
 	var env = getEnv(db)
 
-	var hash, _ = env.hashFunc([]byte(user.Password))
-
 	// mock exists
 	mock.
 		ExpectQuery("SELECT count").
@@ -262,7 +302,7 @@ func TestEnv_UserRegisterPost_IdExtraction(t *testing.T) {
 	// mock user insertion
 	mock.
 		ExpectExec("INSERT INTO Users").
-		WithArgs(user.Login, hash, user.Age, user.Sex, user.About).
+		WithArgs(user.Login, sqlmock.AnyArg(), user.Age, user.Sex, user.About, user.Email).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	// mock id selection
@@ -342,6 +382,35 @@ func TestEnv_UserRegisterPost_NoPassword(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
 
+func TestEnv_UserRegisterPost_InvalidAge(t *testing.T) {
+	var user = &model.User{
+		Login:    "login",
+		Password: "password",
+		Sex:      model.MALE,
+		Age:      200,
+	}
+
+	var env = &Env{
+		conf:   getAuthConf(),
+		logger: mylog.NewLogger(ioutil.Discard),
+	}
+
+	var requestMsg, jsonErr = json.Marshal(user)
+	assert.Nil(t, jsonErr)
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserRegisterPost,
+		strings.NewReader(string(requestMsg)),
+		headerPair{"Content-Type", "application/json"},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "must be either 0")
+}
+
 func TestEnv_UserSignInPost_Success(t *testing.T) {
 	var db, mock, dbErr = sqlmock.New()
 
@@ -367,16 +436,223 @@ func TestEnv_UserSignInPost_Success(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
 
 	// mock user extraction
-	var hash, _ = env.hashFunc([]byte(user.Password))
+	var hash, _ = env.hasher.Hash([]byte(user.Password))
+	mock.
+		ExpectQuery("SELECT id").
+		WithArgs(user.Login).
+		WillReturnRows(
+			sqlmock.NewRows(
+				[]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", hash, 100, model.MALE, "about", "", model.RoleUser, false, nil, ""),
+		)
+
+	// mock two-factor check
+	mock.
+		ExpectQuery("SELECT userId, secret").
+		WithArgs(1).
+		WillReturnError(sql.ErrNoRows)
+
+	var requestMsg, jsonErr = json.Marshal(user)
+	assert.Nil(t, jsonErr)
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserSignInPost,
+		strings.NewReader(string(requestMsg)),
+		headerPair{"Content-Type", "application/json"},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestEnv_UserSignInPost_Banned(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+
+	// mock exists
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs("login").
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+
+	// mock user extraction
+	var hash, _ = env.hasher.Hash([]byte("password"))
+	mock.
+		ExpectQuery("SELECT id").
+		WithArgs("login").
+		WillReturnRows(
+			sqlmock.NewRows(
+				[]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", hash, 100, model.MALE, "about", "", model.RoleUser, true, nil, ""),
+		)
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserSignInPost,
+		strings.NewReader("{\"login\": \"login\", \"password\": \"password\"}"),
+		headerPair{"Content-Type", "application/json"},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), userBanned))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserSignInPost_Suspended(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+
+	// mock exists
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs("login").
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+
+	// mock user extraction
+	var hash, _ = env.hasher.Hash([]byte("password"))
+	mock.
+		ExpectQuery("SELECT id").
+		WithArgs("login").
+		WillReturnRows(
+			sqlmock.NewRows(
+				[]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", hash, 100, model.MALE, "about", "", model.RoleUser, false, time.Now().Add(time.Hour), ""),
+		)
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserSignInPost,
+		strings.NewReader("{\"login\": \"login\", \"password\": \"password\"}"),
+		headerPair{"Content-Type", "application/json"},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), "user is suspended until"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserSignInPost_LegacyHashUpgrade(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var user = &model.User{
+		Login:    "login",
+		Password: "password",
+	}
+
+	var env = getEnv(db)
+
+	// mock exists
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(user.Login).
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+
+	// mock user extraction with legacy unsalted hash
+	var legacyHash = sha256.Sum256([]byte(user.Password))
+	mock.
+		ExpectQuery("SELECT id").
+		WithArgs(user.Login).
+		WillReturnRows(
+			sqlmock.NewRows(
+				[]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", legacyHash[:], 100, model.MALE, "about", "", model.RoleUser, false, nil, ""),
+		)
+
+	// mock password upgrade
+	mock.
+		ExpectExec("UPDATE Users SET password").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// mock two-factor check
+	mock.
+		ExpectQuery("SELECT userId, secret").
+		WithArgs(1).
+		WillReturnError(sql.ErrNoRows)
+
+	var requestMsg, jsonErr = json.Marshal(user)
+	assert.Nil(t, jsonErr)
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserSignInPost,
+		strings.NewReader(string(requestMsg)),
+		headerPair{"Content-Type", "application/json"},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserSignInPost_UpgradeFailIgnored(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var user = &model.User{
+		Login:    "login",
+		Password: "password",
+	}
+
+	var env = getEnv(db)
+
+	// mock exists
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(user.Login).
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+
+	// mock user extraction with legacy unsalted hash
+	var legacyHash = sha256.Sum256([]byte(user.Password))
 	mock.
 		ExpectQuery("SELECT id").
 		WithArgs(user.Login).
 		WillReturnRows(
 			sqlmock.NewRows(
-				[]string{"id", "login", "password", "age", "sex", "about"}).
-				AddRow(1, "login", hash, 100, model.MALE, "about"),
+				[]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", legacyHash[:], 100, model.MALE, "about", "", model.RoleUser, false, nil, ""),
 		)
 
+	// mock password upgrade
+	mock.
+		ExpectExec("UPDATE Users SET password").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnError(errors.New("db fail"))
+
+	// mock two-factor check
+	mock.
+		ExpectQuery("SELECT userId, secret").
+		WithArgs(1).
+		WillReturnError(sql.ErrNoRows)
+
 	var requestMsg, jsonErr = json.Marshal(user)
 	assert.Nil(t, jsonErr)
 
@@ -420,10 +696,16 @@ func TestEnv_UserSignInPost_WrongPassword(t *testing.T) {
 		WithArgs(user.Login).
 		WillReturnRows(
 			sqlmock.NewRows(
-				[]string{"id", "login", "password", "age", "sex", "about"}).
-				AddRow(1, "login", "pass", 100, model.MALE, "about"),
+				[]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", "pass", 100, model.MALE, "about", "", model.RoleUser, false, nil, ""),
 		)
 
+	// mock audit of the failed attempt
+	mock.
+		ExpectExec("INSERT INTO LoginFailure").
+		WithArgs(user.Login, sqlmock.AnyArg(), model.LoginFailureWrongPassword).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
 	var env = getEnv(db)
 
 	var requestMsg, jsonErr = json.Marshal(user)
@@ -439,6 +721,80 @@ func TestEnv_UserSignInPost_WrongPassword(t *testing.T) {
 
 	assert.Nil(t, recErr)
 	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserSignInPost_Throttled(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	env.conf.Auth.Throttle.TrustForwardedFor = true
+	env.conf.Auth.Throttle.TrustedProxies = 2
+	var policy = env.conf.Auth.Throttle.GetLoginPolicy()
+	for i := 0; i != policy.LockoutAttempts; i++ {
+		env.throttler.Fail(env.throttler.LoginKey("login"))
+	}
+
+	// mock audit of the rejected attempt
+	mock.
+		ExpectExec("INSERT INTO LoginFailure").
+		WithArgs("login", "10.0.0.1", model.LoginFailureThrottled).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserSignInPost,
+		strings.NewReader("{\"login\": \"login\", \"password\": \"password\"}"),
+		headerPair{forwardedForStr, "10.0.0.1, 192.168.0.1"},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	var retryAfter, retryErr = strconv.Atoi(rec.Header().Get(retryAfterStr))
+	assert.Nil(t, retryErr)
+	assert.True(t, retryAfter > 0 && retryAfter <= int(env.conf.Auth.Throttle.GetLockoutPeriod().Seconds()))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserSignInPost_FailuresSlowDown(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var policy = env.conf.Auth.Throttle.GetLoginPolicy()
+
+	for i := 0; i <= policy.FreeAttempts; i++ {
+		mock.
+			ExpectQuery("SELECT count").
+			WithArgs("login").
+			WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(0))
+		mock.
+			ExpectExec("INSERT INTO LoginFailure").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		var rec, recErr = getRecorder(
+			urlSample,
+			http.MethodPost,
+			env.UserSignInPost,
+			strings.NewReader("{\"login\": \"login\", \"password\": \"password\"}"),
+		)
+
+		assert.Nil(t, recErr, i)
+		assert.Equal(t, http.StatusNotFound, rec.Code, i)
+		assert.Equal(t, i == policy.FreeAttempts, rec.Header().Get(retryAfterStr) != "", i)
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
 }
 
 func TestEnv_UserSignInPost_ParseError(t *testing.T) {
@@ -520,6 +876,12 @@ func TestEnv_UserSignInPost_NotFound(t *testing.T) {
 		WithArgs(user.Login).
 		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(0))
 
+	// mock audit of the failed attempt
+	mock.
+		ExpectExec("INSERT INTO LoginFailure").
+		WithArgs(user.Login, sqlmock.AnyArg(), model.LoginFailureUnknownLogin).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
 	var env = getEnv(db)
 
 	var requestMsg, jsonErr = json.Marshal(user)
@@ -535,6 +897,7 @@ func TestEnv_UserSignInPost_NotFound(t *testing.T) {
 
 	assert.Nil(t, recErr)
 	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
 }
 
 func TestEnv_UserSignInPost_IdExtractionFail(t *testing.T) {
@@ -582,6 +945,388 @@ func TestEnv_UserSignInPost_IdExtractionFail(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, rec.Code)
 }
 
+func TestEnv_UserRefreshPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var secret = make([]byte, secretLen)
+	var expires = time.Now().Add(time.Hour)
+
+	// mock session selection
+	mock.
+		ExpectQuery("SELECT id, userId, refreshHash").
+		WithArgs(mocks.SessionId).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "userId", "refreshHash", "expires", "revoked"}).
+				AddRow(mocks.SessionId, 1, hashSecret(secret), expires, false),
+		)
+
+	// mock user selection
+	mock.
+		ExpectQuery("SELECT id, login, password").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", "", 100, model.MALE, "about", "", model.RoleUser, false, nil, ""),
+		)
+
+	// mock rotation
+	mock.
+		ExpectExec("UPDATE Session SET refreshHash").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), mocks.SessionId, hashSecret(secret)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+	env.sessionDAO = dao.NewDBSessionDAO(db)
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserRefreshPost,
+		strings.NewReader(fmt.Sprintf("{\"refresh_token\": \"%s\"}", formatRefreshToken(mocks.SessionId, secret))),
+		headerPair{"Content-Type", "application/json"},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserRefreshPost_Reuse(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var secret = make([]byte, secretLen)
+	var expires = time.Now().Add(time.Hour)
+
+	// session already holds hash of another (rotated) secret
+	mock.
+		ExpectQuery("SELECT id, userId, refreshHash").
+		WithArgs(mocks.SessionId).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "userId", "refreshHash", "expires", "revoked"}).
+				AddRow(mocks.SessionId, 1, []byte("another hash"), expires, false),
+		)
+
+	// mock revocation
+	mock.
+		ExpectExec("UPDATE Session SET revoked = TRUE WHERE id").
+		WithArgs(mocks.SessionId).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+	env.sessionDAO = dao.NewDBSessionDAO(db)
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserRefreshPost,
+		strings.NewReader(fmt.Sprintf("{\"refresh_token\": \"%s\"}", formatRefreshToken(mocks.SessionId, secret))),
+		headerPair{"Content-Type", "application/json"},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserRefreshPost_NotFound(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT id, userId, refreshHash").
+		WithArgs(mocks.SessionId).
+		WillReturnError(sql.ErrNoRows)
+
+	var env = getEnv(db)
+	env.sessionDAO = dao.NewDBSessionDAO(db)
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserRefreshPost,
+		strings.NewReader(fmt.Sprintf(
+			"{\"refresh_token\": \"%s\"}", formatRefreshToken(mocks.SessionId, make([]byte, secretLen)),
+		)),
+		headerPair{"Content-Type", "application/json"},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+}
+
+func TestEnv_UserRefreshPost_Malformed(t *testing.T) {
+	var env = getEnv(nil)
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserRefreshPost,
+		strings.NewReader("{\"refresh_token\": \"token\"}"),
+		headerPair{"Content-Type", "application/json"},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+}
+
+func TestEnv_UserLogoutPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	// mock session check
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(mocks.SessionId).
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+
+	// mock revocation
+	mock.
+		ExpectExec("UPDATE Session SET revoked = TRUE WHERE id").
+		WithArgs(mocks.SessionId).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+	env.sessionDAO = dao.NewDBSessionDAO(db)
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.UserLogoutPost),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserLogoutAllPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	// mock session check
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(mocks.SessionId).
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+
+	// mock revocation
+	mock.
+		ExpectExec("UPDATE Session SET revoked = TRUE WHERE userId").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	var env = getEnv(db)
+	env.sessionDAO = dao.NewDBSessionDAO(db)
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.UserLogoutAllPost),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserLogoutPost_RevokedSession(t *testing.T) {
+	var env = getEnv(nil)
+	env.sessionDAO = &mocks.SessionDAOMockRevoked{}
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.UserLogoutPost),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+}
+
+func TestEnv_UserLogoutPost_ExpiredToken(t *testing.T) {
+	var env = getEnv(nil)
+
+	var token = jwt.New(jwt.SigningMethodHS256)
+	var claims = token.Claims.(jwt.MapClaims)
+	claims[idStr] = 1
+	claims[sessionIdStr] = mocks.SessionId
+	claims[expStr] = time.Now().Add(-time.Minute).Unix()
+	var tokenStr, _ = token.SignedString(env.conf.Auth.GetTokenKey())
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.UserLogoutPost),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+}
+
+func TestEnv_UserUpdateSelfPatch_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	// mock user selection
+	mock.
+		ExpectQuery("SELECT id, login, password").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", "hash", 30, model.MALE, "about", "", model.RoleUser, false, nil, ""),
+		)
+
+	// mock update; age is left intact, about is reset
+	mock.
+		ExpectExec("UPDATE Users SET age").
+		WithArgs(30, model.FEMALE, "", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPatch,
+		env.withAuth(env.UserUpdateSelfPatch),
+		strings.NewReader("{\"sex\": \"F\", \"about\": null}"),
+		headerPair{"Content-Type", "application/merge-patch+json"},
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.False(t, strings.Contains(rec.Body.String(), "hash"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserUpdateSelfPatch_Invalid(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	// mock user selection
+	mock.
+		ExpectQuery("SELECT id, login, password").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", "hash", 30, model.MALE, "about", "", model.RoleUser, false, nil, ""),
+		)
+
+	var env = getEnv(db)
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPatch,
+		env.withAuth(env.UserUpdateSelfPatch),
+		strings.NewReader("{\"age\": 500}"),
+		headerPair{"Content-Type", "application/merge-patch+json"},
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserUpdateSelfPatch_ReadOnlyField(t *testing.T) {
+	var env = getEnv(nil)
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPatch,
+		env.withAuth(env.UserUpdateSelfPatch),
+		strings.NewReader("{\"login\": \"other\"}"),
+		headerPair{"Content-Type", "application/merge-patch+json"},
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+}
+
+func TestEnv_UserUpdateSelfPatch_NotFound(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT id, login, password").
+		WithArgs(1).
+		WillReturnError(sql.ErrNoRows)
+
+	var env = getEnv(db)
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPatch,
+		env.withAuth(env.UserUpdateSelfPatch),
+		strings.NewReader("{\"age\": 30}"),
+		headerPair{"Content-Type", "application/merge-patch+json"},
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+}
+
+func TestEnv_JWKSGet_Empty(t *testing.T) {
+	var env = getEnv(nil)
+
+	var rec, recErr = getRecorder(urlSample, http.MethodGet, env.JWKSGet, strings.NewReader(""))
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "{\"keys\":[]}", rec.Body.String())
+}
+
 func getAuthConf() config.Conf {
 	return config.Conf{
 		Auth: config.AuthConfig{
@@ -621,23 +1366,41 @@ func getRecorder(
 
 func getEnv(db *sql.DB) *Env {
 	return &Env{
-		userDAO: dao.NewDBUserDAO(db),
-		conf:    getAuthConf(),
-		hashFunc: func(password []byte) ([]byte, error) {
-			var h = sha256.New()
-			h.Write(password)
-			return h.Sum(nil), nil
-		},
-		hashValidator: func(password []byte, hash []byte) error {
-			var h = sha256.New()
-			h.Write(password)
-			var passHash = h.Sum(nil)
-
-			if string(passHash) != string(hash) {
-				return fmt.Errorf("hashes %s, %s do not match", string(passHash), string(hash))
-			}
-			return nil
-		},
-		logger: mylog.NewLogger(ioutil.Discard),
+		userDAO:          dao.NewDBUserDAO(db),
+		positionDAO:      dao.NewDBPositionDAO(db),
+		meetRequestDAO:   dao.NewMeetDAO(db),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		passwordResetDAO: dao.NewDBPasswordResetDAO(db),
+		loginAuditDAO:    dao.NewDBLoginAuditDAO(db),
+		twoFactorDAO:     dao.NewDBTwoFactorDAO(db),
+		blockDAO:         dao.NewDBBlockDAO(db),
+		reportDAO:        dao.NewDBReportDAO(db),
+		interestDAO:      dao.NewDBInterestDAO(db),
+		eventDAO:         dao.NewDBEventDAO(db),
+		deviceDAO:        dao.NewDBDeviceDAO(db),
+		webhookDAO:       dao.NewDBWebhookDAO(db),
+		privacyDAO:       dao.NewDBPrivacyDAO(db),
+		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		keySet:           getKeySet(),
+		conf:             getAuthConf(),
+		hasher:           getHasher(),
+		throttler:        getThrottler(),
+		mailer:           mail.NewMemoryMailer(),
+		storage:          storage.NewMemoryStorage("/media"),
+		logger:           mylog.NewLogger(ioutil.Discard),
 	}
 }
+
+func getThrottler() *throttle.Throttler {
+	var conf = config.ThrottleConfig{}
+	return throttle.NewThrottler(conf, throttle.NewMemoryStore(conf.GetLockoutPeriod()))
+}
+
+func getKeySet() signing.KeySet {
+	return signing.NewHMACKeySet([]byte(tokenKey))
+}
+
+func getHasher() hashing.Hasher {
+	var hasher, _ = hashing.NewHasher(config.PasswordHashConfig{Algorithm: hashing.Bcrypt, BcryptCost: bcrypt.MinCost})
+	return hasher
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/dgrijalva/jwt-go"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	wwwAuthenticateStr = "WWW-Authenticate"
+	bearerStr          = "Bearer"
+	authRealm          = "acquaintance"
+	rolesStr           = "roles"
+	accessTokenStr     = "access_token"
+
+	// error codes of RFC 6750
+	invalidRequest    = "invalid_request"
+	invalidToken      = "invalid_token"
+	insufficientScope = "insufficient_scope"
+
+	accessTokenExpired   = "Your token has expired"
+	accessSessionRevoked = "Your session has been revoked or expired"
+)
+
+type principalKeyType struct{}
+
+var principalKey = principalKeyType{}
+
+// Principal describes the authenticated caller. withAuth puts it
+// into the request context, handlers get it with getPrincipal.
+type Principal struct {
+	UserId    int
+	Login     string
+	SessionId int
+	Roles     []string
+	Expires   time.Time
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Role returns the most privileged role of the caller.
+func (p *Principal) Role() string {
+	var result = ""
+	for _, r := range p.Roles {
+		if result == "" || model.Outranks(r, result) {
+			result = r
+		}
+	}
+	return result
+}
+
+// withAuth calls handler only for requests with a valid access token bound to
+// an active session. Unauthenticated requests are rejected with 401 and callers
+// lacking any of roles with 403; both carry a WWW-Authenticate header.
+func (env *Env) withAuth(handler http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var principal, code, err = env.authenticate(r)
+		if err == nil {
+			for _, role := range roles {
+				if !principal.HasRole(role) {
+					code, err = http.StatusForbidden, fmt.Errorf("role \"%s\" required", role)
+					break
+				}
+			}
+		}
+
+		if err != nil {
+			env.logger.LogRequestStart(r)
+			env.logger.LogRequestError(r, err)
+			if challenge := getAuthChallenge(r, code, err); challenge != "" {
+				w.Header().Set(wwwAuthenticateStr, challenge)
+			}
+			w.WriteHeader(code)
+			common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+			return
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), principalKey, principal)))
+	}
+}
+
+// withQueryToken lets clients that cannot set headers, like browser
+// WebSocket and EventSource APIs, pass the access token in "access_token"
+// query parameter as RFC 6750 allows. The header wins if both are set.
+func withQueryToken(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var token = r.URL.Query().Get(accessTokenStr)
+		if _, ok := r.Header[authorizationStr]; !ok && token != "" {
+			r.Header.Set(authorizationStr, fmt.Sprintf("%s %s", bearerStr, token))
+		}
+		handler(w, r)
+	}
+}
+
+// getPrincipal returns the caller of a handler wrapped with withAuth.
+func getPrincipal(r *http.Request) *Principal {
+	var principal, _ = r.Context().Value(principalKey).(*Principal)
+	return principal
+}
+
+func (env *Env) authenticate(r *http.Request) (*Principal, int, error) {
+	var authHeaderList, ok = r.Header[authorizationStr]
+	if !ok {
+		return nil, http.StatusUnauthorized, errors.New("Header \"Authorization\" not set in request")
+	}
+	if len(authHeaderList) != 1 {
+		return nil, http.StatusBadRequest, fmt.Errorf("You set too many (%d) \"Authorization\" headers", len(authHeaderList))
+	}
+
+	var fields = strings.Fields(authHeaderList[0]) // getting last word to remove Bearer word from header
+	if len(fields) == 0 {
+		return nil, http.StatusUnauthorized, errors.New("Header \"Authorization\" is empty")
+	}
+	var tokenString = fields[len(fields)-1]
+
+	var token, tokenErr = env.parseTokenString(tokenString)
+	if tokenErr != nil {
+		if validationErr, ok := tokenErr.(*jwt.ValidationError); ok && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, http.StatusUnauthorized, errors.New(accessTokenExpired)
+		}
+		return nil, http.StatusUnauthorized, errors.New("You sent unparseable token")
+	}
+
+	var claims = token.Claims.(jwt.MapClaims)
+	if _, ok := claims[mfaPendingStr]; ok {
+		return nil, http.StatusUnauthorized, errors.New("You sent mfa token, finish sign in to get an access token")
+	}
+
+	var userId, idErr = env.getIdFromTokenString(token)
+	if idErr != nil {
+		return nil, http.StatusUnauthorized, errors.New("Your token does not contain your id")
+	}
+
+	var sessionId, sessionIdErr = getIntClaim(token, sessionIdStr)
+	if sessionIdErr != nil {
+		return nil, http.StatusUnauthorized, errors.New("Your token is not bound to a session, sign in again")
+	}
+
+	var active, activeErr = env.sessionDAO.IsActive(sessionId)
+	if activeErr != nil {
+		return nil, http.StatusInternalServerError, activeErr
+	}
+	if !active {
+		return nil, http.StatusUnauthorized, errors.New(accessSessionRevoked)
+	}
+
+	var login, _ = claims[loginStr].(string)
+	var exp, _ = claims[expStr].(float64)
+	return &Principal{
+		UserId:    userId,
+		Login:     login,
+		SessionId: sessionId,
+		Roles:     getStringsClaim(claims, rolesStr),
+		Expires:   time.Unix(int64(exp), 0),
+	}, http.StatusOK, nil
+}
+
+// checkPrincipal tells whether the caller of a long-lived connection may keep
+// it open. Sign out, password change, role change, ban and suspension all
+// revoke sessions of the user, so checking the session covers them.
+func (env *Env) checkPrincipal(principal *Principal, now time.Time) error {
+	if !now.Before(principal.Expires) {
+		return errors.New(accessTokenExpired)
+	}
+	var active, err = env.sessionDAO.IsActive(principal.SessionId)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return errors.New(accessSessionRevoked)
+	}
+	return nil
+}
+
+// getAuthChallenge builds WWW-Authenticate header value as described in RFC 6750.
+// Requests without credentials get a bare challenge without an error code.
+func getAuthChallenge(r *http.Request, code int, err error) string {
+	var errorCode string
+	switch code {
+	case http.StatusBadRequest:
+		errorCode = invalidRequest
+	case http.StatusUnauthorized:
+		if _, ok := r.Header[authorizationStr]; ok {
+			errorCode = invalidToken
+		}
+	case http.StatusForbidden:
+		errorCode = insufficientScope
+	default:
+		return ""
+	}
+
+	if errorCode == "" {
+		return fmt.Sprintf("%s realm=\"%s\"", bearerStr, authRealm)
+	}
+	return fmt.Sprintf(
+		"%s realm=\"%s\", error=\"%s\", error_description=\"%s\"",
+		bearerStr, authRealm, errorCode, strings.Replace(err.Error(), "\"", "'", -1),
+	)
+}
+
+func getStringsClaim(claims jwt.MapClaims, name string) []string {
+	var data, _ = claims[name].([]interface{})
+	var result = make([]string, 0, len(data))
+	for _, item := range data {
+		if str, ok := item.(string); ok {
+			result = append(result, str)
+		}
+	}
+	return result
+}
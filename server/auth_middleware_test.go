@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/mylog"
+	"github.com/Sovianum/acquaintance-server/server/mocks"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnv_withAuth_Success(t *testing.T) {
+	var env = getMiddlewareEnv()
+	var principal *Principal
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodGet,
+		env.withAuth(func(w http.ResponseWriter, r *http.Request) {
+			principal = getPrincipal(r)
+		}),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, principal.Expires.After(time.Now()))
+	principal.Expires = time.Time{}
+	assert.Equal(t, &Principal{UserId: 1, Login: "login", SessionId: mocks.SessionId, Roles: []string{}}, principal)
+}
+
+func TestEnv_withAuth_NoHeader(t *testing.T) {
+	var env = getMiddlewareEnv()
+
+	var rec, recErr = getRecorder(urlSample, http.MethodGet, env.withAuth(failHandler(t)), strings.NewReader(""))
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer realm=\"acquaintance\"", rec.Header().Get(wwwAuthenticateStr))
+}
+
+func TestEnv_withAuth_BadToken(t *testing.T) {
+	var env = getMiddlewareEnv()
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodGet,
+		env.withAuth(failHandler(t)),
+		strings.NewReader(""),
+		headerPair{authorizationStr, "Bearer some_token"},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.True(t, strings.Contains(rec.Header().Get(wwwAuthenticateStr), "error=\"invalid_token\""))
+}
+
+func TestEnv_withAuth_RevokedSession(t *testing.T) {
+	var env = getMiddlewareEnv()
+	env.sessionDAO = &mocks.SessionDAOMockRevoked{}
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodGet,
+		env.withAuth(failHandler(t)),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestEnv_withAuth_Roles(t *testing.T) {
+	var env = getMiddlewareEnv()
+	var tokenStr, _ = env.keySet.Sign(jwt.MapClaims{
+		idStr:        1,
+		sessionIdStr: mocks.SessionId,
+		rolesStr:     []string{"moderator"},
+		expStr:       time.Now().Add(time.Minute).Unix(),
+	})
+
+	var testData = []struct {
+		role     string
+		expected int
+	}{
+		{"moderator", http.StatusOK},
+		{"admin", http.StatusForbidden},
+	}
+
+	for i, item := range testData {
+		var rec, recErr = getRecorder(
+			urlSample,
+			http.MethodGet,
+			env.withAuth(func(w http.ResponseWriter, r *http.Request) {}, item.role),
+			strings.NewReader(""),
+			headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+		)
+
+		assert.Nil(t, recErr, i)
+		assert.Equal(t, item.expected, rec.Code, i)
+	}
+}
+
+func getMiddlewareEnv() *Env {
+	return &Env{
+		sessionDAO: &mocks.SessionDAOMockActive{},
+		keySet:     getKeySet(),
+		conf:       getAuthConf(),
+		logger:     mylog.NewLogger(ioutil.Discard),
+	}
+}
+
+func failHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler must not be called")
+	}
+}
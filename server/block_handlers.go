@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+const (
+	cannotBlockSelf = "you can not block yourself"
+	userNotBlocked  = "user is not blocked"
+	blockedByUser   = "user has blocked you"
+)
+
+// UserBlockPost adds the user to the caller's block list. Blocked users do not
+// see each other among neighbours and can not send requests to each other;
+// pending requests between them are declined.
+func (env *Env) UserBlockPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var userId = getPrincipal(r).UserId
+
+	var blockedId, code, err = env.getBlockTarget(r)
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	if blockedId == userId {
+		var err = errors.New(cannotBlockSelf)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var declined, blockErr = env.blockDAO.Block(userId, blockedId)
+	if blockErr != nil {
+		env.logger.LogRequestError(r, blockErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(blockErr), env.logger)
+		return
+	}
+	for _, requestId := range declined {
+		env.dropRequestEvents(requestId)
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+func (env *Env) UserUnblockDelete(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var userId = getPrincipal(r).UserId
+
+	var blockedId, idErr = strconv.Atoi(mux.Vars(r)[id])
+	if idErr != nil {
+		env.logger.LogRequestError(r, idErr)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(errors.New(userNotFound)), env.logger)
+		return
+	}
+
+	var found, dbErr = env.blockDAO.Unblock(userId, blockedId)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+	if !found {
+		var err = errors.New(userNotBlocked)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+// UserBlockListGet returns users blocked by the caller, the last blocked first.
+func (env *Env) UserBlockListGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var users, dbErr = env.blockDAO.GetBlockedUsers(getPrincipal(r).UserId)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(users), env.logger)
+}
+
+func (env *Env) getBlockTarget(r *http.Request) (int, int, error) {
+	var blockedId, idErr = strconv.Atoi(mux.Vars(r)[id])
+	if idErr != nil {
+		return 0, http.StatusNotFound, errors.New(userNotFound)
+	}
+
+	var exists, dbErr = env.userDAO.ExistsById(blockedId)
+	if dbErr != nil {
+		return 0, http.StatusInternalServerError, dbErr
+	}
+	if !exists {
+		return 0, http.StatusNotFound, errors.New(userNotFound)
+	}
+	return blockedId, http.StatusOK, nil
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/server/mocks"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEnv_UserBlockPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.
+		ExpectExec("INSERT INTO UserBlock").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectQuery("UPDATE MeetRequest SET status = 'DECLINED'").
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectCommit()
+	// undelivered events of the declined request are dropped
+	mock.
+		ExpectExec("DELETE FROM Event").
+		WithArgs(10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+
+	var rec, recErr = getRecorder(
+		"/api/v1/user/block/2",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserBlockPost_Self(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/block/1",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserBlockPost_UnknownUser(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(0))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/block/2",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserUnblockDelete_NotBlocked(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("DELETE FROM UserBlock").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/block/2",
+		http.MethodDelete,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserGetPositionById_Blocked(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/position/neighbour/2",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), blockedByUser))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func getBlockHeader(env *Env) headerPair {
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	return headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)}
+}
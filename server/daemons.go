@@ -1,18 +1,16 @@
 package server
 
 import (
-	"errors"
-	"strconv"
-	"strings"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/webhook"
 	"time"
 )
 
-const (
-	minToSec = 60
-)
-
 func (env *Env) RunDaemons() {
 	go env.runDaemons()
+
+	var deliverer = webhook.NewDeliverer(env.conf.Webhook, env.webhookDAO, env.logger)
+	go deliverer.Run(env.conf.Webhook.GetPollInterval(), nil)
 }
 
 func (env *Env) runDaemons() {
@@ -26,32 +24,40 @@ func (env *Env) runDaemons() {
 			} else {
 				env.logger.Infof("decline all succeeded")
 			}
+			if err := env.sessionDAO.DeleteStaleSessions(); err != nil {
+				env.logger.Errorf("failed to delete stale sessions with error: %s", err.Error())
+			}
+			if err := env.passwordResetDAO.DeleteStaleResets(); err != nil {
+				env.logger.Errorf("failed to delete stale password resets with error: %s", err.Error())
+			}
+			if err := env.throttler.DeleteStale(); err != nil {
+				env.logger.Errorf("failed to delete stale sign in counters with error: %s", err.Error())
+			}
+			var retentionDays = env.conf.Auth.Throttle.GetAuditRetentionDays()
+			if err := env.loginAuditDAO.DeleteOldFailures(retentionDays); err != nil {
+				env.logger.Errorf("failed to delete old failed sign in audit with error: %s", err.Error())
+			}
+			if err := env.eventDAO.DeleteOldEvents(env.conf.Logic.GetEventRetentionDays()); err != nil {
+				env.logger.Errorf("failed to delete old request events with error: %s", err.Error())
+			}
+			if err := env.webhookDAO.DeleteOldDeliveries(env.conf.Webhook.GetRetentionDays()); err != nil {
+				env.logger.Errorf("failed to delete old webhook deliveries with error: %s", err.Error())
+			}
 		}
 	}
 }
 
+// declineAll declines expired requests and wakes up requesters, whose
+// decline events are saved by the same query.
 func (env *Env) declineAll(timeoutMin int) error {
-	if err := env.meetRequestDAO.DeclineAll(timeoutMin); err != nil {
+	var requests, err = env.meetRequestDAO.DeclineAll(timeoutMin)
+	if err != nil {
 		return err
 	}
 
-	var msgList = make([]string, 0)
-	for userIdStr, item := range env.meetRequestCache.Items() {
-		var userId, _ = strconv.Atoi(userIdStr)
-		var box = item.Object.(MailBox)
-		for _, meetRequest := range box.GetAll(minToSec * timeoutMin) {
-			var requestAge = time.Now().Sub((time.Time)(meetRequest.Time))
-
-			if requestAge.Minutes() > float64(timeoutMin) {
-				if _, err := env.handleRequestDecline(meetRequest.RequestedId, userId); err != nil {
-					msgList = append(msgList, err.Error())
-				}
-			}
-		}
-	}
-
-	if len(msgList) != 0 {
-		return errors.New(strings.Join(msgList, ","))
+	for _, request := range requests {
+		env.wake(request.RequesterId)
+		env.emitWebhook(model.WebhookRequestExpired, request)
 	}
 	return nil
 }
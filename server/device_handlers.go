@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+)
+
+const (
+	tokenStr = "token"
+
+	deviceNotFound = "device not found"
+)
+
+// UserDevicePost registers a push notification token of the caller's device.
+// Registering the same token again is fine, e.g. on every start of the app.
+func (env *Env) UserDevicePost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var device, parseCode, parseErr = parseDevice(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	if err := env.deviceDAO.AddDevice(getPrincipal(r).UserId, device); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(device), env.logger)
+}
+
+// UserDeviceDelete stops push notifications to the device, e.g. on sign out.
+func (env *Env) UserDeviceDelete(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var removed, dbErr = env.deviceDAO.RemoveDevice(getPrincipal(r).UserId, mux.Vars(r)[tokenStr])
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+	if !removed {
+		var err = errors.New(deviceNotFound)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+func parseDevice(r *http.Request) (*model.Device, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var device = new(model.Device)
+	if err := json.Unmarshal(body, &device); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return device, http.StatusOK, nil
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEnv_UserDevicePost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("INSERT INTO Device").
+		WithArgs(1, model.PlatformFCM, "fcm-token").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/devices",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"token\": \"fcm-token\", \"platform\": \"fcm\"}"),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.True(t, strings.Contains(rec.Body.String(), "\"token\":\"fcm-token\""))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserDevicePost_InvalidPlatform(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/devices",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"token\": \"token\", \"platform\": \"wns\"}"),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), "platform must be either"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserDeviceDelete_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("DELETE FROM Device").
+		WithArgs(1, "apns-token").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/devices/apns-token",
+		http.MethodDelete,
+		GetRouter(env).ServeHTTP,
+		nil,
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserDeviceDelete_NotFound(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("DELETE FROM Device").
+		WithArgs(1, "apns-token").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/devices/apns-token",
+		http.MethodDelete,
+		GetRouter(env).ServeHTTP,
+		nil,
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), deviceNotFound))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -1,57 +1,120 @@
 package server
 
 import (
-	"crypto/sha256"
 	"database/sql"
-	"fmt"
 	"github.com/Sovianum/acquaintance-server/config"
 	"github.com/Sovianum/acquaintance-server/dao"
+	"github.com/Sovianum/acquaintance-server/hashing"
+	"github.com/Sovianum/acquaintance-server/mail"
 	"github.com/Sovianum/acquaintance-server/mylog"
+	"github.com/Sovianum/acquaintance-server/notify"
+	"github.com/Sovianum/acquaintance-server/push"
+	"github.com/Sovianum/acquaintance-server/signing"
+	"github.com/Sovianum/acquaintance-server/storage"
+	"github.com/Sovianum/acquaintance-server/throttle"
 	"github.com/patrickmn/go-cache"
 	"time"
 )
 
 type tokenKeyGetterType func() string
 
-func NewEnv(db *sql.DB, conf config.Conf, logger *mylog.Logger) *Env {
+func NewEnv(db *sql.DB, conf config.Conf, logger *mylog.Logger) (*Env, error) {
+	var hasher, hasherErr = hashing.NewHasher(conf.Auth.PasswordHash)
+	if hasherErr != nil {
+		return nil, hasherErr
+	}
+
+	var keySet, keySetErr = signing.NewKeySet(conf.Auth)
+	if keySetErr != nil {
+		return nil, keySetErr
+	}
+
+	var mailer, mailerErr = mail.NewMailer(conf.Mail)
+	if mailerErr != nil {
+		return nil, mailerErr
+	}
+
+	var photoStorage, storageErr = storage.NewStorage(conf.Storage)
+	if storageErr != nil {
+		return nil, storageErr
+	}
+
+	var throttleStore, storeErr = throttle.NewStore(conf.Auth.Throttle, db)
+	if storeErr != nil {
+		return nil, storeErr
+	}
+
+	var notifier, notifierErr = notify.NewNotifier(conf.Notify, db, conf.DB.GetListenerAuthStr(), logger)
+	if notifierErr != nil {
+		return nil, notifierErr
+	}
+
+	var deviceDAO = dao.NewDBDeviceDAO(db)
+	var pusher, pusherErr = push.NewNotifier(conf.Push, deviceDAO, logger)
+	if pusherErr != nil {
+		return nil, pusherErr
+	}
+
 	var env = &Env{
-		userDAO:        dao.NewDBUserDAO(db),
-		positionDAO:    dao.NewDBPositionDAO(db),
-		meetRequestDAO: dao.NewMeetDAO(db),
-		conf:           conf,
+		userDAO:          dao.NewDBUserDAO(db),
+		positionDAO:      dao.NewDBPositionDAO(db),
+		meetRequestDAO:   dao.NewMeetDAO(db),
+		sessionDAO:       dao.NewDBSessionDAO(db),
+		passwordResetDAO: dao.NewDBPasswordResetDAO(db),
+		loginAuditDAO:    dao.NewDBLoginAuditDAO(db),
+		twoFactorDAO:     dao.NewDBTwoFactorDAO(db),
+		blockDAO:         dao.NewDBBlockDAO(db),
+		reportDAO:        dao.NewDBReportDAO(db),
+		interestDAO:      dao.NewDBInterestDAO(db),
+		eventDAO:         dao.NewDBEventDAO(db),
+		deviceDAO:        deviceDAO,
+		webhookDAO:       dao.NewDBWebhookDAO(db),
+		privacyDAO:       dao.NewDBPrivacyDAO(db),
+		conf:             conf,
 		meetRequestCache: cache.New(
 			time.Second*time.Duration(conf.Logic.RequestExpiration),
 			time.Second*time.Duration(conf.Logic.CleanupInterval),
 		),
-		hashFunc: func(password []byte) ([]byte, error) {
-			var h = sha256.New()
-			h.Write(password)
-			return h.Sum(nil), nil
-		},
-		hashValidator: func(password []byte, hash []byte) error {
-			var h = sha256.New()
-			h.Write(password)
-			var passHash = h.Sum(nil)
-
-			if string(passHash) != string(hash) {
-				return fmt.Errorf("hashes %s, %s do not match", string(passHash), string(hash))
-			}
-			return nil
-		},
-		logger: logger,
+		hasher:    hasher,
+		keySet:    keySet,
+		mailer:    mailer,
+		storage:   photoStorage,
+		throttler: throttle.NewThrottler(conf.Auth.Throttle, throttleStore),
+		notifier:  notifier,
+		pusher:    pusher,
+		logger:    logger,
+	}
+	if err := notifier.Listen(env.wakeLocal); err != nil {
+		return nil, err
 	}
 
 	env.RunDaemons()
-	return env
+	return env, nil
 }
 
 type Env struct {
 	userDAO          dao.UserDAO
 	positionDAO      dao.PositionDAO
 	meetRequestDAO   dao.MeetRequestDAO
+	sessionDAO       dao.SessionDAO
+	passwordResetDAO dao.PasswordResetDAO
+	loginAuditDAO    dao.LoginAuditDAO
+	twoFactorDAO     dao.TwoFactorDAO
+	blockDAO         dao.BlockDAO
+	reportDAO        dao.ReportDAO
+	interestDAO      dao.InterestDAO
+	eventDAO         dao.EventDAO
+	deviceDAO        dao.DeviceDAO
+	webhookDAO       dao.WebhookDAO
+	privacyDAO       dao.PrivacyDAO
 	conf             config.Conf
-	hashFunc         func(password []byte) ([]byte, error)
-	hashValidator    func(password []byte, hash []byte) error
+	hasher           hashing.Hasher
+	keySet           signing.KeySet
+	mailer           mail.Mailer
+	storage          storage.Storage
+	throttler        *throttle.Throttler
+	notifier         notify.Notifier
+	pusher           push.Notifier
 	meetRequestCache *cache.Cache
 	logger           *mylog.Logger
 }
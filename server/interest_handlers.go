@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	interestsStr = "interests"
+	nameStr      = "name"
+
+	interestExists     = "interest already added"
+	interestNotFound   = "interest not found"
+	interestsSeparator = ","
+)
+
+// UserInterestsGet returns interests of the caller in alphabetical order.
+func (env *Env) UserInterestsGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var interests, dbErr = env.interestDAO.GetUserInterests(getPrincipal(r).UserId)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(model.InterestList{Interests: interests}), env.logger)
+}
+
+// UserInterestsPut replaces all interests of the caller.
+func (env *Env) UserInterestsPut(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var list, parseCode, parseErr = parseInterestList(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	if err := env.interestDAO.SetUserInterests(getPrincipal(r).UserId, list.Interests); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(list), env.logger)
+}
+
+// UserInterestPost adds a single interest to the caller's profile.
+func (env *Env) UserInterestPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var userId = getPrincipal(r).UserId
+
+	var interest, parseCode, parseErr = parseInterest(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	var interests, dbErr = env.interestDAO.GetUserInterests(userId)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+	if len(interests) >= model.MaxInterests {
+		var err = errors.New(model.TooManyInterests)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var added, addErr = env.interestDAO.AddUserInterest(userId, interest.Name)
+	if addErr != nil {
+		env.logger.LogRequestError(r, addErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(addErr), env.logger)
+		return
+	}
+	if !added {
+		var err = errors.New(interestExists)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusConflict)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(interest), env.logger)
+}
+
+// UserInterestDelete removes an interest from the caller's profile.
+func (env *Env) UserInterestDelete(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var name, nameErr = model.NormalizeInterest(mux.Vars(r)[nameStr])
+	if nameErr != nil {
+		env.logger.LogRequestError(r, nameErr)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(errors.New(interestNotFound)), env.logger)
+		return
+	}
+
+	var removed, dbErr = env.interestDAO.RemoveUserInterest(getPrincipal(r).UserId, name)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+	if !removed {
+		var err = errors.New(interestNotFound)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+// parseInterestsQuery reads comma separated "interests" query parameter.
+// Empty items are skipped, so that "chess," is the same as "chess".
+func parseInterestsQuery(r *http.Request) ([]string, error) {
+	var names = make([]string, 0)
+	for _, name := range strings.Split(r.URL.Query().Get(interestsStr), interestsSeparator) {
+		if strings.TrimSpace(name) != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return model.NormalizeInterests(names)
+}
+
+func parseInterestList(r *http.Request) (*model.InterestList, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var list = new(model.InterestList)
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return list, http.StatusOK, nil
+}
+
+func parseInterest(r *http.Request) (*model.Interest, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var interest = new(model.Interest)
+	if err := json.Unmarshal(body, &interest); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return interest, http.StatusOK, nil
+}
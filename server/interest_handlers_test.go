@@ -0,0 +1,222 @@
+package server
+
+import (
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnv_UserInterestsPut_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.
+		ExpectExec("DELETE FROM UserInterest").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectQuery("INSERT INTO Interest").
+		WithArgs("board games").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.
+		ExpectExec("INSERT INTO UserInterest").
+		WithArgs(1, 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/interests",
+		http.MethodPut,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"interests\": [\"Board  Games\", \"board games\"]}"),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.True(t, strings.Contains(rec.Body.String(), "[\"board games\"]"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserInterestsPut_TooMany(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var names = make([]string, 0)
+	for i := 0; i <= model.MaxInterests; i++ {
+		names = append(names, "\"interest"+strconv.Itoa(i)+"\"")
+	}
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/interests",
+		http.MethodPut,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"interests\": ["+strings.Join(names, ",")+"]}"),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), model.TooManyInterests))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserInterestPost_Exists(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT i.name FROM UserInterest").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("chess"))
+	mock.ExpectBegin()
+	mock.
+		ExpectQuery("INSERT INTO Interest").
+		WithArgs("chess").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.
+		ExpectExec("INSERT INTO UserInterest").
+		WithArgs(1, 10).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/interests",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"name\": \"Chess\"}"),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserInterestPost_InvalidName(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/interests",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"name\": \"c++\"}"),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), model.InterestInvalidChars))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserInterestDelete_NotFound(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("DELETE FROM UserInterest ui USING Interest").
+		WithArgs(1, "board games").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/interests/Board%20Games",
+		http.MethodDelete,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserGetNeighboursGet_Interests(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT n.id").
+		WithArgs(
+			1, sqlmock.AnyArg(), sqlmock.AnyArg(), "{\"chess\",\"hiking\"}",
+			0, 0, "", nil, nil, nil, defaultNeighbourLimit+1, model.MinFuzzRadius,
+		).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about", "photo", "shared", "distance", "bearing", "time"}).
+				AddRow(2, "login2", 20, model.MALE, "about2", "", "{chess,hiking}", 100.5, 90.0, time.Now()).
+				AddRow(3, "login3", 20, model.MALE, "about3", "", "{hiking}", 100.5, 90.0, time.Now()),
+		)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/position/neighbours?interests=Chess,,hiking",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.True(t, strings.Contains(rec.Body.String(), "\"shared_interests\":[\"chess\",\"hiking\"]"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserGetNeighboursGet_InvalidInterest(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/position/neighbours?interests=c%2B%2B",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"errors"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/throttle"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	retryAfterStr   = "Retry-After"
+	forwardedForStr = "X-Forwarded-For"
+	tooManyAttempts = "too many failed sign in attempts, try again later"
+)
+
+// loginKeys returns throttling counters a sign in attempt is accounted in.
+func (env *Env) loginKeys(login string, ip string) []throttle.Key {
+	return []throttle.Key{env.throttler.LoginKey(login), env.throttler.IPKey(ip)}
+}
+
+// rejectThrottled answers 429 if the client has to wait before the next attempt.
+// It returns false if the request may be processed.
+func (env *Env) rejectThrottled(w http.ResponseWriter, r *http.Request, login string, ip string) bool {
+	var wait, waitErr = env.throttler.Wait(env.loginKeys(login, ip)...)
+	if waitErr != nil {
+		// the check is not worth a failed sign in
+		env.logger.Errorf("failed to check sign in throttling: %s", waitErr.Error())
+		return false
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	env.auditLoginFailure(login, ip, model.LoginFailureThrottled)
+
+	var err = errors.New(tooManyAttempts)
+	env.logger.LogRequestError(r, err)
+	setRetryAfter(w, wait)
+	w.WriteHeader(http.StatusTooManyRequests)
+	common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+	return true
+}
+
+// registerLoginFailure audits a failed attempt and slows down the following ones.
+func (env *Env) registerLoginFailure(w http.ResponseWriter, login string, ip string, reason string) {
+	env.auditLoginFailure(login, ip, reason)
+
+	var wait, failErr = env.throttler.Fail(env.loginKeys(login, ip)...)
+	if failErr != nil {
+		env.logger.Errorf("failed to register failed sign in: %s", failErr.Error())
+		return
+	}
+	if wait > 0 {
+		setRetryAfter(w, wait)
+	}
+}
+
+func (env *Env) resetLoginFailures(login string) {
+	if err := env.throttler.Reset(env.throttler.LoginKey(login)); err != nil {
+		env.logger.Errorf("failed to reset failed sign in counter: %s", err.Error())
+	}
+}
+
+func (env *Env) auditLoginFailure(login string, ip string, reason string) {
+	env.logger.Warningf("failed sign in: login \"%s\", ip %s, reason %s", login, ip, reason)
+	if err := env.loginAuditDAO.SaveFailure(login, ip, reason); err != nil {
+		env.logger.Errorf("failed to audit failed sign in: %s", err.Error())
+	}
+}
+
+// getClientIP returns address of the client. X-Forwarded-For is taken into account
+// only if the server is configured to run behind trusted proxies. The client may
+// send any X-Forwarded-For itself, so only the entries appended by the proxies
+// are trusted: the address of the client is the one the farthest proxy appended.
+func (env *Env) getClientIP(r *http.Request) string {
+	if env.conf.Auth.Throttle.TrustForwardedFor {
+		if forwarded := r.Header.Get(forwardedForStr); forwarded != "" {
+			var entries = strings.Split(forwarded, ",")
+			var index = len(entries) - env.conf.Auth.Throttle.GetTrustedProxies()
+			if index < 0 {
+				index = 0
+			}
+			return strings.TrimSpace(entries[index])
+		}
+	}
+
+	var host, _, err = net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set(retryAfterStr, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnv_GetClientIP(t *testing.T) {
+	var cases = []struct {
+		trust     bool
+		proxies   int
+		forwarded string
+		ip        string
+	}{
+		{false, 0, "10.0.0.1", "192.168.0.10"},
+		{true, 0, "", "192.168.0.10"},
+		{true, 0, "10.0.0.1", "10.0.0.1"},
+		// the leading entry is sent by the client and must not be trusted
+		{true, 0, "6.6.6.6, 10.0.0.1", "10.0.0.1"},
+		{true, 1, "6.6.6.6,10.0.0.1", "10.0.0.1"},
+		{true, 2, "6.6.6.6, 10.0.0.1, 172.16.0.1", "10.0.0.1"},
+		{true, 3, "10.0.0.1, 172.16.0.1", "10.0.0.1"},
+	}
+
+	for _, c := range cases {
+		var env = getEnv(nil)
+		env.conf.Auth.Throttle.TrustForwardedFor = c.trust
+		env.conf.Auth.Throttle.TrustedProxies = c.proxies
+
+		var r = httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+		r.RemoteAddr = "192.168.0.10:54321"
+		if c.forwarded != "" {
+			r.Header.Set(forwardedForStr, c.forwarded)
+		}
+
+		assert.Equal(t, c.ip, env.getClientIP(r), c.forwarded)
+	}
+}
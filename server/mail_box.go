@@ -1,9 +1,8 @@
 package server
 
 import (
-	"github.com/Sovianum/acquaintance-server/model"
+	"errors"
 	"github.com/Sovianum/acquaintance-server/mylog"
-	"github.com/go-errors/errors"
 	"sync"
 	"time"
 )
@@ -13,131 +12,96 @@ const (
 	userHasNotAcceptedRequestYet  = "user has not accepted request yet"
 )
 
-type requestMapType map[int]*model.MeetRequest
-
 func NewMailBox(logger *mylog.Logger) MailBox {
 	return &mailBox{
 		logger:       logger,
 		syncChan:     make(chan int, 1),
 		accepted:     false,
-		requestsLock: sync.RWMutex{},
-		acceptedLock: sync.RWMutex{},
-		requestMap:   make(requestMapType),
+		acceptedLock: sync.Mutex{},
 	}
 }
 
+// MailBox wakes up long polling of its owner when new events are saved for
+// them. Events themselves are kept in the database, so a lost box loses
+// nothing but a wake up. The box also remembers whether a request of the
+// owner has been accepted since the owner last polled, so that only one
+// of the requests can be accepted at a time.
 type MailBox interface {
-	AddAccept(request *model.MeetRequest) error
-	AddDecline(request *model.MeetRequest)
-	AddPending(request *model.MeetRequest)
-	Interrupt(request *model.MeetRequest) error
-	Remove(requestId int)
-	GetAll(seconds int) []*model.MeetRequest
+	// Accept fails if a request has already been accepted since the last poll.
+	Accept() error
+	// Interrupt fails if no request has been accepted since the last poll.
+	Interrupt() error
+	// ResetAccept is called when the owner polls for events.
+	ResetAccept()
+	// Notify wakes up the current or the next Wait.
+	Notify()
+	// Wait blocks until Notify is called or seconds pass and reports
+	// whether it was woken up by Notify.
+	Wait(seconds int) bool
+	// Signal receives a value when Notify is called. Each wake up goes to
+	// only one of concurrent readers of the box.
+	Signal() <-chan int
 }
 
 type mailBox struct {
 	logger       *mylog.Logger
 	syncChan     chan int
 	accepted     bool
-	acceptedLock sync.RWMutex
-	requestMap   requestMapType
-	requestsLock sync.RWMutex
+	acceptedLock sync.Mutex
 }
 
-func (box *mailBox) AddAccept(request *model.MeetRequest) error {
+func (box *mailBox) Accept() error {
 	box.acceptedLock.Lock()
+	defer box.acceptedLock.Unlock()
+
 	if box.accepted {
 		return errors.New(userHasAlreadyAcceptedRequest)
-	} else {
-		box.accepted = true
-	}
-	box.acceptedLock.Unlock()
-
-	box.requestsLock.Lock()
-	var requestCopy = new(model.MeetRequest)
-	requestCopy.Status = model.StatusAccepted
-	*requestCopy = *request
-
-	box.requestMap[request.Id] = requestCopy
-	box.requestsLock.Unlock()
-
-	select {
-	case box.syncChan <- 1:
-		box.logger.Infof("pushed to sync chan of box")
-	default:
-		box.logger.Infof("sync chan of box already full")
 	}
-
+	box.accepted = true
 	return nil
 }
 
-func (box *mailBox) AddDecline(request *model.MeetRequest) {
-	box.addNonAccept(request, model.StatusDeclined)
-}
-
-func (box *mailBox) AddPending(request *model.MeetRequest) {
-	box.addNonAccept(request, model.StatusPending)
-}
-
-func (box *mailBox) Interrupt(request *model.MeetRequest) error {
+func (box *mailBox) Interrupt() error {
 	box.acceptedLock.Lock()
+	defer box.acceptedLock.Unlock()
+
 	if !box.accepted {
 		return errors.New(userHasNotAcceptedRequestYet)
-	} else {
-		box.accepted = false
 	}
-	box.acceptedLock.Unlock()
-
-	box.requestsLock.Lock()
-	var requestCopy = new(model.MeetRequest)
-	*requestCopy = *request
-	requestCopy.Status = model.StatusInterrupted
+	box.accepted = false
+	return nil
+}
 
-	box.requestMap[request.Id] = requestCopy
-	box.requestsLock.Unlock()
+func (box *mailBox) ResetAccept() {
+	box.acceptedLock.Lock()
+	box.accepted = false
+	box.acceptedLock.Unlock()
+}
 
+func (box *mailBox) Notify() {
 	select {
 	case box.syncChan <- 1:
+		box.logger.Infof("pushed to sync chan of box")
 	default:
+		box.logger.Infof("sync chan of box already full")
 	}
-	return nil
 }
 
-func (box *mailBox) Remove(requestId int) {
-	delete(box.requestMap, requestId)
-}
-
-func (box *mailBox) GetAll(seconds int) []*model.MeetRequest {
-	var result = make([]*model.MeetRequest, 0)
-
+func (box *mailBox) Wait(seconds int) bool {
+	// check already signalled box first, otherwise select may prefer zero timeout
 	select {
 	case <-box.syncChan:
-		box.requestsLock.Lock()
-		for _, request := range box.requestMap {
-			result = append(result, request)
+		return true
+	default:
+		select {
+		case <-box.syncChan:
+			return true
+		case <-time.After(time.Second * time.Duration(seconds)):
+			return false
 		}
-		box.requestMap = make(requestMapType)
-		box.requestsLock.Unlock()
-	case <-time.After(time.Second * time.Duration(seconds)):
 	}
-
-	box.acceptedLock.Lock()
-	box.accepted = false
-	box.acceptedLock.Unlock()
-	return result
 }
 
-func (box *mailBox) addNonAccept(request *model.MeetRequest, status string) {
-	box.requestsLock.Lock()
-	var requestCopy = new(model.MeetRequest)
-	*requestCopy = *request
-	requestCopy.Status = status
-
-	box.requestMap[request.Id] = requestCopy
-	box.requestsLock.Unlock()
-
-	select {
-	case box.syncChan <- 1:
-	default:
-	}
+func (box *mailBox) Signal() <-chan int {
+	return box.syncChan
 }
@@ -1,43 +1,42 @@
 package server
 
 import (
-	"github.com/Sovianum/acquaintance-server/model"
 	"github.com/Sovianum/acquaintance-server/mylog"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"testing"
 )
 
-func TestMailBox_AddAccept(t *testing.T) {
+func TestMailBox_Accept(t *testing.T) {
 	var box = NewMailBox(mylog.NewLogger(ioutil.Discard))
-	var request = new(model.MeetRequest)
 
-	var err1 = box.AddAccept(request)
+	var err1 = box.Accept()
 	assert.Nil(t, err1)
 
-	var err2 = box.AddAccept(request)
+	var err2 = box.Accept()
 	assert.NotNil(t, err2)
+
+	box.ResetAccept()
+	var err3 = box.Accept()
+	assert.Nil(t, err3)
 }
 
-func TestMailBox_AddDecline(t *testing.T) {
+func TestMailBox_Interrupt(t *testing.T) {
 	var box = NewMailBox(mylog.NewLogger(ioutil.Discard))
-	var request = new(model.MeetRequest)
 
-	box.AddDecline(request)
+	assert.NotNil(t, box.Interrupt())
 
-	var err2 = box.AddAccept(request)
-	assert.Nil(t, err2)
+	box.Accept()
+	assert.Nil(t, box.Interrupt())
+	assert.Nil(t, box.Accept())
 }
 
-func TestMailBox_GetAll(t *testing.T) {
+func TestMailBox_Wait(t *testing.T) {
 	var box = NewMailBox(mylog.NewLogger(ioutil.Discard))
-	var request = new(model.MeetRequest)
-
-	box.AddDecline(request)
 
-	var requests = box.GetAll(1)
-	assert.Equal(t, 1, len(requests))
+	box.Notify()
+	box.Notify()
 
-	requests = box.GetAll(1)
-	assert.Equal(t, 0, len(requests))
+	assert.True(t, box.Wait(1))
+	assert.False(t, box.Wait(0))
 }
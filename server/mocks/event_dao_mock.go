@@ -0,0 +1,82 @@
+package mocks
+
+import (
+	"github.com/Sovianum/acquaintance-server/model"
+	"sync"
+	"time"
+)
+
+// EventDAOMock keeps events in memory. Requests of the events are built the
+// same way MeetRequestDAOMockSuccess builds them.
+type EventDAOMock struct {
+	lock   sync.Mutex
+	lastId int64
+	events []*eventRecord
+}
+
+type eventRecord struct {
+	userId int
+	event  *model.Event
+}
+
+func NewEventDAOMock() *EventDAOMock {
+	return &EventDAOMock{events: make([]*eventRecord, 0)}
+}
+
+func (dao *EventDAOMock) AddEvent(userId int, requestId int, status string) (int64, error) {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+
+	var request, _ = getPendingRequestByIdSuccess(requestId)
+	request.Status = status
+
+	dao.lastId++
+	dao.events = append(dao.events, &eventRecord{
+		userId: userId,
+		event:  &model.Event{Id: dao.lastId, Time: model.QuotedTime(time.Now()), Request: request},
+	})
+	return dao.lastId, nil
+}
+
+func (dao *EventDAOMock) GetEvents(userId int, since int64, limit int) ([]*model.Event, error) {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+
+	var result = make([]*model.Event, 0)
+	for _, record := range dao.events {
+		if record.userId == userId && record.event.Id > since && len(result) < limit {
+			result = append(result, record.event)
+		}
+	}
+	return result, nil
+}
+
+func (dao *EventDAOMock) Ack(userId int, upTo int64) (int, error) {
+	return dao.remove(func(record *eventRecord) bool {
+		return record.userId == userId && record.event.Id <= upTo
+	}), nil
+}
+
+func (dao *EventDAOMock) DeleteRequestEvents(requestId int) error {
+	dao.remove(func(record *eventRecord) bool {
+		return record.event.Request.Id == requestId
+	})
+	return nil
+}
+
+func (dao *EventDAOMock) DeleteOldEvents(retentionDays int) error { return nil }
+
+func (dao *EventDAOMock) remove(predicate func(*eventRecord) bool) int {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+
+	var kept = make([]*eventRecord, 0, len(dao.events))
+	for _, record := range dao.events {
+		if !predicate(record) {
+			kept = append(kept, record)
+		}
+	}
+	var removed = len(dao.events) - len(kept)
+	dao.events = kept
+	return removed
+}
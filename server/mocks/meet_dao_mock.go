@@ -93,7 +93,9 @@ func (*MeetRequestDAOMockSuccess) GetRequestById(id int) (*model.MeetRequest, er
 	return getPendingRequestByIdSuccess(id)
 }
 
-func (*MeetRequestDAOMockSuccess) DeclineAll(timeoutMin int) error { return nil }
+func (*MeetRequestDAOMockSuccess) DeclineAll(timeoutMin int) ([]*model.MeetRequest, error) {
+	return nil, nil
+}
 
 type MeetRequestDAOMockCreateConflict struct{}
 
@@ -121,7 +123,9 @@ func (*MeetRequestDAOMockCreateConflict) GetRequestById(id int) (*model.MeetRequ
 	return getPendingRequestByIdSuccess(id)
 }
 
-func (*MeetRequestDAOMockCreateConflict) DeclineAll(timeoutMin int) error { return nil }
+func (*MeetRequestDAOMockCreateConflict) DeclineAll(timeoutMin int) ([]*model.MeetRequest, error) {
+	return nil, nil
+}
 
 type MeetRequestDAOMockCreateError struct{}
 
@@ -149,7 +153,9 @@ func (*MeetRequestDAOMockCreateError) GetRequestById(id int) (*model.MeetRequest
 	return getPendingRequestByIdSuccess(id)
 }
 
-func (*MeetRequestDAOMockCreateError) DeclineAll(timeoutMin int) error { return nil }
+func (*MeetRequestDAOMockCreateError) DeclineAll(timeoutMin int) ([]*model.MeetRequest, error) {
+	return nil, nil
+}
 
 type MeetRequestDAOMockGetRequestsEmpty struct{}
 
@@ -177,7 +183,9 @@ func (*MeetRequestDAOMockGetRequestsEmpty) GetRequestById(id int) (*model.MeetRe
 	return getPendingRequestByIdSuccess(id)
 }
 
-func (*MeetRequestDAOMockGetRequestsEmpty) DeclineAll(timeoutMin int) error { return nil }
+func (*MeetRequestDAOMockGetRequestsEmpty) DeclineAll(timeoutMin int) ([]*model.MeetRequest, error) {
+	return nil, nil
+}
 
 type MeetRequestDAOMockGetRequestsError struct{}
 
@@ -205,7 +213,9 @@ func (*MeetRequestDAOMockGetRequestsError) GetRequestById(id int) (*model.MeetRe
 	return getPendingRequestByIdSuccess(id)
 }
 
-func (*MeetRequestDAOMockGetRequestsError) DeclineAll(timeoutMin int) error { return nil }
+func (*MeetRequestDAOMockGetRequestsError) DeclineAll(timeoutMin int) ([]*model.MeetRequest, error) {
+	return nil, nil
+}
 
 type MeetRequestDAOMockUpdateNoRequest struct{}
 
@@ -233,7 +243,9 @@ func (*MeetRequestDAOMockUpdateNoRequest) GetRequestById(id int) (*model.MeetReq
 	return getPendingRequestByIdSuccess(id)
 }
 
-func (*MeetRequestDAOMockUpdateNoRequest) DeclineAll(timeoutMin int) error { return nil }
+func (*MeetRequestDAOMockUpdateNoRequest) DeclineAll(timeoutMin int) ([]*model.MeetRequest, error) {
+	return nil, nil
+}
 
 type MeetRequestDAOMockUpdateError struct{}
 
@@ -261,7 +273,9 @@ func (*MeetRequestDAOMockUpdateError) GetRequestById(id int) (*model.MeetRequest
 	return getPendingRequestByIdSuccess(id)
 }
 
-func (*MeetRequestDAOMockUpdateError) DeclineAll(timeoutMin int) error { return nil }
+func (*MeetRequestDAOMockUpdateError) DeclineAll(timeoutMin int) ([]*model.MeetRequest, error) {
+	return nil, nil
+}
 
 type MeetRequestDAOMockGetRequestByIdNotFound struct{}
 
@@ -289,4 +303,6 @@ func (*MeetRequestDAOMockGetRequestByIdNotFound) GetRequestById(id int) (*model.
 	return getPendingRequestByIdNotFound(id)
 }
 
-func (*MeetRequestDAOMockGetRequestByIdNotFound) DeclineAll(timeoutMin int) error { return nil }
+func (*MeetRequestDAOMockGetRequestByIdNotFound) DeclineAll(timeoutMin int) ([]*model.MeetRequest, error) {
+	return nil, nil
+}
@@ -0,0 +1,58 @@
+package mocks
+
+import (
+	"errors"
+	"github.com/Sovianum/acquaintance-server/notify"
+	"sync"
+)
+
+const (
+	publishErr = "publish error"
+)
+
+// NotifierBus connects notifiers of several fake instances of the app the
+// way a Postgres channel does.
+type NotifierBus struct {
+	lock  sync.RWMutex
+	wakes []notify.WakeFunc
+}
+
+func NewNotifierBus() *NotifierBus {
+	return &NotifierBus{wakes: make([]notify.WakeFunc, 0)}
+}
+
+// Notifier returns a notifier of one more instance connected to the bus.
+func (bus *NotifierBus) Notifier() notify.Notifier {
+	return &busNotifier{bus: bus}
+}
+
+type busNotifier struct {
+	bus *NotifierBus
+}
+
+func (notifier *busNotifier) Publish(userId int) error {
+	notifier.bus.lock.RLock()
+	defer notifier.bus.lock.RUnlock()
+
+	for _, wake := range notifier.bus.wakes {
+		wake(userId)
+	}
+	return nil
+}
+
+func (notifier *busNotifier) Listen(wake notify.WakeFunc) error {
+	notifier.bus.lock.Lock()
+	notifier.bus.wakes = append(notifier.bus.wakes, wake)
+	notifier.bus.lock.Unlock()
+	return nil
+}
+
+func (notifier *busNotifier) Close() error { return nil }
+
+type NotifierMockError struct{}
+
+func (*NotifierMockError) Publish(userId int) error { return errors.New(publishErr) }
+
+func (*NotifierMockError) Listen(wake notify.WakeFunc) error { return nil }
+
+func (*NotifierMockError) Close() error { return nil }
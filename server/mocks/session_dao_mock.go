@@ -0,0 +1,76 @@
+package mocks
+
+import (
+	"github.com/Sovianum/acquaintance-server/model"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SessionId = 5
+)
+
+type SessionDAOMockActive struct{}
+
+func (*SessionDAOMockActive) CreateSession(userId int, refreshHash []byte, expires time.Time) (int, error) {
+	return SessionId, nil
+}
+
+func (*SessionDAOMockActive) GetSessionById(id int) (*model.Session, error) {
+	panic("implement me")
+}
+
+func (*SessionDAOMockActive) RotateSession(id int, oldHash []byte, newHash []byte, expires time.Time) (bool, error) {
+	return true, nil
+}
+
+func (*SessionDAOMockActive) IsActive(id int) (bool, error) { return true, nil }
+
+func (*SessionDAOMockActive) RevokeSession(id int) error { return nil }
+
+func (*SessionDAOMockActive) RevokeUserSessions(userId int) error { return nil }
+
+func (*SessionDAOMockActive) DeleteStaleSessions() error { return nil }
+
+type SessionDAOMockRevoked struct{}
+
+func (*SessionDAOMockRevoked) CreateSession(userId int, refreshHash []byte, expires time.Time) (int, error) {
+	return SessionId, nil
+}
+
+func (*SessionDAOMockRevoked) GetSessionById(id int) (*model.Session, error) {
+	panic("implement me")
+}
+
+func (*SessionDAOMockRevoked) RotateSession(id int, oldHash []byte, newHash []byte, expires time.Time) (bool, error) {
+	return false, nil
+}
+
+func (*SessionDAOMockRevoked) IsActive(id int) (bool, error) { return false, nil }
+
+func (*SessionDAOMockRevoked) RevokeSession(id int) error { return nil }
+
+func (*SessionDAOMockRevoked) RevokeUserSessions(userId int) error { return nil }
+
+func (*SessionDAOMockRevoked) DeleteStaleSessions() error { return nil }
+
+// SessionDAOMockRevocable keeps sessions active until RevokeSession or
+// RevokeUserSessions is called.
+type SessionDAOMockRevocable struct {
+	SessionDAOMockActive
+	revoked int32
+}
+
+func (mock *SessionDAOMockRevocable) IsActive(id int) (bool, error) {
+	return atomic.LoadInt32(&mock.revoked) == 0, nil
+}
+
+func (mock *SessionDAOMockRevocable) RevokeSession(id int) error {
+	atomic.StoreInt32(&mock.revoked, 1)
+	return nil
+}
+
+func (mock *SessionDAOMockRevocable) RevokeUserSessions(userId int) error {
+	atomic.StoreInt32(&mock.revoked, 1)
+	return nil
+}
@@ -0,0 +1,80 @@
+package mocks
+
+import (
+	"github.com/Sovianum/acquaintance-server/model"
+	"sync"
+	"time"
+)
+
+// WebhookDAOMock records queued webhooks in memory and has no subscriptions.
+type WebhookDAOMock struct {
+	lock     sync.Mutex
+	enqueued []*QueuedWebhook
+}
+
+type QueuedWebhook struct {
+	EventType string
+	Payload   []byte
+}
+
+func NewWebhookDAOMock() *WebhookDAOMock {
+	return &WebhookDAOMock{enqueued: make([]*QueuedWebhook, 0)}
+}
+
+// Enqueued returns webhooks in the order they were queued.
+func (dao *WebhookDAOMock) Enqueued() []*QueuedWebhook {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+
+	return append([]*QueuedWebhook(nil), dao.enqueued...)
+}
+
+func (dao *WebhookDAOMock) CreateSubscription(subscription *model.WebhookSubscription) error {
+	panic("implement me")
+}
+
+func (dao *WebhookDAOMock) GetSubscriptions() ([]*model.WebhookSubscription, error) {
+	return make([]*model.WebhookSubscription, 0), nil
+}
+
+func (dao *WebhookDAOMock) DeleteSubscription(id int) (bool, error) {
+	return false, nil
+}
+
+func (dao *WebhookDAOMock) Enqueue(eventType string, payload []byte) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+
+	dao.enqueued = append(dao.enqueued, &QueuedWebhook{EventType: eventType, Payload: payload})
+	return nil
+}
+
+func (dao *WebhookDAOMock) ClaimDeliveries(limit int, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	return make([]*model.WebhookDelivery, 0), nil
+}
+
+func (dao *WebhookDAOMock) MarkDelivered(id int64) error {
+	panic("implement me")
+}
+
+func (dao *WebhookDAOMock) MarkFailed(id int64, errMsg string, retryIn time.Duration) error {
+	panic("implement me")
+}
+
+func (dao *WebhookDAOMock) MarkDead(id int64, errMsg string) error {
+	panic("implement me")
+}
+
+func (dao *WebhookDAOMock) GetDeliveries(status string, limit int, offset int) ([]*model.WebhookDelivery, error) {
+	return make([]*model.WebhookDelivery, 0), nil
+}
+
+func (dao *WebhookDAOMock) GetUserDeliveries(userId int) ([]*model.WebhookDelivery, error) {
+	return make([]*model.WebhookDelivery, 0), nil
+}
+
+func (dao *WebhookDAOMock) Replay(id int64) (bool, error) {
+	return false, nil
+}
+
+func (dao *WebhookDAOMock) DeleteOldDeliveries(retentionDays int) error { return nil }
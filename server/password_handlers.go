@@ -0,0 +1,266 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/mail"
+	"github.com/Sovianum/acquaintance-server/model"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	wrongPassword     = "wrong password"
+	invalidResetToken = "password reset token is invalid or expired"
+
+	resetMailSubject  = "Восстановление пароля"
+	resetMailTemplate = "Здравствуйте, %s!\n\n" +
+		"Чтобы задать новый пароль, введите в приложении код:\n\n%s\n\n" +
+		"Код действителен до %s. Если вы не запрашивали восстановление пароля, просто проигнорируйте это письмо.\n"
+)
+
+// UserPasswordChangePost sets a new password and revokes all sessions
+// of the user; the caller gets a fresh token pair. Wrong old passwords are
+// throttled together with sign in attempts.
+func (env *Env) UserPasswordChangePost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var principal = getPrincipal(r)
+
+	var change, parseCode, parseErr = parsePasswordChange(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	var ip = env.getClientIP(r)
+	if env.rejectThrottled(w, r, principal.Login, ip) {
+		return
+	}
+
+	var dbUser, dbErr = env.userDAO.GetUserById(principal.UserId)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+
+	if err := env.hasher.Validate([]byte(change.OldPassword), []byte(dbUser.Password)); err != nil {
+		env.logger.LogRequestError(r, err)
+		env.registerLoginFailure(w, principal.Login, ip, model.LoginFailureWrongPassword)
+		w.WriteHeader(http.StatusForbidden)
+		common.WriteWithLogging(r, w, common.GetErrorJson(errors.New(wrongPassword)), env.logger)
+		return
+	}
+	env.resetLoginFailures(principal.Login)
+
+	if err := env.setPassword(dbUser.Id, change.NewPassword); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var tokens, tokenErr = env.startSession(dbUser.Id, dbUser.Login, dbUser.Role)
+	if tokenErr != nil {
+		env.logger.LogRequestError(r, tokenErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(tokenErr), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(tokens), env.logger)
+}
+
+// UserPasswordResetPost mails a single-use reset token to the user. It answers
+// with success even if the user is not found or has no email, so that it can
+// not be used to find out which logins and emails are registered.
+func (env *Env) UserPasswordResetPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var request, parseCode, parseErr = parsePasswordResetRequest(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	var dbUser *model.User
+	var dbErr error
+	if request.Email != "" {
+		dbUser, dbErr = env.userDAO.GetUserByEmail(request.Email)
+	} else {
+		dbUser, dbErr = env.userDAO.GetUserByLogin(request.Login)
+	}
+	if dbErr != nil && dbErr != sql.ErrNoRows {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+
+	if dbUser == nil || dbUser.Email == "" {
+		env.logger.Infof("password reset requested for unknown user or user without email")
+		env.logger.LogRequestSuccess(r)
+		common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+		return
+	}
+
+	var secret, secretErr = generateSecret()
+	if secretErr != nil {
+		env.logger.LogRequestError(r, secretErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(secretErr), env.logger)
+		return
+	}
+
+	var expires = time.Now().Add(env.conf.Auth.GetResetTokenLifetime())
+	if err := env.passwordResetDAO.CreateReset(dbUser.Id, hashSecret(secret), expires); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var msg = mail.Message{
+		To:      dbUser.Email,
+		Subject: resetMailSubject,
+		Body: fmt.Sprintf(
+			resetMailTemplate,
+			dbUser.Login,
+			base64.RawURLEncoding.EncodeToString(secret),
+			expires.Format("02.01.2006 15:04 MST"),
+		),
+	}
+	if err := env.mailer.Send(msg); err != nil {
+		// error is not returned to keep the answer the same as for unknown users
+		env.logger.Errorf("failed to send password reset mail to user %d: %s", dbUser.Id, err.Error())
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+// UserPasswordResetConfirmPost sets a new password by a reset token
+// and revokes all sessions of the user.
+func (env *Env) UserPasswordResetConfirmPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var confirm, parseCode, parseErr = parsePasswordResetConfirm(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	var secret, decodeErr = base64.RawURLEncoding.DecodeString(confirm.Token)
+	if decodeErr != nil || len(secret) != secretLen {
+		var err = errors.New(invalidResetToken)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var userId, useErr = env.passwordResetDAO.UseReset(hashSecret(secret))
+	if useErr == sql.ErrNoRows {
+		var err = errors.New(invalidResetToken)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	if useErr != nil {
+		env.logger.LogRequestError(r, useErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(useErr), env.logger)
+		return
+	}
+
+	if err := env.setPassword(userId, confirm.Password); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	if err := env.passwordResetDAO.DeleteUserResets(userId); err != nil {
+		env.logger.Errorf("failed to delete password resets of user %d: %s", userId, err.Error())
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+// setPassword stores hash of the new password and signs the user out everywhere.
+func (env *Env) setPassword(userId int, password string) error {
+	var hash, hashErr = env.hasher.Hash([]byte(password))
+	if hashErr != nil {
+		return hashErr
+	}
+	if err := env.userDAO.UpdatePassword(userId, string(hash)); err != nil {
+		return err
+	}
+	return env.sessionDAO.RevokeUserSessions(userId)
+}
+
+func parsePasswordChange(r *http.Request) (*model.PasswordChange, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var change = new(model.PasswordChange)
+	if err := json.Unmarshal(body, &change); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return change, http.StatusOK, nil
+}
+
+func parsePasswordResetRequest(r *http.Request) (*model.PasswordResetRequest, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var request = new(model.PasswordResetRequest)
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return request, http.StatusOK, nil
+}
+
+func parsePasswordResetConfirm(r *http.Request) (*model.PasswordResetConfirm, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var confirm = new(model.PasswordResetConfirm)
+	if err := json.Unmarshal(body, &confirm); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return confirm, http.StatusOK, nil
+}
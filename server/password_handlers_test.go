@@ -0,0 +1,272 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/mail"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/server/mocks"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEnv_UserPasswordChangePost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var hash, _ = env.hasher.Hash([]byte("old"))
+
+	// mock user selection
+	mock.
+		ExpectQuery("SELECT id, login, password").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", hash, 30, model.MALE, "about", "", model.RoleUser, false, nil, ""),
+		)
+
+	// mock password update
+	mock.
+		ExpectExec("UPDATE Users SET password").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.UserPasswordChangePost),
+		strings.NewReader("{\"old_password\": \"old\", \"new_password\": \"new\"}"),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.True(t, strings.Contains(rec.Body.String(), "refresh_token"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserPasswordChangePost_WrongPassword(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var hash, _ = env.hasher.Hash([]byte("old"))
+
+	// mock user selection
+	mock.
+		ExpectQuery("SELECT id, login, password").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", hash, 30, model.MALE, "about", "", model.RoleUser, false, nil, ""),
+		)
+
+	// mock audit of the failed attempt
+	mock.
+		ExpectExec("INSERT INTO LoginFailure").
+		WithArgs("login", sqlmock.AnyArg(), model.LoginFailureWrongPassword).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.UserPasswordChangePost),
+		strings.NewReader("{\"old_password\": \"wrong\", \"new_password\": \"new\"}"),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserPasswordChangePost_Throttled(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var policy = env.conf.Auth.Throttle.GetLoginPolicy()
+	for i := 0; i != policy.LockoutAttempts; i++ {
+		env.throttler.Fail(env.throttler.LoginKey("login"))
+	}
+
+	// the old password is not checked, so that it can not be guessed during the lockout
+	mock.
+		ExpectExec("INSERT INTO LoginFailure").
+		WithArgs("login", sqlmock.AnyArg(), model.LoginFailureThrottled).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.UserPasswordChangePost),
+		strings.NewReader("{\"old_password\": \"old\", \"new_password\": \"new\"}"),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEqual(t, "", rec.Header().Get(retryAfterStr))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserPasswordResetPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	// mock user selection
+	mock.
+		ExpectQuery("SELECT .* WHERE email").
+		WithArgs("login@mail.ru").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", "hash", 30, model.MALE, "about", "login@mail.ru", model.RoleUser, false, nil, ""),
+		)
+
+	// mock reset creation
+	mock.
+		ExpectExec("INSERT INTO PasswordReset").
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserPasswordResetPost,
+		strings.NewReader("{\"email\": \"login@mail.ru\"}"),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var messages = env.mailer.(*mail.MemoryMailer).Messages()
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, "login@mail.ru", messages[0].To)
+}
+
+func TestEnv_UserPasswordResetPost_UnknownUser(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT .* WHERE login").
+		WithArgs("login").
+		WillReturnError(sql.ErrNoRows)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserPasswordResetPost,
+		strings.NewReader("{\"login\": \"login\"}"),
+	)
+
+	// the answer must not reveal that user does not exist
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Empty(t, env.mailer.(*mail.MemoryMailer).Messages())
+}
+
+func TestEnv_UserPasswordResetConfirmPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var secret = make([]byte, secretLen)
+
+	// mock reset usage
+	mock.
+		ExpectQuery("UPDATE PasswordReset SET used = TRUE").
+		WithArgs(hashSecret(secret)).
+		WillReturnRows(sqlmock.NewRows([]string{"userId"}).AddRow(1))
+
+	// mock password update
+	mock.
+		ExpectExec("UPDATE Users SET password").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// mock other resets deletion
+	mock.
+		ExpectExec("DELETE FROM PasswordReset WHERE userId").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserPasswordResetConfirmPost,
+		strings.NewReader(fmt.Sprintf(
+			"{\"token\": \"%s\", \"password\": \"new\"}", base64.RawURLEncoding.EncodeToString(secret),
+		)),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserPasswordResetConfirmPost_InvalidToken(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("UPDATE PasswordReset SET used = TRUE").
+		WillReturnRows(sqlmock.NewRows([]string{"userId"}))
+
+	var env = getEnv(db)
+	var testData = []string{
+		base64.RawURLEncoding.EncodeToString(make([]byte, secretLen)), // used or expired
+		"short",
+	}
+
+	for i, token := range testData {
+		var rec, recErr = getRecorder(
+			urlSample,
+			http.MethodPost,
+			env.UserPasswordResetConfirmPost,
+			strings.NewReader(fmt.Sprintf("{\"token\": \"%s\", \"password\": \"new\"}", token)),
+		)
+
+		assert.Nil(t, recErr, i)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, i)
+	}
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/photo"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	photoField = "photo"
+	// multipartOverhead is allowed on top of the photo size for boundaries and part headers
+	multipartOverhead = 64 * 1024
+	photoKeyBytes     = 16
+
+	photoRequired = "\"photo\" file required"
+	photoTooLarge = "photo must not be larger than %d KB"
+	photoNotFound = "photo not found"
+)
+
+// UserPhotoPost replaces the caller's photo with the one uploaded as "photo"
+// field of a multipart form. Thumbnails of all sizes are generated and saved
+// to the storage, links to them are returned.
+func (env *Env) UserPhotoPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var userId = getPrincipal(r).UserId
+
+	var data, code, err = readPhoto(w, r, env.conf.Storage.GetMaxPhotoSize())
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var thumbnails, thumbnailsErr = photo.Thumbnails(data)
+	if thumbnailsErr != nil {
+		var code = http.StatusBadRequest
+		if thumbnailsErr == photo.ErrUnsupportedFormat {
+			code = http.StatusUnsupportedMediaType
+		}
+		env.logger.LogRequestError(r, thumbnailsErr)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(thumbnailsErr), env.logger)
+		return
+	}
+
+	var user, userErr = env.userDAO.GetUserById(userId)
+	if userErr == sql.ErrNoRows {
+		var err = errors.New(userNotFound)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	if userErr != nil {
+		env.logger.LogRequestError(r, userErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(userErr), env.logger)
+		return
+	}
+
+	var key, saveErr = env.savePhoto(userId, thumbnails)
+	if saveErr != nil {
+		env.logger.LogRequestError(r, saveErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(saveErr), env.logger)
+		return
+	}
+
+	var updated, dbErr = env.userDAO.SetPhoto(userId, key)
+	if dbErr != nil || !updated {
+		env.deletePhoto(key)
+	}
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+	if !updated {
+		var err = errors.New(userNotFound)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	if user.PhotoKey != "" {
+		env.deletePhoto(user.PhotoKey)
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(env.getPhoto(key)), env.logger)
+}
+
+func (env *Env) UserPhotoDelete(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var userId = getPrincipal(r).UserId
+
+	var user, userErr = env.userDAO.GetUserById(userId)
+	if userErr != nil && userErr != sql.ErrNoRows {
+		env.logger.LogRequestError(r, userErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(userErr), env.logger)
+		return
+	}
+	if userErr == sql.ErrNoRows || user.PhotoKey == "" {
+		var err = errors.New(photoNotFound)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	if _, err := env.userDAO.SetPhoto(userId, ""); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	env.deletePhoto(user.PhotoKey)
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+// savePhoto uploads thumbnails under a new random key, so that clients
+// and caches never see a stale photo under a known link.
+func (env *Env) savePhoto(userId int, thumbnails map[string][]byte) (string, error) {
+	var buf = make([]byte, photoKeyBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	var key = fmt.Sprintf("photos/%d/%s", userId, hex.EncodeToString(buf))
+
+	for _, size := range photo.Sizes {
+		var err = env.storage.Put(photo.Key(key, size.Name), thumbnails[size.Name], photo.ContentType)
+		if err != nil {
+			env.deletePhoto(key)
+			return "", err
+		}
+	}
+	return key, nil
+}
+
+// deletePhoto removes all thumbnails of the photo. Failures are only logged:
+// the photo is not referenced any more, so it merely wastes space.
+func (env *Env) deletePhoto(key string) {
+	for _, size := range photo.Sizes {
+		if err := env.storage.Delete(photo.Key(key, size.Name)); err != nil {
+			env.logger.Errorf("failed to delete photo %s: %s", photo.Key(key, size.Name), err.Error())
+		}
+	}
+}
+
+func (env *Env) getPhoto(key string) *model.Photo {
+	if key == "" {
+		return nil
+	}
+	return &model.Photo{
+		Small:  env.storage.URL(photo.Key(key, photo.Small)),
+		Medium: env.storage.URL(photo.Key(key, photo.Medium)),
+		Large:  env.storage.URL(photo.Key(key, photo.Large)),
+	}
+}
+
+func (env *Env) setUserPhotos(users ...*model.User) {
+	for _, user := range users {
+		user.Photo = env.getPhoto(user.PhotoKey)
+	}
+}
+
+func (env *Env) setRequestPhotos(requests ...*model.MeetRequest) {
+	for _, request := range requests {
+		request.RequesterPhoto = env.getPhoto(request.RequesterPhotoKey)
+		request.RequestedPhoto = env.getPhoto(request.RequestedPhotoKey)
+	}
+}
+
+func readPhoto(w http.ResponseWriter, r *http.Request, maxSize int64) ([]byte, int, error) {
+	var tooLarge = fmt.Errorf(photoTooLarge, maxSize/1024)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
+	if err := r.ParseMultipartForm(maxSize); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, http.StatusRequestEntityTooLarge, tooLarge
+		}
+		return nil, http.StatusBadRequest, err
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var file, _, fileErr = r.FormFile(photoField)
+	if fileErr == http.ErrMissingFile {
+		return nil, http.StatusBadRequest, errors.New(photoRequired)
+	}
+	if fileErr != nil {
+		return nil, http.StatusBadRequest, fileErr
+	}
+	defer file.Close()
+
+	var data, err = ioutil.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, http.StatusRequestEntityTooLarge, tooLarge
+	}
+	return data, http.StatusOK, nil
+}
+
+// mediaHandler serves photos kept in the local storage. Directory
+// listings are not served, so that photos can not be enumerated.
+func mediaHandler(prefix string, dir string) http.Handler {
+	var files = http.StripPrefix(prefix, http.FileServer(http.Dir(dir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
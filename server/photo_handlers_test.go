@@ -0,0 +1,275 @@
+package server
+
+import (
+	"bytes"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/photo"
+	"github.com/Sovianum/acquaintance-server/storage"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnv_UserPhotoPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var photoStorage = env.storage.(*storage.MemoryStorage)
+	for _, size := range photo.Sizes {
+		photoStorage.Put(photo.Key("photos/1/old", size.Name), []byte("old"), photo.ContentType)
+	}
+
+	mockPhotoUser(mock, "photos/1/old")
+	mock.
+		ExpectExec("UPDATE Users SET photo").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var body, contentType = getPhotoForm(t, photoField, getPNG(100, 50))
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/photo",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		body,
+		getBlockHeader(env),
+		headerPair{"Content-Type", contentType},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var keys = photoStorage.Keys()
+	assert.Equal(t, len(photo.Sizes), len(keys))
+	for _, key := range keys {
+		assert.True(t, strings.HasPrefix(key, "photos/1/"))
+		assert.False(t, strings.HasPrefix(key, "photos/1/old"))
+		assert.True(t, strings.Contains(rec.Body.String(), "/media/"+key))
+	}
+}
+
+func TestEnv_UserPhotoPost_Unsupported(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var body, contentType = getPhotoForm(t, photoField, []byte("just some text"))
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/photo",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		body,
+		getBlockHeader(env),
+		headerPair{"Content-Type", contentType},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	assert.Empty(t, env.storage.(*storage.MemoryStorage).Keys())
+}
+
+func TestEnv_UserPhotoPost_TooLarge(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	env.conf.Storage.MaxPhotoKB = 1
+	var body, contentType = getPhotoForm(t, photoField, make([]byte, 2048))
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/photo",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		body,
+		getBlockHeader(env),
+		headerPair{"Content-Type", contentType},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), "1 KB"))
+}
+
+func TestEnv_UserPhotoPost_NoFile(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var body, contentType = getPhotoForm(t, "avatar", getPNG(10, 10))
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/photo",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		body,
+		getBlockHeader(env),
+		headerPair{"Content-Type", contentType},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), "photo"))
+}
+
+func TestEnv_UserPhotoDelete_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var photoStorage = env.storage.(*storage.MemoryStorage)
+	for _, size := range photo.Sizes {
+		photoStorage.Put(photo.Key("photos/1/old", size.Name), []byte("old"), photo.ContentType)
+	}
+
+	mockPhotoUser(mock, "photos/1/old")
+	mock.
+		ExpectExec("UPDATE Users SET photo").
+		WithArgs("", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/photo",
+		http.MethodDelete,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Empty(t, photoStorage.Keys())
+}
+
+func TestEnv_UserPhotoDelete_NoPhoto(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockPhotoUser(mock, "")
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/photo",
+		http.MethodDelete,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserGetNeighboursGet_Photo(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT n.id").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about", "photo", "shared", "distance", "bearing", "time"}).
+				AddRow(2, "login2", 20, model.MALE, "about2", "photos/2/abc", "{}", 100.5, 90.0, time.Now()).
+				AddRow(3, "login3", 20, model.MALE, "about3", "", "{}", 100.5, 90.0, time.Now()),
+		)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/position/neighbours",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.True(t, strings.Contains(rec.Body.String(), "\"small\":\"/media/photos/2/abc_small.jpg\""))
+	assert.Equal(t, 1, strings.Count(rec.Body.String(), "\"photo\""))
+}
+
+func TestGetRouter_LocalMedia(t *testing.T) {
+	var dir, dirErr = ioutil.TempDir("", "media")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "photos", "1"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "photos", "1", "a_small.jpg"), []byte("data"), 0644)
+
+	var env = getEnv(nil)
+	env.conf.Storage = config.StorageConfig{Backend: storage.Local, Dir: dir, BaseURL: "/media"}
+
+	var rec, _ = getRecorder("/media/photos/1/a_small.jpg", http.MethodGet, GetRouter(env).ServeHTTP, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "data", rec.Body.String())
+
+	rec, _ = getRecorder("/media/photos/1/", http.MethodGet, GetRouter(env).ServeHTTP, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func mockPhotoUser(mock sqlmock.Sqlmock, photoKey string) {
+	mock.
+		ExpectQuery("SELECT id, login, password").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", "hash", 30, model.MALE, "about", "", model.RoleUser, false, nil, photoKey),
+		)
+}
+
+func getPhotoForm(t *testing.T, field string, data []byte) (*bytes.Buffer, string) {
+	var body = new(bytes.Buffer)
+	var writer = multipart.NewWriter(body)
+	var part, err = writer.CreateFormFile(field, "photo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	writer.Close()
+	return body, writer.FormDataContentType()
+}
+
+func getPNG(width int, height int) []byte {
+	var buf = new(bytes.Buffer)
+	png.Encode(buf, image.NewRGBA(image.Rect(0, 0, width, height)))
+	return buf.Bytes()
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,47 +10,68 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"io/ioutil"
 	"net/http"
-	"strings"
 	"github.com/gorilla/mux"
 	"strconv"
+	"time"
 )
 
 const (
 	authorizationStr = "Authorization"
 	id = "id"
+
+	minAgeStr = "min_age"
+	maxAgeStr = "max_age"
+	sexStr    = "sex"
+	radiusStr = "radius"
+	cursorStr = "cursor"
+
+	nextCursorHeader = "X-Next-Cursor"
+
+	positionNotFound = "position not found"
+
+	defaultNeighbourLimit = 50
+	maxNeighbourLimit     = 100
 )
 
+// UserGetNeighboursGet returns users nearby with distance, bearing and the time
+// they were last seen, nearest first. Comma separated "interests" query parameter
+// leaves only neighbours having at least one of the listed interests and ranks
+// ones sharing more interests with the caller higher; "min_age", "max_age",
+// "sex" and "radius" narrow the search further. Results are paged with "limit"
+// and "cursor", the cursor of the next page is sent in X-Next-Cursor header.
 func (env *Env) UserGetNeighboursGet(w http.ResponseWriter, r *http.Request) {
 	env.logger.LogRequestStart(r)
-	var userId, idCode, idErr = env.getIdFromRequest(r)
-	if idErr != nil {
-		env.logger.LogRequestError(r, idErr)
-		w.WriteHeader(idCode)
-		common.WriteWithLogging(r, w, common.GetErrorJson(idErr), env.logger)
+	var userId = getPrincipal(r).UserId
+
+	var filter, filterErr = env.parseNeighbourFilter(r)
+	if filterErr != nil {
+		env.logger.LogRequestError(r, filterErr)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(filterErr), env.logger)
 		return
 	}
 
-	var neighbours, nErr = env.userDAO.GetNeighbourUsers(userId, env.conf.Logic.Distance, env.conf.Logic.OnlineTimeout)
+	var neighbours, next, nErr = env.userDAO.GetNeighbourUsers(userId, filter)
 	if nErr != nil {
 		env.logger.LogRequestError(r, nErr)
 		w.WriteHeader(http.StatusInternalServerError)
 		common.WriteWithLogging(r, w, common.GetErrorJson(nErr), env.logger)
 		return
 	}
+	if next != nil {
+		w.Header().Set(nextCursorHeader, next.String())
+	}
 
+	for _, neighbour := range neighbours {
+		env.setUserPhotos(neighbour.User)
+	}
 	env.logger.LogRequestSuccess(r)
 	common.WriteWithLogging(r, w, common.GetDataJson(neighbours), env.logger)
 }
 
 func (env *Env) UserSavePositionPost(w http.ResponseWriter, r *http.Request) {
 	env.logger.LogRequestStart(r)
-	var userId, idCode, idErr = env.getIdFromRequest(r)
-	if idErr != nil {
-		env.logger.LogRequestError(r, idErr)
-		w.WriteHeader(idCode)
-		common.WriteWithLogging(r, w, common.GetErrorJson(idErr), env.logger)
-		return
-	}
+	var userId = getPrincipal(r).UserId
 
 	var position, code, parseErr = parsePosition(r)
 	if parseErr != nil {
@@ -72,8 +94,50 @@ func (env *Env) UserSavePositionPost(w http.ResponseWriter, r *http.Request) {
 	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
 }
 
-// TODO add tests
+// UserSavePositionBatchPost saves positions an offline client queued while it had
+// no connection. Positions are identified by client time: ones repeating the time
+// of an earlier position in the batch or of an already saved one are reported as
+// duplicates, invalid ones are reported with the error and the rest are saved in
+// a single transaction. Results follow the order of the batch.
+func (env *Env) UserSavePositionBatchPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var userId = getPrincipal(r).UserId
+
+	var items, code, parseErr = parsePositionBatch(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	var positions, indices, results = decodePositionBatch(items)
+	if len(positions) > 0 {
+		var saved, saveErr = env.positionDAO.SaveBatch(userId, positions)
+		if saveErr != nil {
+			env.logger.LogRequestError(r, saveErr)
+			w.WriteHeader(http.StatusInternalServerError)
+			common.WriteWithLogging(r, w, common.GetErrorJson(saveErr), env.logger)
+			return
+		}
+
+		for i, index := range indices {
+			var status = model.PositionDuplicate
+			if saved[i] {
+				status = model.PositionSaved
+			}
+			results[index] = &model.PositionResult{Index: index, Status: status}
+		}
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(results), env.logger)
+}
+
+// UserGetPositionById returns the latest position of the user as privacy
+// settings of the user let the caller see it. Positions of ghosts are not found.
 func (env *Env) UserGetPositionById(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
 	var vars = mux.Vars(r)
 	var neighbourIdStr = vars[id]
 	var neighbourId, neighbourIdErr = strconv.Atoi(neighbourIdStr)
@@ -84,19 +148,31 @@ func (env *Env) UserGetPositionById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	env.logger.LogRequestStart(r)
-	var _, idCode, userIdErr = env.getIdFromRequest(r)
-	if userIdErr != nil {
-		env.logger.LogRequestError(r, userIdErr)
-		w.WriteHeader(idCode)
-		common.WriteWithLogging(r, w, common.GetErrorJson(userIdErr), env.logger)
+	var blocked, blockErr = env.blockDAO.IsBlocked(neighbourId, getPrincipal(r).UserId)
+	if blockErr != nil {
+		env.logger.LogRequestError(r, blockErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(blockErr), env.logger)
+		return
+	}
+	if blocked {
+		var err = errors.New(blockedByUser)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusForbidden)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
 		return
 	}
 
-	// todo check if current user has submitted request to requested user
-	var neighbour, nErr = env.positionDAO.GetUserPositionById(neighbourId)
+	var neighbour, nErr = env.positionDAO.GetVisiblePosition(getPrincipal(r).UserId, neighbourId)
+	if nErr == sql.ErrNoRows {
+		var err = errors.New(positionNotFound)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
 	if nErr != nil {
-		env.logger.LogRequestError(r, nErr)	// TODO handle user not found case
+		env.logger.LogRequestError(r, nErr)
 		w.WriteHeader(http.StatusInternalServerError)
 		common.WriteWithLogging(r, w, common.GetErrorJson(nErr), env.logger)
 		return
@@ -106,6 +182,58 @@ func (env *Env) UserGetPositionById(w http.ResponseWriter, r *http.Request) {
 	common.WriteWithLogging(r, w, common.GetDataJson(neighbour), env.logger)
 }
 
+// parseNeighbourFilter reads neighbour search parameters from the query string.
+// Radius defaults to and is capped with the configured distance.
+func (env *Env) parseNeighbourFilter(r *http.Request) (*model.NeighbourFilter, error) {
+	var query = r.URL.Query()
+	var filter = &model.NeighbourFilter{
+		Radius:        env.conf.Logic.Distance,
+		OnlineTimeout: env.conf.Logic.OnlineTimeout,
+		Sex:           query.Get(sexStr),
+	}
+
+	var err error
+	if filter.Interests, err = parseInterestsQuery(r); err != nil {
+		return nil, err
+	}
+	if filter.MinAge, err = getQueryInt(r, minAgeStr, 0); err != nil {
+		return nil, err
+	}
+	if filter.MaxAge, err = getQueryInt(r, maxAgeStr, 0); err != nil {
+		return nil, err
+	}
+	if err = filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	if value := query.Get(radiusStr); value != "" {
+		var radius, radiusErr = strconv.ParseFloat(value, 64)
+		if radiusErr != nil || !(radius > 0) {
+			return nil, errors.New(model.NeighbourInvalidRadius)
+		}
+		if radius < filter.Radius {
+			filter.Radius = radius
+		}
+	}
+
+	if filter.Limit, err = getQueryInt(r, limitStr, defaultNeighbourLimit); err != nil {
+		return nil, err
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultNeighbourLimit
+	}
+	if filter.Limit > maxNeighbourLimit {
+		filter.Limit = maxNeighbourLimit
+	}
+
+	if value := query.Get(cursorStr); value != "" {
+		if filter.After, err = model.ParseNeighbourCursor(value); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
 func parsePosition(r *http.Request) (*model.Position, int, error) {
 	var body, err = ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -121,72 +249,91 @@ func parsePosition(r *http.Request) (*model.Position, int, error) {
 		return nil, http.StatusBadRequest, err
 	}
 
-	// TODO add position validation
-
 	return position, http.StatusOK, nil
 }
 
-// TODO use some standard mechanisms instead of bicycles
-func (env *Env) parseTokenString(tokenString string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
+func parsePositionBatch(r *http.Request) ([]json.RawMessage, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
 
-		return env.conf.Auth.GetTokenKey(), nil
-	})
-}
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
 
-func (env *Env) getIdFromRequest(r *http.Request) (id int, code int, err error) {
-	var headers = r.Header
-	var authHeaderList, ok = headers[authorizationStr]
-	if !ok {
-		return 0, http.StatusUnauthorized, errors.New("Header \"Authorization\" not set in request")
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, http.StatusBadRequest, err
 	}
-	if len(authHeaderList) != 1 {
-		return 0, http.StatusBadRequest, fmt.Errorf("You set too many (%d) \"Authorization\" headers", len(authHeaderList))
+	if len(items) > model.MaxPositionBatch {
+		return nil, http.StatusBadRequest, errors.New(model.PositionInvalidBatchSize)
 	}
-	var authHeader = authHeaderList[0]
 
-	var fields = strings.Fields(authHeader) // getting last word to remove Bearer word from header
-	var tokenString = fields[len(fields)-1]
+	return items, http.StatusOK, nil
+}
 
-	var token, tokenErr = env.parseTokenString(tokenString)
-	if tokenErr != nil {
-		return 0, http.StatusBadRequest, errors.New("You sent unparseable token")
-	}
+// decodePositionBatch returns valid positions of the batch with distinct client
+// times together with their indices in the batch. Results are filled in for
+// invalid and duplicate positions only.
+func decodePositionBatch(items []json.RawMessage) ([]*model.Position, []int, []*model.PositionResult) {
+	var positions = make([]*model.Position, 0, len(items))
+	var indices = make([]int, 0, len(items))
+	var results = make([]*model.PositionResult, len(items))
+
+	var seen = make(map[time.Time]bool)
+	for i, item := range items {
+		var position = new(model.QueuedPosition)
+		if err := json.Unmarshal(item, position); err != nil {
+			results[i] = &model.PositionResult{Index: i, Status: model.PositionInvalid, ErrMsg: err.Error()}
+			continue
+		}
 
-	var userId, idErr = env.getIdFromTokenString(token)
-	if idErr != nil {
-		return 0, http.StatusBadRequest, errors.New("Your token does not contain your id")
+		var clientTime = time.Time(*position.ClientTime)
+		if seen[clientTime] {
+			results[i] = &model.PositionResult{Index: i, Status: model.PositionDuplicate}
+			continue
+		}
+		seen[clientTime] = true
+
+		positions = append(positions, &position.Position)
+		indices = append(indices, i)
 	}
+	return positions, indices, results
+}
 
-	return userId, http.StatusOK, nil
+// TODO use some standard mechanisms instead of bicycles
+func (env *Env) parseTokenString(tokenString string) (*jwt.Token, error) {
+	return env.keySet.Parse(tokenString)
 }
 
 func (env *Env) getIdFromTokenString(token *jwt.Token) (int, error) {
+	return getIntClaim(token, idStr)
+}
+
+func getIntClaim(token *jwt.Token, name string) (int, error) {
 	var claims, okClaims = token.Claims.(jwt.MapClaims)
 	if !okClaims {
 		return 0, errors.New("Failed to extract claims from token")
 	}
 
-	var idData, okId = claims[idStr]
-	if !okId {
-		return 0, errors.New("Failed to extract id from claims")
+	var data, okData = claims[name]
+	if !okData {
+		return 0, fmt.Errorf("Failed to extract %s from claims", name)
 	}
 
-	var id int
-	switch idData.(type) {
+	var value int
+	switch data.(type) {
 	case int:
-		id = idData.(int)
+		value = data.(int)
 	case float64:
-		var floatId = idData.(float64)
-		id = round(floatId)
+		var floatValue = data.(float64)
+		value = round(floatValue)
 	default:
-		return 0, errors.New("Failed to cast claims[id] to int")
+		return 0, fmt.Errorf("Failed to cast claims[%s] to int", name)
 	}
 
-	return id, nil
+	return value, nil
 }
 
 func round(f float64) int {
@@ -7,6 +7,7 @@ import (
 	"github.com/Sovianum/acquaintance-server/dao"
 	"github.com/Sovianum/acquaintance-server/model"
 	"github.com/Sovianum/acquaintance-server/mylog"
+	"github.com/Sovianum/acquaintance-server/server/mocks"
 	"github.com/go-errors/errors"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
@@ -22,6 +23,10 @@ const (
 	onlineTimeout = 5
 )
 
+var positionColumns = []string{
+	"id", "userId", "latitude", "longitude", "accuracy", "altitude", "speed", "clientTime", "time",
+}
+
 func TestEnv_UserGetNeighboursGet_Success(t *testing.T) {
 	var db, mock, dbErr = sqlmock.New()
 
@@ -32,22 +37,22 @@ func TestEnv_UserGetNeighboursGet_Success(t *testing.T) {
 
 	// mock user extraction
 	mock.
-		ExpectQuery("SELECT DISTINCT").
-		WithArgs(1, distance, onlineTimeout).
+		ExpectQuery("SELECT n.id").
+		WithArgs(1, distance, onlineTimeout, "{}", 0, 0, "", nil, nil, nil, defaultNeighbourLimit+1, model.MinFuzzRadius).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about"}).
-				AddRow(1, "login1", 100, model.MALE, "about1").
-				AddRow(2, "login2", 200, model.MALE, "about2"),
+			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about", "photo", "shared", "distance", "bearing", "time"}).
+				AddRow(1, "login1", 100, model.MALE, "about1", "", "{}", 100.5, 90.0, time.Now()).
+				AddRow(2, "login2", 200, model.MALE, "about2", "", "{}", 100.5, 90.0, time.Now()),
 		)
 
 	var env = getEnv(db)
 	env.conf = getLogicConf()
 
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodGet,
-		env.UserGetNeighboursGet,
+		env.withAuth(env.UserGetNeighboursGet),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -73,10 +78,10 @@ func TestEnv_UserGetNeighboursGet_BadToken(t *testing.T) {
 
 	// mock user extraction
 	mock.
-		ExpectQuery("SELECT u2").
-		WithArgs(1, distance, onlineTimeout).
+		ExpectQuery("SELECT n.id").
+		WithArgs(1, distance, onlineTimeout, "{}", 0, 0, "", nil, nil, nil, defaultNeighbourLimit+1, model.MinFuzzRadius).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about"}),
+			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about", "photo", "shared", "distance", "bearing", "time"}),
 		)
 
 	var env = getEnv(db)
@@ -86,14 +91,14 @@ func TestEnv_UserGetNeighboursGet_BadToken(t *testing.T) {
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodGet,
-		env.UserGetNeighboursGet,
+		env.withAuth(env.UserGetNeighboursGet),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
 	)
 
 	assert.Nil(t, recErr)
-	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
 }
 
 func TestEnv_UserGetNeighboursGet_DBErr(t *testing.T) {
@@ -106,18 +111,18 @@ func TestEnv_UserGetNeighboursGet_DBErr(t *testing.T) {
 
 	// mock user extraction
 	mock.
-		ExpectQuery("SELECT u2").
-		WithArgs(1, distance, onlineTimeout).
+		ExpectQuery("SELECT n.id").
+		WithArgs(1, distance, onlineTimeout, "{}", 0, 0, "", nil, nil, nil, defaultNeighbourLimit+1, model.MinFuzzRadius).
 		WillReturnError(errors.New("err"))
 
 	var env = getEnv(db)
 	env.conf = getLogicConf()
 
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodGet,
-		env.UserGetNeighboursGet,
+		env.withAuth(env.UserGetNeighboursGet),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -127,6 +132,184 @@ func TestEnv_UserGetNeighboursGet_DBErr(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, rec.Code, rec.Body.String())
 }
 
+func TestEnv_UserGetNeighboursGet_Details(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var lastSeen = time.Date(2017, 10, 17, 12, 30, 0, 0, time.UTC)
+	mock.
+		ExpectQuery("SELECT n.id").
+		WithArgs(1, distance, onlineTimeout, "{}", 0, 0, "", nil, nil, nil, defaultNeighbourLimit+1, model.MinFuzzRadius).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about", "photo", "shared", "distance", "bearing", "time"}).
+				AddRow(2, "login2", 20, model.MALE, "about2", "", "{}", 120.5, 45.25, lastSeen),
+		)
+
+	var env = getEnv(db)
+	env.conf = getLogicConf()
+
+	var rec, recErr = getRecorder(
+		"/api/v1/user/position/neighbours",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var body = rec.Body.String()
+	assert.True(t, strings.Contains(body, "\"login\":\"login2\""), body)
+	assert.True(t, strings.Contains(body, "\"distance\":120.5"), body)
+	assert.True(t, strings.Contains(body, "\"bearing\":45.25"), body)
+	assert.True(t, strings.Contains(body, "\"last_seen\":\"2017-10-17T12:30:00Z\""), body)
+}
+
+func TestEnv_UserGetNeighboursGet_Filters(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT n.id").
+		WithArgs(1, 0.25, onlineTimeout, "{}", 20, 30, model.FEMALE, nil, nil, nil, 11, model.MinFuzzRadius).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about", "photo", "shared", "distance", "bearing", "time"}).
+				AddRow(2, "login2", 25, model.FEMALE, "about2", "", "{}", 100.5, 90.0, time.Now()),
+		)
+
+	var env = getEnv(db)
+	env.conf = getLogicConf()
+
+	var rec, recErr = getRecorder(
+		"/api/v1/user/position/neighbours?min_age=20&max_age=30&sex=F&radius=0.25&limit=10",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Empty(t, rec.Header().Get(nextCursorHeader))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserGetNeighboursGet_RadiusCapped(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT n.id").
+		WithArgs(1, distance, onlineTimeout, "{}", 0, 0, "", nil, nil, nil, maxNeighbourLimit+1, model.MinFuzzRadius).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about", "photo", "shared", "distance", "bearing", "time"}),
+		)
+
+	var env = getEnv(db)
+	env.conf = getLogicConf()
+
+	var rec, recErr = getRecorder(
+		"/api/v1/user/position/neighbours?radius=100000&limit=1000",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserGetNeighboursGet_Cursor(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var after = &model.NeighbourCursor{Distance: 0.125, Id: 2}
+	mock.
+		ExpectQuery("SELECT n.id").
+		WithArgs(1, distance, onlineTimeout, "{}", 0, 0, "", 0, 0.125, 2, 2, model.MinFuzzRadius).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "age", "sex", "about", "photo", "shared", "distance", "bearing", "time"}).
+				AddRow(3, "login3", 25, model.MALE, "about3", "", "{}", 0.25, 90.0, time.Now()).
+				AddRow(4, "login4", 25, model.MALE, "about4", "", "{}", 0.375, 90.0, time.Now()),
+		)
+
+	var env = getEnv(db)
+	env.conf = getLogicConf()
+
+	var rec, recErr = getRecorder(
+		"/api/v1/user/position/neighbours?limit=1&cursor="+after.String(),
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 1, strings.Count(rec.Body.String(), "\"login\""))
+
+	var next, nextErr = model.ParseNeighbourCursor(rec.Header().Get(nextCursorHeader))
+	assert.Nil(t, nextErr)
+	assert.Equal(t, &model.NeighbourCursor{Distance: 0.25, Id: 3}, next)
+}
+
+func TestEnv_UserGetNeighboursGet_BadFilter(t *testing.T) {
+	var queries = []string{
+		"min_age=10",
+		"max_age=200",
+		"min_age=40&max_age=30",
+		"min_age=abc",
+		"sex=X",
+		"radius=-1",
+		"radius=abc",
+		"limit=-5",
+		"cursor=garbage",
+	}
+
+	for _, query := range queries {
+		var db, mock, dbErr = sqlmock.New()
+		if dbErr != nil {
+			t.Fatal(dbErr)
+		}
+
+		var env = getEnv(db)
+		env.conf = getLogicConf()
+
+		var rec, recErr = getRecorder(
+			"/api/v1/user/position/neighbours?"+query,
+			http.MethodGet,
+			GetRouter(env).ServeHTTP,
+			strings.NewReader(""),
+			getBlockHeader(env),
+		)
+
+		assert.Nil(t, recErr, query)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		assert.Nil(t, mock.ExpectationsWereMet(), query)
+		db.Close()
+	}
+}
+
 func TestEnv_UserSavePositionPost_Success(t *testing.T) {
 	var db, mock, dbErr = sqlmock.New()
 
@@ -138,30 +321,32 @@ func TestEnv_UserSavePositionPost_Success(t *testing.T) {
 	var date = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
 	var pos = &model.Position{
 		UserId: 1,
-		Point:  model.Point{X: 100, Y: 200},
+		Point:  model.Point{Latitude: 55.75, Longitude: 37.6},
 		Time:   model.QuotedTime(date),
 	}
 
 	// mock position insertion
 	mock.
 		ExpectExec("INSERT INTO Position").
-		WithArgs(pos.UserId, pos.Point.X, pos.Point.Y).
+		WithArgs(pos.UserId, pos.Point.Longitude, pos.Point.Latitude, nil, nil, nil, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	var env = &Env{
 		positionDAO: dao.NewDBPositionDAO(db),
 		conf:        getAuthConf(),
 		logger:      mylog.NewLogger(ioutil.Discard),
+		sessionDAO:  &mocks.SessionDAOMockActive{},
+		keySet:      getKeySet(),
 	}
 
 	var requestMsg, jsonErr = json.Marshal(pos)
 	assert.Nil(t, jsonErr)
 
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.UserSavePositionPost,
+		env.withAuth(env.UserSavePositionPost),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -173,17 +358,19 @@ func TestEnv_UserSavePositionPost_Success(t *testing.T) {
 
 func TestEnv_UserSavePositionPost_BadFormat(t *testing.T) {
 	var env = &Env{
-		conf:   getAuthConf(),
-		logger: mylog.NewLogger(ioutil.Discard),
+		conf:       getAuthConf(),
+		sessionDAO: &mocks.SessionDAOMockActive{},
+		keySet:     getKeySet(),
+		logger:     mylog.NewLogger(ioutil.Discard),
 	}
 
 	var requestMsg = "invalid json"
 
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.UserSavePositionPost,
+		env.withAuth(env.UserSavePositionPost),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -193,11 +380,42 @@ func TestEnv_UserSavePositionPost_BadFormat(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
 
+func TestEnv_UserSavePositionPost_InvalidPosition(t *testing.T) {
+	var env = &Env{
+		conf:       getAuthConf(),
+		sessionDAO: &mocks.SessionDAOMockActive{},
+		keySet:     getKeySet(),
+		logger:     mylog.NewLogger(ioutil.Discard),
+	}
+
+	var stale = time.Now().UTC().Add(-time.Hour).Format("2006-01-02T15:04:05")
+	var requests = []string{
+		`{"point": {"latitude": 95, "longitude": 37.6}}`,
+		`{"point": {"latitude": 55.75, "longitude": 37.6}, "accuracy": -5}`,
+		`{"point": {"latitude": 55.75, "longitude": 37.6}, "client_time": "` + stale + `Z"}`,
+	}
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	for _, requestMsg := range requests {
+		var rec, recErr = getRecorder(
+			urlSample,
+			http.MethodPost,
+			env.withAuth(env.UserSavePositionPost),
+			strings.NewReader(requestMsg),
+			headerPair{"Content-Type", "application/json"},
+			headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+		)
+
+		assert.Nil(t, recErr)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, requestMsg)
+	}
+}
+
 func TestEnv_UserSavePositionPost_Unauthorized(t *testing.T) {
 	var date = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
 	var pos = &model.Position{
 		UserId: 1,
-		Point:  model.Point{X: 100, Y: 200},
+		Point:  model.Point{Latitude: 55.75, Longitude: 37.6},
 		Time:   model.QuotedTime(date),
 	}
 
@@ -212,7 +430,7 @@ func TestEnv_UserSavePositionPost_Unauthorized(t *testing.T) {
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.UserSavePositionPost,
+		env.withAuth(env.UserSavePositionPost),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 	)
@@ -225,13 +443,15 @@ func TestEnv_UserSavePositionPost_BadToken(t *testing.T) {
 	var date = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
 	var pos = &model.Position{
 		UserId: 1,
-		Point:  model.Point{X: 100, Y: 200},
+		Point:  model.Point{Latitude: 55.75, Longitude: 37.6},
 		Time:   model.QuotedTime(date),
 	}
 
 	var env = &Env{
-		conf:   getAuthConf(),
-		logger: mylog.NewLogger(ioutil.Discard),
+		conf:       getAuthConf(),
+		sessionDAO: &mocks.SessionDAOMockActive{},
+		keySet:     getKeySet(),
+		logger:     mylog.NewLogger(ioutil.Discard),
 	}
 
 	var requestMsg, jsonErr = json.Marshal(pos)
@@ -240,14 +460,14 @@ func TestEnv_UserSavePositionPost_BadToken(t *testing.T) {
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.UserSavePositionPost,
+		env.withAuth(env.UserSavePositionPost),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer some_strange_token")},
 	)
 
 	assert.Nil(t, recErr)
-	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 }
 
 func TestEnv_UserSavePositionPost_SaveErr(t *testing.T) {
@@ -261,30 +481,32 @@ func TestEnv_UserSavePositionPost_SaveErr(t *testing.T) {
 	var date = time.Date(2003, 10, 17, 0, 0, 0, 0, time.UTC)
 	var pos = &model.Position{
 		UserId: 1,
-		Point:  model.Point{X: 100, Y: 200},
+		Point:  model.Point{Latitude: 55.75, Longitude: 37.6},
 		Time:   model.QuotedTime(date),
 	}
 
 	// mock position insertion
 	mock.
 		ExpectExec("INSERT INTO Position").
-		WithArgs(pos.UserId, pos.Point.X, pos.Point.Y, pos.Time.String()).
+		WithArgs(pos.UserId, pos.Point.Longitude, pos.Point.Latitude, nil, nil, nil, nil).
 		WillReturnError(errors.New("Save error"))
 
 	var env = &Env{
 		positionDAO: dao.NewDBPositionDAO(db),
 		conf:        getAuthConf(),
 		logger:      mylog.NewLogger(ioutil.Discard),
+		sessionDAO:  &mocks.SessionDAOMockActive{},
+		keySet:      getKeySet(),
 	}
 
 	var requestMsg, jsonErr = json.Marshal(pos)
 	assert.Nil(t, jsonErr)
 
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.UserSavePositionPost,
+		env.withAuth(env.UserSavePositionPost),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -294,11 +516,215 @@ func TestEnv_UserSavePositionPost_SaveErr(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, rec.Code)
 }
 
+func TestEnv_UserSavePositionBatchPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var date1 = time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Second)
+	var date2 = date1.Add(time.Minute)
+	var stamp1 = date1.Format("2006-01-02T15:04:05") + "Z"
+	var stamp2 = date2.Format("2006-01-02T15:04:05") + "Z"
+
+	// the first position is saved, the second one was uploaded before
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TEMP TABLE").WillReturnResult(sqlmock.NewResult(0, 0))
+	var copyIn = mock.ExpectPrepare("COPY")
+	copyIn.ExpectExec().WithArgs(0, 55.75, 37.6, nil, nil, nil, date1).WillReturnResult(sqlmock.NewResult(0, 1))
+	copyIn.ExpectExec().WithArgs(1, 55.76, 37.61, nil, nil, nil, date2).WillReturnResult(sqlmock.NewResult(0, 1))
+	copyIn.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectQuery("WITH inserted").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"idx"}).AddRow(0))
+	mock.ExpectCommit()
+
+	var env = &Env{
+		positionDAO: dao.NewDBPositionDAO(db),
+		conf:        getAuthConf(),
+		logger:      mylog.NewLogger(ioutil.Discard),
+		sessionDAO:  &mocks.SessionDAOMockActive{},
+		keySet:      getKeySet(),
+	}
+
+	var requestMsg = `[
+		{"point": {"latitude": 55.75, "longitude": 37.6}, "client_time": "` + stamp1 + `"},
+		{"point": {"latitude": 95, "longitude": 37.6}, "client_time": "` + stamp2 + `"},
+		{"point": {"latitude": 55.76, "longitude": 37.61}, "client_time": "` + stamp2 + `"},
+		{"point": {"x": 37.6, "y": 55.75}, "client_time": "` + stamp1 + `"}
+	]`
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.UserSavePositionBatchPost),
+		strings.NewReader(requestMsg),
+		headerPair{"Content-Type", "application/json"},
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var response struct {
+		Data []*model.PositionResult `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(
+		t,
+		[]*model.PositionResult{
+			{Index: 0, Status: model.PositionSaved},
+			{Index: 1, Status: model.PositionInvalid, ErrMsg: model.PointInvalidLatitude},
+			{Index: 2, Status: model.PositionDuplicate},
+			{Index: 3, Status: model.PositionDuplicate},
+		},
+		response.Data,
+	)
+}
+
+func TestEnv_UserSavePositionBatchPost_BadFormat(t *testing.T) {
+	var env = &Env{
+		conf:       getAuthConf(),
+		sessionDAO: &mocks.SessionDAOMockActive{},
+		keySet:     getKeySet(),
+		logger:     mylog.NewLogger(ioutil.Discard),
+	}
+
+	var tooLarge = "[" + strings.Repeat("{},", model.MaxPositionBatch) + "{}]"
+	var requests = []string{
+		`{"point": {"latitude": 55.75, "longitude": 37.6}}`,
+		tooLarge,
+	}
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	for _, requestMsg := range requests {
+		var rec, recErr = getRecorder(
+			urlSample,
+			http.MethodPost,
+			env.withAuth(env.UserSavePositionBatchPost),
+			strings.NewReader(requestMsg),
+			headerPair{"Content-Type", "application/json"},
+			headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+		)
+
+		assert.Nil(t, recErr)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestEnv_UserSavePositionBatchPost_SaveErr(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin().WillReturnError(errors.New("Begin error"))
+
+	var env = &Env{
+		positionDAO: dao.NewDBPositionDAO(db),
+		conf:        getAuthConf(),
+		logger:      mylog.NewLogger(ioutil.Discard),
+		sessionDAO:  &mocks.SessionDAOMockActive{},
+		keySet:      getKeySet(),
+	}
+
+	var stamp = time.Now().UTC().Add(-time.Hour).Format("2006-01-02T15:04:05") + "Z"
+	var requestMsg = `[{"point": {"latitude": 55.75, "longitude": 37.6}, "client_time": "` + stamp + `"}]`
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.UserSavePositionBatchPost),
+		strings.NewReader(requestMsg),
+		headerPair{"Content-Type", "application/json"},
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestEnv_UserGetPositionById_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.
+		ExpectQuery("SELECT p.id, p.userId").
+		WithArgs(1, 2, model.MinFuzzRadius).
+		WillReturnRows(
+			sqlmock.NewRows(positionColumns).AddRow(10, 2, 55.75, 37.6, nil, nil, nil, nil, time.Now()),
+		)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/position/neighbour/2",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.True(t, strings.Contains(rec.Body.String(), "55.75"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserGetPositionById_Hidden(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.
+		ExpectQuery("SELECT p.id, p.userId").
+		WithArgs(1, 2, model.MinFuzzRadius).
+		WillReturnRows(sqlmock.NewRows(positionColumns))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/position/neighbour/2",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), positionNotFound))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
 func TestEnv_getIdFromTokenString_Success(t *testing.T) {
 	var env = &Env{
-		conf: getAuthConf(),
+		conf:       getAuthConf(),
+		sessionDAO: &mocks.SessionDAOMockActive{},
+		keySet:     getKeySet(),
 	}
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 	var token, _ = env.parseTokenString(tokenStr)
 	var id, err = env.getIdFromTokenString(token)
 
@@ -308,9 +734,11 @@ func TestEnv_getIdFromTokenString_Success(t *testing.T) {
 
 func TestEnv_parseTokenString_Success(t *testing.T) {
 	var env = &Env{
-		conf: getAuthConf(),
+		conf:       getAuthConf(),
+		sessionDAO: &mocks.SessionDAOMockActive{},
+		keySet:     getKeySet(),
 	}
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 	var _, err = env.parseTokenString(tokenStr)
 
 	assert.Nil(t, err)
@@ -318,7 +746,8 @@ func TestEnv_parseTokenString_Success(t *testing.T) {
 
 func TestEnv_parseTokenString_Fail(t *testing.T) {
 	var env = &Env{
-		conf: getAuthConf(),
+		conf:   getAuthConf(),
+		keySet: getKeySet(),
 	}
 	var _, err = env.parseTokenString("Some_strange_str")
 
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/model"
+	"io/ioutil"
+	"net/http"
+)
+
+// UserPrivacyGet returns privacy settings of the caller.
+func (env *Env) UserPrivacyGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var privacy, dbErr = env.privacyDAO.GetPrivacy(getPrincipal(r).UserId)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(privacy), env.logger)
+}
+
+// UserPrivacyPut replaces privacy settings of the caller. They apply to
+// positions saved before as well.
+func (env *Env) UserPrivacyPut(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var privacy, parseCode, parseErr = parsePrivacy(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	if err := env.privacyDAO.SetPrivacy(getPrincipal(r).UserId, privacy); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(privacy), env.logger)
+}
+
+func parsePrivacy(r *http.Request) (*model.Privacy, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var privacy = new(model.Privacy)
+	if err := json.Unmarshal(body, &privacy); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return privacy, http.StatusOK, nil
+}
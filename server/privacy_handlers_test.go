@@ -0,0 +1,87 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEnv_UserPrivacyGet_Default(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT ghost, fuzzRadius FROM Privacy").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"ghost", "fuzzRadius"}))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/privacy",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.True(t, strings.Contains(rec.Body.String(), "\"ghost\":false"))
+	assert.True(t, strings.Contains(rec.Body.String(), "\"fuzz_radius\":100"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserPrivacyPut_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("INSERT INTO Privacy").
+		WithArgs(1, true, 300).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/privacy",
+		http.MethodPut,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"ghost\": true, \"fuzz_radius\": 300}"),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserPrivacyPut_InvalidRadius(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/self/privacy",
+		http.MethodPut,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"ghost\": false, \"fuzz_radius\": -5}"),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), "must be between 100 and"))
+}
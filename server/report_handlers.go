@@ -0,0 +1,350 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/mail"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	recentRequestsLimit = 10
+
+	cannotReportSelf     = "you can not report yourself"
+	reportRequestInvalid = "request is not between you and the reported user"
+	reportNotFound       = "report not found"
+	reportResolved       = "report is already resolved"
+
+	warnMailSubject     = "Предупреждение"
+	warnMailTemplate    = "Здравствуйте, %s!\n\nНа вас поступила жалоба, модератор вынес предупреждение.\n\n%s\n"
+	suspendMailSubject  = "Аккаунт заблокирован"
+	suspendMailTemplate = "Здравствуйте, %s!\n\nНа вас поступила жалоба, ваш аккаунт заблокирован до %s.\n\n%s\n"
+	banMailSubject      = "Аккаунт заблокирован"
+	banMailTemplate     = "Здравствуйте, %s!\n\nНа вас поступила жалоба, ваш аккаунт заблокирован навсегда.\n\n%s\n"
+)
+
+// UserReportPost saves a complaint of the caller about another user.
+// If request_id is set, the request must be between these two users.
+func (env *Env) UserReportPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var report, parseCode, parseErr = parseReport(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+	report.ReporterId = getPrincipal(r).UserId
+
+	if code, err := env.checkReport(report); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var reportId, dbErr = env.reportDAO.CreateReport(report)
+	if dbErr == sql.ErrNoRows {
+		// the reported user has deleted the account since the check
+		var err = errors.New(userNotFound)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+	report.Id = reportId
+	report.Status = model.ReportOpen
+	report.Time = model.QuotedTime(time.Now())
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(report), env.logger)
+}
+
+// AdminReportsGet returns open reports, the oldest first, together with
+// profiles and recent requests of the reported users.
+func (env *Env) AdminReportsGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var limit, offset, pageErr = parsePage(r)
+	if pageErr != nil {
+		env.logger.LogRequestError(r, pageErr)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(pageErr), env.logger)
+		return
+	}
+
+	var reports, dbErr = env.reportDAO.GetOpenReports(limit, offset)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+
+	var views, viewErr = env.getReportViews(reports)
+	if viewErr != nil {
+		env.logger.LogRequestError(r, viewErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(viewErr), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(views), env.logger)
+}
+
+// AdminReportResolvePost closes the report applying the moderator's decision to
+// the reported user. Suspended and banned users are signed out everywhere.
+func (env *Env) AdminReportResolvePost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var resolution, parseCode, parseErr = parseReportResolution(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	var report, code, err = env.getOpenReport(r)
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var principal = getPrincipal(r)
+	if resolution.Action != model.ActionDismiss {
+		var code, err = env.applyResolution(principal, report.ReportedId, resolution)
+		if err != nil {
+			env.logger.LogRequestError(r, err)
+			w.WriteHeader(code)
+			common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+			return
+		}
+	}
+
+	var resolved, dbErr = env.reportDAO.ResolveReport(report.Id, principal.UserId, resolution.Action, resolution.Comment)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+	if !resolved {
+		var err = errors.New(reportResolved)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusConflict)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+func (env *Env) checkReport(report *model.Report) (int, error) {
+	if report.ReportedId == report.ReporterId {
+		return http.StatusBadRequest, errors.New(cannotReportSelf)
+	}
+
+	var exists, existsErr = env.userDAO.ExistsById(report.ReportedId)
+	if existsErr != nil {
+		return http.StatusInternalServerError, existsErr
+	}
+	if !exists {
+		return http.StatusNotFound, errors.New(userNotFound)
+	}
+
+	if report.RequestId == nil {
+		return http.StatusOK, nil
+	}
+	var request, requestErr = env.meetRequestDAO.GetRequestById(*report.RequestId)
+	if requestErr == sql.ErrNoRows {
+		return http.StatusBadRequest, errors.New(reportRequestInvalid)
+	}
+	if requestErr != nil {
+		return http.StatusInternalServerError, requestErr
+	}
+
+	var forward = request.RequesterId == report.ReporterId && request.RequestedId == report.ReportedId
+	var backward = request.RequesterId == report.ReportedId && request.RequestedId == report.ReporterId
+	if !forward && !backward {
+		return http.StatusBadRequest, errors.New(reportRequestInvalid)
+	}
+	return http.StatusOK, nil
+}
+
+func (env *Env) getReportViews(reports []*model.Report) ([]*model.ReportView, error) {
+	var users = make(map[int]*model.User)
+	var requests = make(map[int][]*model.MeetRequest)
+
+	var result = make([]*model.ReportView, 0, len(reports))
+	for _, report := range reports {
+		var userId = report.ReportedId
+		if userId == 0 {
+			// the reported user has deleted the account
+			result = append(result, &model.ReportView{Report: *report, RecentRequests: []*model.MeetRequest{}})
+			continue
+		}
+		if _, ok := users[userId]; !ok {
+			var user, userErr = env.userDAO.GetUserById(userId)
+			if userErr != nil {
+				return nil, userErr
+			}
+			user.Password = ""
+			env.setUserPhotos(user)
+			users[userId] = user
+
+			var userRequests, requestsErr = env.getRecentRequests(userId)
+			if requestsErr != nil {
+				return nil, requestsErr
+			}
+			env.setRequestPhotos(userRequests...)
+			requests[userId] = userRequests
+		}
+
+		result = append(result, &model.ReportView{
+			Report:         *report,
+			ReportedUser:   users[userId],
+			RecentRequests: requests[userId],
+		})
+	}
+	return result, nil
+}
+
+// getRecentRequests returns last requests sent or received by the user, newest first.
+func (env *Env) getRecentRequests(userId int) ([]*model.MeetRequest, error) {
+	var requests, err = env.meetRequestDAO.GetAllRequests(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		return time.Time(requests[i].Time).After(time.Time(requests[j].Time))
+	})
+	if len(requests) > recentRequestsLimit {
+		requests = requests[:recentRequestsLimit]
+	}
+	return requests, nil
+}
+
+func (env *Env) getOpenReport(r *http.Request) (*model.Report, int, error) {
+	var reportId, idErr = strconv.Atoi(mux.Vars(r)[id])
+	if idErr != nil {
+		return nil, http.StatusNotFound, errors.New(reportNotFound)
+	}
+
+	var report, dbErr = env.reportDAO.GetReportById(reportId)
+	if dbErr == sql.ErrNoRows {
+		return nil, http.StatusNotFound, errors.New(reportNotFound)
+	}
+	if dbErr != nil {
+		return nil, http.StatusInternalServerError, dbErr
+	}
+	if report.Status != model.ReportOpen {
+		return nil, http.StatusConflict, errors.New(reportResolved)
+	}
+	return report, http.StatusOK, nil
+}
+
+// applyResolution warns, suspends or bans the reported user.
+func (env *Env) applyResolution(principal *Principal, userId int, resolution *model.ReportResolution) (int, error) {
+	var user, userErr = env.userDAO.GetUserById(userId)
+	if userErr == sql.ErrNoRows {
+		// reports about deleted accounts can only be dismissed
+		return http.StatusNotFound, errors.New(userNotFound)
+	}
+	if userErr != nil {
+		return http.StatusInternalServerError, userErr
+	}
+	if err := checkManageable(principal, user); err != nil {
+		return http.StatusForbidden, err
+	}
+
+	var msg = mail.Message{To: user.Email}
+	switch resolution.Action {
+	case model.ActionWarn:
+		msg.Subject = warnMailSubject
+		msg.Body = fmt.Sprintf(warnMailTemplate, user.Login, resolution.Comment)
+
+	case model.ActionSuspend:
+		var until = time.Now().Add(time.Duration(resolution.Days) * 24 * time.Hour)
+		if _, err := env.userDAO.Suspend(user.Id, until); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if err := env.sessionDAO.RevokeUserSessions(user.Id); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		msg.Subject = suspendMailSubject
+		msg.Body = fmt.Sprintf(suspendMailTemplate, user.Login, until.Format("02.01.2006 15:04 MST"), resolution.Comment)
+
+	case model.ActionBan:
+		if _, err := env.userDAO.SetBanned(user.Id, true); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if err := env.sessionDAO.RevokeUserSessions(user.Id); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		msg.Subject = banMailSubject
+		msg.Body = fmt.Sprintf(banMailTemplate, user.Login, resolution.Comment)
+	}
+
+	if user.Email != "" {
+		if err := env.mailer.Send(msg); err != nil {
+			// the decision is already applied, so the mail is not worth failing the request
+			env.logger.Errorf("failed to send moderation mail to user %d: %s", user.Id, err.Error())
+		}
+	}
+	return http.StatusOK, nil
+}
+
+func parseReport(r *http.Request) (*model.Report, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var report = new(model.Report)
+	if err := json.Unmarshal(body, &report); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return report, http.StatusOK, nil
+}
+
+func parseReportResolution(r *http.Request) (*model.ReportResolution, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var resolution = new(model.ReportResolution)
+	if err := json.Unmarshal(body, &resolution); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return resolution, http.StatusOK, nil
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"github.com/Sovianum/acquaintance-server/mail"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var reportColumns = []string{"id", "reporterId", "reportedId", "reportedLogin", "requestId", "reason", "text", "status", "time"}
+
+func TestEnv_UserReportPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+	mock.
+		ExpectQuery("SELECT mr.id").
+		WithArgs(10).
+		WillReturnRows(
+			sqlmock.NewRows(requestColumns).
+				AddRow(10, 2, "login2", "", 1, "login", "", model.StatusDeclined, time.Now(), "", ""),
+		)
+	mock.
+		ExpectQuery("INSERT INTO Report").
+		WithArgs(1, 2, 10, model.ReasonHarassment, "text").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "reportedLogin"}).AddRow(5, "login2"))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/report",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"reported_id\": 2, \"request_id\": 10, \"reason\": \"harassment\", \"text\": \"text\"}"),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.True(t, strings.Contains(rec.Body.String(), "\"id\":5"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserReportPost_ForeignRequest(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+	mock.
+		ExpectQuery("SELECT mr.id").
+		WithArgs(10).
+		WillReturnRows(
+			sqlmock.NewRows(requestColumns).
+				AddRow(10, 2, "login2", "", 3, "login3", "", model.StatusPending, time.Now(), "", ""),
+		)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/report",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"reported_id\": 2, \"request_id\": 10, \"reason\": \"spam\"}"),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), reportRequestInvalid))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserReportPost_Self(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/user/report",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"reported_id\": 1, \"reason\": \"spam\"}"),
+		getBlockHeader(env),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestEnv_AdminReportsGet_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var date = time.Now()
+	mock.
+		ExpectQuery("SELECT id, COALESCE").
+		WithArgs(defaultAdminLimit, 0).
+		WillReturnRows(
+			sqlmock.NewRows(reportColumns).
+				AddRow(1, 1, 2, "login2", nil, model.ReasonSpam, "", model.ReportOpen, date).
+				AddRow(2, 3, 2, "login2", nil, model.ReasonFake, "", model.ReportOpen, date),
+		)
+
+	// the reported user is fetched once for both reports
+	mockUser(mock, 2, model.RoleUser, false)
+	mock.
+		ExpectQuery("SELECT mr.id").
+		WithArgs(2).
+		WillReturnRows(
+			sqlmock.NewRows(requestColumns).
+				AddRow(10, 2, "login", "", 1, "login1", "", model.StatusPending, date.Add(-time.Hour), "", "").
+				AddRow(11, 2, "login", "", 3, "login3", "", model.StatusPending, date, "", ""),
+		)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/reports",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleModerator),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var body = rec.Body.String()
+	assert.Equal(t, 2, strings.Count(body, "\"reported_user\""))
+	assert.False(t, strings.Contains(body, "password"))
+	// recent requests go newest first
+	assert.True(t, strings.Index(body, "\"id\":11") < strings.Index(body, "\"id\":10"))
+}
+
+func TestEnv_AdminReportsGet_DeletedUser(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT id, COALESCE").
+		WithArgs(defaultAdminLimit, 0).
+		WillReturnRows(
+			sqlmock.NewRows(reportColumns).AddRow(1, 1, 0, "login2", nil, model.ReasonSpam, "", model.ReportOpen, time.Now()),
+		)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/reports",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleModerator),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var body = rec.Body.String()
+	assert.True(t, strings.Contains(body, "\"reported_login\":\"login2\""))
+	assert.True(t, strings.Contains(body, "\"reported_user\":null"))
+}
+
+func TestEnv_AdminReportResolvePost_Suspend(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT id, COALESCE").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows(reportColumns).AddRow(1, 3, 2, "login2", nil, model.ReasonSpam, "", model.ReportOpen, time.Now()),
+		)
+	mock.
+		ExpectQuery("SELECT id, login, password").
+		WithArgs(2).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(2, "login", "hash", 30, model.MALE, "about", "login@mail.ru", model.RoleUser, false, nil, ""),
+		)
+	mock.
+		ExpectExec("UPDATE Users SET suspendedUntil").
+		WithArgs(sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec("UPDATE Report SET status = 'resolved'").
+		WithArgs(1, 1, model.ActionSuspend, "spam").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/reports/1/resolve",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"action\": \"suspend\", \"days\": 7, \"comment\": \"spam\"}"),
+		getRoleHeader(env, model.RoleModerator),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var messages = env.mailer.(*mail.MemoryMailer).Messages()
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, suspendMailSubject, messages[0].Subject)
+}
+
+func TestEnv_AdminReportResolvePost_Resolved(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT id, COALESCE").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows(reportColumns).AddRow(1, 3, 2, "login2", nil, model.ReasonSpam, "", model.ReportResolved, time.Now()),
+		)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/reports/1/resolve",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"action\": \"dismiss\"}"),
+		getRoleHeader(env, model.RoleModerator),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
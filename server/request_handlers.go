@@ -8,6 +8,9 @@ import (
 	"github.com/Sovianum/acquaintance-server/dao"
 	"github.com/Sovianum/acquaintance-server/model"
 	"github.com/Sovianum/acquaintance-server/mylog"
+	"github.com/Sovianum/acquaintance-server/notify"
+	"github.com/Sovianum/acquaintance-server/push"
+	"github.com/Sovianum/acquaintance-server/webhook"
 	"github.com/patrickmn/go-cache"
 	"io/ioutil"
 	"net/http"
@@ -17,6 +20,15 @@ import (
 const (
 	requestNotFound = "request not found"
 	alreadyAccepted = "user has already accepted another request"
+	invalidSince    = "\"since\" must be a non-negative event id"
+
+	sinceStr      = "since"
+	maxEventLimit = 100
+
+	pushTypeStr      = "type"
+	pushRequestIdStr = "request_id"
+	pushStatusStr    = "status"
+	pushTypeRequest  = "request"
 )
 
 func (env *Env) CreateRequest(w http.ResponseWriter, r *http.Request) {
@@ -28,13 +40,7 @@ func (env *Env) CreateRequest(w http.ResponseWriter, r *http.Request) {
 		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
 		return
 	}
-	var userId, tokenCode, tokenErr = env.getIdFromRequest(r)
-	if tokenErr != nil {
-		env.logger.LogRequestError(r, tokenErr)
-		w.WriteHeader(tokenCode)
-		common.WriteWithLogging(r, w, common.GetErrorJson(tokenErr), env.logger)
-		return
-	}
+	var userId = getPrincipal(r).UserId
 	meetRequest.RequesterId = userId
 
 	var requestId, dbErr = env.meetRequestDAO.CreateRequest(
@@ -92,51 +98,43 @@ func (env *Env) UpdateRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var userId, tokenCode, tokenErr = env.getIdFromRequest(r)
-	if tokenErr != nil {
-		env.logger.LogRequestError(r, tokenErr)
-		w.WriteHeader(tokenCode)
-		common.WriteWithLogging(r, w, common.GetErrorJson(tokenErr), env.logger)
+	var request, code, err = env.updateRequest(getPrincipal(r).UserId, update)
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(code)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
 		return
 	}
 
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(request), env.logger)
+}
+
+// updateRequest changes status of the request on behalf of the user and
+// notifies the other side. It is shared by UpdateRequest and the event socket.
+func (env *Env) updateRequest(userId int, update *model.MeetRequestUpdate) (*model.MeetRequest, int, error) {
 	var dbRequest, err = env.meetRequestDAO.GetRequestById(update.Id)
 	if err != nil {
-		env.logger.LogRequestError(r, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
-		return
+		return nil, http.StatusInternalServerError, err
 	}
 
 	var validStatusCombination = dbRequest.Status == model.StatusPending && update.Status != model.StatusInterrupted
 	validStatusCombination = validStatusCombination || dbRequest.Status == model.StatusAccepted && update.Status == model.StatusInterrupted
 	if !validStatusCombination {
-		var err = fmt.Errorf(
+		// the error has always been sent with 200 code, clients rely on it
+		return nil, http.StatusOK, fmt.Errorf(
 			"trying to update request with status \"%s\" to status \"%s\"",
 			dbRequest.Status,
 			update.Status,
 		)
-		env.logger.LogRequestError(r, err)
-		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
-		return
 	}
 
 	var rowsAffected, dbErr = env.meetRequestDAO.UpdateRequest(update.Id, userId, update.Status)
 	if dbErr != nil {
-		env.logger.LogRequestError(r, dbErr)
-		env.rollBackCache(update.Id, userId)
-		w.WriteHeader(http.StatusInternalServerError)
-		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
-		return
+		return nil, http.StatusInternalServerError, dbErr
 	}
-
 	if rowsAffected == 0 {
-		var err = errors.New(requestNotFound)
-		env.logger.LogRequestError(r, err)
-		env.rollBackCache(update.Id, userId)
-		w.WriteHeader(http.StatusNotFound)
-		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
-		return
+		return nil, http.StatusNotFound, errors.New(requestNotFound)
 	}
 
 	var handler func(int, int) (int, error) = nil
@@ -153,40 +151,153 @@ func (env *Env) UpdateRequest(w http.ResponseWriter, r *http.Request) {
 		var code, err = handler(update.Id, userId)
 		env.logger.Infof("finish request update to status %s", update.Status)
 		if err != nil {
-			env.logger.LogRequestError(r, err)
-			w.WriteHeader(code)
-			common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
-			return
+			return nil, code, err
 		}
 	}
 
 	dbRequest.Status = update.Status
-	env.logger.LogRequestSuccess(r)
-	common.WriteWithLogging(r, w, common.GetDataJson(dbRequest), env.logger)
+	env.setRequestPhotos(dbRequest)
+	return dbRequest, http.StatusOK, nil
 }
 
+// GetNewRequestsEvents answers in the shape the route had before events were
+// persisted: new requests and updates of own requests with their latest statuses.
+// Clients of the route neither pass a cursor nor ack, so the returned events are
+// acked at once and each update is delivered only once. EventsGet delivers
+// events reliably.
 func (env *Env) GetNewRequestsEvents(w http.ResponseWriter, r *http.Request) {
 	env.logger.LogRequestStart(r)
-	var userId, tokenCode, tokenErr = env.getIdFromRequest(r)
-	if tokenErr != nil {
-		env.logger.LogRequestError(r, tokenErr)
-		w.WriteHeader(tokenCode)
-		common.WriteWithLogging(r, w, common.GetErrorJson(tokenErr), env.logger)
+	var userId = getPrincipal(r).UserId
+
+	var events, err = env.pollEvents(userId, 0, maxEventLimit)
+	if err == nil && len(events) != 0 {
+		_, err = env.eventDAO.Ack(userId, events[len(events)-1].Id)
+	}
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
 		return
 	}
 
+	var requests = getLatestRequests(events)
+	env.setRequestPhotos(requests...)
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(requests), env.logger)
+}
+
+// EventsGet returns events of the caller with ids greater than the "since"
+// query parameter. If there are none, the call blocks until a new event arrives
+// or the poll timeout passes. Events are kept until the caller acks them.
+func (env *Env) EventsGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var userId = getPrincipal(r).UserId
+
+	var since, limit, pageErr = parseEventPage(r)
+	if pageErr != nil {
+		env.logger.LogRequestError(r, pageErr)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(pageErr), env.logger)
+		return
+	}
+
+	var events, err = env.pollEvents(userId, since, limit)
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	for _, event := range events {
+		env.setRequestPhotos(event.Request)
+	}
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(events), env.logger)
+}
+
+// pollEvents returns events of the user with ids greater than since. If there
+// are none, it waits for a wake up of the user's mail box up to the poll timeout.
+func (env *Env) pollEvents(userId int, since int64, limit int) ([]*model.Event, error) {
 	var box, boxErr = env.getMailBox(userId)
 	if boxErr != nil {
-		env.logger.LogRequestError(r, boxErr)
-		w.WriteHeader(http.StatusInternalServerError)
-		common.WriteWithLogging(r, w, common.GetErrorJson(boxErr), env.logger)
+		return nil, boxErr
+	}
+	box.ResetAccept()
+
+	var events, err = env.eventDAO.GetEvents(userId, since, limit)
+	if err == nil && len(events) == 0 && box.Wait(env.conf.Logic.PollSeconds) {
+		events, err = env.eventDAO.GetEvents(userId, since, limit)
+	}
+	return events, err
+}
+
+// getLatestRequests returns requests of the events, each once with the status
+// of its latest event.
+func getLatestRequests(events []*model.Event) []*model.MeetRequest {
+	var result = make([]*model.MeetRequest, 0, len(events))
+	var indices = make(map[int]int)
+	for _, event := range events {
+		if index, ok := indices[event.Request.Id]; ok {
+			result[index] = event.Request
+			continue
+		}
+		indices[event.Request.Id] = len(result)
+		result = append(result, event.Request)
+	}
+	return result
+}
+
+// EventsAckPost removes delivered events of the caller up to the given id
+// inclusive.
+func (env *Env) EventsAckPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var userId = getPrincipal(r).UserId
+
+	var ack, parseCode, parseErr = parseEventAck(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
 		return
 	}
 
-	var newRequestData = box.GetAll(env.conf.Logic.PollSeconds)
+	if _, err := env.eventDAO.Ack(userId, ack.Id); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
 
 	env.logger.LogRequestSuccess(r)
-	common.WriteWithLogging(r, w, common.GetDataJson(newRequestData), env.logger)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+// sendNewEvents passes events of the user with ids greater than since to send
+// oldest first and moves since past each sent event. It is shared by the
+// pushing transports, the event socket and the event stream.
+func (env *Env) sendNewEvents(userId int, box MailBox, since *int64, send func(*model.Event) error) error {
+	for {
+		var events, err = env.eventDAO.GetEvents(userId, *since, maxEventLimit)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		box.ResetAccept()
+		for _, event := range events {
+			env.setRequestPhotos(event.Request)
+			if err := send(event); err != nil {
+				return err
+			}
+			*since = event.Id
+		}
+		if len(events) < maxEventLimit {
+			return nil
+		}
+	}
 }
 
 func (env *Env) getRequestsTemplate(
@@ -195,13 +306,7 @@ func (env *Env) getRequestsTemplate(
 	r *http.Request,
 ) {
 	env.logger.LogRequestStart(r)
-	var userId, tokenCode, tokenErr = env.getIdFromRequest(r)
-	if tokenErr != nil {
-		env.logger.LogRequestError(r, tokenErr)
-		w.WriteHeader(tokenCode)
-		common.WriteWithLogging(r, w, common.GetErrorJson(tokenErr), env.logger)
-		return
-	}
+	var userId = getPrincipal(r).UserId
 	var requests, requestsErr = daoFunc(userId, env.meetRequestDAO)
 	if requestsErr != nil {
 		env.logger.LogRequestError(r, requestsErr)
@@ -210,23 +315,22 @@ func (env *Env) getRequestsTemplate(
 		return
 	}
 
+	env.setRequestPhotos(requests...)
 	env.logger.LogRequestSuccess(r)
 	common.WriteWithLogging(r, w, common.GetDataJson(requests), env.logger)
 }
 
-func (env *Env) rollBackCache(requestId int, userId int) {
-	var box, found = env.meetRequestCache.Get(strconv.Itoa(userId))
-	if !found {
-		return
+// dropRequestEvents removes undelivered events about the request. Failures
+// are only logged cos the request itself has already been updated.
+func (env *Env) dropRequestEvents(requestId int) {
+	if err := env.eventDAO.DeleteRequestEvents(requestId); err != nil {
+		env.logger.Errorf("failed to delete events of request %d: %s", requestId, err.Error())
 	}
-
-	box.(MailBox).Remove(requestId)
 }
 
 func (env *Env) handleRequestAccept(requestId int, userId int) (int, error) {
-	var boxFunc = func(box MailBox, request *model.MeetRequest) (int, error) {
-		env.logger.Logger.Infof("add accepted request to mail box")
-		if err := box.AddAccept(request); err != nil {
+	var boxFunc = func(box MailBox) (int, error) {
+		if err := box.Accept(); err != nil {
 			return http.StatusUnavailableForLegalReasons, errors.New(alreadyAccepted)
 		}
 		return http.StatusOK, nil
@@ -240,20 +344,15 @@ func (env *Env) handleRequestAccept(requestId int, userId int) (int, error) {
 		)
 		return request.RequestedId == userId
 	}
-	var boxExtractFunc = func(userId int, request *model.MeetRequest) (MailBox, error) {
-		// here we extract requester's mail box cos the one who initiated the requested should be
+	var addresseeFunc = func(userId int, request *model.MeetRequest) int {
+		// here we choose requester cos the one who initiated the requested should be
 		// informed about request accept
-		return env.getMailBox(request.RequesterId)
+		return request.RequesterId
 	}
-	return env.dispatchRequest(boxFunc, boxExtractFunc, rightsCheckFunc, requestId, userId)
+	return env.dispatchRequest(boxFunc, addresseeFunc, rightsCheckFunc, requestId, userId, model.StatusAccepted)
 }
 
 func (env *Env) handleRequestDecline(requestId int, userId int) (int, error) {
-	var boxFunc = func(box MailBox, request *model.MeetRequest) (int, error) {
-		env.logger.Logger.Infof("add declined request to mail box")
-		box.AddDecline(request)
-		return http.StatusOK, nil
-	}
 	var rightsCheckFunc = func(request *model.MeetRequest, userId int) bool {
 		env.logger.Logger.Infof(
 			"check decline request to add to mailbox: requested_id (%d) == userId (%d): %v",
@@ -263,20 +362,17 @@ func (env *Env) handleRequestDecline(requestId int, userId int) (int, error) {
 		)
 		return request.RequestedId == userId
 	}
-	var boxExtractFunc = func(userId int, request *model.MeetRequest) (MailBox, error) {
-		// here we extract requester's mail box cos the one who initiated the requested should be
+	var addresseeFunc = func(userId int, request *model.MeetRequest) int {
+		// here we choose requester cos the one who initiated the requested should be
 		// informed about request decline
-		return env.getMailBox(request.RequesterId)
+		return request.RequesterId
 	}
-	return env.dispatchRequest(boxFunc, boxExtractFunc, rightsCheckFunc, requestId, userId)
+	return env.dispatchRequest(nil, addresseeFunc, rightsCheckFunc, requestId, userId, model.StatusDeclined)
 }
 
 func (env *Env) handleRequestInterrupt(requestId int, userId int) (int, error) {
-	var boxFunc = func(box MailBox, request *model.MeetRequest) (int, error) {
-		env.logger.Logger.Infof("interrupt request in mail box")
-		err := box.Interrupt(request)
-
-		if err != nil {
+	var boxFunc = func(box MailBox) (int, error) {
+		if err := box.Interrupt(); err != nil {
 			return http.StatusConflict, err
 		}
 		return http.StatusOK, nil
@@ -293,27 +389,19 @@ func (env *Env) handleRequestInterrupt(requestId int, userId int) (int, error) {
 		)
 		return hasRights
 	}
-	var boxExtractFunc = func(userId int, request *model.MeetRequest) (MailBox, error) {
-		var address int
+	var addresseeFunc = func(userId int, request *model.MeetRequest) int {
+		// here we choose the one who didn't interrupt the request
 		if userId == request.RequesterId {
 			env.logger.Infof("chosen requested with id = %d", request.RequestedId)
-			address = request.RequestedId
-		} else {
-			env.logger.Infof("chosen requester with id = %d", request.RequesterId)
-			address = request.RequesterId
+			return request.RequestedId
 		}
-		// here we extract mail box of the one who didn't interrupt the request
-		return env.getMailBox(address)
+		env.logger.Infof("chosen requester with id = %d", request.RequesterId)
+		return request.RequesterId
 	}
-	return env.dispatchRequest(boxFunc, boxExtractFunc, rightsCheckFunc, requestId, userId)
+	return env.dispatchRequest(boxFunc, addresseeFunc, rightsCheckFunc, requestId, userId, model.StatusInterrupted)
 }
 
 func (env *Env) handleRequestPending(requestId int, userId int) (int, error) {
-	var boxFunc = func(box MailBox, request *model.MeetRequest) (int, error) {
-		env.logger.Logger.Infof("add pending request to mail box")
-		box.AddPending(request)
-		return http.StatusOK, nil
-	}
 	var rightsCheckFunc = func(request *model.MeetRequest, userId int) bool {
 		env.logger.Logger.Infof(
 			"check pending request to add to mailbox: requester_id (%d) == userId (%d): %v",
@@ -323,20 +411,25 @@ func (env *Env) handleRequestPending(requestId int, userId int) (int, error) {
 		)
 		return request.RequesterId == userId
 	}
-	var boxExtractFunc = func(userId int, request *model.MeetRequest) (MailBox, error) {
-		// here we extract requested's mail box cos the one whom the request was addressed should be
+	var addresseeFunc = func(userId int, request *model.MeetRequest) int {
+		// here we choose requested cos the one whom the request was addressed should be
 		// informed about new request
-		return env.getMailBox(request.RequestedId)
+		return request.RequestedId
 	}
-	return env.dispatchRequest(boxFunc, boxExtractFunc, rightsCheckFunc, requestId, userId)
+	return env.dispatchRequest(nil, addresseeFunc, rightsCheckFunc, requestId, userId, model.StatusPending)
 }
 
+// dispatchRequest saves an event with given status for the addressee of the
+// request, wakes up their polling and sends a push notification to their devices
+// in case the app is in background. boxFunc, if not nil, is checked against
+// the addressee's mail box before the event is saved.
 func (env *Env) dispatchRequest(
-	boxFunc func(MailBox, *model.MeetRequest) (int, error),
-	boxExtractFunc func(userId int, request *model.MeetRequest) (MailBox, error),
+	boxFunc func(MailBox) (int, error),
+	addresseeFunc func(userId int, request *model.MeetRequest) int,
 	rightsCheckFunc func(request *model.MeetRequest, userId int) bool,
 	requestId int,
 	userId int,
+	status string,
 ) (int, error) {
 	env.logger.Logger.Infof("entered dispatchRequest")
 
@@ -351,16 +444,57 @@ func (env *Env) dispatchRequest(
 		return http.StatusNotFound, errors.New(requestNotFound)
 	}
 
-	var box, boxErr = boxExtractFunc(userId, request)
+	var addressee = addresseeFunc(userId, request)
+	var box, boxErr = env.getMailBox(addressee)
 	if boxErr != nil {
-		env.logger.Logger.Errorf(
-			"mail box for request with %d => %d not found",
-			request.RequesterId,
-			request.RequesterId,
-		)
+		env.logger.Logger.Errorf("mail box of user %d not found", addressee)
 		return http.StatusInternalServerError, boxErr
 	}
-	return boxFunc(box, request)
+	if boxFunc != nil {
+		if code, err := boxFunc(box); err != nil {
+			return code, err
+		}
+	}
+
+	if _, err := env.eventDAO.AddEvent(addressee, request.Id, status); err != nil {
+		env.logger.Errorf("failed to save event of request %d for user %d", request.Id, addressee)
+		return http.StatusInternalServerError, err
+	}
+	env.wake(addressee)
+	env.pusher.Notify(addressee, requestMessage(request, addressee, status))
+
+	var changed = *request
+	changed.Status = status
+	env.emitWebhook(webhook.RequestEventType(status), &changed)
+	return http.StatusOK, nil
+}
+
+// requestMessage describes the change of the request for its addressee.
+// The app may render the message itself from the data.
+func requestMessage(request *model.MeetRequest, addressee int, status string) push.Message {
+	var other = request.RequesterLogin
+	if addressee == request.RequesterId {
+		other = request.RequestedLogin
+	}
+
+	var msg = push.Message{
+		Data: map[string]string{
+			pushTypeStr:      pushTypeRequest,
+			pushRequestIdStr: strconv.Itoa(request.Id),
+			pushStatusStr:    status,
+		},
+	}
+	switch status {
+	case model.StatusPending:
+		msg.Title, msg.Body = "New meet request", fmt.Sprintf("%s wants to meet you", other)
+	case model.StatusAccepted:
+		msg.Title, msg.Body = "Request accepted", fmt.Sprintf("%s accepted your request", other)
+	case model.StatusDeclined:
+		msg.Title, msg.Body = "Request declined", fmt.Sprintf("%s declined your request", other)
+	case model.StatusInterrupted:
+		msg.Title, msg.Body = "Meeting cancelled", fmt.Sprintf("%s cancelled the meeting", other)
+	}
+	return msg
 }
 
 func (env *Env) getMailBox(id int) (MailBox, error) {
@@ -377,6 +511,74 @@ func (env *Env) getMailBox(id int) (MailBox, error) {
 	return casted, nil
 }
 
+// wake tells pollers of the user on all instances that new events are saved.
+// If the notifier fails, at least pollers of this instance are woken up.
+func (env *Env) wake(userId int) {
+	if err := env.notifier.Publish(userId); err != nil {
+		env.logger.Errorf("failed to publish wake up of user %d: %s", userId, err.Error())
+		env.wakeLocal(userId)
+	}
+}
+
+// wakeLocal wakes up pollers of the user on this instance. It is the handler
+// of the notifier. Boxes are not created here: a user without a box on this
+// instance is not waiting here.
+func (env *Env) wakeLocal(userId int) {
+	if userId == notify.AllUsers {
+		for _, item := range env.meetRequestCache.Items() {
+			if box, ok := item.Object.(MailBox); ok {
+				box.Notify()
+			}
+		}
+		return
+	}
+
+	if item, found := env.meetRequestCache.Get(strconv.Itoa(userId)); found {
+		if box, ok := item.(MailBox); ok {
+			box.Notify()
+		}
+	}
+}
+
+// parseEventPage reads since and limit query parameters. Since defaults to 0,
+// so that all undelivered events are returned, limit is capped with maxEventLimit.
+func parseEventPage(r *http.Request) (int64, int, error) {
+	var since int64
+	if value := r.URL.Query().Get(sinceStr); value != "" {
+		var err error
+		if since, err = strconv.ParseInt(value, 10, 64); err != nil || since < 0 {
+			return 0, 0, errors.New(invalidSince)
+		}
+	}
+
+	var limit, limitErr = getQueryInt(r, limitStr, maxEventLimit)
+	if limitErr != nil {
+		return 0, 0, limitErr
+	}
+	if limit == 0 || limit > maxEventLimit {
+		limit = maxEventLimit
+	}
+	return since, limit, nil
+}
+
+func parseEventAck(r *http.Request) (*model.EventAck, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var ack = new(model.EventAck)
+	if err := json.Unmarshal(body, ack); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return ack, http.StatusOK, nil
+}
+
 func parseRequestUpdate(r *http.Request) (*model.MeetRequestUpdate, int, error) {
 	var body, err = ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -422,6 +624,8 @@ func requestCreationError(code int) error {
 		return fmt.Errorf("request already exists")
 	case dao.UserInaccessible:
 		return fmt.Errorf("user inaccessible")
+	case dao.UserBlocked:
+		return fmt.Errorf("user blocked")
 	default:
 		return fmt.Errorf("unknown error with code %d", code)
 	}
@@ -433,6 +637,8 @@ func requestCreationCode(code int) int {
 		return http.StatusConflict
 	case dao.UserInaccessible:
 		return http.StatusFailedDependency
+	case dao.UserBlocked:
+		return http.StatusForbidden
 	default:
 		return http.StatusForbidden
 	}
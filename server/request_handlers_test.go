@@ -6,6 +6,8 @@ import (
 	"github.com/Sovianum/acquaintance-server/config"
 	"github.com/Sovianum/acquaintance-server/model"
 	"github.com/Sovianum/acquaintance-server/mylog"
+	"github.com/Sovianum/acquaintance-server/notify"
+	"github.com/Sovianum/acquaintance-server/push"
 	"github.com/Sovianum/acquaintance-server/server/mocks"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/patrickmn/go-cache"
@@ -29,16 +31,22 @@ func TestEnv_CreateRequest_Success(t *testing.T) {
 
 	var env = &Env{
 		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
 		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
 		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
 		logger:           mylog.NewLogger(ioutil.Discard),
 	}
-	var tokenStr, _ = env.generateTokenString(mocks.RequesterId, "login")
+	var tokenStr, _ = env.generateTokenString(mocks.RequesterId, "login", mocks.SessionId)
 
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.CreateRequest,
+		env.withAuth(env.CreateRequest),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -51,6 +59,8 @@ func TestEnv_CreateRequest_Success(t *testing.T) {
 func TestEnv_CreateRequest_NoIdInToken(t *testing.T) {
 	var env = &Env{
 		conf:           getTotalConf(),
+		sessionDAO:     &mocks.SessionDAOMockActive{},
+		keySet:         getKeySet(),
 		meetRequestDAO: &mocks.MeetRequestDAOMockSuccess{},
 		logger:         mylog.NewLogger(ioutil.Discard),
 	}
@@ -59,31 +69,31 @@ func TestEnv_CreateRequest_NoIdInToken(t *testing.T) {
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.CreateRequest,
+		env.withAuth(env.CreateRequest),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
 	)
 
 	assert.Nil(t, recErr)
-	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 }
 
 func TestEnv_CreateRequest_BadToken(t *testing.T) {
-	var env = &Env{conf: getTotalConf(), meetRequestDAO: &mocks.MeetRequestDAOMockSuccess{}, logger: mylog.NewLogger(ioutil.Discard)}
+	var env = &Env{conf: getTotalConf(), sessionDAO: &mocks.SessionDAOMockActive{}, keySet: getKeySet(), meetRequestDAO: &mocks.MeetRequestDAOMockSuccess{}, logger: mylog.NewLogger(ioutil.Discard)}
 	var tokenStr = "Bad token"
 
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.CreateRequest,
+		env.withAuth(env.CreateRequest),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
 	)
 
 	assert.Nil(t, recErr)
-	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 }
 
 func TestEnv_CreateRequest_Conflict(t *testing.T) {
@@ -93,16 +103,18 @@ func TestEnv_CreateRequest_Conflict(t *testing.T) {
 
 	var env = &Env{
 		conf:           getTotalConf(),
+		sessionDAO:     &mocks.SessionDAOMockActive{},
+		keySet:         getKeySet(),
 		meetRequestDAO: &mocks.MeetRequestDAOMockCreateConflict{},
 		logger:         mylog.NewLogger(ioutil.Discard),
 	}
 
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.CreateRequest,
+		env.withAuth(env.CreateRequest),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -119,16 +131,18 @@ func TestEnv_CreateRequest_Error(t *testing.T) {
 
 	var env = &Env{
 		conf:           getTotalConf(),
+		sessionDAO:     &mocks.SessionDAOMockActive{},
+		keySet:         getKeySet(),
 		meetRequestDAO: &mocks.MeetRequestDAOMockCreateError{},
 		logger:         mylog.NewLogger(ioutil.Discard),
 	}
 
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.CreateRequest,
+		env.withAuth(env.CreateRequest),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -139,13 +153,13 @@ func TestEnv_CreateRequest_Error(t *testing.T) {
 }
 
 func TestEnv_GetRequests_Success(t *testing.T) {
-	var env = &Env{conf: getTotalConf(), meetRequestDAO: &mocks.MeetRequestDAOMockSuccess{}, logger: mylog.NewLogger(ioutil.Discard)}
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var env = &Env{conf: getTotalConf(), sessionDAO: &mocks.SessionDAOMockActive{}, keySet: getKeySet(), meetRequestDAO: &mocks.MeetRequestDAOMockSuccess{}, logger: mylog.NewLogger(ioutil.Discard)}
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodGet,
-		env.GetRequests,
+		env.withAuth(env.GetRequests),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -166,13 +180,13 @@ func TestEnv_GetRequests_Success(t *testing.T) {
 }
 
 func TestEnv_GetRequests_Empty(t *testing.T) {
-	var env = &Env{conf: getTotalConf(), meetRequestDAO: &mocks.MeetRequestDAOMockGetRequestsEmpty{}, logger: mylog.NewLogger(ioutil.Discard)}
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var env = &Env{conf: getTotalConf(), sessionDAO: &mocks.SessionDAOMockActive{}, keySet: getKeySet(), meetRequestDAO: &mocks.MeetRequestDAOMockGetRequestsEmpty{}, logger: mylog.NewLogger(ioutil.Discard)}
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodGet,
-		env.GetRequests,
+		env.withAuth(env.GetRequests),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -193,47 +207,47 @@ func TestEnv_GetRequests_Empty(t *testing.T) {
 }
 
 func TestEnv_GetRequests_NoIdInToken(t *testing.T) {
-	var env = &Env{conf: getTotalConf(), meetRequestDAO: &mocks.MeetRequestDAOMockSuccess{}, logger: mylog.NewLogger(ioutil.Discard)}
+	var env = &Env{conf: getTotalConf(), sessionDAO: &mocks.SessionDAOMockActive{}, keySet: getKeySet(), meetRequestDAO: &mocks.MeetRequestDAOMockSuccess{}, logger: mylog.NewLogger(ioutil.Discard)}
 	var tokenStr, _ = getIncompleteToken(env)
 
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodGet,
-		env.GetRequests,
+		env.withAuth(env.GetRequests),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
 	)
 
 	assert.Nil(t, recErr)
-	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 }
 
 func TestEnv_GetRequests_BadToken(t *testing.T) {
-	var env = &Env{conf: getTotalConf(), meetRequestDAO: &mocks.MeetRequestDAOMockSuccess{}, logger: mylog.NewLogger(ioutil.Discard)}
+	var env = &Env{conf: getTotalConf(), sessionDAO: &mocks.SessionDAOMockActive{}, keySet: getKeySet(), meetRequestDAO: &mocks.MeetRequestDAOMockSuccess{}, logger: mylog.NewLogger(ioutil.Discard)}
 	var tokenStr = "Bad token"
 
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodGet,
-		env.GetRequests,
+		env.withAuth(env.GetRequests),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
 	)
 
 	assert.Nil(t, recErr)
-	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 }
 
 func TestEnv_GetRequests_Error(t *testing.T) {
-	var env = &Env{conf: getTotalConf(), meetRequestDAO: &mocks.MeetRequestDAOMockGetRequestsError{}, logger: mylog.NewLogger(ioutil.Discard)}
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var env = &Env{conf: getTotalConf(), sessionDAO: &mocks.SessionDAOMockActive{}, keySet: getKeySet(), meetRequestDAO: &mocks.MeetRequestDAOMockGetRequestsError{}, logger: mylog.NewLogger(ioutil.Discard)}
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodGet,
-		env.GetRequests,
+		env.withAuth(env.GetRequests),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -244,47 +258,53 @@ func TestEnv_GetRequests_Error(t *testing.T) {
 }
 
 func TestEnv_UpdateRequest_NoIdInToken(t *testing.T) {
-	var env = &Env{conf: getTotalConf(), meetRequestDAO: &mocks.MeetRequestDAOMockSuccess{}, logger: mylog.NewLogger(ioutil.Discard)}
+	var env = &Env{conf: getTotalConf(), sessionDAO: &mocks.SessionDAOMockActive{}, keySet: getKeySet(), meetRequestDAO: &mocks.MeetRequestDAOMockSuccess{}, logger: mylog.NewLogger(ioutil.Discard)}
 	var tokenStr, _ = getIncompleteToken(env)
 
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.UpdateRequest,
+		env.withAuth(env.UpdateRequest),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
 	)
 
 	assert.Nil(t, recErr)
-	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 }
 
 func TestEnv_UpdateRequest_BadToken(t *testing.T) {
-	var env = &Env{conf: getTotalConf(), meetRequestDAO: &mocks.MeetRequestDAOMockSuccess{}, logger: mylog.NewLogger(ioutil.Discard)}
+	var env = &Env{conf: getTotalConf(), sessionDAO: &mocks.SessionDAOMockActive{}, keySet: getKeySet(), meetRequestDAO: &mocks.MeetRequestDAOMockSuccess{}, logger: mylog.NewLogger(ioutil.Discard)}
 	var tokenStr = "bad string"
 
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.UpdateRequest,
+		env.withAuth(env.UpdateRequest),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
 	)
 
 	assert.Nil(t, recErr)
-	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 }
 
 func TestEnv_UpdateRequest_NoRequest(t *testing.T) {
 	var env = &Env{
 		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
 		meetRequestDAO:   &mocks.MeetRequestDAOMockUpdateNoRequest{},
 		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
 		logger:           mylog.NewLogger(ioutil.Discard),
 	}
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 
 	var update = model.MeetRequestUpdate{Id: 1, Status: model.StatusAccepted}
 	var requestMsg, err = json.Marshal(update)
@@ -293,7 +313,7 @@ func TestEnv_UpdateRequest_NoRequest(t *testing.T) {
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.UpdateRequest,
+		env.withAuth(env.UpdateRequest),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -304,8 +324,8 @@ func TestEnv_UpdateRequest_NoRequest(t *testing.T) {
 }
 
 func TestEnv_UpdateRequest_BadStatus(t *testing.T) {
-	var env = &Env{conf: getTotalConf(), meetRequestDAO: &mocks.MeetRequestDAOMockUpdateNoRequest{}, logger: mylog.NewLogger(ioutil.Discard)}
-	var tokenStr, _ = env.generateTokenString(1, "login")
+	var env = &Env{conf: getTotalConf(), sessionDAO: &mocks.SessionDAOMockActive{}, keySet: getKeySet(), meetRequestDAO: &mocks.MeetRequestDAOMockUpdateNoRequest{}, logger: mylog.NewLogger(ioutil.Discard)}
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
 
 	var update = model.MeetRequestUpdate{Id: 1, Status: "BAD"}
 	var requestMsg, err = json.Marshal(update)
@@ -314,7 +334,7 @@ func TestEnv_UpdateRequest_BadStatus(t *testing.T) {
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.UpdateRequest,
+		env.withAuth(env.UpdateRequest),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -327,11 +347,17 @@ func TestEnv_UpdateRequest_BadStatus(t *testing.T) {
 func TestEnv_UpdateRequest_AcceptSuccess(t *testing.T) {
 	var env = &Env{
 		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
 		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
 		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
 		logger:           mylog.NewLogger(ioutil.Discard),
 	}
-	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login")
+	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
 
 	var update = model.MeetRequestUpdate{Id: mocks.RequestedId, Status: model.StatusAccepted}
 	var requestMsg, err = json.Marshal(update)
@@ -340,7 +366,7 @@ func TestEnv_UpdateRequest_AcceptSuccess(t *testing.T) {
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.UpdateRequest,
+		env.withAuth(env.UpdateRequest),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -357,7 +383,7 @@ func TestEnv_UpdateRequest_AcceptSuccess(t *testing.T) {
 //		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
 //		logger:           mylog.NewLogger(ioutil.Discard),
 //	}
-//	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login")
+//	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
 //
 //	var update = model.MeetRequestUpdate{Id: mocks.RequestedId, Status: model.StatusAccepted}
 //	var requestMsg, err = json.Marshal(update)
@@ -379,14 +405,20 @@ func TestEnv_UpdateRequest_AcceptSuccess(t *testing.T) {
 func TestEnv_UpdateRequest_AcceptLocked(t *testing.T) {
 	var env = &Env{
 		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
 		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
 		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
 		logger:           mylog.NewLogger(ioutil.Discard),
 	}
 	var request, _ = env.meetRequestDAO.GetRequestById(1)
 	env.handleRequestAccept(request.Id, request.RequestedId)
 
-	var tokenStr, _ = env.generateTokenString(request.RequestedId, "login")
+	var tokenStr, _ = env.generateTokenString(request.RequestedId, "login", mocks.SessionId)
 
 	var update = model.MeetRequestUpdate{Id: request.RequestedId, Status: model.StatusAccepted}
 	var requestMsg, err = json.Marshal(update)
@@ -395,7 +427,7 @@ func TestEnv_UpdateRequest_AcceptLocked(t *testing.T) {
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.UpdateRequest,
+		env.withAuth(env.UpdateRequest),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -408,11 +440,17 @@ func TestEnv_UpdateRequest_AcceptLocked(t *testing.T) {
 func TestEnv_UpdateRequest_DeclineSuccess(t *testing.T) {
 	var env = &Env{
 		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
 		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
 		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
 		logger:           mylog.NewLogger(ioutil.Discard),
 	}
-	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login")
+	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
 
 	var update = model.MeetRequestUpdate{Id: mocks.RequestedId, Status: model.StatusDeclined}
 	var requestMsg, err = json.Marshal(update)
@@ -421,7 +459,7 @@ func TestEnv_UpdateRequest_DeclineSuccess(t *testing.T) {
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.UpdateRequest,
+		env.withAuth(env.UpdateRequest),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -434,11 +472,17 @@ func TestEnv_UpdateRequest_DeclineSuccess(t *testing.T) {
 func TestEnv_UpdateRequest_Error(t *testing.T) {
 	var env = &Env{
 		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
 		meetRequestDAO:   &mocks.MeetRequestDAOMockUpdateError{},
 		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
 		logger:           mylog.NewLogger(ioutil.Discard),
 	}
-	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login")
+	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
 
 	var update = model.MeetRequestUpdate{Id: 1, Status: model.StatusAccepted}
 	var requestMsg, err = json.Marshal(update)
@@ -447,7 +491,7 @@ func TestEnv_UpdateRequest_Error(t *testing.T) {
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodPost,
-		env.UpdateRequest,
+		env.withAuth(env.UpdateRequest),
 		strings.NewReader(string(requestMsg)),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -460,19 +504,26 @@ func TestEnv_UpdateRequest_Error(t *testing.T) {
 func TestEnv_GetNewRequests_Success(t *testing.T) {
 	var env = &Env{
 		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
 		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
 		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
 		logger:           mylog.NewLogger(ioutil.Discard),
 	}
-	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login")
+	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
 
 	env.handleRequestPending(10, mocks.RequesterId)
 	env.handleRequestPending(20, mocks.RequesterId)
+	env.handleRequestPending(10, mocks.RequesterId)
 
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodGet,
-		env.GetNewRequestsEvents,
+		env.withAuth(env.GetNewRequestsEvents),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -486,16 +537,238 @@ func TestEnv_GetNewRequests_Success(t *testing.T) {
 
 	assert.Nil(t, jsonErr)
 	assert.Equal(t, 2, len(gotRequests["data"]))
-	for _, request := range gotRequests["data"] {
-		request.Status = model.StatusPending
+	assert.Equal(t, 10, gotRequests["data"][0].Id)
+	assert.Equal(t, model.StatusPending, gotRequests["data"][0].Status)
+	assert.Equal(t, 20, gotRequests["data"][1].Id)
+
+	// delivered events are acked at once
+	var left, _ = env.eventDAO.GetEvents(mocks.RequestedId, 0, maxEventLimit)
+	assert.Equal(t, 0, len(left))
+}
+
+func TestEnv_EventsGet_Success(t *testing.T) {
+	var env = &Env{
+		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
+		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
+		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
+		logger:           mylog.NewLogger(ioutil.Discard),
+	}
+	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
+
+	env.handleRequestPending(10, mocks.RequesterId)
+	env.handleRequestPending(20, mocks.RequesterId)
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodGet,
+		env.withAuth(env.EventsGet),
+		strings.NewReader(""),
+		headerPair{"Content-Type", "application/json"},
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var gotEvents = make(map[string][]*model.Event)
+	var jsonErr = json.Unmarshal(rec.Body.Bytes(), &gotEvents)
+
+	assert.Nil(t, jsonErr)
+	assert.Equal(t, 2, len(gotEvents["data"]))
+	assert.Equal(t, 10, gotEvents["data"][0].Request.Id)
+	assert.Equal(t, model.StatusPending, gotEvents["data"][0].Request.Status)
+	assert.Equal(t, 20, gotEvents["data"][1].Request.Id)
+	assert.True(t, gotEvents["data"][0].Id < gotEvents["data"][1].Id)
+}
+
+func TestEnv_EventsGet_Since(t *testing.T) {
+	var env = &Env{
+		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
+		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
+		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
+		logger:           mylog.NewLogger(ioutil.Discard),
+	}
+	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
+
+	env.handleRequestPending(10, mocks.RequesterId)
+	env.handleRequestPending(20, mocks.RequesterId)
+	var events, _ = env.eventDAO.GetEvents(mocks.RequestedId, 0, maxEventLimit)
+
+	var rec, recErr = getRecorder(
+		fmt.Sprintf("%s?since=%d", urlSample, events[0].Id),
+		http.MethodGet,
+		env.withAuth(env.EventsGet),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var gotEvents = make(map[string][]*model.Event)
+	var jsonErr = json.Unmarshal(rec.Body.Bytes(), &gotEvents)
+
+	assert.Nil(t, jsonErr)
+	assert.Equal(t, 1, len(gotEvents["data"]))
+	assert.Equal(t, events[1].Id, gotEvents["data"][0].Id)
+}
+
+func TestEnv_EventsGet_BadSince(t *testing.T) {
+	var env = &Env{
+		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
+		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
+		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
+		logger:           mylog.NewLogger(ioutil.Discard),
 	}
+	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
+
+	var rec, recErr = getRecorder(
+		urlSample+"?since=-1",
+		http.MethodGet,
+		env.withAuth(env.EventsGet),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestEnv_GetNewRequests_WakeUp(t *testing.T) {
+	var conf = getTotalConf()
+	conf.Logic.PollSeconds = 5
+	var env = &Env{
+		conf:             conf,
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
+		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
+		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
+		logger:           mylog.NewLogger(ioutil.Discard),
+	}
+	env.notifier.Listen(env.wakeLocal)
+	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		env.handleRequestPending(10, mocks.RequesterId)
+	}()
+
+	var start = time.Now()
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodGet,
+		env.withAuth(env.GetNewRequestsEvents),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, time.Since(start) < time.Second*time.Duration(conf.Logic.PollSeconds))
+
+	var gotRequests = make(map[string][]*model.MeetRequest)
+	var jsonErr = json.Unmarshal(rec.Body.Bytes(), &gotRequests)
+
+	assert.Nil(t, jsonErr)
+	assert.Equal(t, 1, len(gotRequests["data"]))
+}
+
+func TestEnv_EventsAckPost_Success(t *testing.T) {
+	var env = &Env{
+		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
+		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
+		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
+		logger:           mylog.NewLogger(ioutil.Discard),
+	}
+	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
+
+	env.handleRequestPending(10, mocks.RequesterId)
+	env.handleRequestPending(20, mocks.RequesterId)
+	var events, _ = env.eventDAO.GetEvents(mocks.RequestedId, 0, maxEventLimit)
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.EventsAckPost),
+		strings.NewReader(fmt.Sprintf(`{"id": %d}`, events[0].Id)),
+		headerPair{"Content-Type", "application/json"},
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var left, _ = env.eventDAO.GetEvents(mocks.RequestedId, 0, maxEventLimit)
+	assert.Equal(t, 1, len(left))
+	assert.Equal(t, events[1].Id, left[0].Id)
+}
+
+func TestEnv_EventsAckPost_BadBody(t *testing.T) {
+	var env = &Env{
+		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
+		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
+		logger:           mylog.NewLogger(ioutil.Discard),
+	}
+	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.EventsAckPost),
+		strings.NewReader(`{"id": 0}`),
+		headerPair{"Content-Type", "application/json"},
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
 
 func TestEnv_GetNewRequests_NoIdInToken(t *testing.T) {
 	var env = &Env{
 		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
 		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
 		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
 		logger:           mylog.NewLogger(ioutil.Discard),
 	}
 	var tokenStr, _ = getIncompleteToken(env)
@@ -503,21 +776,27 @@ func TestEnv_GetNewRequests_NoIdInToken(t *testing.T) {
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodGet,
-		env.GetNewRequestsEvents,
+		env.withAuth(env.GetNewRequestsEvents),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
 	)
 
 	assert.Nil(t, recErr)
-	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 }
 
 func TestEnv_GetNewRequests_BadToken(t *testing.T) {
 	var env = &Env{
 		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
 		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
 		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
 		logger:           mylog.NewLogger(ioutil.Discard),
 	}
 	var tokenStr = "Bad token"
@@ -525,29 +804,35 @@ func TestEnv_GetNewRequests_BadToken(t *testing.T) {
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodGet,
-		env.GetNewRequestsEvents,
+		env.withAuth(env.GetNewRequestsEvents),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
 	)
 
 	assert.Nil(t, recErr)
-	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 }
 
 func TestEnv_GetNewRequests_Empty(t *testing.T) {
 	var env = &Env{
 		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
 		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
 		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
 		logger:           mylog.NewLogger(ioutil.Discard),
 	}
-	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login")
+	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
 
 	var rec, recErr = getRecorder(
 		urlSample,
 		http.MethodGet,
-		env.GetNewRequestsEvents,
+		env.withAuth(env.GetNewRequestsEvents),
 		strings.NewReader(""),
 		headerPair{"Content-Type", "application/json"},
 		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
@@ -586,3 +871,122 @@ func getTotalConf() config.Conf {
 		},
 	}
 }
+
+func TestEnv_Wake_OtherInstance(t *testing.T) {
+	var bus = mocks.NewNotifierBus()
+	var eventDAO = mocks.NewEventDAOMock()
+	var instanceEnv = func() *Env {
+		var env = &Env{
+			conf:             getTotalConf(),
+			sessionDAO:       &mocks.SessionDAOMockActive{},
+			keySet:           getKeySet(),
+			meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
+			meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+			eventDAO:         eventDAO,
+			notifier:         bus.Notifier(),
+			pusher:           push.NewMemoryNotifier(),
+			webhookDAO:       mocks.NewWebhookDAOMock(),
+			logger:           mylog.NewLogger(ioutil.Discard),
+		}
+		env.notifier.Listen(env.wakeLocal)
+		return env
+	}
+	var envA = instanceEnv()
+	var envB = instanceEnv()
+
+	// requested user polls instance B, the request is created on instance A
+	var box, _ = envB.getMailBox(mocks.RequestedId)
+	envA.handleRequestPending(10, mocks.RequesterId)
+
+	assert.True(t, box.Wait(0))
+}
+
+func TestEnv_Wake_PublishError(t *testing.T) {
+	var env = &Env{
+		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
+		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         &mocks.NotifierMockError{},
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
+		logger:           mylog.NewLogger(ioutil.Discard),
+	}
+
+	// pollers of this instance are woken up anyway
+	var box, _ = env.getMailBox(mocks.RequestedId)
+	env.handleRequestPending(10, mocks.RequesterId)
+
+	assert.True(t, box.Wait(0))
+}
+
+func TestEnv_DispatchRequest_Push(t *testing.T) {
+	var pusher = push.NewMemoryNotifier()
+	var env = &Env{
+		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
+		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           pusher,
+		webhookDAO:       mocks.NewWebhookDAOMock(),
+		logger:           mylog.NewLogger(ioutil.Discard),
+	}
+
+	env.handleRequestPending(10, mocks.RequesterId)
+	env.handleRequestAccept(10, mocks.RequestedId)
+	// nobody is notified about a request of others
+	env.handleRequestDecline(10, mocks.RequesterId)
+
+	var notifications = pusher.Notifications()
+	assert.Equal(t, 2, len(notifications))
+	assert.Equal(t, mocks.RequestedId, notifications[0].UserId)
+	assert.Equal(t, model.StatusPending, notifications[0].Message.Data[pushStatusStr])
+	assert.Equal(t, mocks.RequesterId, notifications[1].UserId)
+	assert.Equal(t, model.StatusAccepted, notifications[1].Message.Data[pushStatusStr])
+	assert.Equal(t, "10", notifications[1].Message.Data[pushRequestIdStr])
+}
+
+func TestRequestMessage(t *testing.T) {
+	var request = &model.MeetRequest{
+		Id:             10,
+		RequesterId:    mocks.RequesterId,
+		RequesterLogin: "alice",
+		RequestedId:    mocks.RequestedId,
+		RequestedLogin: "bob",
+	}
+
+	var testData = []struct {
+		addressee int
+		status    string
+		body      string
+	}{
+		{mocks.RequestedId, model.StatusPending, "alice wants to meet you"},
+		{mocks.RequesterId, model.StatusAccepted, "bob accepted your request"},
+		{mocks.RequesterId, model.StatusDeclined, "bob declined your request"},
+		{mocks.RequestedId, model.StatusInterrupted, "alice cancelled the meeting"},
+		{mocks.RequesterId, model.StatusInterrupted, "bob cancelled the meeting"},
+	}
+
+	for i, item := range testData {
+		var msg = requestMessage(request, item.addressee, item.status)
+		assert.Equal(t, item.body, msg.Body, i)
+		assert.Equal(t, map[string]string{
+			pushTypeStr:      pushTypeRequest,
+			pushRequestIdStr: "10",
+			pushStatusStr:    item.status,
+		}, msg.Data, i)
+	}
+}
+
+func TestEnv_WakeLocal_AllUsers(t *testing.T) {
+	var env = &Env{
+		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		logger:           mylog.NewLogger(ioutil.Discard),
+	}
+	var box1, _ = env.getMailBox(1)
+	var box2, _ = env.getMailBox(2)
+
+	env.wakeLocal(notify.AllUsers)
+
+	assert.True(t, box1.Wait(0))
+	assert.True(t, box2.Wait(0))
+}
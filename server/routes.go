@@ -1,24 +1,81 @@
 package server
 
 import (
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/storage"
 	"github.com/gorilla/mux"
 	"net/http"
+	"strings"
 )
 
 func GetRouter(env *Env) *mux.Router {
 	var router = mux.NewRouter()
 	router.HandleFunc("/api/v1/auth/register", env.UserRegisterPost).Methods(http.MethodPost)
 	router.HandleFunc("/api/v1/auth/login", env.UserSignInPost).Methods(http.MethodPost)
-	router.HandleFunc("/api/v1/user/self", env.UserGetSelfInfo).Methods(http.MethodGet)
-	router.HandleFunc("/api/v1/user/position/neighbours", env.UserGetNeighboursGet).Methods(http.MethodGet)
-	router.HandleFunc("/api/v1/user/position/save", env.UserSavePositionPost).Methods(http.MethodPost)
-	router.HandleFunc("/api/v1/user/position/neighbour/{id}", env.UserGetPositionById).Methods(http.MethodGet)
-	router.HandleFunc("/api/v1/user/request/create", env.CreateRequest).Methods(http.MethodPost)
-	router.HandleFunc("/api/v1/user/request/all", env.GetRequests).Methods(http.MethodGet)
-	router.HandleFunc("/api/v1/user/request/income/pending", env.GetIncomePendingRequests).Methods(http.MethodGet)
-	router.HandleFunc("/api/v1/user/request/outcome/pending", env.GetOutcomePendingRequests).Methods(http.MethodGet)
-	router.HandleFunc("/api/v1/user/request/update", env.UpdateRequest).Methods(http.MethodPost)
-	router.HandleFunc("/api/v1/user/request/new", env.GetNewRequestsEvents).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/auth/refresh", env.UserRefreshPost).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/auth/logout", env.withAuth(env.UserLogoutPost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/auth/logout/all", env.withAuth(env.UserLogoutAllPost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/auth/password/change", env.withAuth(env.UserPasswordChangePost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/auth/password/reset", env.UserPasswordResetPost).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/auth/password/reset/confirm", env.UserPasswordResetConfirmPost).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/auth/2fa/enroll", env.withAuth(env.TwoFactorEnrollPost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/auth/2fa/confirm", env.withAuth(env.TwoFactorConfirmPost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/auth/2fa/disable", env.withAuth(env.TwoFactorDisablePost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/auth/2fa/verify", env.TwoFactorVerifyPost).Methods(http.MethodPost)
+	router.HandleFunc("/.well-known/jwks.json", env.JWKSGet).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/self", env.withAuth(env.UserGetSelfInfo)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/self", env.withAuth(env.UserUpdateSelfPatch)).Methods(http.MethodPatch)
+	router.HandleFunc("/api/v1/user/self", env.withAuth(env.UserDeleteSelf)).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v1/user/self/photo", env.withAuth(env.UserPhotoPost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/user/self/photo", env.withAuth(env.UserPhotoDelete)).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v1/user/self/interests", env.withAuth(env.UserInterestsGet)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/self/interests", env.withAuth(env.UserInterestsPut)).Methods(http.MethodPut)
+	router.HandleFunc("/api/v1/user/self/interests", env.withAuth(env.UserInterestPost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/user/self/interests/{name}", env.withAuth(env.UserInterestDelete)).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v1/user/self/export", env.withAuth(env.UserExportSelfGet)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/self/devices", env.withAuth(env.UserDevicePost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/user/self/devices/{token}", env.withAuth(env.UserDeviceDelete)).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v1/user/self/privacy", env.withAuth(env.UserPrivacyGet)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/self/privacy", env.withAuth(env.UserPrivacyPut)).Methods(http.MethodPut)
+	router.HandleFunc("/api/v1/user/block", env.withAuth(env.UserBlockListGet)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/block/{id}", env.withAuth(env.UserBlockPost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/user/block/{id}", env.withAuth(env.UserUnblockDelete)).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v1/user/report", env.withAuth(env.UserReportPost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/user/position/neighbours", env.withAuth(env.UserGetNeighboursGet)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/position/save", env.withAuth(env.UserSavePositionPost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/user/position/batch", env.withAuth(env.UserSavePositionBatchPost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/user/position/neighbour/{id}", env.withAuth(env.UserGetPositionById)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/request/create", env.withAuth(env.CreateRequest)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/user/request/all", env.withAuth(env.GetRequests)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/request/income/pending", env.withAuth(env.GetIncomePendingRequests)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/request/outcome/pending", env.withAuth(env.GetOutcomePendingRequests)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/request/update", env.withAuth(env.UpdateRequest)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/user/request/new", env.withAuth(env.GetNewRequestsEvents)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/events", env.withAuth(env.EventsGet)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/events/ack", env.withAuth(env.EventsAckPost)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/user/events/ws", withQueryToken(env.withAuth(env.EventsSocketGet))).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/user/events/stream", withQueryToken(env.withAuth(env.EventsStreamGet))).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/admin/users", env.withAuth(env.AdminUsersGet, model.RoleModerator)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/admin/users/{id}", env.withAuth(env.AdminUserGet, model.RoleModerator)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/admin/users/{id}/requests", env.withAuth(env.AdminUserRequestsGet, model.RoleModerator)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/admin/users/{id}/positions", env.withAuth(env.AdminUserPositionsGet, model.RoleModerator)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/admin/users/{id}/ban", env.withAuth(env.AdminUserBanPost, model.RoleModerator)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/admin/users/{id}/unban", env.withAuth(env.AdminUserUnbanPost, model.RoleModerator)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/admin/users/{id}/logout", env.withAuth(env.AdminUserLogoutPost, model.RoleModerator)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/admin/users/{id}/role", env.withAuth(env.AdminUserRolePut, model.RoleAdmin)).Methods(http.MethodPut)
+	router.HandleFunc("/api/v1/admin/reports", env.withAuth(env.AdminReportsGet, model.RoleModerator)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/admin/reports/{id}/resolve", env.withAuth(env.AdminReportResolvePost, model.RoleModerator)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/admin/webhooks", env.withAuth(env.AdminWebhooksGet, model.RoleAdmin)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/admin/webhooks", env.withAuth(env.AdminWebhookPost, model.RoleAdmin)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/admin/webhooks/deliveries", env.withAuth(env.AdminWebhookDeliveriesGet, model.RoleAdmin)).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/admin/webhooks/deliveries/{id}/replay", env.withAuth(env.AdminWebhookReplayPost, model.RoleAdmin)).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/admin/webhooks/{id}", env.withAuth(env.AdminWebhookDelete, model.RoleAdmin)).Methods(http.MethodDelete)
+
+	// photos in the local storage are served by the app unless they are linked elsewhere
+	if conf := env.conf.Storage; conf.Backend == storage.Local && strings.HasPrefix(conf.GetBaseURL(), "/") {
+		var prefix = conf.GetBaseURL() + "/"
+		router.PathPrefix(prefix).Handler(mediaHandler(prefix, conf.Dir)).Methods(http.MethodGet)
+	}
 
 	return router
 }
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"time"
+)
+
+const (
+	frameEvent  = "event"
+	frameUpdate = "update"
+	frameAck    = "ack"
+	frameError  = "error"
+
+	unknownFrameType = "unknown frame type \"%s\""
+
+	socketWriteWait = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// socketFrame is a message of the event socket. Server sends "event" frames
+// with model.Event data, "update" frames with the updated model.MeetRequest in
+// reply to client "update" frames carrying model.MeetRequestUpdate and "error"
+// frames. Client also sends "ack" frames carrying model.EventAck.
+type socketFrame struct {
+	Type   string      `json:"type"`
+	ErrMsg string      `json:"err_msg,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+type clientFrame struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type eventSocket struct {
+	env       *Env
+	conn      *websocket.Conn
+	box       MailBox
+	principal *Principal
+	userId    int
+	since     int64
+	replies   chan *socketFrame
+}
+
+// EventsSocketGet upgrades the connection to a WebSocket and pushes events of
+// the caller with ids greater than "since" query parameter as they appear.
+// The client may update requests and ack events over the same socket.
+func (env *Env) EventsSocketGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var principal = getPrincipal(r)
+	var userId = principal.UserId
+
+	var since, _, pageErr = parseEventPage(r)
+	if pageErr != nil {
+		env.logger.LogRequestError(r, pageErr)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(pageErr), env.logger)
+		return
+	}
+
+	var box, boxErr = env.getMailBox(userId)
+	if boxErr != nil {
+		env.logger.LogRequestError(r, boxErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(boxErr), env.logger)
+		return
+	}
+
+	var conn, upgradeErr = upgrader.Upgrade(w, r, nil)
+	if upgradeErr != nil {
+		// upgrader has already replied with an error
+		env.logger.LogRequestError(r, upgradeErr)
+		return
+	}
+	defer conn.Close()
+
+	var socket = &eventSocket{
+		env:       env,
+		conn:      conn,
+		box:       box,
+		principal: principal,
+		userId:    userId,
+		since:     since,
+		replies:   make(chan *socketFrame, 1),
+	}
+	var readDone = make(chan struct{})
+	var writeDone = make(chan struct{})
+	go socket.readLoop(readDone, writeDone)
+
+	var err = socket.writeLoop(readDone)
+	close(writeDone)
+	if err != nil {
+		env.logger.LogRequestError(r, err)
+		return
+	}
+	env.logger.LogRequestSuccess(r)
+}
+
+// writeLoop is the only writer of the connection. It returns when the
+// connection breaks, the client closes it or the credentials of the client
+// are no longer valid.
+func (socket *eventSocket) writeLoop(readDone <-chan struct{}) error {
+	var ticker = time.NewTicker(socket.env.conf.Logic.GetPingInterval())
+	defer ticker.Stop()
+
+	if err := socket.pushEvents(); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-socket.box.Signal():
+			if err := socket.pushEvents(); err != nil {
+				return err
+			}
+		case frame := <-socket.replies:
+			if err := socket.write(frame); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			var deadline = time.Now().Add(socketWriteWait)
+			if err := socket.env.checkPrincipal(socket.principal, time.Now()); err != nil {
+				var msg = websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error())
+				socket.conn.WriteControl(websocket.CloseMessage, msg, deadline)
+				return err
+			}
+			// a wake up may have gone to another connection of the user,
+			// so events are checked on each heartbeat as well
+			if err := socket.pushEvents(); err != nil {
+				return err
+			}
+			if err := socket.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return err
+			}
+		case <-readDone:
+			return nil
+		}
+	}
+}
+
+// readLoop handles client frames until the connection breaks or the client
+// misses two heartbeats in a row.
+func (socket *eventSocket) readLoop(done chan<- struct{}, writeDone <-chan struct{}) {
+	defer close(done)
+
+	var readWait = 2 * socket.env.conf.Logic.GetPingInterval()
+	socket.conn.SetReadDeadline(time.Now().Add(readWait))
+	socket.conn.SetPongHandler(func(string) error {
+		return socket.conn.SetReadDeadline(time.Now().Add(readWait))
+	})
+
+	for {
+		var _, data, err = socket.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		socket.conn.SetReadDeadline(time.Now().Add(readWait))
+
+		var reply = socket.handleFrame(data)
+		if reply == nil {
+			continue
+		}
+		select {
+		case socket.replies <- reply:
+		case <-writeDone:
+			return
+		}
+	}
+}
+
+func (socket *eventSocket) handleFrame(data []byte) *socketFrame {
+	var frame clientFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return getErrorFrame(err)
+	}
+
+	switch frame.Type {
+	case frameUpdate:
+		var update = new(model.MeetRequestUpdate)
+		if err := json.Unmarshal(frame.Data, update); err != nil {
+			return getErrorFrame(err)
+		}
+		var request, _, err = socket.env.updateRequest(socket.userId, update)
+		if err != nil {
+			return getErrorFrame(err)
+		}
+		return &socketFrame{Type: frameUpdate, Data: request}
+	case frameAck:
+		var ack = new(model.EventAck)
+		if err := json.Unmarshal(frame.Data, ack); err != nil {
+			return getErrorFrame(err)
+		}
+		if _, err := socket.env.eventDAO.Ack(socket.userId, ack.Id); err != nil {
+			return getErrorFrame(err)
+		}
+		return nil
+	default:
+		return getErrorFrame(fmt.Errorf(unknownFrameType, frame.Type))
+	}
+}
+
+// pushEvents sends all events saved since the last pushed one. Failure to
+// read events is reported to the client without closing the socket.
+func (socket *eventSocket) pushEvents() error {
+	var writeErr error
+	var err = socket.env.sendNewEvents(socket.userId, socket.box, &socket.since, func(event *model.Event) error {
+		writeErr = socket.write(&socketFrame{Type: frameEvent, Data: event})
+		return writeErr
+	})
+	if err != nil && writeErr == nil {
+		return socket.write(getErrorFrame(err))
+	}
+	return err
+}
+
+func (socket *eventSocket) write(frame *socketFrame) error {
+	socket.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	return socket.conn.WriteJSON(frame)
+}
+
+func getErrorFrame(err error) *socketFrame {
+	return &socketFrame{Type: frameError, ErrMsg: err.Error()}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/mylog"
+	"github.com/Sovianum/acquaintance-server/notify"
+	"github.com/Sovianum/acquaintance-server/push"
+	"github.com/Sovianum/acquaintance-server/server/mocks"
+	"github.com/gorilla/websocket"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type eventFrame struct {
+	Type   string       `json:"type"`
+	ErrMsg string       `json:"err_msg"`
+	Data   *model.Event `json:"data"`
+}
+
+type updateFrame struct {
+	Type   string             `json:"type"`
+	ErrMsg string             `json:"err_msg"`
+	Data   *model.MeetRequest `json:"data"`
+}
+
+func TestEnv_EventsSocketGet_Push(t *testing.T) {
+	var env = getEventEnv()
+	var server = httptest.NewServer(GetRouter(env))
+	defer server.Close()
+
+	var conn, resp, err = dialSocket(server, env, mocks.RequestedId, "")
+	if err != nil {
+		t.Fatal(err, resp)
+	}
+	defer conn.Close()
+
+	env.handleRequestPending(10, mocks.RequesterId)
+
+	var frame eventFrame
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.Nil(t, conn.ReadJSON(&frame))
+	assert.Equal(t, frameEvent, frame.Type)
+	assert.Equal(t, 10, frame.Data.Request.Id)
+	assert.Equal(t, model.StatusPending, frame.Data.Request.Status)
+}
+
+func TestEnv_EventsSocketGet_Resume(t *testing.T) {
+	var env = getEventEnv()
+	var server = httptest.NewServer(GetRouter(env))
+	defer server.Close()
+
+	env.handleRequestPending(10, mocks.RequesterId)
+	env.handleRequestPending(20, mocks.RequesterId)
+	var events, _ = env.eventDAO.GetEvents(mocks.RequestedId, 0, maxEventLimit)
+
+	var conn, resp, err = dialSocket(server, env, mocks.RequestedId, fmt.Sprintf("since=%d", events[0].Id))
+	if err != nil {
+		t.Fatal(err, resp)
+	}
+	defer conn.Close()
+
+	var frame eventFrame
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.Nil(t, conn.ReadJSON(&frame))
+	assert.Equal(t, events[1].Id, frame.Data.Id)
+	assert.Equal(t, 20, frame.Data.Request.Id)
+}
+
+func TestEnv_EventsSocketGet_UpdateAndAck(t *testing.T) {
+	var env = getEventEnv()
+	var server = httptest.NewServer(GetRouter(env))
+	defer server.Close()
+
+	var conn, resp, err = dialSocket(server, env, mocks.RequestedId, "")
+	if err != nil {
+		t.Fatal(err, resp)
+	}
+	defer conn.Close()
+
+	var update = fmt.Sprintf(`{"type": "update", "data": {"id": 10, "status": "%s"}}`, model.StatusAccepted)
+	assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte(update)))
+
+	var frame updateFrame
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.Nil(t, conn.ReadJSON(&frame))
+	assert.Equal(t, frameUpdate, frame.Type, frame.ErrMsg)
+	assert.Equal(t, model.StatusAccepted, frame.Data.Status)
+
+	// requester got the accept event
+	var events, _ = env.eventDAO.GetEvents(mocks.RequesterId, 0, maxEventLimit)
+	assert.Equal(t, 1, len(events))
+
+	env.handleRequestPending(20, mocks.RequesterId)
+	var pushed eventFrame
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.Nil(t, conn.ReadJSON(&pushed))
+	assert.Equal(t, frameEvent, pushed.Type)
+
+	// ack is not replied, so the next frame is the error about the unknown type
+	var ack = fmt.Sprintf(`{"type": "ack", "data": {"id": %d}}`, pushed.Data.Id)
+	assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte(ack)))
+	assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "unknown"}`)))
+
+	var errFrame eventFrame
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.Nil(t, conn.ReadJSON(&errFrame))
+	assert.Equal(t, frameError, errFrame.Type)
+	assert.Equal(t, fmt.Sprintf(unknownFrameType, "unknown"), errFrame.ErrMsg)
+
+	var left, _ = env.eventDAO.GetEvents(mocks.RequestedId, 0, maxEventLimit)
+	assert.Equal(t, 0, len(left))
+}
+
+func TestEnv_EventsSocketGet_QueryToken(t *testing.T) {
+	var env = getEventEnv()
+	var server = httptest.NewServer(GetRouter(env))
+	defer server.Close()
+
+	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
+	var url = fmt.Sprintf("%s/api/v1/user/events/ws?access_token=%s", strings.Replace(server.URL, "http", "ws", 1), tokenStr)
+	var conn, resp, err = websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err, resp)
+	}
+	conn.Close()
+}
+
+func TestEnv_EventsSocketGet_Revoked(t *testing.T) {
+	var env = getEventEnv()
+	var sessionDAO = &mocks.SessionDAOMockRevocable{}
+	env.sessionDAO = sessionDAO
+	env.conf.Logic.PingSeconds = 1
+	var server = httptest.NewServer(GetRouter(env))
+	defer server.Close()
+
+	var conn, resp, err = dialSocket(server, env, mocks.RequestedId, "")
+	if err != nil {
+		t.Fatal(err, resp)
+	}
+	defer conn.Close()
+
+	sessionDAO.RevokeUserSessions(mocks.RequestedId)
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	var _, _, readErr = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(readErr, websocket.ClosePolicyViolation), readErr)
+}
+
+func TestEnv_EventsSocketGet_Unauthorized(t *testing.T) {
+	var env = getEventEnv()
+	var server = httptest.NewServer(GetRouter(env))
+	defer server.Close()
+
+	var url = strings.Replace(server.URL, "http", "ws", 1) + "/api/v1/user/events/ws"
+	var _, resp, err = websocket.DefaultDialer.Dial(url, nil)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func getEventEnv() *Env {
+	var env = &Env{
+		conf:             getTotalConf(),
+		sessionDAO:       &mocks.SessionDAOMockActive{},
+		keySet:           getKeySet(),
+		meetRequestDAO:   &mocks.MeetRequestDAOMockSuccess{},
+		meetRequestCache: cache.New(time.Second*defaultExpiration, time.Second*defaultCleanup),
+		eventDAO:         mocks.NewEventDAOMock(),
+		notifier:         notify.NewLocalNotifier(),
+		pusher:           push.NewMemoryNotifier(),
+		webhookDAO:       mocks.NewWebhookDAOMock(),
+		logger:           mylog.NewLogger(ioutil.Discard),
+	}
+	env.notifier.Listen(env.wakeLocal)
+	return env
+}
+
+func dialSocket(server *httptest.Server, env *Env, userId int, query string) (*websocket.Conn, *http.Response, error) {
+	var tokenStr, _ = env.generateTokenString(userId, "login", mocks.SessionId)
+	var url = strings.Replace(server.URL, "http", "ws", 1) + "/api/v1/user/events/ws?" + query
+	var header = http.Header{}
+	header.Set(authorizationStr, fmt.Sprintf("Bearer %s", tokenStr))
+	return websocket.DefaultDialer.Dial(url, header)
+}
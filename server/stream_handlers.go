@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/model"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	lastEventIdHeader = "Last-Event-ID"
+	eventStreamType   = "text/event-stream"
+
+	streamingUnsupported = "streaming unsupported"
+	invalidLastEventId   = "\"Last-Event-ID\" must be a non-negative event id"
+)
+
+// EventsStreamGet streams events of the caller as Server-Sent Events. Each
+// event carries its id, so that a reconnecting client resumes after the last
+// received one with "Last-Event-ID" header, which wins over "since" query
+// parameter. Comment lines are sent as heartbeats to keep proxies from
+// closing an idle stream. The stream ends once the session of the caller is
+// revoked or the access token expires, so that the reconnecting client has to
+// authenticate again.
+func (env *Env) EventsStreamGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var principal = getPrincipal(r)
+	var userId = principal.UserId
+
+	var since, sinceErr = parseStreamSince(r)
+	if sinceErr != nil {
+		env.logger.LogRequestError(r, sinceErr)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(sinceErr), env.logger)
+		return
+	}
+
+	var flusher, ok = w.(http.Flusher)
+	if !ok {
+		var err = errors.New(streamingUnsupported)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var box, boxErr = env.getMailBox(userId)
+	if boxErr != nil {
+		env.logger.LogRequestError(r, boxErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(boxErr), env.logger)
+		return
+	}
+
+	w.Header().Set("Content-Type", eventStreamType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// nginx buffers responses unless told otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var send = func(event *model.Event) error {
+		var data, err = json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.Id, data)
+		return err
+	}
+	var push = func() error {
+		var err = env.sendNewEvents(userId, box, &since, send)
+		flusher.Flush()
+		if err != nil {
+			// the client gets the events with the next push
+			env.logger.Errorf("failed to stream events of user %d: %s", userId, err.Error())
+		}
+		return r.Context().Err()
+	}
+
+	var ticker = time.NewTicker(env.conf.Logic.GetPingInterval())
+	defer ticker.Stop()
+
+	var err = push()
+	for err == nil {
+		select {
+		case <-r.Context().Done():
+			err = r.Context().Err()
+		case <-box.Signal():
+			err = push()
+		case <-ticker.C:
+			if checkErr := env.checkPrincipal(principal, time.Now()); checkErr != nil {
+				env.logger.LogRequestError(r, checkErr)
+				return
+			}
+			// a wake up may have gone to another connection of the user,
+			// so events are checked on each heartbeat as well
+			if err = push(); err == nil {
+				fmt.Fprint(w, ": ping\n\n")
+				flusher.Flush()
+			}
+		}
+	}
+
+	// otherwise the stream only ends when the client goes away
+	env.logger.LogRequestSuccess(r)
+}
+
+func parseStreamSince(r *http.Request) (int64, error) {
+	var value = r.Header.Get(lastEventIdHeader)
+	if value == "" {
+		var since, _, err = parseEventPage(r)
+		return since, err
+	}
+
+	var since, err = strconv.ParseInt(value, 10, 64)
+	if err != nil || since < 0 {
+		return 0, errors.New(invalidLastEventId)
+	}
+	return since, nil
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/server/mocks"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnv_EventsStreamGet_Push(t *testing.T) {
+	var env = getEventEnv()
+	var server = httptest.NewServer(GetRouter(env))
+	defer server.Close()
+
+	var resp, err = openStream(server, env, headerPair{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, eventStreamType, resp.Header.Get("Content-Type"))
+
+	env.handleRequestPending(10, mocks.RequesterId)
+
+	var id, event = readStreamEvent(t, bufio.NewReader(resp.Body))
+	assert.Equal(t, fmt.Sprint(event.Id), id)
+	assert.Equal(t, 10, event.Request.Id)
+	assert.Equal(t, model.StatusPending, event.Request.Status)
+}
+
+func TestEnv_EventsStreamGet_LastEventId(t *testing.T) {
+	var env = getEventEnv()
+	var server = httptest.NewServer(GetRouter(env))
+	defer server.Close()
+
+	env.handleRequestPending(10, mocks.RequesterId)
+	env.handleRequestPending(20, mocks.RequesterId)
+	var events, _ = env.eventDAO.GetEvents(mocks.RequestedId, 0, maxEventLimit)
+
+	var resp, err = openStream(server, env, headerPair{lastEventIdHeader, fmt.Sprint(events[0].Id)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var _, event = readStreamEvent(t, bufio.NewReader(resp.Body))
+	assert.Equal(t, events[1].Id, event.Id)
+	assert.Equal(t, 20, event.Request.Id)
+}
+
+func TestEnv_EventsStreamGet_Heartbeat(t *testing.T) {
+	var env = getEventEnv()
+	env.conf.Logic.PingSeconds = 1
+	var server = httptest.NewServer(GetRouter(env))
+	defer server.Close()
+
+	var resp, err = openStream(server, env, headerPair{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var line, readErr = bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Nil(t, readErr)
+	assert.Equal(t, ": ping\n", line)
+}
+
+func TestEnv_EventsStreamGet_Revoked(t *testing.T) {
+	var env = getEventEnv()
+	var sessionDAO = &mocks.SessionDAOMockRevocable{}
+	env.sessionDAO = sessionDAO
+	env.conf.Logic.PingSeconds = 1
+	var server = httptest.NewServer(GetRouter(env))
+	defer server.Close()
+
+	var resp, err = openStream(server, env, headerPair{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	sessionDAO.RevokeUserSessions(mocks.RequestedId)
+
+	var data, readErr = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, readErr)
+	assert.Empty(t, string(data))
+}
+
+func TestEnv_EventsStreamGet_BadLastEventId(t *testing.T) {
+	var env = getEventEnv()
+	var server = httptest.NewServer(GetRouter(env))
+	defer server.Close()
+
+	var resp, err = openStream(server, env, headerPair{lastEventIdHeader, "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func openStream(server *httptest.Server, env *Env, extra headerPair) (*http.Response, error) {
+	var tokenStr, _ = env.generateTokenString(mocks.RequestedId, "login", mocks.SessionId)
+	var req, err = http.NewRequest(http.MethodGet, server.URL+"/api/v1/user/events/stream", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(authorizationStr, fmt.Sprintf("Bearer %s", tokenStr))
+	if extra.key != "" {
+		req.Header.Set(extra.key, extra.value)
+	}
+	return (&http.Client{Timeout: 5 * time.Second}).Do(req)
+}
+
+// readStreamEvent reads the next "id" and "data" lines of the stream.
+func readStreamEvent(t *testing.T, reader *bufio.Reader) (string, *model.Event) {
+	var id string
+	for {
+		var line, err = reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if strings.HasPrefix(line, "id: ") {
+			id = strings.TrimPrefix(line, "id: ")
+		}
+		if strings.HasPrefix(line, "data: ") {
+			var event = new(model.Event)
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), event); err != nil {
+				t.Fatal(err)
+			}
+			return id, event
+		}
+	}
+}
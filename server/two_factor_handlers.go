@@ -0,0 +1,390 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/totp"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	mfaPendingStr = "mfa_pending"
+
+	totpSkew            = 1
+	recoveryCodeCount   = 10
+	recoveryCodeLen     = 10
+	recoveryCodeDivider = "-"
+
+	twoFactorAlreadyEnabled = "two-factor authentication is already enabled"
+	twoFactorNotEnabled     = "two-factor authentication is not enabled"
+	twoFactorNotEnrolled    = "two-factor enrollment has not been started"
+	invalidTwoFactorCode    = "invalid two-factor code"
+	invalidMFAToken         = "mfa token is invalid or expired, sign in again"
+)
+
+// TwoFactorEnrollPost generates a new TOTP secret for the caller. The secret is
+// not used for sign in until it is confirmed with TwoFactorConfirmPost.
+func (env *Env) TwoFactorEnrollPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var principal = getPrincipal(r)
+
+	var secret, secretErr = totp.GenerateSecret()
+	if secretErr != nil {
+		env.logger.LogRequestError(r, secretErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(secretErr), env.logger)
+		return
+	}
+
+	var saved, saveErr = env.twoFactorDAO.SavePendingSecret(principal.UserId, secret)
+	if saveErr != nil {
+		env.logger.LogRequestError(r, saveErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(saveErr), env.logger)
+		return
+	}
+	if !saved {
+		var err = errors.New(twoFactorAlreadyEnabled)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusConflict)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(model.TwoFactorEnrollment{
+		Secret: totp.EncodeSecret(secret),
+		URI:    totp.URI(env.conf.Auth.GetTOTPIssuer(), principal.Login, secret),
+	}), env.logger)
+}
+
+// TwoFactorConfirmPost enables two-factor authentication if the code matches the
+// pending secret and returns recovery codes. They are shown only once.
+func (env *Env) TwoFactorConfirmPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var userId = getPrincipal(r).UserId
+
+	var code, parseCode, parseErr = parseTwoFactorCode(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	var twoFactor, tfCode, tfErr = env.getTwoFactor(userId, false)
+	if tfErr != nil {
+		env.logger.LogRequestError(r, tfErr)
+		w.WriteHeader(tfCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(tfErr), env.logger)
+		return
+	}
+
+	var counter, valid = totp.Validate(twoFactor.Secret, code.Code, time.Now(), totpSkew)
+	if !valid {
+		var err = errors.New(invalidTwoFactorCode)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var codes, hashes, codesErr = generateRecoveryCodes()
+	if codesErr != nil {
+		env.logger.LogRequestError(r, codesErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(codesErr), env.logger)
+		return
+	}
+
+	var enabled, enableErr = env.twoFactorDAO.Enable(userId, counter, hashes)
+	if enableErr != nil {
+		env.logger.LogRequestError(r, enableErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(enableErr), env.logger)
+		return
+	}
+	if !enabled {
+		var err = errors.New(twoFactorAlreadyEnabled)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusConflict)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(model.RecoveryCodes{Codes: codes}), env.logger)
+}
+
+// TwoFactorDisablePost turns two-factor authentication off;
+// the caller has to prove possession of the second factor once more.
+// Wrong codes are throttled together with the ones sent to TwoFactorVerifyPost.
+func (env *Env) TwoFactorDisablePost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var principal = getPrincipal(r)
+	var userId = principal.UserId
+
+	var code, parseCode, parseErr = parseTwoFactorCode(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	var ip = env.getClientIP(r)
+	if env.rejectThrottled(w, r, principal.Login, ip) {
+		return
+	}
+
+	var twoFactor, tfCode, tfErr = env.getTwoFactor(userId, true)
+	if tfErr != nil {
+		env.logger.LogRequestError(r, tfErr)
+		w.WriteHeader(tfCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(tfErr), env.logger)
+		return
+	}
+
+	var valid, checkErr = env.checkSecondFactor(twoFactor, code.Code)
+	if checkErr != nil {
+		env.logger.LogRequestError(r, checkErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(checkErr), env.logger)
+		return
+	}
+	if !valid {
+		var err = errors.New(invalidTwoFactorCode)
+		env.logger.LogRequestError(r, err)
+		env.registerLoginFailure(w, principal.Login, ip, model.LoginFailureWrongCode)
+		w.WriteHeader(http.StatusForbidden)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	env.resetLoginFailures(principal.Login)
+
+	if err := env.twoFactorDAO.Disable(userId); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+// TwoFactorVerifyPost is the second step of sign in: it exchanges the mfa token
+// issued by UserSignInPost and a TOTP or recovery code for a token pair.
+func (env *Env) TwoFactorVerifyPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var request, parseCode, parseErr = parseMFAVerifyRequest(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	var userId, login, tokenErr = env.parseMFAToken(request.MFAToken)
+	if tokenErr != nil {
+		env.logger.LogRequestError(r, tokenErr)
+		w.WriteHeader(http.StatusUnauthorized)
+		common.WriteWithLogging(r, w, common.GetErrorJson(tokenErr), env.logger)
+		return
+	}
+
+	var ip = env.getClientIP(r)
+	if env.rejectThrottled(w, r, login, ip) {
+		return
+	}
+
+	var twoFactor, tfCode, tfErr = env.getTwoFactor(userId, true)
+	if tfErr != nil {
+		env.logger.LogRequestError(r, tfErr)
+		w.WriteHeader(tfCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(tfErr), env.logger)
+		return
+	}
+
+	var valid, checkErr = env.checkSecondFactor(twoFactor, request.Code)
+	if checkErr != nil {
+		env.logger.LogRequestError(r, checkErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(checkErr), env.logger)
+		return
+	}
+	if !valid {
+		var err = errors.New(invalidTwoFactorCode)
+		env.logger.LogRequestError(r, err)
+		env.registerLoginFailure(w, login, ip, model.LoginFailureWrongCode)
+		w.WriteHeader(http.StatusUnauthorized)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+	env.resetLoginFailures(login)
+
+	// the user could have been banned or suspended after the mfa token was issued
+	var user, userErr = env.userDAO.GetUserById(userId)
+	if userErr != nil {
+		env.logger.LogRequestError(r, userErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(userErr), env.logger)
+		return
+	}
+	if err := checkUserAccess(user, time.Now()); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusForbidden)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var tokens, sessionErr = env.startSession(user.Id, user.Login, user.Role)
+	if sessionErr != nil {
+		env.logger.LogRequestError(r, sessionErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(sessionErr), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(tokens), env.logger)
+}
+
+// isTwoFactorEnabled tells sign in whether the second step is required.
+func (env *Env) isTwoFactorEnabled(userId int) (bool, error) {
+	var twoFactor, err = env.twoFactorDAO.GetTwoFactor(userId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return twoFactor.Enabled, nil
+}
+
+// getTwoFactor returns settings of the user which must be either enabled or pending.
+func (env *Env) getTwoFactor(userId int, enabled bool) (*model.TwoFactor, int, error) {
+	var twoFactor, err = env.twoFactorDAO.GetTwoFactor(userId)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	switch {
+	case enabled && (twoFactor == nil || !twoFactor.Enabled):
+		return nil, http.StatusConflict, errors.New(twoFactorNotEnabled)
+	case !enabled && twoFactor == nil:
+		return nil, http.StatusConflict, errors.New(twoFactorNotEnrolled)
+	case !enabled && twoFactor.Enabled:
+		return nil, http.StatusConflict, errors.New(twoFactorAlreadyEnabled)
+	}
+	return twoFactor, http.StatusOK, nil
+}
+
+// checkSecondFactor accepts either a TOTP code, which can be used only once,
+// or one of the recovery codes, each of them is burnt on use.
+func (env *Env) checkSecondFactor(twoFactor *model.TwoFactor, code string) (bool, error) {
+	if counter, valid := totp.Validate(twoFactor.Secret, code, time.Now(), totpSkew); valid {
+		return env.twoFactorDAO.UseCounter(twoFactor.UserId, counter)
+	}
+	return env.twoFactorDAO.UseRecoveryCode(twoFactor.UserId, hashRecoveryCode(code))
+}
+
+func (env *Env) generateMFAToken(id int, login string) (string, error) {
+	return env.keySet.Sign(jwt.MapClaims{
+		idStr:         id,
+		loginStr:      login,
+		mfaPendingStr: true,
+		expStr:        time.Now().Add(env.conf.Auth.GetMFATokenLifetime()).Unix(),
+	})
+}
+
+func (env *Env) parseMFAToken(tokenString string) (int, string, error) {
+	var token, tokenErr = env.parseTokenString(tokenString)
+	if tokenErr != nil {
+		return 0, "", errors.New(invalidMFAToken)
+	}
+
+	var claims = token.Claims.(jwt.MapClaims)
+	if pending, _ := claims[mfaPendingStr].(bool); !pending {
+		return 0, "", errors.New(invalidMFAToken)
+	}
+
+	var userId, idErr = env.getIdFromTokenString(token)
+	if idErr != nil {
+		return 0, "", errors.New(invalidMFAToken)
+	}
+	var login, _ = claims[loginStr].(string)
+	return userId, login, nil
+}
+
+// generateRecoveryCodes returns codes formatted for the user
+// and their hashes, which are the only thing stored.
+func generateRecoveryCodes() ([]string, [][]byte, error) {
+	var codes = make([]string, 0, recoveryCodeCount)
+	var hashes = make([][]byte, 0, recoveryCodeCount)
+	var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for i := 0; i != recoveryCodeCount; i++ {
+		var data = make([]byte, recoveryCodeLen)
+		if _, err := rand.Read(data); err != nil {
+			return nil, nil, err
+		}
+
+		var code = strings.ToLower(encoding.EncodeToString(data))[:recoveryCodeLen]
+		codes = append(codes, code[:recoveryCodeLen/2]+recoveryCodeDivider+code[recoveryCodeLen/2:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case and dividers, so that the code can be typed as is.
+func hashRecoveryCode(code string) []byte {
+	var normalized = strings.ToLower(strings.TrimSpace(code))
+	normalized = strings.Replace(normalized, recoveryCodeDivider, "", -1)
+	return hashSecret([]byte(normalized))
+}
+
+func parseTwoFactorCode(r *http.Request) (*model.TwoFactorCode, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var code = new(model.TwoFactorCode)
+	if err := json.Unmarshal(body, &code); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return code, http.StatusOK, nil
+}
+
+func parseMFAVerifyRequest(r *http.Request) (*model.MFAVerifyRequest, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var request = new(model.MFAVerifyRequest)
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return request, http.StatusOK, nil
+}
@@ -0,0 +1,439 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/server/mocks"
+	"github.com/Sovianum/acquaintance-server/totp"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var totpSecret = []byte("12345678901234567890")
+
+func TestEnv_TwoFactorEnrollPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("INSERT INTO TwoFactor").
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.TwoFactorEnrollPost),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var enrollment = new(model.TwoFactorEnrollment)
+	assert.Nil(t, json.Unmarshal(getResponseData(t, rec.Body.Bytes()), enrollment))
+	assert.Equal(t, 32, len(enrollment.Secret))
+	assert.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/Acquaintance:login?"))
+}
+
+func TestEnv_TwoFactorEnrollPost_AlreadyEnabled(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("INSERT INTO TwoFactor").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var env = getEnv(db)
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.TwoFactorEnrollPost),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestEnv_TwoFactorConfirmPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockTwoFactor(mock, false, 0)
+
+	mock.ExpectBegin()
+	mock.
+		ExpectExec("UPDATE TwoFactor SET enabled = TRUE").
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec("DELETE FROM RecoveryCode").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	for i := 0; i != recoveryCodeCount; i++ {
+		mock.
+			ExpectExec("INSERT INTO RecoveryCode").
+			WillReturnResult(sqlmock.NewResult(int64(i), 1))
+	}
+	mock.ExpectCommit()
+
+	var env = getEnv(db)
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.TwoFactorConfirmPost),
+		strings.NewReader(fmt.Sprintf("{\"code\": \"%s\"}", totp.Code(totpSecret, time.Now()))),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var codes = new(model.RecoveryCodes)
+	assert.Nil(t, json.Unmarshal(getResponseData(t, rec.Body.Bytes()), codes))
+	assert.Equal(t, recoveryCodeCount, len(codes.Codes))
+}
+
+func TestEnv_TwoFactorConfirmPost_WrongCode(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockTwoFactor(mock, false, 0)
+
+	var env = getEnv(db)
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.TwoFactorConfirmPost),
+		strings.NewReader(fmt.Sprintf("{\"code\": \"%s\"}", totp.Code(totpSecret, time.Now().Add(time.Hour)))),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_UserSignInPost_TwoFactorRequired(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var hash, _ = env.hasher.Hash([]byte("password"))
+
+	mock.
+		ExpectQuery("SELECT count").
+		WithArgs("login").
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+	mock.
+		ExpectQuery("SELECT id").
+		WithArgs("login").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "login", "password", "age", "sex", "about", "email", "role", "banned", "suspended_until", "photo"}).
+				AddRow(1, "login", hash, 30, model.MALE, "about", "", model.RoleUser, false, nil, ""),
+		)
+	mockTwoFactor(mock, true, 0)
+
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.UserSignInPost,
+		strings.NewReader("{\"login\": \"login\", \"password\": \"password\"}"),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var challenge = new(model.MFAChallenge)
+	assert.Nil(t, json.Unmarshal(getResponseData(t, rec.Body.Bytes()), challenge))
+	assert.True(t, challenge.MFARequired)
+
+	// mfa token must not work as an access token
+	rec, recErr = getRecorder(
+		urlSample,
+		http.MethodGet,
+		env.withAuth(failHandler(t)),
+		strings.NewReader(""),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", challenge.MFAToken)},
+	)
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestEnv_TwoFactorVerifyPost_TOTP(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockTwoFactor(mock, true, 0)
+	mock.
+		ExpectExec("UPDATE TwoFactor SET lastCounter").
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mockUser(mock, 1, model.RoleUser, false)
+
+	var env = getEnv(db)
+	var mfaToken, _ = env.generateMFAToken(1, "login")
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.TwoFactorVerifyPost,
+		strings.NewReader(fmt.Sprintf(
+			"{\"mfa_token\": \"%s\", \"code\": \"%s\"}", mfaToken, totp.Code(totpSecret, time.Now()),
+		)),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.True(t, strings.Contains(rec.Body.String(), "refresh_token"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_TwoFactorVerifyPost_RecoveryCode(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockTwoFactor(mock, true, 0)
+	mock.
+		ExpectExec("UPDATE RecoveryCode SET used = TRUE").
+		WithArgs(1, hashRecoveryCode("abcdefghij")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mockUser(mock, 1, model.RoleUser, false)
+
+	var env = getEnv(db)
+	var mfaToken, _ = env.generateMFAToken(1, "login")
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.TwoFactorVerifyPost,
+		strings.NewReader(fmt.Sprintf("{\"mfa_token\": \"%s\", \"code\": \"ABCDE-FGHIJ\"}", mfaToken)),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_TwoFactorVerifyPost_WrongCode(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockTwoFactor(mock, true, 0)
+	mock.
+		ExpectExec("UPDATE RecoveryCode SET used = TRUE").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectExec("INSERT INTO LoginFailure").
+		WithArgs("login", sqlmock.AnyArg(), model.LoginFailureWrongCode).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	var env = getEnv(db)
+	var mfaToken, _ = env.generateMFAToken(1, "login")
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.TwoFactorVerifyPost,
+		strings.NewReader(fmt.Sprintf("{\"mfa_token\": \"%s\", \"code\": \"000000\"}", mfaToken)),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_TwoFactorVerifyPost_AccessToken(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.TwoFactorVerifyPost,
+		strings.NewReader(fmt.Sprintf("{\"mfa_token\": \"%s\", \"code\": \"000000\"}", tokenStr)),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestEnv_TwoFactorDisablePost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockTwoFactor(mock, true, 0)
+	mock.
+		ExpectExec("UPDATE TwoFactor SET lastCounter").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM RecoveryCode").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec("DELETE FROM TwoFactor").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var env = getEnv(db)
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.TwoFactorDisablePost),
+		strings.NewReader(fmt.Sprintf("{\"code\": \"%s\"}", totp.Code(totpSecret, time.Now()))),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_TwoFactorDisablePost_WrongCode(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mockTwoFactor(mock, true, 0)
+	mock.
+		ExpectExec("UPDATE RecoveryCode SET used = TRUE").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectExec("INSERT INTO LoginFailure").
+		WithArgs("login", sqlmock.AnyArg(), model.LoginFailureWrongCode).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	var env = getEnv(db)
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.TwoFactorDisablePost),
+		strings.NewReader("{\"code\": \"000000\"}"),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_TwoFactorDisablePost_Throttled(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var policy = env.conf.Auth.Throttle.GetLoginPolicy()
+	for i := 0; i != policy.LockoutAttempts; i++ {
+		env.throttler.Fail(env.throttler.LoginKey("login"))
+	}
+
+	// the code is not checked, so that it can not be guessed during the lockout
+	mock.
+		ExpectExec("INSERT INTO LoginFailure").
+		WithArgs("login", sqlmock.AnyArg(), model.LoginFailureThrottled).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	var tokenStr, _ = env.generateTokenString(1, "login", mocks.SessionId)
+	var rec, recErr = getRecorder(
+		urlSample,
+		http.MethodPost,
+		env.withAuth(env.TwoFactorDisablePost),
+		strings.NewReader(fmt.Sprintf("{\"code\": \"%s\"}", totp.Code(totpSecret, time.Now()))),
+		headerPair{authorizationStr, fmt.Sprintf("Bearer %s", tokenStr)},
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEqual(t, "", rec.Header().Get(retryAfterStr))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	var codes, hashes, err = generateRecoveryCodes()
+
+	assert.Nil(t, err)
+	assert.Equal(t, recoveryCodeCount, len(codes))
+	for i, code := range codes {
+		assert.Equal(t, recoveryCodeLen+len(recoveryCodeDivider), len(code), i)
+		assert.Equal(t, hashes[i], hashRecoveryCode(strings.ToUpper(code)), i)
+	}
+}
+
+func mockTwoFactor(mock sqlmock.Sqlmock, enabled bool, lastCounter int64) {
+	mock.
+		ExpectQuery("SELECT userId, secret").
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"userId", "secret", "enabled", "lastCounter"}).
+				AddRow(1, totpSecret, enabled, lastCounter),
+		)
+}
+
+func getResponseData(t *testing.T, body []byte) []byte {
+	var msg = struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg.Data
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/common"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/webhook"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	statusStr = "status"
+
+	subscriptionNotFound  = "webhook subscription not found"
+	deadDeliveryNotFound  = "dead webhook delivery not found"
+	invalidDeliveryStatus = "\"%s\" must be one of pending, delivered, dead"
+)
+
+// AdminWebhooksGet returns webhook subscriptions without their secrets.
+func (env *Env) AdminWebhooksGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var subscriptions, dbErr = env.webhookDAO.GetSubscriptions()
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(subscriptions), env.logger)
+}
+
+// AdminWebhookPost subscribes the URL to lifecycle events of meet requests.
+// The secret is returned back only here.
+func (env *Env) AdminWebhookPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var subscription, parseCode, parseErr = parseWebhookSubscription(r)
+	if parseErr != nil {
+		env.logger.LogRequestError(r, parseErr)
+		w.WriteHeader(parseCode)
+		common.WriteWithLogging(r, w, common.GetErrorJson(parseErr), env.logger)
+		return
+	}
+
+	if err := env.webhookDAO.CreateSubscription(subscription); err != nil {
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(subscription), env.logger)
+}
+
+// AdminWebhookDelete removes the subscription; its queued deliveries are dropped.
+func (env *Env) AdminWebhookDelete(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var subscriptionId, idErr = strconv.Atoi(mux.Vars(r)[id])
+	if idErr != nil {
+		var err = errors.New(subscriptionNotFound)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var deleted, dbErr = env.webhookDAO.DeleteSubscription(subscriptionId)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+	if !deleted {
+		var err = errors.New(subscriptionNotFound)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+// AdminWebhookDeliveriesGet returns deliveries with the status from the query,
+// dead ones by default, the newest first.
+func (env *Env) AdminWebhookDeliveriesGet(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var limit, offset, pageErr = parsePage(r)
+	if pageErr != nil {
+		env.logger.LogRequestError(r, pageErr)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(pageErr), env.logger)
+		return
+	}
+
+	var status = r.URL.Query().Get(statusStr)
+	switch status {
+	case "":
+		status = model.DeliveryDead
+	case model.DeliveryPending, model.DeliveryDelivered, model.DeliveryDead:
+	default:
+		var err = fmt.Errorf(invalidDeliveryStatus, statusStr)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusBadRequest)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var deliveries, dbErr = env.webhookDAO.GetDeliveries(status, limit, offset)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetDataJson(deliveries), env.logger)
+}
+
+// AdminWebhookReplayPost queues a dead delivery again with the same payload.
+func (env *Env) AdminWebhookReplayPost(w http.ResponseWriter, r *http.Request) {
+	env.logger.LogRequestStart(r)
+	var deliveryId, idErr = strconv.ParseInt(mux.Vars(r)[id], 10, 64)
+	if idErr != nil {
+		var err = errors.New(deadDeliveryNotFound)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	var replayed, dbErr = env.webhookDAO.Replay(deliveryId)
+	if dbErr != nil {
+		env.logger.LogRequestError(r, dbErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteWithLogging(r, w, common.GetErrorJson(dbErr), env.logger)
+		return
+	}
+	if !replayed {
+		var err = errors.New(deadDeliveryNotFound)
+		env.logger.LogRequestError(r, err)
+		w.WriteHeader(http.StatusNotFound)
+		common.WriteWithLogging(r, w, common.GetErrorJson(err), env.logger)
+		return
+	}
+
+	env.logger.LogRequestSuccess(r)
+	common.WriteWithLogging(r, w, common.GetEmptyJson(), env.logger)
+}
+
+// emitWebhook queues the event about the request for subscribers. Failures
+// are only logged, a webhook must not break the change of the request.
+func (env *Env) emitWebhook(eventType string, request *model.MeetRequest) {
+	var payload, err = webhook.NewRequestPayload(eventType, request, time.Now())
+	if err == nil {
+		err = env.webhookDAO.Enqueue(eventType, payload)
+	}
+	if err != nil {
+		env.logger.Errorf("failed to queue webhook %s of request %d: %s", eventType, request.Id, err.Error())
+	}
+}
+
+func parseWebhookSubscription(r *http.Request) (*model.WebhookSubscription, int, error) {
+	var body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := r.Body.Close(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var subscription = new(model.WebhookSubscription)
+	if err := json.Unmarshal(body, &subscription); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return subscription, http.StatusOK, nil
+}
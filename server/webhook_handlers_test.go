@@ -0,0 +1,312 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/Sovianum/acquaintance-server/dao"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/server/mocks"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var webhookDeliveryColumns = []string{
+	"id", "subscriptionId", "url", "eventType", "payload", "status", "attempts", "nextAttempt", "lastError", "created",
+}
+
+func TestEnv_AdminWebhookPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("INSERT INTO WebhookSubscription").
+		WithArgs("https://partner.example/hooks", "0123456789abcdef", pq.Array([]string{model.WebhookRequestExpired})).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created"}).AddRow(1, time.Now()))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/webhooks",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(
+			"{\"url\": \"https://partner.example/hooks\", \"secret\": \"0123456789abcdef\", \"events\": [\"request.expired\"]}",
+		),
+		getRoleHeader(env, model.RoleAdmin),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.True(t, strings.Contains(rec.Body.String(), "0123456789abcdef"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_AdminWebhookPost_Forbidden(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/webhooks",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"url\": \"https://partner.example/hooks\", \"secret\": \"0123456789abcdef\"}"),
+		getRoleHeader(env, model.RoleModerator),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestEnv_AdminWebhookPost_InvalidURL(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/webhooks",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader("{\"url\": \"partner.example\", \"secret\": \"0123456789abcdef\"}"),
+		getRoleHeader(env, model.RoleAdmin),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), "must be an absolute http or https URL"))
+}
+
+func TestEnv_AdminWebhooksGet_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT id, url, events, created FROM WebhookSubscription").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "url", "events", "created"}).
+				AddRow(1, "https://partner.example/hooks", "{request.created}", time.Now()),
+		)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/webhooks",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleAdmin),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.True(t, strings.Contains(rec.Body.String(), "request.created"))
+	assert.False(t, strings.Contains(rec.Body.String(), "secret"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_AdminWebhookDelete_NotFound(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("DELETE FROM WebhookSubscription").
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/webhooks/7",
+		http.MethodDelete,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleAdmin),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), subscriptionNotFound))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_AdminWebhookDeliveriesGet_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectQuery("SELECT d.id, d.subscriptionId").
+		WithArgs(model.DeliveryDead, defaultAdminLimit, 0).
+		WillReturnRows(
+			sqlmock.NewRows(webhookDeliveryColumns).AddRow(
+				5, 1, "https://partner.example/hooks", model.WebhookRequestCreated, "{\"id\": \"a\"}",
+				model.DeliveryDead, 8, time.Now(), "responded with 500", time.Now(),
+			),
+		)
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/webhooks/deliveries",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleAdmin),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.True(t, strings.Contains(rec.Body.String(), "responded with 500"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_AdminWebhookDeliveriesGet_BadStatus(t *testing.T) {
+	var db, _, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/webhooks/deliveries?status=lost",
+		http.MethodGet,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleAdmin),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestEnv_AdminWebhookReplayPost_Success(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE WebhookDelivery SET status = 'pending'").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/webhooks/deliveries/5/replay",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleAdmin),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_AdminWebhookReplayPost_NotDead(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("UPDATE WebhookDelivery SET status = 'pending'").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var env = getEnv(db)
+	var rec, recErr = getRecorder(
+		"/api/v1/admin/webhooks/deliveries/5/replay",
+		http.MethodPost,
+		GetRouter(env).ServeHTTP,
+		strings.NewReader(""),
+		getRoleHeader(env, model.RoleAdmin),
+	)
+
+	assert.Nil(t, recErr)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), deadDeliveryNotFound))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestEnv_DispatchRequest_Webhook(t *testing.T) {
+	var env = getEventEnv()
+	var webhookDAO = env.webhookDAO.(*mocks.WebhookDAOMock)
+
+	env.handleRequestPending(10, mocks.RequesterId)
+	env.handleRequestAccept(10, mocks.RequestedId)
+
+	var enqueued = webhookDAO.Enqueued()
+	if assert.Equal(t, 2, len(enqueued)) {
+		assert.Equal(t, model.WebhookRequestCreated, enqueued[0].EventType)
+		assert.Equal(t, model.WebhookRequestAccepted, enqueued[1].EventType)
+		assert.True(t, strings.Contains(string(enqueued[1].Payload), model.StatusAccepted))
+	}
+}
+
+func TestEnv_DeclineAll_Webhook(t *testing.T) {
+	var db, mock, dbErr = sqlmock.New()
+
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.
+		ExpectQuery("UPDATE MeetRequest SET status = 'DECLINED'").
+		WithArgs(5).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "requesterId", "requestedId", "time"}).AddRow(10, 2, 3, time.Now()),
+		)
+	mock.ExpectExec("INSERT INTO EventLock").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO Event ").WithArgs(2, 10, model.StatusDeclined).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	var env = getEventEnv()
+	var webhookDAO = env.webhookDAO.(*mocks.WebhookDAOMock)
+	env.meetRequestDAO = dao.NewMeetDAO(db)
+
+	assert.Nil(t, env.declineAll(5))
+
+	var enqueued = webhookDAO.Enqueued()
+	if assert.Equal(t, 1, len(enqueued)) {
+		assert.Equal(t, model.WebhookRequestExpired, enqueued[0].EventType)
+
+		var payload = struct{ Data map[string]interface{} }{}
+		assert.Nil(t, json.Unmarshal(enqueued[0].Payload, &payload))
+		assert.Equal(t, 10.0, payload.Data["request_id"])
+		assert.Equal(t, model.StatusDeclined, payload.Data["status"])
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,62 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+const (
+	p256CoordinateLen = 32
+)
+
+// JWKS is a JSON Web Key Set (RFC 7517) with public keys only.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA public key fields
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC public key fields
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+func (k *key) jwk() JWK {
+	var result = JWK{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		result.Kty = "RSA"
+		result.N = encodeBigInt(public.N, 0)
+		result.E = encodeBigInt(big.NewInt(int64(public.E)), 0)
+	case *ecdsa.PublicKey:
+		result.Kty = "EC"
+		result.Crv = "P-256"
+		result.X = encodeBigInt(public.X, p256CoordinateLen)
+		result.Y = encodeBigInt(public.Y, p256CoordinateLen)
+	}
+	return result
+}
+
+// encodeBigInt encodes n as unsigned big-endian base64url value
+// left padded with zeros up to size bytes.
+func encodeBigInt(n *big.Int, size int) string {
+	var data = n.Bytes()
+	if len(data) < size {
+		var padded = make([]byte, size)
+		copy(padded[size-len(data):], data)
+		data = padded
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
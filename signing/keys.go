@@ -0,0 +1,106 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	keyFileExt = ".pem"
+)
+
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+// loadKeys reads every *.pem file in dir. File name without extension
+// becomes the key id. A file may contain either a private key (RSA in PKCS1
+// or PKCS8, P-256 EC in SEC1 or PKCS8) or, for keys which only verify
+// tokens, a PKIX public key.
+func loadKeys(dir string) ([]*key, error) {
+	var paths, globErr = filepath.Glob(filepath.Join(dir, "*"+keyFileExt))
+	if globErr != nil {
+		return nil, globErr
+	}
+
+	var result = make([]*key, 0, len(paths))
+	for _, path := range paths {
+		var data, readErr = ioutil.ReadFile(path)
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		var id = strings.TrimSuffix(filepath.Base(path), keyFileExt)
+		var k, parseErr = parseKey(id, data)
+		if parseErr != nil {
+			return nil, fmt.Errorf("failed to load key from %s: %s", path, parseErr.Error())
+		}
+		result = append(result, k)
+	}
+	return result, nil
+}
+
+func parseKey(id string, data []byte) (*key, error) {
+	var block, _ = pem.Decode(data)
+	if block == nil {
+		return nil, jwt.ErrKeyMustBePEMEncoded
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block \"%s\"", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var k = &key{id: id}
+	switch typed := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.method, k.private, k.public = jwt.SigningMethodRS256, typed, &typed.PublicKey
+	case *rsa.PublicKey:
+		k.method, k.public = jwt.SigningMethodRS256, typed
+	case *ecdsa.PrivateKey:
+		k.method, k.private, k.public = jwt.SigningMethodES256, typed, &typed.PublicKey
+	case *ecdsa.PublicKey:
+		k.method, k.public = jwt.SigningMethodES256, typed
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	if ecKey, ok := k.public.(*ecdsa.PublicKey); ok && ecKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("only P-256 curve is supported for ES256, got %s", ecKey.Curve.Params().Name)
+	}
+	return k, nil
+}
+
+func sortedIds(keys map[string]*key) []string {
+	var result = make([]string, 0, len(keys))
+	for id := range keys {
+		result = append(result, id)
+	}
+	sort.Strings(result)
+	return result
+}
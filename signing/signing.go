@@ -0,0 +1,152 @@
+package signing
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/dgrijalva/jwt-go"
+	"time"
+)
+
+const (
+	kidHeader = "kid"
+)
+
+var errUnknownKey = errors.New("token is signed with unknown key")
+
+// KeySet signs access tokens and verifies their signatures.
+type KeySet interface {
+	Sign(claims jwt.MapClaims) (string, error)
+	Parse(tokenString string) (*jwt.Token, error)
+	// JWKS returns public keys which may be used to verify tokens.
+	// It is empty for symmetric key sets.
+	JWKS() *JWKS
+}
+
+// NewKeySet returns asymmetric key set loaded from conf.Signing.KeysDir
+// or, if the directory is not configured, HMAC key set built from conf.TokenKey.
+func NewKeySet(conf config.AuthConfig) (KeySet, error) {
+	if conf.Signing.KeysDir == "" {
+		return NewHMACKeySet(conf.GetTokenKey()), nil
+	}
+
+	var keys, loadErr = loadKeys(conf.Signing.KeysDir)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	return newAsymmetricKeySet(keys, conf.Signing.ActiveKeyId, conf.GetGracePeriod(), time.Now)
+}
+
+func NewHMACKeySet(key []byte) KeySet {
+	return &hmacKeySet{key: key}
+}
+
+type hmacKeySet struct {
+	key []byte
+}
+
+func (ks *hmacKeySet) Sign(claims jwt.MapClaims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.key)
+}
+
+func (ks *hmacKeySet) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return ks.key, nil
+	})
+}
+
+func (ks *hmacKeySet) JWKS() *JWKS {
+	return &JWKS{Keys: []JWK{}}
+}
+
+// asymmetricKeySet signs tokens with the active key. Other keys are considered
+// retired when the set is loaded and verify tokens only during the grace period,
+// so rotation is done by adding a new key and making it active.
+type asymmetricKeySet struct {
+	active       *key
+	keys         map[string]*key
+	retiredUntil time.Time
+	now          func() time.Time
+}
+
+func newAsymmetricKeySet(
+	keys []*key, activeId string, grace time.Duration, now func() time.Time,
+) (*asymmetricKeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys found")
+	}
+
+	var result = &asymmetricKeySet{
+		keys:         make(map[string]*key, len(keys)),
+		retiredUntil: now().Add(grace),
+		now:          now,
+	}
+
+	for _, k := range keys {
+		if _, ok := result.keys[k.id]; ok {
+			return nil, fmt.Errorf("duplicate signing key \"%s\"", k.id)
+		}
+		result.keys[k.id] = k
+
+		// without explicit choice the newest key (ids are expected to sort by date) signs tokens
+		if activeId == "" && k.private != nil && (result.active == nil || k.id > result.active.id) {
+			result.active = k
+		}
+	}
+
+	if activeId != "" {
+		result.active = result.keys[activeId]
+	}
+	if result.active == nil {
+		return nil, fmt.Errorf("active signing key \"%s\" not found", activeId)
+	}
+	if result.active.private == nil {
+		return nil, fmt.Errorf("active signing key \"%s\" has no private part", result.active.id)
+	}
+
+	return result, nil
+}
+
+func (ks *asymmetricKeySet) Sign(claims jwt.MapClaims) (string, error) {
+	var token = jwt.NewWithClaims(ks.active.method, claims)
+	token.Header[kidHeader] = ks.active.id
+	return token.SignedString(ks.active.private)
+}
+
+func (ks *asymmetricKeySet) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		var kid, _ = token.Header[kidHeader].(string)
+		var k = ks.verificationKey(kid)
+		if k == nil {
+			return nil, errUnknownKey
+		}
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return k.public, nil
+	})
+}
+
+func (ks *asymmetricKeySet) JWKS() *JWKS {
+	var result = &JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, id := range sortedIds(ks.keys) {
+		if k := ks.verificationKey(id); k != nil {
+			result.Keys = append(result.Keys, k.jwk())
+		}
+	}
+	return result
+}
+
+func (ks *asymmetricKeySet) verificationKey(id string) *key {
+	var k, ok = ks.keys[id]
+	if !ok {
+		return nil
+	}
+	if k != ks.active && ks.now().After(ks.retiredUntil) {
+		return nil
+	}
+	return k
+}
@@ -0,0 +1,161 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewKeySet_HMACFallback(t *testing.T) {
+	var keySet, err = NewKeySet(config.AuthConfig{TokenKey: "key"})
+	assert.Nil(t, err)
+
+	var tokenStr, signErr = keySet.Sign(jwt.MapClaims{"id": 1})
+	assert.Nil(t, signErr)
+
+	var token, parseErr = keySet.Parse(tokenStr)
+	assert.Nil(t, parseErr)
+	assert.Equal(t, "HS256", token.Method.Alg())
+	assert.Empty(t, keySet.JWKS().Keys)
+}
+
+func TestNewKeySet_FromDir(t *testing.T) {
+	var dir = getKeysDir(t)
+	defer os.RemoveAll(dir)
+
+	writeKey(t, dir, "2017-01", getRSAKeyBlock(t))
+	writeKey(t, dir, "2017-02", getECKeyBlock(t))
+
+	var keySet, err = NewKeySet(config.AuthConfig{Signing: config.SigningConfig{KeysDir: dir}})
+	assert.Nil(t, err)
+
+	var tokenStr, signErr = keySet.Sign(jwt.MapClaims{"id": 1})
+	assert.Nil(t, signErr)
+
+	var token, parseErr = keySet.Parse(tokenStr)
+	assert.Nil(t, parseErr)
+	assert.Equal(t, "ES256", token.Method.Alg())
+	assert.Equal(t, "2017-02", token.Header[kidHeader])
+
+	var jwks = keySet.JWKS()
+	assert.Equal(t, 2, len(jwks.Keys))
+	assert.Equal(t, "RSA", jwks.Keys[0].Kty)
+	assert.Equal(t, "AQAB", jwks.Keys[0].E)
+	assert.Equal(t, "EC", jwks.Keys[1].Kty)
+	assert.Equal(t, 43, len(jwks.Keys[1].X))
+}
+
+func TestNewKeySet_ActiveKeyMissing(t *testing.T) {
+	var dir = getKeysDir(t)
+	defer os.RemoveAll(dir)
+
+	writeKey(t, dir, "2017-01", getECKeyBlock(t))
+
+	var _, err = NewKeySet(config.AuthConfig{Signing: config.SigningConfig{KeysDir: dir, ActiveKeyId: "2017-02"}})
+	assert.NotNil(t, err)
+}
+
+func TestNewKeySet_PublicKeyCanNotBeActive(t *testing.T) {
+	var dir = getKeysDir(t)
+	defer os.RemoveAll(dir)
+
+	var privateKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var publicDer, _ = x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	writeKey(t, dir, "2017-01", &pem.Block{Type: "PUBLIC KEY", Bytes: publicDer})
+
+	var _, err = NewKeySet(config.AuthConfig{Signing: config.SigningConfig{KeysDir: dir, ActiveKeyId: "2017-01"}})
+	assert.NotNil(t, err)
+}
+
+func TestNewKeySet_EmptyDir(t *testing.T) {
+	var dir = getKeysDir(t)
+	defer os.RemoveAll(dir)
+
+	var _, err = NewKeySet(config.AuthConfig{Signing: config.SigningConfig{KeysDir: dir}})
+	assert.NotNil(t, err)
+}
+
+func TestAsymmetricKeySet_GracePeriod(t *testing.T) {
+	var oldKey, _ = parseKey("old", pem.EncodeToMemory(getRSAKeyBlock(t)))
+	var newKey, _ = parseKey("new", pem.EncodeToMemory(getECKeyBlock(t)))
+
+	var now = time.Date(2017, 10, 17, 0, 0, 0, 0, time.UTC)
+	var clock = func() time.Time { return now }
+
+	var oldKeySet, _ = newAsymmetricKeySet([]*key{oldKey}, "old", time.Hour, clock)
+	var oldToken, _ = oldKeySet.Sign(jwt.MapClaims{"id": 1})
+
+	var keySet, err = newAsymmetricKeySet([]*key{oldKey, newKey}, "new", time.Hour, clock)
+	assert.Nil(t, err)
+
+	var _, parseErr = keySet.Parse(oldToken)
+	assert.Nil(t, parseErr)
+	assert.Equal(t, 2, len(keySet.JWKS().Keys))
+
+	now = now.Add(2 * time.Hour)
+
+	_, parseErr = keySet.Parse(oldToken)
+	assert.NotNil(t, parseErr)
+	assert.Equal(t, 1, len(keySet.JWKS().Keys))
+	assert.Equal(t, "new", keySet.JWKS().Keys[0].Kid)
+}
+
+func TestAsymmetricKeySet_RejectsHMAC(t *testing.T) {
+	var k, _ = parseKey("key", pem.EncodeToMemory(getRSAKeyBlock(t)))
+	var keySet, _ = newAsymmetricKeySet([]*key{k}, "", time.Hour, time.Now)
+
+	// a token signed with HS256 and the public key as a secret must not pass
+	var publicDer, _ = x509.MarshalPKIXPublicKey(k.public)
+	var token = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": 1})
+	token.Header[kidHeader] = "key"
+	var tokenStr, _ = token.SignedString(publicDer)
+
+	var _, err = keySet.Parse(tokenStr)
+	assert.NotNil(t, err)
+}
+
+func getKeysDir(t *testing.T) string {
+	var dir, err = ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeKey(t *testing.T, dir string, id string, block *pem.Block) {
+	var err = ioutil.WriteFile(filepath.Join(dir, id+keyFileExt), pem.EncodeToMemory(block), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getRSAKeyBlock(t *testing.T) *pem.Block {
+	var privateKey, err = rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}
+}
+
+func getECKeyBlock(t *testing.T) *pem.Block {
+	var privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var der, marshalErr = x509.MarshalECPrivateKey(privateKey)
+	if marshalErr != nil {
+		t.Fatal(marshalErr)
+	}
+	return &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+}
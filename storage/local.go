@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// localStorage keeps objects as files under dir. Serving them is up to
+// the application or a reverse proxy, see config.StorageConfig.
+type localStorage struct {
+	dir     string
+	baseURL string
+}
+
+func newLocalStorage(dir string, baseURL string) (Storage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &localStorage{dir: dir, baseURL: baseURL}, nil
+}
+
+func (s *localStorage) Put(key string, data []byte, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	var path = filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// the file is renamed into place so that readers never see a partial photo
+	var tmp, tmpErr = ioutil.TempFile(filepath.Dir(path), ".upload")
+	if tmpErr != nil {
+		return tmpErr
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *localStorage) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	var err = os.Remove(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *localStorage) URL(key string) string {
+	return s.baseURL + "/" + key
+}
@@ -0,0 +1,60 @@
+package storage
+
+import "sync"
+
+// MemoryStorage keeps objects in memory so that tests can inspect them.
+type MemoryStorage struct {
+	lock    sync.Mutex
+	baseURL string
+	objects map[string][]byte
+}
+
+func NewMemoryStorage(baseURL string) *MemoryStorage {
+	return &MemoryStorage{baseURL: baseURL, objects: make(map[string][]byte)}
+}
+
+func (s *MemoryStorage) Put(key string, data []byte, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var copied = make([]byte, len(data))
+	copy(copied, data)
+	s.objects[key] = copied
+	return nil
+}
+
+func (s *MemoryStorage) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *MemoryStorage) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+// Get returns the object and whether it exists.
+func (s *MemoryStorage) Get(key string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var data, ok = s.objects[key]
+	return data, ok
+}
+
+func (s *MemoryStorage) Keys() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var result = make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		result = append(result, key)
+	}
+	return result
+}
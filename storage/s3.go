@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/config"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3Service       = "s3"
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3DateFormat    = "20060102T150405Z"
+	s3DefaultRegion = "us-east-1"
+	s3Timeout       = 30 * time.Second
+
+	amzDateHeader    = "X-Amz-Date"
+	amzContentHeader = "X-Amz-Content-Sha256"
+)
+
+// s3Storage talks to an S3-compatible service (AWS S3, MinIO, Ceph etc.)
+// using path-style addressing and Signature Version 4.
+type s3Storage struct {
+	endpoint  string
+	bucket    string
+	baseURL   string
+	signer    *s3Signer
+	client    *http.Client
+	timestamp func() time.Time
+}
+
+func newS3Storage(conf config.StorageConfig) (Storage, error) {
+	if conf.Endpoint == "" || conf.Bucket == "" {
+		return nil, errors.New("s3 storage requires endpoint and bucket")
+	}
+	var region = conf.Region
+	if region == "" {
+		region = s3DefaultRegion
+	}
+	return &s3Storage{
+		endpoint:  strings.TrimSuffix(conf.Endpoint, "/"),
+		bucket:    conf.Bucket,
+		baseURL:   conf.GetBaseURL(),
+		signer:    &s3Signer{accessKey: conf.AccessKey, secretKey: conf.SecretKey, region: region},
+		client:    &http.Client{Timeout: s3Timeout},
+		timestamp: time.Now,
+	}, nil
+}
+
+func (s *s3Storage) Put(key string, data []byte, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return s.do(http.MethodPut, key, data, contentType)
+}
+
+func (s *s3Storage) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	// S3 answers 204 to deletion of a missing object as well
+	return s.do(http.MethodDelete, key, nil, "")
+}
+
+func (s *s3Storage) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+func (s *s3Storage) do(method string, key string, data []byte, contentType string) error {
+	var req, reqErr = http.NewRequest(method, s.endpoint+"/"+s.bucket+"/"+key, bytes.NewReader(data))
+	if reqErr != nil {
+		return reqErr
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.signer.sign(req, data, s.timestamp().UTC())
+
+	var resp, err = s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		var body, _ = ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3 %s %s failed with status %d: %s", method, key, resp.StatusCode, body)
+	}
+	return nil
+}
+
+type s3Signer struct {
+	accessKey string
+	secretKey string
+	region    string
+}
+
+// sign adds Signature Version 4 authorization to req. All headers set
+// on req at this point are signed, Host included.
+func (signer *s3Signer) sign(req *http.Request, payload []byte, now time.Time) {
+	var payloadHash = hashHex(payload)
+	var amzDate = now.Format(s3DateFormat)
+	req.Header.Set(amzDateHeader, amzDate)
+	req.Header.Set(amzContentHeader, payloadHash)
+
+	var headers = map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names = make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders = new(bytes.Buffer)
+	for _, name := range names {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	var signedHeaders = strings.Join(names, ";")
+
+	var canonicalRequest = strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	var date = now.Format("20060102")
+	var scope = strings.Join([]string{date, signer.region, s3Service, "aws4_request"}, "/")
+	var stringToSign = strings.Join([]string{
+		s3Algorithm, amzDate, scope, hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	var key = hmacSHA256([]byte("AWS4"+signer.secretKey), date)
+	key = hmacSHA256(key, signer.region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	var signature = hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, signer.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+// escapePath encodes every segment of the path as required by SigV4.
+func escapePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	var parts = strings.Split(path, "/")
+	for i, part := range parts {
+		parts[i] = escapeSigV4(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func canonicalQuery(query url.Values) string {
+	var keys = make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs = make([]string, 0, len(keys))
+	for _, key := range keys {
+		var values = query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, escapeSigV4(key)+"="+escapeSigV4(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// escapeSigV4 percent-encodes everything except RFC 3986 unreserved characters.
+func escapeSigV4(s string) string {
+	var buf = new(bytes.Buffer)
+	for i := 0; i < len(s); i++ {
+		var c = s[i]
+		var unreserved = 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~'
+		if unreserved {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+func hashHex(data []byte) string {
+	var sum = sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	var mac = hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
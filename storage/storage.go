@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/config"
+	"strings"
+)
+
+const (
+	Local  = "local"
+	S3     = "s3"
+	Memory = "memory"
+)
+
+var ErrInvalidKey = errors.New("invalid object key")
+
+// Storage keeps publicly readable objects such as user photos.
+// Keys are slash separated relative paths, e.g. "photos/1/abc_small.jpg".
+type Storage interface {
+	Put(key string, data []byte, contentType string) error
+	// Delete does not fail if there is no object with such key.
+	Delete(key string) error
+	// URL returns the address the object can be downloaded from.
+	URL(key string) string
+}
+
+func NewStorage(conf config.StorageConfig) (Storage, error) {
+	switch conf.Backend {
+	case Local:
+		return newLocalStorage(conf.Dir, conf.GetBaseURL())
+	case S3:
+		return newS3Storage(conf)
+	case Memory, "":
+		return NewMemoryStorage(conf.GetBaseURL()), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage backend \"%s\"", conf.Backend)
+	}
+}
+
+// checkKey rejects keys which could escape the storage root.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
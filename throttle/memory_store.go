@@ -0,0 +1,62 @@
+package throttle
+
+import (
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/patrickmn/go-cache"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps counters in the memory of a single server instance.
+// Entries expire by themselves after ttl of inactivity.
+type MemoryStore struct {
+	cache *cache.Cache
+	lock  sync.Mutex
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		cache: cache.New(ttl, ttl),
+	}
+}
+
+func (store *MemoryStore) Get(key string, since time.Time) (model.LoginAttempts, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return store.get(key, since), nil
+}
+
+func (store *MemoryStore) AddFailure(key string, now time.Time, since time.Time) (model.LoginAttempts, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	var attempts = store.get(key, since)
+	attempts.Failures++
+	attempts.LastFailure = now
+	store.cache.Set(key, attempts, cache.DefaultExpiration)
+	return attempts, nil
+}
+
+func (store *MemoryStore) Reset(key string) error {
+	store.cache.Delete(key)
+	return nil
+}
+
+func (store *MemoryStore) DeleteStale(since time.Time) error {
+	store.cache.DeleteExpired()
+	return nil
+}
+
+func (store *MemoryStore) get(key string, since time.Time) model.LoginAttempts {
+	var item, found = store.cache.Get(key)
+	if !found {
+		return model.LoginAttempts{}
+	}
+
+	var attempts = item.(model.LoginAttempts)
+	if !attempts.LastFailure.After(since) {
+		return model.LoginAttempts{}
+	}
+	return attempts
+}
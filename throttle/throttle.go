@@ -0,0 +1,141 @@
+package throttle
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/Sovianum/acquaintance-server/dao"
+	"github.com/Sovianum/acquaintance-server/model"
+	"time"
+)
+
+const (
+	Memory   = "memory"
+	Postgres = "postgres"
+
+	loginPrefix = "login:"
+	ipPrefix    = "ip:"
+
+	// prevents overflow of the backoff shift
+	maxBackoffPower = 30
+)
+
+// Store keeps failed attempt counters. Failures made before since are forgotten.
+// dao.LoginThrottleDAO is the Postgres implementation.
+type Store interface {
+	Get(key string, since time.Time) (model.LoginAttempts, error)
+	AddFailure(key string, now time.Time, since time.Time) (model.LoginAttempts, error)
+	Reset(key string) error
+	DeleteStale(since time.Time) error
+}
+
+func NewStore(conf config.ThrottleConfig, db *sql.DB) (Store, error) {
+	switch conf.Store {
+	case Postgres:
+		return dao.NewDBLoginThrottleDAO(db), nil
+	case Memory, "":
+		return NewMemoryStore(conf.GetLockoutPeriod()), nil
+	default:
+		return nil, fmt.Errorf("unsupported throttle store \"%s\"", conf.Store)
+	}
+}
+
+// Key identifies a counter together with the policy applied to it.
+type Key struct {
+	name   string
+	policy config.ThrottlePolicy
+}
+
+// Throttler slows down password guessing: each key gets some free attempts,
+// then exponentially growing delays and finally a temporary lockout.
+type Throttler struct {
+	store Store
+	conf  config.ThrottleConfig
+	now   func() time.Time
+}
+
+func NewThrottler(conf config.ThrottleConfig, store Store) *Throttler {
+	return &Throttler{
+		store: store,
+		conf:  conf,
+		now:   time.Now,
+	}
+}
+
+func (t *Throttler) LoginKey(login string) Key {
+	return Key{name: loginPrefix + login, policy: t.conf.GetLoginPolicy()}
+}
+
+func (t *Throttler) IPKey(ip string) Key {
+	return Key{name: ipPrefix + ip, policy: t.conf.GetIPPolicy()}
+}
+
+// Wait returns how long the caller must wait before the next attempt
+// with any of keys is allowed. Zero means the attempt is allowed now.
+func (t *Throttler) Wait(keys ...Key) (time.Duration, error) {
+	var now = t.now()
+	var result time.Duration
+	for _, key := range keys {
+		var attempts, err = t.store.Get(key.name, now.Add(-t.conf.GetLockoutPeriod()))
+		if err != nil {
+			return 0, err
+		}
+		result = maxDuration(result, t.blockedUntil(key.policy, attempts).Sub(now))
+	}
+	return result, nil
+}
+
+// Fail registers a failed attempt for every key and returns
+// how long the caller must wait before the next attempt.
+func (t *Throttler) Fail(keys ...Key) (time.Duration, error) {
+	var now = t.now()
+	var result time.Duration
+	for _, key := range keys {
+		var attempts, err = t.store.AddFailure(key.name, now, now.Add(-t.conf.GetLockoutPeriod()))
+		if err != nil {
+			return 0, err
+		}
+		result = maxDuration(result, t.blockedUntil(key.policy, attempts).Sub(now))
+	}
+	return result, nil
+}
+
+// Reset forgets failures of the key, e.g. after a successful sign in.
+func (t *Throttler) Reset(key Key) error {
+	return t.store.Reset(key.name)
+}
+
+// DeleteStale removes counters which are not taken into account any more.
+func (t *Throttler) DeleteStale() error {
+	return t.store.DeleteStale(t.now().Add(-t.conf.GetLockoutPeriod()))
+}
+
+func (t *Throttler) blockedUntil(policy config.ThrottlePolicy, attempts model.LoginAttempts) time.Time {
+	if attempts.Failures >= policy.LockoutAttempts {
+		return attempts.LastFailure.Add(t.conf.GetLockoutPeriod())
+	}
+	if attempts.Failures <= policy.FreeAttempts {
+		return time.Time{}
+	}
+
+	var power = attempts.Failures - policy.FreeAttempts - 1
+	var delay = t.conf.GetMaxDelay()
+	if power < maxBackoffPower {
+		delay = minDuration(delay, t.conf.GetBaseDelay()<<uint(power))
+	}
+	return attempts.LastFailure.Add(delay)
+}
+
+func maxDuration(d1 time.Duration, d2 time.Duration) time.Duration {
+	if d1 > d2 {
+		return d1
+	}
+	return d2
+}
+
+func minDuration(d1 time.Duration, d2 time.Duration) time.Duration {
+	if d1 < d2 {
+		return d1
+	}
+	return d2
+}
@@ -0,0 +1,97 @@
+package throttle
+
+import (
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewStore_Unknown(t *testing.T) {
+	var _, err = NewStore(config.ThrottleConfig{Store: "redis"}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestThrottler_Backoff(t *testing.T) {
+	var throttler, now = getThrottler()
+	var key = throttler.LoginKey("login")
+
+	var testData = []time.Duration{
+		0, 0, // free attempts
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		10 * time.Second, // max delay
+		time.Minute,      // lockout
+	}
+
+	for i, expected := range testData {
+		var wait, err = throttler.Fail(key)
+		assert.Nil(t, err, i)
+		assert.Equal(t, expected, wait, i)
+
+		var waitAgain, waitErr = throttler.Wait(key)
+		assert.Nil(t, waitErr, i)
+		assert.Equal(t, expected, waitAgain, i)
+	}
+
+	*now = now.Add(30 * time.Second)
+	var wait, _ = throttler.Wait(key)
+	assert.Equal(t, 30*time.Second, wait)
+
+	*now = now.Add(30 * time.Second)
+	wait, _ = throttler.Wait(key)
+	assert.Equal(t, time.Duration(0), wait)
+
+	// failures older than lockout period are forgotten
+	wait, _ = throttler.Fail(key)
+	assert.Equal(t, time.Duration(0), wait)
+}
+
+func TestThrottler_MaxOfKeys(t *testing.T) {
+	var throttler, _ = getThrottler()
+	var loginKey = throttler.LoginKey("login")
+	var ipKey = throttler.IPKey("127.0.0.1")
+
+	for i := 0; i != 3; i++ {
+		throttler.Fail(loginKey)
+	}
+
+	var wait, err = throttler.Wait(loginKey, ipKey)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, wait)
+
+	wait, _ = throttler.Wait(ipKey)
+	assert.Equal(t, time.Duration(0), wait)
+}
+
+func TestThrottler_Reset(t *testing.T) {
+	var throttler, _ = getThrottler()
+	var key = throttler.LoginKey("login")
+
+	for i := 0; i != 3; i++ {
+		throttler.Fail(key)
+	}
+	assert.Nil(t, throttler.Reset(key))
+
+	var wait, _ = throttler.Wait(key)
+	assert.Equal(t, time.Duration(0), wait)
+}
+
+func getThrottler() (*Throttler, *time.Time) {
+	var conf = config.ThrottleConfig{
+		BaseDelaySeconds: 1,
+		MaxDelaySeconds:  10,
+		LockoutMinutes:   1,
+		Login:            config.ThrottlePolicy{FreeAttempts: 2, LockoutAttempts: 8},
+		IP:               config.ThrottlePolicy{FreeAttempts: 5, LockoutAttempts: 20},
+	}
+	var now = time.Date(2017, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	var throttler = NewThrottler(conf, NewMemoryStore(time.Hour))
+	throttler.now = func() time.Time {
+		return now
+	}
+	return throttler, &now
+}
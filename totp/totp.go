@@ -0,0 +1,98 @@
+// Package totp implements time-based one-time passwords as described
+// in RFC 6238 (and HOTP of RFC 4226 it is based on) with the parameters
+// supported by all authenticator apps: HMAC-SHA1, 6 digits and 30 s step.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	SecretLen = 20
+	Digits    = 6
+	Period    = 30
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateSecret() ([]byte, error) {
+	var secret = make([]byte, SecretLen)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeSecret returns secret in the base32 form users type into authenticator apps.
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// URI builds otpauth:// key URI which authenticator apps import from a QR code.
+func URI(issuer string, account string, secret []byte) string {
+	var query = url.Values{}
+	query.Set("secret", EncodeSecret(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(Period))
+
+	var label = url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// Counter returns number of the time step t belongs to.
+func Counter(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+func Code(secret []byte, t time.Time) string {
+	return hotp(secret, Counter(t), Digits)
+}
+
+// Validate checks code against time steps within skew steps from t to tolerate
+// clock drift. It returns the matched counter, so that callers can reject
+// codes of already used steps.
+func Validate(secret []byte, code string, t time.Time, skew int) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	var counter = Counter(t)
+	for delta := -int64(skew); delta <= int64(skew); delta++ {
+		var expected = hotp(secret, counter+delta, Digits)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter + delta, true
+		}
+	}
+	return 0, false
+}
+
+// hotp computes HOTP value (RFC 4226, section 5.3).
+func hotp(secret []byte, counter int64, digits int) string {
+	var msg = make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	var mac = hmac.New(sha1.New, secret)
+	mac.Write(msg)
+	var sum = mac.Sum(nil)
+
+	var offset = sum[len(sum)-1] & 0xf
+	var value = binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	var mod uint32 = 1
+	for i := 0; i != digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
@@ -0,0 +1,74 @@
+package totp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+	"time"
+)
+
+var rfcSecret = []byte("12345678901234567890")
+
+// test vectors of RFC 4226, appendix D
+func TestHOTP(t *testing.T) {
+	var expected = []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+
+	for i, code := range expected {
+		assert.Equal(t, code, hotp(rfcSecret, int64(i), 6), i)
+	}
+}
+
+// SHA1 test vectors of RFC 6238, appendix B
+func TestTOTP_RFCVectors(t *testing.T) {
+	var testData = []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for i, item := range testData {
+		assert.Equal(t, item.code, hotp(rfcSecret, Counter(time.Unix(item.unix, 0)), 8), i)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var now = time.Unix(1111111111, 0)
+	var code = Code(rfcSecret, now)
+	assert.Equal(t, "050471", code)
+
+	var counter, ok = Validate(rfcSecret, code, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, Counter(now), counter)
+
+	// previous step is accepted within skew
+	counter, ok = Validate(rfcSecret, code, now.Add(Period*time.Second), 1)
+	assert.True(t, ok)
+	assert.Equal(t, Counter(now), counter)
+
+	_, ok = Validate(rfcSecret, code, now.Add(2*Period*time.Second), 1)
+	assert.False(t, ok)
+
+	_, ok = Validate(rfcSecret, "12345", now, 1)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	var uri = URI("Around You", "login", rfcSecret)
+
+	var parsed, err = url.Parse(uri)
+	assert.Nil(t, err)
+	assert.Equal(t, "otpauth", parsed.Scheme)
+	assert.Equal(t, "totp", parsed.Host)
+	assert.Equal(t, "/Around You:login", parsed.Path)
+	assert.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", parsed.Query().Get("secret"))
+	assert.Equal(t, "Around You", parsed.Query().Get("issuer"))
+}
@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/Sovianum/acquaintance-server/dao"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/mylog"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// a batch is sent concurrently, so it takes about a timeout; the lease
+	// keeps other instances away from it a bit longer
+	leaseTimeouts = 3
+	// only a part of a response body is read to reuse the connection
+	maxResponseBytes = 64 * 1024
+)
+
+// Deliverer sends webhooks queued in the database. Deliveries are claimed with
+// a lease, so that instances may run it at the same time; a delivery claimed
+// by an instance which died is attempted again after the lease expires.
+type Deliverer struct {
+	webhookDAO  dao.WebhookDAO
+	client      *http.Client
+	batchSize   int
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	lease       time.Duration
+	now         func() time.Time
+	logger      *mylog.Logger
+}
+
+func NewDeliverer(conf config.WebhookConfig, webhookDAO dao.WebhookDAO, logger *mylog.Logger) *Deliverer {
+	return &Deliverer{
+		webhookDAO:  webhookDAO,
+		client:      &http.Client{Timeout: conf.GetTimeout()},
+		batchSize:   conf.GetBatchSize(),
+		maxAttempts: conf.GetMaxAttempts(),
+		baseDelay:   conf.GetBaseDelay(),
+		maxDelay:    conf.GetMaxDelay(),
+		lease:       leaseTimeouts * conf.GetTimeout(),
+		now:         time.Now,
+		logger:      logger,
+	}
+}
+
+// Run delivers due webhooks every interval until done is closed. A full batch
+// is followed by the next one at once, so that a backlog is cleared quickly.
+func (deliverer *Deliverer) Run(interval time.Duration, done <-chan struct{}) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			var count, err = deliverer.DeliverDue()
+			if err != nil {
+				deliverer.logger.Errorf("failed to claim webhook deliveries: %s", err.Error())
+			}
+			if err != nil || count < deliverer.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+// DeliverDue sends a batch of due deliveries concurrently and returns its size.
+func (deliverer *Deliverer) DeliverDue() (int, error) {
+	var deliveries, err = deliverer.webhookDAO.ClaimDeliveries(deliverer.batchSize, deliverer.lease)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery *model.WebhookDelivery) {
+			defer wg.Done()
+			deliverer.deliver(delivery)
+		}(delivery)
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+func (deliverer *Deliverer) deliver(delivery *model.WebhookDelivery) {
+	var attempt = delivery.Attempts + 1
+	var sendErr = deliverer.send(delivery)
+
+	var err error
+	switch {
+	case sendErr == nil:
+		err = deliverer.webhookDAO.MarkDelivered(delivery.Id)
+	case attempt >= deliverer.maxAttempts:
+		deliverer.logger.Errorf(
+			"webhook delivery %d to %s is dead after %d attempts: %s",
+			delivery.Id, delivery.URL, attempt, sendErr.Error(),
+		)
+		err = deliverer.webhookDAO.MarkDead(delivery.Id, sendErr.Error())
+	default:
+		err = deliverer.webhookDAO.MarkFailed(delivery.Id, sendErr.Error(), deliverer.backoff(attempt))
+	}
+
+	if err != nil {
+		// the delivery is attempted again after the lease expires
+		deliverer.logger.Errorf("failed to save result of webhook delivery %d: %s", delivery.Id, err.Error())
+	}
+}
+
+func (deliverer *Deliverer) send(delivery *model.WebhookDelivery) error {
+	var req, reqErr = http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if reqErr != nil {
+		return reqErr
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, deliverer.now(), delivery.Payload))
+
+	var resp, err = deliverer.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("responded with %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// backoff returns the delay after a failed attempt: twice longer than the
+// previous one, starting from baseDelay and up to maxDelay.
+func (deliverer *Deliverer) backoff(attempt int) time.Duration {
+	var delay = deliverer.baseDelay
+	for i := 1; i < attempt && delay < deliverer.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > deliverer.maxDelay {
+		delay = deliverer.maxDelay
+	}
+	return delay
+}
@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sovianum/acquaintance-server/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureHeader holds "t=<unix time>,v1=<signature>", where the signature
+	// is hex encoded HMAC-SHA256 of "<unix time>.<body>" with the secret of
+	// the subscription.
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	// DeliveryHeader is the same for all attempts of a delivery.
+	DeliveryHeader = "X-Webhook-Delivery"
+
+	signatureVersion = "v1"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Payload is the body of a webhook. Id is the same for all subscriptions
+// told about the event.
+type Payload struct {
+	Id   string           `json:"id"`
+	Type string           `json:"type"`
+	Time model.QuotedTime `json:"time"`
+	Data interface{}      `json:"data"`
+}
+
+// RequestData describes a meet request in payloads. Profiles are not
+// passed to third parties, users are referred to by ids only.
+type RequestData struct {
+	RequestId   int              `json:"request_id"`
+	RequesterId int              `json:"requester_id"`
+	RequestedId int              `json:"requested_id"`
+	Status      string           `json:"status"`
+	Time        model.QuotedTime `json:"time"`
+}
+
+func NewRequestPayload(eventType string, request *model.MeetRequest, now time.Time) ([]byte, error) {
+	var id = make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(Payload{
+		Id:   hex.EncodeToString(id),
+		Type: eventType,
+		Time: model.QuotedTime(now),
+		Data: RequestData{
+			RequestId:   request.Id,
+			RequesterId: request.RequesterId,
+			RequestedId: request.RequestedId,
+			Status:      request.Status,
+			Time:        request.Time,
+		},
+	})
+}
+
+// RequestEventType returns the type of the event about a request switched to
+// status by a user. Requests declined on expiration are reported with
+// model.WebhookRequestExpired instead.
+func RequestEventType(status string) string {
+	switch status {
+	case model.StatusPending:
+		return model.WebhookRequestCreated
+	case model.StatusAccepted:
+		return model.WebhookRequestAccepted
+	case model.StatusDeclined:
+		return model.WebhookRequestDeclined
+	default:
+		return model.WebhookRequestInterrupted
+	}
+}
+
+// Sign returns the value of SignatureHeader for the body sent at timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	var unix = strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,%s=%s", unix, signatureVersion, hex.EncodeToString(mac(secret, unix, body)))
+}
+
+// Verify checks the value of SignatureHeader the way receivers are expected
+// to. Signatures made more than tolerance ago are rejected, so that a captured
+// request can not be replayed later.
+func Verify(secret string, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var unix, signature string
+	for _, part := range strings.Split(header, ",") {
+		var pair = strings.SplitN(part, "=", 2)
+		if len(pair) != 2 {
+			return ErrInvalidSignature
+		}
+		switch pair[0] {
+		case "t":
+			unix = pair[1]
+		case signatureVersion:
+			signature = pair[1]
+		}
+	}
+
+	var seconds, timeErr = strconv.ParseInt(unix, 10, 64)
+	var decoded, hexErr = hex.DecodeString(signature)
+	if timeErr != nil || hexErr != nil || !hmac.Equal(decoded, mac(secret, unix, body)) {
+		return ErrInvalidSignature
+	}
+
+	var age = now.Sub(time.Unix(seconds, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func mac(secret string, unix string, body []byte) []byte {
+	var hash = hmac.New(sha256.New, []byte(secret))
+	hash.Write([]byte(unix + "."))
+	hash.Write(body)
+	return hash.Sum(nil)
+}
@@ -0,0 +1,216 @@
+package webhook
+
+import (
+	"encoding/json"
+	"github.com/Sovianum/acquaintance-server/config"
+	"github.com/Sovianum/acquaintance-server/model"
+	"github.com/Sovianum/acquaintance-server/mylog"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef"
+
+type failure struct {
+	errMsg  string
+	retryIn time.Duration
+}
+
+type fakeWebhookDAO struct {
+	lock       sync.Mutex
+	deliveries []*model.WebhookDelivery
+	lease      time.Duration
+	delivered  []int64
+	failed     map[int64]failure
+	dead       map[int64]string
+}
+
+func newFakeWebhookDAO(deliveries ...*model.WebhookDelivery) *fakeWebhookDAO {
+	return &fakeWebhookDAO{
+		deliveries: deliveries,
+		delivered:  make([]int64, 0),
+		failed:     make(map[int64]failure),
+		dead:       make(map[int64]string),
+	}
+}
+
+func (dao *fakeWebhookDAO) CreateSubscription(subscription *model.WebhookSubscription) error {
+	return nil
+}
+
+func (dao *fakeWebhookDAO) GetSubscriptions() ([]*model.WebhookSubscription, error) {
+	return nil, nil
+}
+
+func (dao *fakeWebhookDAO) DeleteSubscription(id int) (bool, error) {
+	return false, nil
+}
+
+func (dao *fakeWebhookDAO) Enqueue(eventType string, payload []byte) error {
+	return nil
+}
+
+func (dao *fakeWebhookDAO) ClaimDeliveries(limit int, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+
+	dao.lease = lease
+	if limit > len(dao.deliveries) {
+		limit = len(dao.deliveries)
+	}
+	var result = dao.deliveries[:limit]
+	dao.deliveries = dao.deliveries[limit:]
+	return result, nil
+}
+
+func (dao *fakeWebhookDAO) MarkDelivered(id int64) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	dao.delivered = append(dao.delivered, id)
+	return nil
+}
+
+func (dao *fakeWebhookDAO) MarkFailed(id int64, errMsg string, retryIn time.Duration) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	dao.failed[id] = failure{errMsg: errMsg, retryIn: retryIn}
+	return nil
+}
+
+func (dao *fakeWebhookDAO) MarkDead(id int64, errMsg string) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	dao.dead[id] = errMsg
+	return nil
+}
+
+func (dao *fakeWebhookDAO) GetDeliveries(status string, limit int, offset int) ([]*model.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (dao *fakeWebhookDAO) GetUserDeliveries(userId int) ([]*model.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (dao *fakeWebhookDAO) Replay(id int64) (bool, error) {
+	return false, nil
+}
+
+func (dao *fakeWebhookDAO) DeleteOldDeliveries(retentionDays int) error {
+	return nil
+}
+
+func getConf() config.WebhookConfig {
+	return config.WebhookConfig{
+		BatchSize:        2,
+		TimeoutSeconds:   1,
+		MaxAttempts:      3,
+		BaseDelaySeconds: 30,
+		MaxDelayMinutes:  1,
+	}
+}
+
+func TestSign_Verify(t *testing.T) {
+	var now = time.Unix(1500000000, 0)
+	var body = []byte("{\"id\": \"1\"}")
+	var signature = Sign(testSecret, now, body)
+
+	assert.Nil(t, Verify(testSecret, signature, body, time.Minute, now.Add(30*time.Second)))
+	assert.Equal(t, ErrInvalidSignature, Verify("another secret..", signature, body, time.Minute, now))
+	assert.Equal(t, ErrInvalidSignature, Verify(testSecret, signature, []byte("{}"), time.Minute, now))
+	assert.Equal(t, ErrInvalidSignature, Verify(testSecret, signature, body, time.Minute, now.Add(2*time.Minute)))
+	assert.Equal(t, ErrInvalidSignature, Verify(testSecret, "v1=00", body, time.Minute, now))
+}
+
+func TestNewRequestPayload(t *testing.T) {
+	var request = &model.MeetRequest{
+		Id:             1,
+		RequesterId:    2,
+		RequestedId:    3,
+		RequesterLogin: "requester",
+		Status:         model.StatusDeclined,
+	}
+	var data, err = NewRequestPayload(model.WebhookRequestExpired, request, time.Now())
+	assert.Nil(t, err)
+
+	var payload = make(map[string]interface{})
+	assert.Nil(t, json.Unmarshal(data, &payload))
+	assert.Equal(t, 32, len(payload["id"].(string)))
+	assert.Equal(t, model.WebhookRequestExpired, payload["type"])
+	assert.Equal(t, map[string]interface{}{
+		"request_id":   1.0,
+		"requester_id": 2.0,
+		"requested_id": 3.0,
+		"status":       model.StatusDeclined,
+		"time":         payload["data"].(map[string]interface{})["time"],
+	}, payload["data"])
+}
+
+func TestRequestEventType(t *testing.T) {
+	assert.Equal(t, model.WebhookRequestCreated, RequestEventType(model.StatusPending))
+	assert.Equal(t, model.WebhookRequestAccepted, RequestEventType(model.StatusAccepted))
+	assert.Equal(t, model.WebhookRequestDeclined, RequestEventType(model.StatusDeclined))
+	assert.Equal(t, model.WebhookRequestInterrupted, RequestEventType(model.StatusInterrupted))
+}
+
+func TestDeliverer_DeliverDue(t *testing.T) {
+	var body = []byte("{\"type\": \"request.created\"}")
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var received, _ = ioutil.ReadAll(r.Body)
+		var err = Verify(testSecret, r.Header.Get(SignatureHeader), received, time.Minute, time.Now())
+		if err != nil || r.Header.Get(EventHeader) != model.WebhookRequestCreated || r.Header.Get(DeliveryHeader) != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	var webhookDAO = newFakeWebhookDAO(
+		&model.WebhookDelivery{Id: 1, URL: server.URL, Secret: testSecret, EventType: model.WebhookRequestCreated, Payload: body},
+		&model.WebhookDelivery{Id: 2, URL: server.URL, Secret: "wrong secret....", EventType: model.WebhookRequestCreated, Payload: body, Attempts: 1},
+		&model.WebhookDelivery{Id: 3, URL: server.URL, Secret: "wrong secret....", EventType: model.WebhookRequestCreated, Payload: body, Attempts: 2},
+	)
+	var deliverer = NewDeliverer(getConf(), webhookDAO, mylog.NewLogger(ioutil.Discard))
+
+	var count, err = deliverer.DeliverDue()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 3*time.Second, webhookDAO.lease)
+
+	count, err = deliverer.DeliverDue()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	assert.Equal(t, []int64{1}, webhookDAO.delivered)
+	assert.Equal(t, map[int64]failure{2: {errMsg: "responded with 400", retryIn: time.Minute}}, webhookDAO.failed)
+	assert.Equal(t, map[int64]string{3: "responded with 400"}, webhookDAO.dead)
+}
+
+func TestDeliverer_DeliverDue_Unreachable(t *testing.T) {
+	var server = httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	var webhookDAO = newFakeWebhookDAO(&model.WebhookDelivery{Id: 1, URL: server.URL, Secret: testSecret})
+	var deliverer = NewDeliverer(getConf(), webhookDAO, mylog.NewLogger(ioutil.Discard))
+
+	var _, err = deliverer.DeliverDue()
+	assert.Nil(t, err)
+	if assert.Contains(t, webhookDAO.failed, int64(1)) {
+		assert.Equal(t, 30*time.Second, webhookDAO.failed[1].retryIn)
+	}
+}
+
+func TestDeliverer_Backoff(t *testing.T) {
+	var deliverer = NewDeliverer(
+		config.WebhookConfig{BaseDelaySeconds: 30, MaxDelayMinutes: 3}, nil, nil,
+	)
+	assert.Equal(t, 30*time.Second, deliverer.backoff(1))
+	assert.Equal(t, time.Minute, deliverer.backoff(2))
+	assert.Equal(t, 2*time.Minute, deliverer.backoff(3))
+	assert.Equal(t, 3*time.Minute, deliverer.backoff(4))
+	assert.Equal(t, 3*time.Minute, deliverer.backoff(40))
+}